@@ -0,0 +1,68 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tidb
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+const benchPath = "/tmp/test-tidb-bench"
+
+// BenchmarkParallelInsert inserts rows by many sessions concurrently into a store
+// which syncs every write, the concurrent commits are merged into group commits.
+func BenchmarkParallelInsert(b *testing.B) {
+	os.RemoveAll(benchPath)
+	defer os.RemoveAll(benchPath)
+	store, err := NewStore(EngineGoLevelDBPersistent + benchPath + "?sync=true")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.Close()
+
+	se, err := CreateSession(store)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, sql := range []string{"create database bench", "use bench", "create table t (id int primary key, c int)"} {
+		if _, err = se.Execute(sql); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var id int64
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		se, err := CreateSession(store)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer se.Close()
+		if _, err = se.Execute("use bench"); err != nil {
+			b.Fatal(err)
+		}
+		stmtID, _, _, err := se.PrepareStmt("insert t values (?, ?)")
+		if err != nil {
+			b.Fatal(err)
+		}
+		for pb.Next() {
+			n := atomic.AddInt64(&id, 1)
+			if _, err = se.ExecutePreparedStmt(stmtID, n, n); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
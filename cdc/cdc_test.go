@@ -0,0 +1,162 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/sessionctx"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testCDCSuite{})
+
+type testCDCSuite struct {
+	store kv.Storage
+	se    tidb.Session
+	d     *Decoder
+}
+
+func (s *testCDCSuite) SetUpSuite(c *C) {
+	var err error
+	s.store, err = tidb.NewStore("memory://cdc")
+	c.Assert(err, IsNil)
+	s.se, err = tidb.CreateSession(s.store)
+	c.Assert(err, IsNil)
+	s.mustExec(c, "create database cdc")
+	s.mustExec(c, "use cdc")
+	s.mustExec(c, "create table t (id int primary key, name varchar(20))")
+
+	s.d = NewDecoder(sessionctx.GetDomain(s.se.(context.Context)).InfoSchema)
+}
+
+func (s *testCDCSuite) TearDownSuite(c *C) {
+	s.se.Close()
+	s.store.Close()
+}
+
+func (s *testCDCSuite) mustExec(c *C, sql string) {
+	_, err := s.se.Execute(sql)
+	c.Assert(err, IsNil)
+}
+
+func (s *testCDCSuite) TestDecode(c *C) {
+	sub := s.store.(kv.CommitNotifier).Subscribe()
+	defer sub.Close()
+	ch := make(ChanSink, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(sub, s.d, ch)
+	}()
+
+	s.mustExec(c, "insert into t values (1, 'a'), (2, 'b')")
+	s.mustExec(c, "update t set name = 'c' where id = 2")
+	s.mustExec(c, "delete from t where id = 1")
+
+	e := <-ch
+	c.Assert(e.Type, Equals, Insert)
+	c.Assert(e.Schema, Equals, "cdc")
+	c.Assert(e.Table, Equals, "t")
+	c.Assert(e.Columns, DeepEquals, []string{"id", "name"})
+	c.Assert(e.OldRow, IsNil)
+	c.Assert(e.NewRow, DeepEquals, []interface{}{int64(1), "a"})
+	insertVer := e.CommitVersion
+	e = <-ch
+	c.Assert(e.Type, Equals, Insert)
+	c.Assert(e.NewRow, DeepEquals, []interface{}{int64(2), "b"})
+	c.Assert(e.CommitVersion, Equals, insertVer)
+
+	e = <-ch
+	c.Assert(e.Type, Equals, Update)
+	c.Assert(e.OldRow, DeepEquals, []interface{}{int64(2), "b"})
+	c.Assert(e.NewRow, DeepEquals, []interface{}{int64(2), "c"})
+	c.Assert(e.Present, DeepEquals, []bool{true, true})
+	c.Assert(e.CommitVersion.Cmp(insertVer), Greater, 0)
+
+	e = <-ch
+	c.Assert(e.Type, Equals, Delete)
+	c.Assert(e.OldRow, DeepEquals, []interface{}{int64(1), "a"})
+	c.Assert(e.NewRow, IsNil)
+	c.Assert(e.Present, DeepEquals, []bool{true, true})
+
+
+	sub.Close()
+	c.Assert(<-done, IsNil)
+}
+
+func (s *testCDCSuite) TestPartialUpdate(c *C) {
+	s.mustExec(c, "create table t2 (id int primary key, name varchar(20)) row_format=redundant")
+	s.mustExec(c, "insert into t2 values (1, 'a')")
+	sub := s.store.(kv.CommitNotifier).Subscribe()
+	defer sub.Close()
+
+	// Only the written column is present.
+	t, err := sessionctx.GetDomain(s.se.(context.Context)).InfoSchema().TableByName(model.NewCIStr("cdc"), model.NewCIStr("t2"))
+	c.Assert(err, IsNil)
+	err = kv.RunInNewTxn(s.store, false, func(txn kv.Transaction) error {
+		v, err1 := t.EncodeValue("b")
+		if err1 != nil {
+			return err1
+		}
+		return txn.Set(t.RecordKey(1, t.Cols()[1]), v)
+	})
+	c.Assert(err, IsNil)
+	events, err := s.d.Decode(<-sub.Events())
+	c.Assert(err, IsNil)
+	c.Assert(events, HasLen, 1)
+	e := events[0]
+	c.Assert(e.Type, Equals, Update)
+	c.Assert(e.OldRow, DeepEquals, []interface{}{nil, "a"})
+	c.Assert(e.NewRow, DeepEquals, []interface{}{nil, "b"})
+	c.Assert(e.Present, DeepEquals, []bool{false, true})
+}
+
+func (s *testCDCSuite) TestFileSink(c *C) {
+	var buf bytes.Buffer
+	sink := NewFileSink(&buf)
+	err := sink.Write(&RowEvent{
+		Type:          Update,
+		Schema:        "cdc",
+		Table:         "t",
+		Handle:        1,
+		CommitVersion: kv.NewVersion(10),
+		Columns:       []string{"id", "name"},
+		OldRow:        []interface{}{nil, []byte("a")},
+		NewRow:        []interface{}{nil, []byte("b")},
+		Present:       []bool{false, true},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(buf.String(), "\n"), Equals, 1)
+
+	var e jsonEvent
+	err = json.Unmarshal(buf.Bytes(), &e)
+	c.Assert(err, IsNil)
+	c.Assert(e.Type, Equals, "update")
+	c.Assert(e.Version, Equals, uint64(10))
+	c.Assert(e.Old["name"], Equals, "a")
+	c.Assert(e.New["name"], Equals, "b")
+	_, ok := e.Old["id"]
+	c.Assert(ok, IsFalse)
+}
@@ -0,0 +1,285 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cdc turns the transactions emitted by a kv.CommitNotifier into the
+// row changes of the tables.
+package cdc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/infoschema"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/table/tables"
+)
+
+// EventType is the type of a row change.
+type EventType int
+
+// Row change types.
+const (
+	Insert EventType = iota + 1
+	Update
+	Delete
+)
+
+// String implements fmt.Stringer interface.
+func (t EventType) String() string {
+	switch t {
+	case Insert:
+		return "insert"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// RowEvent is a row change of a committed transaction.
+type RowEvent struct {
+	Type          EventType
+	Schema        string
+	Table         string
+	Handle        int64
+	CommitVersion kv.Version
+	// Columns are the names of the columns of the table, OldRow, NewRow and
+	// Present are aligned with them. OldRow is nil for Insert, NewRow is nil for Delete.
+	Columns []string
+	OldRow  []interface{}
+	NewRow  []interface{}
+	// Present marks the columns whose values are in OldRow and NewRow, the values
+	// of the others are unknown and left nil. A row not in the compact format
+	// stores a key per column, an Update of it only has the columns written by
+	// the transaction. The VIRTUAL generated columns are never present.
+	Present []bool
+}
+
+// Decoder decodes the record keys in CommitEvents to RowEvents.
+type Decoder struct {
+	schema func() infoschema.InfoSchema
+}
+
+// NewDecoder creates a Decoder which finds the tables in the latest schema returned by schema.
+func NewDecoder(schema func() infoschema.InfoSchema) *Decoder {
+	return &Decoder{schema: schema}
+}
+
+// recordKey is a decoded record key, columnID is 0 for the row key.
+type recordKey struct {
+	tableID  int64
+	handle   int64
+	columnID int64
+}
+
+// decodeRecordKey decodes the key encoded by util.EncodeRecordKey, it returns false
+// if the key is not a record key.
+func decodeRecordKey(key []byte) (recordKey, bool) {
+	vals, err := kv.DecodeValue(key)
+	if err != nil || len(vals) < 2 || len(vals) > 3 {
+		return recordKey{}, false
+	}
+
+	var prefix string
+	switch v := vals[0].(type) {
+	case []byte:
+		prefix = string(v)
+	case string:
+		prefix = v
+	default:
+		return recordKey{}, false
+	}
+	if !strings.HasSuffix(prefix, "_r") {
+		return recordKey{}, false
+	}
+	tableID, err := strconv.ParseInt(strings.TrimSuffix(prefix, "_r"), 10, 64)
+	if err != nil {
+		return recordKey{}, false
+	}
+
+	rk := recordKey{tableID: tableID}
+	var ok bool
+	if rk.handle, ok = vals[1].(int64); !ok {
+		return recordKey{}, false
+	}
+	if len(vals) == 3 {
+		if rk.columnID, ok = vals[2].(int64); !ok {
+			return recordKey{}, false
+		}
+	}
+	return rk, true
+}
+
+type rowID struct {
+	tableID int64
+	handle  int64
+}
+
+// rowMutations are the mutations of a row in a transaction.
+type rowMutations struct {
+	row     *kv.Mutation
+	columns map[int64]*kv.Mutation
+}
+
+// Decode returns the RowEvents of ev ordered by table ID and handle, the
+// mutations which are not of the records or of unknown tables are skipped.
+func (d *Decoder) Decode(ev *kv.CommitEvent) ([]*RowEvent, error) {
+	rows := make(map[rowID]*rowMutations)
+	var ids []rowID
+	for i := range ev.Mutations {
+		m := &ev.Mutations[i]
+		rk, ok := decodeRecordKey(m.Key)
+		if !ok {
+			continue
+		}
+		id := rowID{tableID: rk.tableID, handle: rk.handle}
+		rm, ok := rows[id]
+		if !ok {
+			rm = &rowMutations{columns: make(map[int64]*kv.Mutation)}
+			rows[id] = rm
+			ids = append(ids, id)
+		}
+		if rk.columnID == 0 {
+			rm.row = m
+		} else {
+			rm.columns[rk.columnID] = m
+		}
+	}
+	sort.Sort(rowIDs(ids))
+
+	is := d.schema()
+	schemas := make(map[int64]string)
+	for _, db := range is.AllSchemas() {
+		for _, t := range db.Tables {
+			schemas[t.ID] = db.Name.O
+		}
+	}
+
+	var events []*RowEvent
+	for _, id := range ids {
+		t, ok := is.TableByID(id.tableID)
+		if !ok {
+			continue
+		}
+		e, err := newRowEvent(t, rows[id])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		e.Schema = schemas[id.tableID]
+		e.Handle = id.handle
+		e.CommitVersion = ev.CommitVersion
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func newRowEvent(t table.Table, rm *rowMutations) (*RowEvent, error) {
+	e := &RowEvent{Type: Update, Table: t.TableName().O}
+	if rm.row != nil {
+		if rm.row.OldValue == nil {
+			e.Type = Insert
+		} else if rm.row.NewValue == nil {
+			e.Type = Delete
+		}
+	}
+
+	cols := t.Cols()
+	e.Present = make([]bool, len(cols))
+	if e.Type != Insert {
+		e.OldRow = make([]interface{}, len(cols))
+	}
+	if e.Type != Delete {
+		e.NewRow = make([]interface{}, len(cols))
+	}
+	// A compact row has all the columns in the row key, the columns of a row
+	// converted from or to the compact format are in the column keys.
+	var (
+		err     error
+		compact bool
+	)
+	if rm.row != nil && e.OldRow != nil && tables.IsCompactRow(rm.row.OldValue) {
+		if e.OldRow, err = decodeRow(t, rm.row.OldValue); err != nil {
+			return nil, errors.Trace(err)
+		}
+		compact = true
+	}
+	if rm.row != nil && e.NewRow != nil && tables.IsCompactRow(rm.row.NewValue) {
+		if e.NewRow, err = decodeRow(t, rm.row.NewValue); err != nil {
+			return nil, errors.Trace(err)
+		}
+		compact = true
+	}
+	for i, c := range cols {
+		e.Columns = append(e.Columns, c.Name.O)
+		if c.IsGenerated() && !c.GeneratedStored {
+			continue
+		}
+		m, ok := rm.columns[c.ID]
+		// Insert and Delete write all the stored columns, a compact image has all of them too.
+		e.Present[i] = ok || compact || e.Type != Update
+		if !ok {
+			continue
+		}
+		if e.OldRow != nil && m.OldValue != nil {
+			v, err := decodeValue(t, c, m.OldValue)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			e.OldRow[i] = v
+		}
+		if e.NewRow != nil && m.NewValue != nil {
+			v, err := decodeValue(t, c, m.NewValue)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			e.NewRow[i] = v
+		}
+	}
+	return e, nil
+}
+
+// rowDecoder is implemented by the tables which can store a row in one key.
+type rowDecoder interface {
+	DecodeRow(data []byte, cols []*column.Col) ([]interface{}, error)
+}
+
+func decodeRow(t table.Table, data []byte) ([]interface{}, error) {
+	d, ok := t.(rowDecoder)
+	if !ok {
+		return nil, errors.Errorf("table %s can't decode compact rows", t.TableName())
+	}
+	return d.DecodeRow(data, t.Cols())
+}
+
+func decodeValue(t table.Table, c *column.Col, data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return t.DecodeValue(data, c)
+}
+
+type rowIDs []rowID
+
+func (s rowIDs) Len() int      { return len(s) }
+func (s rowIDs) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s rowIDs) Less(i, j int) bool {
+	if s[i].tableID != s[j].tableID {
+		return s[i].tableID < s[j].tableID
+	}
+	return s[i].handle < s[j].handle
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/kv"
+)
+
+// Sink receives the RowEvents.
+type Sink interface {
+	Write(e *RowEvent) error
+}
+
+// ChanSink sends the RowEvents to a channel.
+type ChanSink chan *RowEvent
+
+// Write implements Sink Write interface.
+func (s ChanSink) Write(e *RowEvent) error {
+	s <- e
+	return nil
+}
+
+// jsonEvent is the JSON form of a RowEvent written by FileSink.
+type jsonEvent struct {
+	Type    string                 `json:"type"`
+	Schema  string                 `json:"schema"`
+	Table   string                 `json:"table"`
+	Handle  int64                  `json:"handle"`
+	Version uint64                 `json:"version"`
+	Old     map[string]interface{} `json:"old,omitempty"`
+	New     map[string]interface{} `json:"new,omitempty"`
+}
+
+// FileSink writes the RowEvents to a writer as JSON lines.
+type FileSink struct {
+	enc *json.Encoder
+}
+
+// NewFileSink creates a FileSink writing to w.
+func NewFileSink(w io.Writer) *FileSink {
+	return &FileSink{enc: json.NewEncoder(w)}
+}
+
+// jsonRow returns the present columns of row, see RowEvent.Present.
+func jsonRow(cols []string, row []interface{}, present []bool) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	m := make(map[string]interface{}, len(cols))
+	for i, c := range cols {
+		if present != nil && !present[i] {
+			continue
+		}
+		switch v := row[i].(type) {
+		case []byte:
+			m[c] = string(v)
+		case fmt.Stringer:
+			m[c] = v.String()
+		default:
+			m[c] = v
+		}
+	}
+	return m
+}
+
+// Write implements Sink Write interface.
+func (s *FileSink) Write(e *RowEvent) error {
+	err := s.enc.Encode(&jsonEvent{
+		Type:    e.Type.String(),
+		Schema:  e.Schema,
+		Table:   e.Table,
+		Handle:  e.Handle,
+		Version: e.CommitVersion.Ver,
+		Old:     jsonRow(e.Columns, e.OldRow, e.Present),
+		New:     jsonRow(e.Columns, e.NewRow, e.Present),
+	})
+	return errors.Trace(err)
+}
+
+// Pipe decodes the events received from sub and writes them to sink,
+// it returns after sub is stopped or an error occurs.
+func Pipe(sub kv.Subscription, d *Decoder, sink Sink) error {
+	for ev := range sub.Events() {
+		events, err := d.Decode(ev)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, e := range events {
+			if err = sink.Write(e); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return errors.Trace(sub.Err())
+}
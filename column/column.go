@@ -196,6 +196,12 @@ func NewColDesc(col *Col) *ColDesc {
 		extra = "auto_increment"
 	} else if mysql.HasOnUpdateNowFlag(col.Flag) {
 		extra = "on update CURRENT_TIMESTAMP"
+	} else if col.IsGenerated() {
+		if col.GeneratedStored {
+			extra = "STORED GENERATED"
+		} else {
+			extra = "VIRTUAL GENERATED"
+		}
 	}
 
 	return &ColDesc{
@@ -244,8 +250,12 @@ func (c *Col) CheckNotNull(data interface{}) error {
 }
 
 // CheckNotNull checks if row has nil value set to a column with NotNull flag set.
+// The generated columns are skipped, their values are computed by the table.
 func CheckNotNull(cols []*Col, row []interface{}) error {
 	for _, c := range cols {
+		if c.IsGenerated() {
+			continue
+		}
 		if err := c.CheckNotNull(row[c.Offset]); err != nil {
 			return err
 		}
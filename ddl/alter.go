@@ -15,6 +15,7 @@ package ddl
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/pingcap/tidb/parser/coldef"
 )
@@ -28,6 +29,9 @@ const (
 	AlterDropPrimaryKey
 	AlterDropIndex
 	AlterDropForeignKey
+	AlterAddPartition
+	AlterDropPartition
+	AlterTruncatePartition
 
 // TODO: Add more actions
 )
@@ -67,6 +71,10 @@ type AlterSpecification struct {
 	TableOpts  []*coldef.TableOpt
 	Column     *coldef.ColumnDef
 	Position   *ColumnPosition
+	// Partitions are the RANGE partitions to add.
+	Partitions []*coldef.PartitionDefinition
+	// PartitionNames are the partitions to drop or truncate.
+	PartitionNames []string
 }
 
 // String implements fmt.Stringer
@@ -94,6 +102,16 @@ func (as *AlterSpecification) String() string {
 			return fmt.Sprintf("ADD Column %s %s", as.Column.String(), ps)
 		}
 		return fmt.Sprintf("ADD Column %s", as.Column.String())
+	case AlterAddPartition:
+		defs := make([]string, 0, len(as.Partitions))
+		for _, pd := range as.Partitions {
+			defs = append(defs, pd.String())
+		}
+		return fmt.Sprintf("ADD PARTITION (%s)", strings.Join(defs, ", "))
+	case AlterDropPartition:
+		return fmt.Sprintf("DROP PARTITION %s", strings.Join(as.PartitionNames, ", "))
+	case AlterTruncatePartition:
+		return fmt.Sprintf("TRUNCATE PARTITION %s", strings.Join(as.PartitionNames, ", "))
 	default:
 		return ""
 	}
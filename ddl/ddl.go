@@ -32,6 +32,7 @@ import (
 	"github.com/pingcap/tidb/model"
 	mysql "github.com/pingcap/tidb/mysqldef"
 	"github.com/pingcap/tidb/parser/coldef"
+	"github.com/pingcap/tidb/sessionctx/temptable"
 	"github.com/pingcap/tidb/table"
 	"github.com/pingcap/tidb/table/tables"
 	"github.com/pingcap/tidb/util"
@@ -52,8 +53,14 @@ var (
 type DDL interface {
 	CreateSchema(ctx context.Context, name model.CIStr) error
 	DropSchema(ctx context.Context, schema model.CIStr) error
-	CreateTable(ctx context.Context, ident table.Ident, cols []*coldef.ColumnDef, constrs []*coldef.TableConstraint) error
+	// CreateTable creates a table with the options opt, it is partitioned if partition is not nil.
+	CreateTable(ctx context.Context, ident table.Ident, cols []*coldef.ColumnDef, constrs []*coldef.TableConstraint, opt *coldef.TableOption, partition *coldef.PartitionOption) error
+	// CreateTemporaryTable creates a temporary table of the session ctx with the options opt.
+	CreateTemporaryTable(ctx context.Context, ident table.Ident, cols []*coldef.ColumnDef, constrs []*coldef.TableConstraint, opt *coldef.TableOption) error
+	// DropTable drops a table, the temporary table of the session ctx is dropped if there is one.
 	DropTable(ctx context.Context, tableIdent table.Ident) (err error)
+	// DropTemporaryTable drops a temporary table of the session ctx.
+	DropTemporaryTable(ctx context.Context, tableIdent table.Ident) error
 	CreateIndex(ctx context.Context, tableIdent table.Ident, unique bool, indexName model.CIStr, columnNames []*coldef.IndexColName) error
 	DropIndex(ctx context.Context, schema, tableName, indexName model.CIStr) error
 	GetInformationSchema() infoschema.InfoSchema
@@ -78,12 +85,25 @@ func (d *ddl) GetInformationSchema() infoschema.InfoSchema {
 	return d.infoHandle.Get()
 }
 
+// checkWritable returns kv.ErrReadOnly if the store is read-only, the DDL
+// must be refused before the InfoSchema is changed. Creating an existing
+// schema or table fails with ErrExists first, so IF NOT EXISTS works.
+func (d *ddl) checkWritable() error {
+	if kv.IsReadOnly(d.store) {
+		return errors.Trace(kv.ErrReadOnly)
+	}
+	return nil
+}
+
 func (d *ddl) CreateSchema(ctx context.Context, schema model.CIStr) (err error) {
 	is := d.GetInformationSchema()
 	_, ok := is.SchemaByName(schema)
 	if ok {
 		return ErrExists
 	}
+	if err = d.checkWritable(); err != nil {
+		return errors.Trace(err)
+	}
 	info := &model.DBInfo{Name: schema}
 	info.ID, err = meta.GenGlobalID(d.store)
 	if err != nil {
@@ -99,6 +119,9 @@ func (d *ddl) CreateSchema(ctx context.Context, schema model.CIStr) (err error)
 }
 
 func (d *ddl) DropSchema(ctx context.Context, schema model.CIStr) (err error) {
+	if err = d.checkWritable(); err != nil {
+		return errors.Trace(err)
+	}
 	is := d.GetInformationSchema()
 	old, ok := is.SchemaByName(schema)
 	if !ok {
@@ -122,18 +145,9 @@ func (d *ddl) DropSchema(ctx context.Context, schema model.CIStr) (err error) {
 	}
 	tables := is.SchemaTables(schema)
 	for _, t := range tables {
-		err = t.Truncate(ctx)
-		if err != nil {
+		if err = dropTableData(txn, t); err != nil {
 			return errors.Trace(err)
 		}
-		// remove indices
-		for _, v := range t.Indices() {
-			if v != nil && v.X != nil {
-				if err = v.X.Drop(txn); err != nil {
-					return errors.Trace(err)
-				}
-			}
-		}
 	}
 
 	// Delete meta key
@@ -206,11 +220,15 @@ func setColumnFlagWithConstraint(colMap map[string]*column.Col, v *coldef.TableC
 	}
 }
 
-func (d *ddl) buildColumnsAndConstraints(colDefs []*coldef.ColumnDef, constraints []*coldef.TableConstraint) ([]*column.Col, []*coldef.TableConstraint, error) {
+// buildColumnsAndConstraints builds the columns whose IDs are generated in store.
+func (d *ddl) buildColumnsAndConstraints(store kv.Storage, colDefs []*coldef.ColumnDef, constraints []*coldef.TableConstraint) ([]*column.Col, []*coldef.TableConstraint, error) {
+	if err := checkGeneratedColumns(colDefs); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
 	var cols []*column.Col
 	colMap := map[string]*column.Col{}
 	for i, colDef := range colDefs {
-		col, cts, err := d.buildColumnAndConstraint(i, colDef)
+		col, cts, err := d.buildColumnAndConstraint(store, i, colDef)
 		if err != nil {
 			return nil, nil, errors.Trace(err)
 		}
@@ -225,7 +243,7 @@ func (d *ddl) buildColumnsAndConstraints(colDefs []*coldef.ColumnDef, constraint
 	return cols, constraints, nil
 }
 
-func (d *ddl) buildColumnAndConstraint(offset int, colDef *coldef.ColumnDef) (*column.Col, []*coldef.TableConstraint, error) {
+func (d *ddl) buildColumnAndConstraint(store kv.Storage, offset int, colDef *coldef.ColumnDef) (*column.Col, []*coldef.TableConstraint, error) {
 	// set charset
 	if len(colDef.Tp.Charset) == 0 {
 		switch colDef.Tp.Tp {
@@ -241,7 +259,7 @@ func (d *ddl) buildColumnAndConstraint(offset int, colDef *coldef.ColumnDef) (*c
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
-	col.ID, err = meta.GenGlobalID(d.store)
+	col.ID, err = meta.GenGlobalID(store)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
@@ -292,11 +310,18 @@ func checkConstraintNames(constraints []*coldef.TableConstraint) error {
 	return nil
 }
 
-func (d *ddl) buildTableInfo(tableName model.CIStr, cols []*column.Col, constraints []*coldef.TableConstraint) (tbInfo *model.TableInfo, err error) {
+// buildTableInfo builds the TableInfo whose ID is generated in store.
+func (d *ddl) buildTableInfo(store kv.Storage, tableName model.CIStr, cols []*column.Col, constraints []*coldef.TableConstraint, opt *coldef.TableOption) (tbInfo *model.TableInfo, err error) {
 	tbInfo = &model.TableInfo{
-		Name: tableName,
+		Name:      tableName,
+		RowFormat: model.RowFormatCompact,
 	}
-	tbInfo.ID, err = meta.GenGlobalID(d.store)
+	if opt != nil && opt.RowFormat != "" {
+		if tbInfo.RowFormat, err = parseRowFormat(opt.RowFormat); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	tbInfo.ID, err = meta.GenGlobalID(store)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -312,12 +337,23 @@ func (d *ddl) buildTableInfo(tableName model.CIStr, cols []*column.Col, constrai
 			if col == nil {
 				return nil, errors.Errorf("No such column: %v", key)
 			}
+			if err = checkIndexColumn(col); err != nil {
+				return nil, errors.Trace(err)
+			}
 			indexColumns = append(indexColumns, &model.IndexColumn{
 				Name:   model.NewCIStr(key.ColumnName),
 				Offset: col.Offset,
 				Length: key.Length,
 			})
 		}
+		if constr.Tp == coldef.ConstrPrimaryKey && len(constr.Keys) == 1 {
+			col := column.FindCol(cols, constr.Keys[0].ColumnName)
+			if canBeHandle(col) {
+				// The row handles are the values of the primary key, no index is needed.
+				tbInfo.PKIsHandle = true
+				continue
+			}
+		}
 		idxInfo := &model.IndexInfo{
 			Name:    model.NewCIStr(constr.ConstrName),
 			Columns: indexColumns,
@@ -335,7 +371,18 @@ func (d *ddl) buildTableInfo(tableName model.CIStr, cols []*column.Col, constrai
 	return
 }
 
-func (d *ddl) CreateTable(ctx context.Context, ident table.Ident, colDefs []*coldef.ColumnDef, constraints []*coldef.TableConstraint) (err error) {
+// canBeHandle returns true if the values of col fit in the int64 row handles.
+func canBeHandle(col *column.Col) bool {
+	switch col.Tp {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong:
+		return true
+	case mysql.TypeLonglong:
+		return !mysql.HasUnsignedFlag(col.Flag)
+	}
+	return false
+}
+
+func (d *ddl) CreateTable(ctx context.Context, ident table.Ident, colDefs []*coldef.ColumnDef, constraints []*coldef.TableConstraint, opt *coldef.TableOption, partition *coldef.PartitionOption) (err error) {
 	is := d.GetInformationSchema()
 	if !is.SchemaExists(ident.Schema) {
 		return errors.Trace(qerror.ErrDatabaseNotExist)
@@ -343,11 +390,14 @@ func (d *ddl) CreateTable(ctx context.Context, ident table.Ident, colDefs []*col
 	if is.TableExists(ident.Schema, ident.Name) {
 		return errors.Trace(ErrExists)
 	}
+	if err = d.checkWritable(); err != nil {
+		return errors.Trace(err)
+	}
 	if err = checkDuplicateColumn(colDefs); err != nil {
 		return errors.Trace(err)
 	}
 
-	cols, newConstraints, err := d.buildColumnsAndConstraints(colDefs, constraints)
+	cols, newConstraints, err := d.buildColumnsAndConstraints(d.store, colDefs, constraints)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -357,10 +407,16 @@ func (d *ddl) CreateTable(ctx context.Context, ident table.Ident, colDefs []*col
 		return errors.Trace(err)
 	}
 
-	tbInfo, err := d.buildTableInfo(ident.Name, cols, newConstraints)
+	tbInfo, err := d.buildTableInfo(d.store, ident.Name, cols, newConstraints, opt)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if partition != nil {
+		tbInfo.Partition, err = d.buildPartitionInfo(ctx, tbInfo, partition)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
 	log.Infof("New table: %+v", tbInfo)
 	err = d.updateInfoSchema(ctx, ident.Schema, tbInfo)
 	return errors.Trace(err)
@@ -372,16 +428,46 @@ func (d *ddl) AlterTable(ctx context.Context, ident table.Ident, specs []*AlterS
 	if !is.SchemaExists(ident.Schema) {
 		return errors.Trace(qerror.ErrDatabaseNotExist)
 	}
-	tbl, err := is.TableByName(ident.Schema, ident.Name)
+	tbl, err := d.tableByName(ctx, ident.Schema, ident.Name)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	temporary := isTemporary(tbl)
+	if !temporary {
+		if err = d.checkWritable(); err != nil {
+			return errors.Trace(err)
+		}
+	}
 	for _, spec := range specs {
+		// Only the indices of the temporary tables can be dropped.
+		if temporary && spec.Action != AlterDropIndex {
+			return errors.Errorf("ALTER TABLE: %s is not supported for temporary table %s", spec, ident)
+		}
 		switch spec.Action {
 		case AlterAddColumn:
 			if err := d.addColumn(ctx, ident.Schema, tbl, spec); err != nil {
 				return errors.Trace(err)
 			}
+		case AlterDropIndex:
+			if err := d.DropIndex(ctx, ident.Schema, ident.Name, model.NewCIStr(spec.Name)); err != nil {
+				return errors.Trace(err)
+			}
+		case AlterTableOpt:
+			if err := d.alterTableOpts(ctx, ident.Schema, tbl, spec.TableOpts); err != nil {
+				return errors.Trace(err)
+			}
+		case AlterAddPartition:
+			if err := d.addPartitions(ctx, ident.Schema, tbl, spec.Partitions); err != nil {
+				return errors.Trace(err)
+			}
+		case AlterDropPartition:
+			if err := d.dropPartitions(ctx, ident.Schema, tbl, spec.PartitionNames); err != nil {
+				return errors.Trace(err)
+			}
+		case AlterTruncatePartition:
+			if err := truncatePartitions(ctx, tbl, spec.PartitionNames); err != nil {
+				return errors.Trace(err)
+			}
 		default:
 			// TODO: process more actions
 			continue
@@ -412,8 +498,12 @@ func (d *ddl) addColumn(ctx context.Context, schema model.CIStr, tbl table.Table
 		// insert position is after the mentioned column
 		position = c.Offset + 1
 	}
+	// The values of a generated column would have to be computed for all the rows.
+	if generatedExpr(spec.Column) != nil {
+		return errors.Errorf("ALTER TABLE: adding generated column %s is not supported", name)
+	}
 	// TODO: Set constraint
-	col, _, err := d.buildColumnAndConstraint(position, spec.Column)
+	col, _, err := d.buildColumnAndConstraint(d.store, position, spec.Column)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -448,8 +538,57 @@ func (d *ddl) addColumn(ctx context.Context, schema model.CIStr, tbl table.Table
 	return errors.Trace(err)
 }
 
+// parseRowFormat returns the row format of ROW_FORMAT=s.
+func parseRowFormat(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "compact":
+		return model.RowFormatCompact, nil
+	case "redundant":
+		return model.RowFormatColumns, nil
+	default:
+		return 0, errors.Errorf("Unsupported row format: %s", s)
+	}
+}
+
+// alterTableOpts applies the table options, only ROW_FORMAT is supported now.
+func (d *ddl) alterTableOpts(ctx context.Context, schema model.CIStr, tbl table.Table, opts []*coldef.TableOpt) error {
+	for _, opt := range opts {
+		if opt.Tp != coldef.TblOptRowFormat {
+			// TODO: process more options
+			continue
+		}
+		format, err := parseRowFormat(opt.StrValue)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tbInfo := tbl.Meta()
+		if tbInfo.RowFormat == format {
+			continue
+		}
+		// The rows of both formats can be read, so the new rows are written in
+		// the format once it is saved, and the old rows are rewritten after it.
+		tbInfo.RowFormat = format
+		if err = d.updateInfoSchema(ctx, schema, tbInfo); err != nil {
+			return errors.Trace(err)
+		}
+		if tbl, err = d.tableByName(ctx, schema, tbInfo.Name); err != nil {
+			return errors.Trace(err)
+		}
+		if err = tbl.(*tables.Table).RewriteRows(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
 // drop table will proceed even if some table in the list does not exists
 func (d *ddl) DropTable(ctx context.Context, ti table.Ident) (err error) {
+	if temptable.GetTables(ctx).TableByName(ti.Schema, ti.Name) != nil {
+		return d.DropTemporaryTable(ctx, ti)
+	}
+	if err = d.checkWritable(); err != nil {
+		return errors.Trace(err)
+	}
 	is := d.GetInformationSchema()
 	tb, err := is.TableByName(ti.Schema, ti.Name)
 	if err != nil {
@@ -478,24 +617,31 @@ func (d *ddl) DropTable(ctx context.Context, ti table.Ident) (err error) {
 	return errors.Trace(err)
 }
 
+// dropTableData drops the records and the indices of t. The table ID is never
+// reused, so the ranges are dropped and removed physically in the background.
+func dropTableData(txn kv.Transaction, t table.Table) error {
+	for _, p := range t.Partitions() {
+		if err := dropTableData(txn, p); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, prefix := range []string{t.KeyPrefix(), t.IndexPrefix()} {
+		if err := kv.DropRange(txn, []byte(prefix), kv.PrefixNext([]byte(prefix))); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
 func (d *ddl) deleteTableData(ctx context.Context, t table.Table) error {
-	// Remove data
-	err := t.Truncate(ctx)
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	txn, err := ctx.GetTxn(false)
-	if err != nil {
+	// Remove data and indices
+	if err = dropTableData(txn, t); err != nil {
 		return errors.Trace(err)
 	}
-	// Remove indices
-	for _, v := range t.Indices() {
-		if v != nil && v.X != nil {
-			if err = v.X.Drop(txn); err != nil {
-				return errors.Trace(err)
-			}
-		}
-	}
 	// Remove auto ID key
 	err = txn.Delete([]byte(meta.AutoIDKey(t.TableID())))
 
@@ -507,20 +653,25 @@ func (d *ddl) deleteTableData(ctx context.Context, t table.Table) error {
 }
 
 func (d *ddl) CreateIndex(ctx context.Context, ti table.Ident, unique bool, indexName model.CIStr, idxColNames []*coldef.IndexColName) error {
-	is := d.infoHandle.Get()
-	t, err := is.TableByName(ti.Schema, ti.Name)
+	t, err := d.tableByName(ctx, ti.Schema, ti.Name)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	if _, ok := is.IndexByName(ti.Schema, ti.Name, indexName); ok {
-		return errors.Errorf("CREATE INDEX: index already exist %s", indexName)
+	tbInfo := t.Meta()
+	if !tbInfo.Temporary {
+		if err = d.checkWritable(); err != nil {
+			return errors.Trace(err)
+		}
 	}
-	if is.ColumnExists(ti.Schema, ti.Name, indexName) {
+	for _, idx := range tbInfo.Indices {
+		if idx.Name.L == indexName.L {
+			return errors.Errorf("CREATE INDEX: index already exist %s", indexName)
+		}
+	}
+	if column.FindCol(t.Cols(), indexName.L) != nil {
 		return errors.Errorf("CREATE INDEX: index name collision with existing column: %s", indexName)
 	}
 
-	tbInfo := t.Meta()
-
 	// build offsets
 	idxColumns := make([]*model.IndexColumn, 0, len(idxColNames))
 	for i, ic := range idxColNames {
@@ -528,6 +679,9 @@ func (d *ddl) CreateIndex(ctx context.Context, ti table.Ident, unique bool, inde
 		if col == nil {
 			return errors.Errorf("CREATE INDEX: column does not exist: %s", ic.ColumnName)
 		}
+		if err = checkIndexColumn(col); err != nil {
+			return errors.Trace(err)
+		}
 		idxColumns = append(idxColumns, &model.IndexColumn{
 			Name:   col.Name,
 			Offset: col.Offset,
@@ -549,6 +703,11 @@ func (d *ddl) CreateIndex(ctx context.Context, ti table.Ident, unique bool, inde
 		Unique:  unique,
 	}
 	tbInfo.Indices = append(tbInfo.Indices, idxInfo)
+	if unique {
+		if err = checkPartitionUniqueKey(tbInfo, idxInfo.Columns); err != nil {
+			return errors.Trace(err)
+		}
+	}
 
 	// build index
 	err = d.buildIndex(ctx, t, idxInfo, unique)
@@ -556,15 +715,27 @@ func (d *ddl) CreateIndex(ctx context.Context, ti table.Ident, unique bool, inde
 		return errors.Trace(err)
 	}
 
+	if tbInfo.Temporary {
+		return d.updateTemporaryTable(ctx, ti.Schema, tbInfo)
+	}
 	// update InfoSchema
 	return d.updateInfoSchema(ctx, ti.Schema, tbInfo)
 }
 
 func (d *ddl) buildIndex(ctx context.Context, t table.Table, idxInfo *model.IndexInfo, unique bool) error {
+	if ps := t.Partitions(); ps != nil {
+		// every partition has its local index
+		for _, p := range ps {
+			if err := d.buildIndex(ctx, p, idxInfo, unique); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	}
 	firstKey := t.FirstKey()
 	prefix := t.KeyPrefix()
 
-	txn, err := ctx.GetTxn(false)
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -583,23 +754,17 @@ func (d *ddl) buildIndex(ctx context.Context, t table.Table, idxInfo *model.Inde
 		// TODO: v is timestamp ?
 		// fetch datas
 		cols := t.Cols()
+		var idxCols []*column.Col
+		for _, v := range idxInfo.Columns {
+			idxCols = append(idxCols, cols[v.Offset])
+		}
+		data, err := t.RowWithCols(ctx, handle, idxCols)
+		if err != nil {
+			return errors.Trace(err)
+		}
 		var vals []interface{}
 		for _, v := range idxInfo.Columns {
-			var (
-				data []byte
-				val  interface{}
-			)
-			col := cols[v.Offset]
-			k := t.RecordKey(handle, col)
-			data, err = txn.Get([]byte(k))
-			if err != nil {
-				return errors.Trace(err)
-			}
-			val, err = t.DecodeValue(data, col)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			vals = append(vals, val)
+			vals = append(vals, data[v.Offset])
 		}
 		// build index
 		kvX := kv.NewKVIndex(t.IndexPrefix(), idxInfo.Name.L, unique)
@@ -617,9 +782,74 @@ func (d *ddl) buildIndex(ctx context.Context, t table.Table, idxInfo *model.Inde
 	return nil
 }
 
-func (d *ddl) DropIndex(ctx context.Context, schema, tableName, indexNmae model.CIStr) error {
-	// TODO: implement
-	return nil
+func (d *ddl) DropIndex(ctx context.Context, schema, tableName, indexName model.CIStr) error {
+	t, err := d.tableByName(ctx, schema, tableName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !isTemporary(t) {
+		if err = d.checkWritable(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	var idx *column.IndexedCol
+	for _, v := range t.Indices() {
+		if v.Name.L == indexName.L {
+			idx = v
+		}
+	}
+	if idx == nil {
+		return errors.Errorf("DROP INDEX: index does not exist %s", indexName)
+	}
+
+	// remove index info
+	tbInfo := t.Meta()
+	var indices []*model.IndexInfo
+	for _, v := range tbInfo.Indices {
+		if v.Name.L != indexName.L {
+			indices = append(indices, v)
+		}
+	}
+	tbInfo.Indices = indices
+
+	// Reset ColumnInfo flag by the indices left
+	offset := idx.Columns[0].Offset
+	tbInfo.Columns[offset].Flag &^= mysql.UniqueKeyFlag | mysql.MultipleKeyFlag
+	for _, v := range tbInfo.Indices {
+		if v.Columns[0].Offset != offset || v.Primary {
+			continue
+		}
+		if v.Unique && len(v.Columns) == 1 {
+			tbInfo.Columns[offset].Flag |= mysql.UniqueKeyFlag
+		} else {
+			tbInfo.Columns[offset].Flag |= mysql.MultipleKeyFlag
+		}
+	}
+
+	// remove index data
+	txn, err := t.GetTxn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = idx.X.Drop(txn); err != nil {
+		return errors.Trace(err)
+	}
+	for _, p := range t.Partitions() {
+		for _, v := range p.Indices() {
+			if v.Name.L != indexName.L {
+				continue
+			}
+			if err = v.X.Drop(txn); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	if tbInfo.Temporary {
+		return d.updateTemporaryTable(ctx, schema, tbInfo)
+	}
+	// update InfoSchema
+	return d.updateInfoSchema(ctx, schema, tbInfo)
 }
 
 func (d *ddl) writeSchemaInfo(info *model.DBInfo) error {
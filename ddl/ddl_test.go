@@ -48,7 +48,7 @@ func (ts *testSuite) SetUpSuite(c *C) {
 }
 
 func (ts *testSuite) TestT(c *C) {
-	handle := infoschema.NewHandle(ts.store)
+	handle := infoschema.NewHandle(ts.store, nil)
 	handle.Set(nil)
 	dd := ddl.NewDDL(ts.store, handle)
 	se, _ := tidb.CreateSession(ts.store)
@@ -69,17 +69,17 @@ func (ts *testSuite) TestT(c *C) {
 
 	tbStmt := statement("create table t (a int primary key not null, b varchar(255), key idx_b (b), c int, d int unique)").(*stmts.CreateTableStmt)
 
-	err = dd.CreateTable(ctx, table.Ident{Schema: noExist, Name: tbIdent.Name}, tbStmt.Cols, tbStmt.Constraints)
+	err = dd.CreateTable(ctx, table.Ident{Schema: noExist, Name: tbIdent.Name}, tbStmt.Cols, tbStmt.Constraints, tbStmt.Opt, tbStmt.Partition)
 	c.Assert(errors2.ErrorEqual(err, qerror.ErrDatabaseNotExist), IsTrue)
-	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints)
+	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints, tbStmt.Opt, tbStmt.Partition)
 	c.Assert(err, IsNil)
-	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints)
+	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints, tbStmt.Opt, tbStmt.Partition)
 	c.Assert(errors2.ErrorEqual(err, ddl.ErrExists), IsTrue)
 
 	tbIdent2 := tbIdent
 	tbIdent2.Name = model.NewCIStr("t2")
 	tbStmt = statement("create table t2 (a int unique not null)").(*stmts.CreateTableStmt)
-	err = dd.CreateTable(ctx, tbIdent2, tbStmt.Cols, tbStmt.Constraints)
+	err = dd.CreateTable(ctx, tbIdent2, tbStmt.Cols, tbStmt.Constraints, tbStmt.Opt, tbStmt.Partition)
 	c.Assert(err, IsNil)
 
 	tb, err := handle.Get().TableByName(tbIdent.Schema, tbIdent.Name)
@@ -135,7 +135,7 @@ func (ts *testSuite) TestT(c *C) {
 }
 
 func (ts *testSuite) TestConstraintNames(c *C) {
-	handle := infoschema.NewHandle(ts.store)
+	handle := infoschema.NewHandle(ts.store, nil)
 	handle.Set(nil)
 	dd := ddl.NewDDL(ts.store, handle)
 	se, _ := tidb.CreateSession(ts.store)
@@ -149,11 +149,11 @@ func (ts *testSuite) TestConstraintNames(c *C) {
 	err := dd.CreateSchema(ctx, tbIdent.Schema)
 	c.Assert(err, IsNil)
 	tbStmt := statement("create table t (a int, b int, index a (a, b), index a (a))").(*stmts.CreateTableStmt)
-	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints)
+	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints, tbStmt.Opt, tbStmt.Partition)
 	c.Assert(err, NotNil)
 
 	tbStmt = statement("create table t (a int, b int, index A (a, b), index (a))").(*stmts.CreateTableStmt)
-	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints)
+	err = dd.CreateTable(ctx, tbIdent, tbStmt.Cols, tbStmt.Constraints, tbStmt.Opt, tbStmt.Partition)
 	c.Assert(err, IsNil)
 	tbl, err := handle.Get().TableByName(schemaName, tblName)
 	indices := tbl.Indices()
@@ -0,0 +1,74 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/expression/expressions"
+	"github.com/pingcap/tidb/parser/coldef"
+)
+
+// generatedExpr returns the expression of the generated column colDef, nil if
+// the column is not generated.
+func generatedExpr(colDef *coldef.ColumnDef) expression.Expression {
+	for _, v := range colDef.Constraints {
+		if v.Tp == coldef.ConstrGenerated {
+			return v.Evalue
+		}
+	}
+	return nil
+}
+
+// checkGeneratedColumns checks the expressions of the generated columns in
+// colDefs. A generated column is computed from the other columns of the row in
+// column order, so it can only mention the columns which are not generated and
+// the generated columns defined before it.
+func checkGeneratedColumns(colDefs []*coldef.ColumnDef) error {
+	offsets := make(map[string]int, len(colDefs))
+	for i, colDef := range colDefs {
+		offsets[strings.ToLower(colDef.Name)] = i
+	}
+	for i, colDef := range colDefs {
+		expr := generatedExpr(colDef)
+		if expr == nil {
+			continue
+		}
+		if expressions.ContainAggregateFunc(expr) {
+			return errors.Errorf("Invalid use of group function in generated column %s", colDef.Name)
+		}
+		for _, name := range expressions.MentionedColumns(expr) {
+			j, ok := offsets[strings.ToLower(name)]
+			if !ok {
+				return errors.Errorf("No such column: %s", name)
+			}
+			if j >= i && generatedExpr(colDefs[j]) != nil {
+				return errors.Errorf("Generated column %s can't refer to generated column %s which is defined after it or itself", colDef.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkIndexColumn checks col can be a column of an index, the values of a
+// VIRTUAL generated column are not stored, so it can't be indexed.
+func checkIndexColumn(col *column.Col) error {
+	if col.IsGenerated() && !col.GeneratedStored {
+		return errors.Errorf("Index on VIRTUAL generated column %s is not supported", col.Name)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/expression/expressions"
+	"github.com/pingcap/tidb/meta"
+	"github.com/pingcap/tidb/model"
+	mysql "github.com/pingcap/tidb/mysqldef"
+	"github.com/pingcap/tidb/parser/coldef"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// maxPartitions is the max number of the partitions of a table.
+const maxPartitions = 1024
+
+// buildPartitionInfo builds the partitioning of tbInfo, every partition gets a new ID.
+func (d *ddl) buildPartitionInfo(ctx context.Context, tbInfo *model.TableInfo, opt *coldef.PartitionOption) (*model.PartitionInfo, error) {
+	pi := &model.PartitionInfo{
+		Expr: opt.Expr.String(),
+	}
+	if err := checkPartitionExpr(tbInfo, opt.Expr); err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, name := range expressions.MentionedColumns(opt.Expr) {
+		pi.Columns = append(pi.Columns, model.NewCIStr(name))
+	}
+	if err := checkPartitionUniqueKeys(tbInfo, pi); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	defs := opt.Definitions
+	switch opt.Tp {
+	case coldef.PartitionHash:
+		pi.Type = model.PartitionTypeHash
+		if opt.Num == 0 || opt.Num > maxPartitions {
+			return nil, errors.Errorf("Invalid number of partitions %d", opt.Num)
+		}
+		defs = make([]*coldef.PartitionDefinition, 0, opt.Num)
+		for i := uint64(0); i < opt.Num; i++ {
+			defs = append(defs, &coldef.PartitionDefinition{Name: fmt.Sprintf("p%d", i)})
+		}
+	default:
+		pi.Type = model.PartitionTypeRange
+	}
+	if err := d.addPartitionDefinitions(ctx, pi, defs); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return pi, nil
+}
+
+// checkPartitionExpr checks the partitioning expression mentions the columns of
+// tbInfo, a single column must be an integer.
+func checkPartitionExpr(tbInfo *model.TableInfo, expr expression.Expression) error {
+	names := expressions.MentionedColumns(expr)
+	if len(names) == 0 {
+		return errors.Errorf("Constant expression in partitioning function is not allowed")
+	}
+	for _, name := range names {
+		col := findColumnInfo(tbInfo, name)
+		if col == nil {
+			return errors.Errorf("No such column: %s", name)
+		}
+		if _, ok := expr.(*expressions.Ident); !ok {
+			continue
+		}
+		switch col.Tp {
+		case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear:
+		default:
+			return errors.Errorf("Field '%s' is of a not allowed type for this type of partitioning", name)
+		}
+	}
+	return nil
+}
+
+func findColumnInfo(tbInfo *model.TableInfo, name string) *model.ColumnInfo {
+	for _, col := range tbInfo.Columns {
+		if col.Name.L == model.NewCIStr(name).L {
+			return col
+		}
+	}
+	return nil
+}
+
+// checkPartitionUniqueKeys checks all the unique keys of tbInfo include the
+// columns of its partitioning pi, the local indices of the partitions can only
+// make the keys unique in this way.
+func checkPartitionUniqueKeys(tbInfo *model.TableInfo, pi *model.PartitionInfo) error {
+	for _, col := range tbInfo.Columns {
+		if tbInfo.PKIsHandle && mysql.HasPriKeyFlag(col.Flag) {
+			pk := []*model.IndexColumn{{Name: col.Name, Offset: col.Offset}}
+			if err := checkPartitionKey(pi, pk); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	for _, idx := range tbInfo.Indices {
+		if !idx.Unique {
+			continue
+		}
+		if err := checkPartitionKey(pi, idx.Columns); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// checkPartitionUniqueKey checks the unique key of cols includes the columns of
+// the partitioning of tbInfo if it is partitioned.
+func checkPartitionUniqueKey(tbInfo *model.TableInfo, cols []*model.IndexColumn) error {
+	if tbInfo.Partition == nil {
+		return nil
+	}
+	return checkPartitionKey(tbInfo.Partition, cols)
+}
+
+func checkPartitionKey(pi *model.PartitionInfo, cols []*model.IndexColumn) error {
+	for _, name := range pi.Columns {
+		found := false
+		for _, col := range cols {
+			if col.Name.L == name.L {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("A UNIQUE INDEX must include all columns in the table's partitioning function")
+		}
+	}
+	return nil
+}
+
+// addPartitionDefinitions appends the partitions of defs to pi.
+func (d *ddl) addPartitionDefinitions(ctx context.Context, pi *model.PartitionInfo, defs []*coldef.PartitionDefinition) error {
+	if len(pi.Definitions)+len(defs) > maxPartitions {
+		return errors.Errorf("Too many partitions")
+	}
+	for _, pd := range defs {
+		name := model.NewCIStr(pd.Name)
+		for _, def := range pi.Definitions {
+			if def.Name.L == name.L {
+				return errors.Errorf("Duplicate partition name %s", pd.Name)
+			}
+		}
+		def := &model.PartitionDefinition{Name: name}
+		if pi.Type == model.PartitionTypeRange {
+			var last *model.PartitionDefinition
+			if n := len(pi.Definitions); n > 0 {
+				last = pi.Definitions[n-1]
+			}
+			if last != nil && last.MaxValue {
+				return errors.Errorf("MAXVALUE can only be used in last partition definition")
+			}
+			if pd.LessThan == nil {
+				def.MaxValue = true
+			} else {
+				v, err := pd.LessThan.Eval(ctx, nil)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				if v == nil {
+					return errors.Errorf("Not allowed to use NULL value in VALUES LESS THAN")
+				}
+				if def.LessThan, err = types.ToInt64(v); err != nil {
+					return errors.Trace(err)
+				}
+				if last != nil && def.LessThan <= last.LessThan {
+					return errors.Errorf("VALUES LESS THAN value must be strictly increasing for each partition")
+				}
+			}
+		}
+		var err error
+		if def.ID, err = meta.GenGlobalID(d.store); err != nil {
+			return errors.Trace(err)
+		}
+		pi.Definitions = append(pi.Definitions, def)
+	}
+	return nil
+}
+
+// clonePartitionInfo returns a copy of the partitioning of tbInfo which can be
+// changed, the meta of the tables in the information schema are never changed.
+func clonePartitionInfo(tbInfo *model.TableInfo) *model.PartitionInfo {
+	pi := *tbInfo.Partition
+	pi.Definitions = append([]*model.PartitionDefinition(nil), pi.Definitions...)
+	return &pi
+}
+
+// addPartitions adds the RANGE partitions of defs after the last partition of tbl.
+func (d *ddl) addPartitions(ctx context.Context, schema model.CIStr, tbl table.Table, defs []*coldef.PartitionDefinition) error {
+	tbInfo := tbl.Meta()
+	if tbInfo.Partition == nil || tbInfo.Partition.Type != model.PartitionTypeRange {
+		return errors.Errorf("ADD PARTITION: table %s is not partitioned by RANGE", tbInfo.Name)
+	}
+	pi := clonePartitionInfo(tbInfo)
+	if err := d.addPartitionDefinitions(ctx, pi, defs); err != nil {
+		return errors.Trace(err)
+	}
+	tbInfo.Partition = pi
+	return errors.Trace(d.updateInfoSchema(ctx, schema, tbInfo))
+}
+
+// findPartitions returns the offsets of the partitions of names in the partitions of tbInfo.
+func findPartitions(tbInfo *model.TableInfo, names []string) (map[int]bool, error) {
+	if tbInfo.Partition == nil {
+		return nil, errors.Errorf("table %s is not partitioned", tbInfo.Name)
+	}
+	offsets := make(map[int]bool, len(names))
+	for _, name := range names {
+		found := false
+		for i, def := range tbInfo.Partition.Definitions {
+			if def.Name.L == model.NewCIStr(name).L {
+				offsets[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("Unknown partition %s in table %s", name, tbInfo.Name)
+		}
+	}
+	return offsets, nil
+}
+
+// dropPartitions drops the RANGE partitions of names and their rows.
+func (d *ddl) dropPartitions(ctx context.Context, schema model.CIStr, tbl table.Table, names []string) error {
+	tbInfo := tbl.Meta()
+	offsets, err := findPartitions(tbInfo, names)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if tbInfo.Partition.Type != model.PartitionTypeRange {
+		return errors.Errorf("DROP PARTITION: table %s is not partitioned by RANGE", tbInfo.Name)
+	}
+	if len(offsets) == len(tbInfo.Partition.Definitions) {
+		return errors.Errorf("Cannot remove all partitions, use DROP TABLE instead")
+	}
+	pi := clonePartitionInfo(tbInfo)
+	pi.Definitions = pi.Definitions[:0]
+	for i, def := range tbInfo.Partition.Definitions {
+		if !offsets[i] {
+			pi.Definitions = append(pi.Definitions, def)
+		}
+	}
+	tbInfo.Partition = pi
+	// update InfoSchema before dropping the data like DROP TABLE.
+	if err = d.updateInfoSchema(ctx, schema, tbInfo); err != nil {
+		return errors.Trace(err)
+	}
+	txn, err := ctx.GetTxn(false)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for i, p := range tbl.Partitions() {
+		if !offsets[i] {
+			continue
+		}
+		if err = dropTableData(txn, p); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// truncatePartitions removes all the rows of the partitions of names.
+func truncatePartitions(ctx context.Context, tbl table.Table, names []string) error {
+	offsets, err := findPartitions(tbl.Meta(), names)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for i, p := range tbl.Partitions() {
+		if !offsets[i] {
+			continue
+		}
+		if err = p.Truncate(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/meta/autoid"
+	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/parser/coldef"
+	"github.com/pingcap/tidb/sessionctx/temptable"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/table/tables"
+	qerror "github.com/pingcap/tidb/util/errors"
+)
+
+// tableByName returns the table schema.name, the temporary table of the
+// session ctx shadows the table of the same name in the InfoSchema.
+func (d *ddl) tableByName(ctx context.Context, schema, name model.CIStr) (table.Table, error) {
+	if t := temptable.GetTables(ctx).TableByName(schema, name); t != nil {
+		return t, nil
+	}
+	t, err := d.GetInformationSchema().TableByName(schema, name)
+	return t, errors.Trace(err)
+}
+
+func isTemporary(t table.Table) bool {
+	return t.Meta().Temporary
+}
+
+// CreateTemporaryTable creates a temporary table in the store of the temporary
+// tables of ctx, it is never written to the store of the DDL, so it can be
+// created even if the store is read-only.
+func (d *ddl) CreateTemporaryTable(ctx context.Context, ident table.Ident, colDefs []*coldef.ColumnDef, constraints []*coldef.TableConstraint, opt *coldef.TableOption) error {
+	ts := temptable.GetTables(ctx)
+	if ts == nil {
+		return errors.Errorf("CREATE TEMPORARY TABLE: temporary tables are not supported in this context")
+	}
+	if !d.GetInformationSchema().SchemaExists(ident.Schema) {
+		return errors.Trace(qerror.ErrDatabaseNotExist)
+	}
+	if ts.TableByName(ident.Schema, ident.Name) != nil {
+		return errors.Trace(ErrExists)
+	}
+	if err := checkDuplicateColumn(colDefs); err != nil {
+		return errors.Trace(err)
+	}
+
+	// The IDs of the columns and the table are generated in the store of the temporary tables.
+	store, err := ts.Store()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cols, newConstraints, err := d.buildColumnsAndConstraints(store, colDefs, constraints)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = checkConstraintNames(newConstraints); err != nil {
+		return errors.Trace(err)
+	}
+	tbInfo, err := d.buildTableInfo(store, ident.Name, cols, newConstraints, opt)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// The IDs of the temporary tables are negative, so they never collide
+	// with the IDs of the other tables, like the table IDs of the row keys.
+	tbInfo.ID = -tbInfo.ID
+	tbInfo.Temporary = true
+	log.Infof("New temporary table: %+v", tbInfo)
+	return d.updateTemporaryTable(ctx, ident.Schema, tbInfo)
+}
+
+// DropTemporaryTable drops the temporary table and deletes its data in the
+// transaction of the temporary tables.
+func (d *ddl) DropTemporaryTable(ctx context.Context, ti table.Ident) error {
+	ts := temptable.GetTables(ctx)
+	t := ts.TableByName(ti.Schema, ti.Name)
+	if t == nil {
+		return errors.Errorf("temporary table %s.%s does not exist", ti.Schema, ti.Name)
+	}
+	ts.RemoveTable(ti.Schema, ti.Name)
+	return errors.Trace(d.deleteTableData(ctx, t))
+}
+
+// updateTemporaryTable builds the temporary table of tbInfo, it replaces the
+// table of the same name.
+func (d *ddl) updateTemporaryTable(ctx context.Context, schema model.CIStr, tbInfo *model.TableInfo) error {
+	ts := temptable.GetTables(ctx)
+	store, err := ts.Store()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ts.AddTable(schema, tables.TableFromMeta(schema.L, autoid.NewAllocator(store), tbInfo, d.infoHandle.ExprParser()))
+	return nil
+}
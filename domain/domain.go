@@ -23,6 +23,7 @@ import (
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta"
 	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/table"
 	"github.com/pingcap/tidb/util"
 )
 
@@ -67,9 +68,9 @@ func (do *Domain) Store() kv.Storage {
 	return do.store
 }
 
-// NewDomain creates a new domain.
-func NewDomain(store kv.Storage) (d *Domain, err error) {
-	infoHandle := infoschema.NewHandle(store)
+// NewDomain creates a new domain, the expressions of the tables are parsed by parse.
+func NewDomain(store kv.Storage, parse table.ExprParser) (d *Domain, err error) {
+	infoHandle := infoschema.NewHandle(store, parse)
 	ddl := ddl.NewDDL(store, infoHandle)
 	d = &Domain{
 		store:      store,
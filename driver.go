@@ -130,13 +130,20 @@ func (d *sqlDriver) lock() func() {
 // efficient re-use.
 //
 // The returned connection is only used by one goroutine at a time.
+//
+// The options of the store are after the dbName, like goleveldb:///tmp/tidb/test?sync=true.
 func (d *sqlDriver) Open(dataSource string) (driver.Conn, error) {
+	// Split the options from the dataSource.
+	var options string
+	if i := strings.Index(dataSource, "?"); i != -1 {
+		dataSource, options = dataSource[:i], dataSource[i:]
+	}
 	// Split the dataSource to uri and dbName
 	i := strings.LastIndex(dataSource, "/")
 	if i == -1 {
 		return nil, errors.Errorf("Invalid dataSource: %q", dataSource)
 	}
-	uri := dataSource[:i]
+	uri := dataSource[:i] + options
 	dbName := dataSource[i+1:]
 
 	store, err := NewStore(uri)
@@ -221,6 +228,8 @@ func (c *driverConn) Close() error {
 		err.append(stmt.conn.s.DropPreparedStmt(stmt.stmtID))
 	}
 	defer c.driver.lock()()
+	// The transaction left by the connection is rolled back.
+	err.append(c.s.Close())
 	return err.error()
 }
 
@@ -185,15 +185,22 @@ func (is *infoSchema) Clone() (result []*model.DBInfo) {
 type Handle struct {
 	value atomic.Value
 	store kv.Storage
+	parse table.ExprParser
 }
 
-// NewHandle creates a new Handle.
-func NewHandle(store kv.Storage) *Handle {
+// NewHandle creates a new Handle, the expressions of the tables are parsed by parse.
+func NewHandle(store kv.Storage, parse table.ExprParser) *Handle {
 	return &Handle{
 		store: store,
+		parse: parse,
 	}
 }
 
+// ExprParser returns the parser of the expressions of the tables.
+func (h *Handle) ExprParser() table.ExprParser {
+	return h.parse
+}
+
 // Set sets DBInfo to information schema.
 func (h *Handle) Set(newInfo []*model.DBInfo) {
 	info := &infoSchema{
@@ -211,7 +218,12 @@ func (h *Handle) Set(newInfo []*model.DBInfo) {
 		info.schemaNameToID[di.Name.L] = di.ID
 		for _, t := range di.Tables {
 			alloc := autoid.NewAllocator(h.store)
-			info.tables[t.ID] = table.TableFromMeta(di.Name.L, alloc, t)
+			tbl := table.TableFromMeta(di.Name.L, alloc, t, h.parse)
+			info.tables[t.ID] = tbl
+			// The partitions are found by their IDs in the keys, but not by name.
+			for _, p := range tbl.Partitions() {
+				info.tables[p.TableID()] = p
+			}
 			tname := tableName{di.Name.L, t.Name.L}
 			info.tableNameToID[tname] = t.ID
 			for _, c := range t.Columns {
@@ -40,7 +40,7 @@ func (*testSuite) TestT(c *C) {
 	c.Assert(err, IsNil)
 	defer store.Close()
 
-	handle := infoschema.NewHandle(store)
+	handle := infoschema.NewHandle(store, nil)
 	dbName := model.NewCIStr("Test")
 	tbName := model.NewCIStr("T")
 	colName := model.NewCIStr("A")
@@ -87,7 +87,7 @@ func (c *IndexIter) Next() (k []interface{}, h int64, err error) {
 		k = vv
 	}
 	// update new iter to next
-	newIt, err := c.it.Next(hasPrefix([]byte(c.prefix)))
+	newIt, err := c.it.Next(nil)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -189,35 +189,11 @@ func (c *kvIndex) Delete(txn Transaction, indexedValues []interface{}, h int64)
 	return err
 }
 
-func hasPrefix(prefix []byte) FnKeyCmp {
-	return func(k []byte) bool {
-		return bytes.HasPrefix(k, prefix)
-	}
-}
-
 // Drop removes the KV index from store.
 func (c *kvIndex) Drop(txn Transaction) error {
+	// The index may be created again with the same name, so its range is deleted instead of dropped.
 	prefix := []byte(c.prefix)
-	it, err := txn.Seek(prefix, hasPrefix(prefix))
-	if err != nil {
-		return err
-	}
-	defer it.Close()
-	// remove all indices
-	for it.Valid() {
-		if !strings.HasPrefix(it.Key(), c.prefix) {
-			break
-		}
-		err := txn.Delete([]byte(it.Key()))
-		if err != nil {
-			return err
-		}
-		it, err = it.Next(hasPrefix(prefix))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return errors.Trace(DeleteRange(txn, prefix, PrefixNext(prefix)))
 }
 
 // Seek searches KV index for the entry with indexedValues.
@@ -226,7 +202,7 @@ func (c *kvIndex) Seek(txn Transaction, indexedValues []interface{}) (iter Index
 	if err != nil {
 		return nil, false, err
 	}
-	it, err := txn.Seek(keyBuf, hasPrefix([]byte(c.prefix)))
+	it, err := txn.Scan(keyBuf, PrefixNext([]byte(c.prefix)), 0)
 	if err != nil {
 		return nil, false, err
 	}
@@ -241,7 +217,16 @@ func (c *kvIndex) Seek(txn Transaction, indexedValues []interface{}) (iter Index
 // SeekFirst returns an iterator which points to the first entry of the KV index.
 func (c *kvIndex) SeekFirst(txn Transaction) (iter IndexIterator, err error) {
 	prefix := []byte(c.prefix)
-	it, err := txn.Seek([]byte(c.prefix), hasPrefix(prefix))
+	it, err := txn.Scan(prefix, PrefixNext(prefix), 0)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexIter{it: it, idx: c, prefix: c.prefix}, nil
+}
+
+// SeekLast returns an iterator which points to the last entry of the KV index and moves backward.
+func (c *kvIndex) SeekLast(txn Transaction) (iter IndexIterator, err error) {
+	it, err := txn.SeekReverse(PrefixNext([]byte(c.prefix)))
 	if err != nil {
 		return nil, err
 	}
@@ -16,6 +16,7 @@ package kv
 import (
 	"errors"
 
+	mysql "github.com/pingcap/tidb/mysqldef"
 	"github.com/pingcap/tidb/util/codec"
 )
 
@@ -30,6 +31,16 @@ var (
 	ErrConditionNotMatch = errors.New("Error: Condition not match")
 	// ErrLockConflict is used when try to lock an already locked key.
 	ErrLockConflict = errors.New("Error: Lock conflict")
+	// ErrLockWaitTimeout is used when waiting for a locked key exceeds the lock wait timeout.
+	ErrLockWaitTimeout = mysql.NewDefaultError(mysql.ErLockWaitTimeout)
+	// ErrDeadlock is used when a transaction is chosen as the victim of a deadlock.
+	ErrDeadlock = mysql.NewDefaultError(mysql.ErLockDeadlock)
+	// ErrTxnTooLarge is used when the writes of a transaction exceed TxnEntryLimit or TxnSizeLimit.
+	ErrTxnTooLarge = mysql.NewError(mysql.ErTransCacheFull, "Transaction is too large, increase tidb_txn_entry_limit or tidb_txn_size_limit and try again")
+	// ErrReadOnly is used when writing to a read-only Storage.
+	ErrReadOnly = mysql.NewDefaultError(mysql.ErOptionPreventsStatement, "--read-only")
+	// ErrEventsOverflow is used when a Subscription is stopped because too many events are not received.
+	ErrEventsOverflow = errors.New("Error: too many events are not received")
 )
 
 var (
@@ -53,6 +64,28 @@ func EncodeKey(k []byte) []byte {
 	return append(keyPrefix, k...)
 }
 
+// EncodeEndKey is like EncodeKey, but a nil k is encoded as the key after all encoded keys,
+// it is used as the upper bound of the reverse iteration.
+func EncodeEndKey(k []byte) []byte {
+	if k == nil {
+		return PrefixNext(keyPrefix)
+	}
+	return EncodeKey(k)
+}
+
+// PrefixNext returns the smallest key which is greater than all the keys with the prefix.
+func PrefixNext(prefix []byte) []byte {
+	next := append([]byte(nil), prefix...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next[:i+1]
+		}
+	}
+	// All bytes are 0xff, there is no upper bound.
+	return nil
+}
+
 // DecodeKey removes the prefixed keyPrefix.
 func DecodeKey(k []byte) []byte {
 	return k[len(keyPrefix):]
@@ -13,21 +13,46 @@
 
 package kv
 
+import "bytes"
+
 // DecodeFn is a function that decode data after fetch from store.
 type DecodeFn func(raw interface{}) (interface{}, error)
 
 // EncodeFn is a function that encode data before put into store
 type EncodeFn func(raw interface{}) (interface{}, error)
 
+// Option is used for customizing kv store's behaviors during a transaction.
+type Option int
+
+const (
+	// LockWaitTimeout is the time.Duration a transaction waits for a key locked by
+	// another transaction. A zero value means failing with ErrLockConflict immediately.
+	LockWaitTimeout Option = iota + 1
+	// TxnEntryLimit is the int maximum number of the entries a transaction buffers,
+	// TxnSizeLimit is the int maximum total bytes of them. A zero value means no limit.
+	TxnEntryLimit
+	TxnSizeLimit
+)
+
 // Transaction defines the interface for operations inside a Transaction.
 // This is not thread safe.
 type Transaction interface {
 	// Get gets the value for key k from KV store.
 	Get(k []byte) ([]byte, error)
+	// BatchGet gets the values for keys from KV store in one pass,
+	// the keys which do not exist are not in the returned map.
+	BatchGet(keys [][]byte) (map[string][]byte, error)
 	// Set sets the value for key k as v into KV store.
 	Set(k []byte, v []byte) error
 	// Seek searches for the entry with key k in KV store.
+	// Prefer Scan if the upper bound of the keys is known.
 	Seek(k []byte, fnKeyCmp func(key []byte) bool) (Iterator, error)
+	// Scan returns an iterator over the entries whose keys are in [start, end),
+	// a nil end means no upper bound. If limit > 0, the iterator stops after limit entries.
+	Scan(start, end []byte, limit int) (Iterator, error)
+	// SeekReverse searches for the last entry whose key is less than k in KV store,
+	// or the last entry if k is nil. The returned iterator moves backward.
+	SeekReverse(k []byte) (Iterator, error)
 	// Inc increases the value for key k in KV store by step.
 	Inc(k []byte, step int64) (int64, error)
 	// Deletes removes the entry for key k from KV store.
@@ -40,14 +65,25 @@ type Transaction interface {
 	String() string
 	// LockKeys tries to lock the entries with the keys in KV store.
 	LockKeys(keys ...[]byte) error
+	// SetOption sets an option with a value, when val is nil, uses the default
+	// value of this option.
+	SetOption(opt Option, val interface{})
 }
 
 // Snapshot defines the interface for the snapshot fetched from KV store.
 type Snapshot interface {
 	// Get gets the value for key k from snapshot.
 	Get(k []byte) ([]byte, error)
+	// BatchGet gets the values for keys from snapshot in one pass,
+	// the keys which do not exist are not in the returned map.
+	BatchGet(keys [][]byte) (map[string][]byte, error)
 	// NewIterator gets a new iterator on the snapshot.
-	NewIterator(param interface{}) Iterator
+	NewIterator(param interface{}) (Iterator, error)
+	// NewReverseIterator gets a new iterator on the snapshot which moves backward.
+	NewReverseIterator(param interface{}) (Iterator, error)
+	// Scan returns an iterator over the entries whose keys are in [start, end),
+	// a nil end means no upper bound. If limit > 0, the iterator stops after limit entries.
+	Scan(start, end []byte, limit int) (Iterator, error)
 	// Release releases the snapshot to store.
 	Release()
 }
@@ -64,12 +100,121 @@ type Driver interface {
 type Storage interface {
 	// Begin transaction
 	Begin() (Transaction, error)
+	// GetSnapshot gets a snapshot that is able to read any data whose version is <= ver.
+	// If ver is MaxVersion, the snapshot reads the latest committed data.
+	GetSnapshot(ver Version) (Snapshot, error)
+	// CurrentVersion returns a version which is greater than all the committed versions.
+	CurrentVersion() (Version, error)
 	// Close store
 	Close() error
 	// Storage's unique ID
 	UUID() string
 }
 
+// Mutation is a change of a key made by a committed transaction.
+type Mutation struct {
+	Key []byte
+	// OldValue is nil if the key didn't exist before the transaction.
+	OldValue []byte
+	// NewValue is nil if the key is deleted by the transaction.
+	NewValue []byte
+}
+
+// CommitEvent is the mutations of a committed transaction.
+type CommitEvent struct {
+	// CommitVersion is the commit version of the transaction, the events
+	// are emitted in the ascending order of it.
+	CommitVersion Version
+	Mutations     []Mutation
+}
+
+// Subscription receives the CommitEvents of a Storage.
+type Subscription interface {
+	// Events returns the channel of the events, it is closed after Close is called
+	// or the subscription is stopped by an error.
+	Events() <-chan *CommitEvent
+	// Err returns the error which stops the subscription, nil if it is stopped by Close.
+	Err() error
+	// Close stops the subscription.
+	Close()
+}
+
+// CommitNotifier is implemented by the Storages which can emit the committed transactions.
+type CommitNotifier interface {
+	// Subscribe starts receiving the transactions committed after it returns.
+	// The events are buffered until they are received, so a slow subscriber doesn't
+	// block the commits. If too many events are buffered, the subscription is
+	// stopped with ErrEventsOverflow, the subscriber has to catch up in another way.
+	Subscribe() Subscription
+}
+
+// CompressionStats is the statistics of the values written by a Storage which compresses values.
+type CompressionStats struct {
+	// Values is the number of the values written, Compressed is the number of the compressed ones.
+	Values     int64
+	Compressed int64
+	// RawSize is the total size of the values, StoredSize is the total size written to the storage.
+	RawSize    int64
+	StoredSize int64
+}
+
+// Ratio returns RawSize / StoredSize, or 1 if nothing is written.
+func (s CompressionStats) Ratio() float64 {
+	if s.StoredSize == 0 {
+		return 1
+	}
+	return float64(s.RawSize) / float64(s.StoredSize)
+}
+
+// CompressionReporter is implemented by the Storages which can compress values.
+type CompressionReporter interface {
+	// CompressionStats returns the statistics since the Storage is opened.
+	CompressionStats() CompressionStats
+}
+
+// TxnBufferReporter is implemented by the Transactions which buffer the writes in memory.
+type TxnBufferReporter interface {
+	// BufferLen returns the number of the buffered entries.
+	BufferLen() int
+	// BufferSize returns the total bytes of the buffered entries.
+	BufferSize() int
+}
+
+// KeyRange is the range [StartKey, EndKey) of keys, a nil EndKey means no upper bound.
+type KeyRange struct {
+	StartKey []byte
+	EndKey   []byte
+}
+
+// Contains returns true if k is in the range.
+func (r KeyRange) Contains(k []byte) bool {
+	return bytes.Compare(k, r.StartKey) >= 0 && (r.EndKey == nil || bytes.Compare(k, r.EndKey) < 0)
+}
+
+// RangeDeleter is implemented by the Transactions which can delete a range
+// of keys without buffering every key in it.
+type RangeDeleter interface {
+	// DeleteRange deletes the keys in [start, end) when the transaction commits,
+	// a nil end means no upper bound. The keys set in the range after it are kept.
+	DeleteRange(start, end []byte) error
+	// DropRange is like DeleteRange, but the range is never written again, like
+	// the keys of a dropped table, so the Storage can remove its data physically
+	// in the background once no transaction reads it.
+	DropRange(start, end []byte) error
+}
+
+// ReadOnlyChecker is implemented by the Storages which can be opened in read-only mode.
+type ReadOnlyChecker interface {
+	// IsReadOnly returns true if the transactions of the Storage fail to write with ErrReadOnly.
+	IsReadOnly() bool
+}
+
+// IsReadOnly returns true if store is a read-only Storage.
+func IsReadOnly(store Storage) bool {
+	c, ok := store.(ReadOnlyChecker)
+	return ok && c.IsReadOnly()
+}
+
 // FnKeyCmp is the function for iterator the keys
 type FnKeyCmp func(key []byte) bool
 
@@ -95,4 +240,5 @@ type Index interface {
 	Drop(txn Transaction) error                                                                  // supports drop table, drop index statements
 	Seek(txn Transaction, indexedValues []interface{}) (iter IndexIterator, hit bool, err error) // supports where clause
 	SeekFirst(txn Transaction) (iter IndexIterator, err error)                                   // supports aggregate min / ascending order by
+	SeekLast(txn Transaction) (iter IndexIterator, err error)                                    // supports aggregate max / descending order by
 }
@@ -25,13 +25,54 @@ func IsRetryableError(err error) bool {
 		return false
 	}
 
-	if errors2.ErrorEqual(err, ErrLockConflict) || errors2.ErrorEqual(err, ErrConditionNotMatch) {
+	if errors2.ErrorEqual(err, ErrLockConflict) || errors2.ErrorEqual(err, ErrConditionNotMatch) ||
+		errors2.ErrorEqual(err, ErrDeadlock) {
 		return true
 	}
 
 	return false
 }
 
+// DeleteRange deletes the keys in [start, end) in txn, a nil end means no upper bound.
+// If txn is not a RangeDeleter, the keys are deleted one by one.
+func DeleteRange(txn Transaction, start, end []byte) error {
+	if d, ok := txn.(RangeDeleter); ok {
+		return errors.Trace(d.DeleteRange(start, end))
+	}
+	return errors.Trace(deleteKeys(txn, start, end))
+}
+
+// DropRange is like DeleteRange, but the range must never be written again,
+// see RangeDeleter DropRange.
+func DropRange(txn Transaction, start, end []byte) error {
+	if d, ok := txn.(RangeDeleter); ok {
+		return errors.Trace(d.DropRange(start, end))
+	}
+	return errors.Trace(deleteKeys(txn, start, end))
+}
+
+func deleteKeys(txn Transaction, start, end []byte) error {
+	var keys []string
+	it, err := txn.Scan(start, end, 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer it.Close()
+	for it.Valid() {
+		keys = append(keys, it.Key())
+		if it, err = it.Next(nil); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	for _, key := range keys {
+		if err = txn.Delete([]byte(key)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
 // RunInNewTxn will run the f in a new transaction evnironment.
 func RunInNewTxn(store Storage, retryable bool, f func(txn Transaction) error) error {
 	for {
@@ -16,6 +16,7 @@ package kv
 import (
 	"bytes"
 
+	"github.com/juju/errors"
 	"github.com/ngaut/log"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 )
@@ -27,6 +28,13 @@ type UnionIter struct {
 	curIsDirty    bool
 	dirtyValid    bool
 	snapshotValid bool
+	// reverse means the iterator moves backward.
+	reverse bool
+	// If limit > 0, the iterator stops after limit entries.
+	limit int
+	count int
+	// err is the error of moving snapshotIt, the iterator stops at it.
+	err error
 
 	isValid bool
 }
@@ -43,20 +51,46 @@ func newUnionIter(dirtyIt iterator.Iterator, snapshotIt Iterator) *UnionIter {
 	return it
 }
 
+func newUnionReverseIter(dirtyIt iterator.Iterator, snapshotIt Iterator) *UnionIter {
+	it := &UnionIter{
+		dirtyIt:       dirtyIt,
+		snapshotIt:    snapshotIt,
+		dirtyValid:    dirtyIt.Last(),
+		snapshotValid: snapshotIt.Valid(),
+		reverse:       true,
+	}
+	it.updateCur()
+	return it
+}
+
 // Go next and update valid status.
 func (iter *UnionIter) dirtyNext() {
+	if iter.reverse {
+		iter.dirtyValid = iter.dirtyIt.Prev()
+		return
+	}
 	iter.dirtyValid = iter.dirtyIt.Next()
 }
 
 // Go next and update valid status.
 func (iter *UnionIter) snapshotNext() {
-	iter.snapshotIt, _ = iter.snapshotIt.Next(nil)
-	iter.snapshotValid = iter.snapshotIt.Valid()
+	it, err := iter.snapshotIt.Next(nil)
+	if err != nil {
+		iter.err = err
+		iter.snapshotValid = false
+		return
+	}
+	iter.snapshotIt = it
+	iter.snapshotValid = it.Valid()
 }
 
 func (iter *UnionIter) updateCur() {
 	iter.isValid = true
 	for {
+		if iter.err != nil {
+			iter.isValid = false
+			return
+		}
 		if !iter.dirtyValid && !iter.snapshotValid {
 			iter.isValid = false
 			return
@@ -82,6 +116,9 @@ func (iter *UnionIter) updateCur() {
 			snapshotKey := []byte(iter.snapshotIt.Key())
 			dirtyKey := iter.dirtyIt.Key()
 			cmp := bytes.Compare(dirtyKey, snapshotKey)
+			if iter.reverse {
+				cmp = -cmp
+			}
 			// if equal, means both have value
 			if cmp == 0 {
 				if len(iter.dirtyIt.Value()) == 0 {
@@ -114,6 +151,15 @@ func (iter *UnionIter) updateCur() {
 	}
 }
 
+// checkErr closes iter and returns the error if it fails to move to its first entry.
+func (iter *UnionIter) checkErr() (Iterator, error) {
+	if iter.err != nil {
+		iter.Close()
+		return nil, errors.Trace(iter.err)
+	}
+	return iter, nil
+}
+
 // Next implements the Iterator Next interface.
 func (iter *UnionIter) Next(f FnKeyCmp) (Iterator, error) {
 	if iter.curIsDirty == false {
@@ -122,7 +168,19 @@ func (iter *UnionIter) Next(f FnKeyCmp) (Iterator, error) {
 		iter.dirtyNext()
 	}
 	iter.updateCur()
-	return iter, nil
+	iter.checkLimit()
+	return iter, errors.Trace(iter.err)
+}
+
+// checkLimit counts the current entry and invalidates the iterator if the limit is exceeded.
+func (iter *UnionIter) checkLimit() {
+	if iter.limit <= 0 || !iter.isValid {
+		return
+	}
+	iter.count++
+	if iter.count > iter.limit {
+		iter.isValid = false
+	}
 }
 
 // Value implements the Iterator Value interface.
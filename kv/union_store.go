@@ -14,6 +14,7 @@
 package kv
 
 import (
+	"github.com/juju/errors"
 	"github.com/ngaut/pool"
 	"github.com/pingcap/tidb/util/errors2"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -71,6 +72,11 @@ func IsErrNotFound(err error) bool {
 type UnionStore struct {
 	Dirty    *memdb.DB // updates are buffered in memory
 	Snapshot Snapshot  // for read
+	// EntryLimit and SizeLimit limit the entries and the bytes in Dirty, zero means no limit.
+	EntryLimit int
+	SizeLimit  int
+	// DeletedRanges are deleted by DeleteRange, the keys in them are only read from Dirty.
+	DeletedRanges []KeyRange
 }
 
 // NewUnionStore builds a new UnionStore.
@@ -87,6 +93,9 @@ func (us *UnionStore) Get(key []byte) (value []byte, err error) {
 	// Get from update records frist
 	value, err = us.Dirty.Get(key)
 	if IsErrNotFound(err) {
+		if us.isDeleted(key) {
+			return nil, ErrNotExist
+		}
 		// Try get from snapshot
 		return us.Snapshot.Get(key)
 	}
@@ -102,17 +111,113 @@ func (us *UnionStore) Get(key []byte) (value []byte, err error) {
 	return value, nil
 }
 
+// BatchGet implements the Snapshot BatchGet interface.
+func (us *UnionStore) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	m := make(map[string][]byte, len(keys))
+	// Read the keys which are not in the update records from snapshot together.
+	var missKeys [][]byte
+	for _, k := range keys {
+		value, err := us.Dirty.Get(k)
+		if IsErrNotFound(err) {
+			if !us.isDeleted(k) {
+				missKeys = append(missKeys, k)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(value) != 0 { // Skip deleted marker
+			m[string(k)] = value
+		}
+	}
+	if len(missKeys) == 0 {
+		return m, nil
+	}
+
+	values, err := us.Snapshot.BatchGet(missKeys)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		m[k] = v
+	}
+	return m, nil
+}
+
 // Set implements the Store Set interface.
 func (us *UnionStore) Set(key []byte, value []byte) error {
-	return us.Dirty.Put(key, value)
+	if err := us.Dirty.Put(key, value); err != nil {
+		return err
+	}
+	return us.checkLimit()
+}
+
+// checkLimit returns ErrTxnTooLarge if Dirty exceeds the limits.
+func (us *UnionStore) checkLimit() error {
+	if us.EntryLimit > 0 && us.Dirty.Len() > us.EntryLimit {
+		return errors.Annotatef(ErrTxnTooLarge, "%d entries exceed tidb_txn_entry_limit %d", us.Dirty.Len(), us.EntryLimit)
+	}
+	if us.SizeLimit > 0 && us.Dirty.Size() > us.SizeLimit {
+		return errors.Annotatef(ErrTxnTooLarge, "%d bytes exceed tidb_txn_size_limit %d", us.Dirty.Size(), us.SizeLimit)
+	}
+	return nil
+}
+
+// BufferLen implements the TxnBufferReporter BufferLen interface.
+func (us *UnionStore) BufferLen() int {
+	return us.Dirty.Len()
+}
+
+// BufferSize implements the TxnBufferReporter BufferSize interface.
+func (us *UnionStore) BufferSize() int {
+	return us.Dirty.Size()
 }
 
 // Seek implements the Snapshot Seek interface.
 func (us *UnionStore) Seek(key []byte, txn Transaction) (Iterator, error) {
-	snapshotIt := us.Snapshot.NewIterator(key)
+	snapshotIt, err := us.Snapshot.NewIterator(key)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotIt, err = us.hideDeleted(snapshotIt); err != nil {
+		return nil, err
+	}
 	dirtyIt := us.Dirty.NewIterator(&util.Range{Start: key})
 	it := newUnionIter(dirtyIt, snapshotIt)
-	return it, nil
+	return it.checkErr()
+}
+
+// Scan implements the Snapshot Scan interface.
+func (us *UnionStore) Scan(start, end []byte, limit int) (Iterator, error) {
+	// The limit can't be pushed down to the snapshot, some of its entries may be
+	// overridden or deleted by the dirty data.
+	snapshotIt, err := us.Snapshot.Scan(start, end, 0)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotIt, err = us.hideDeleted(snapshotIt); err != nil {
+		return nil, err
+	}
+	dirtyIt := us.Dirty.NewIterator(&util.Range{Start: start, Limit: end})
+	it := newUnionIter(dirtyIt, snapshotIt)
+	it.limit = limit
+	it.checkLimit()
+	return it.checkErr()
+}
+
+// SeekReverse implements the Snapshot SeekReverse interface.
+func (us *UnionStore) SeekReverse(key []byte, txn Transaction) (Iterator, error) {
+	snapshotIt, err := us.Snapshot.NewReverseIterator(key)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotIt, err = us.hideDeleted(snapshotIt); err != nil {
+		return nil, err
+	}
+	dirtyIt := us.Dirty.NewIterator(&util.Range{Limit: key})
+	it := newUnionReverseIter(dirtyIt, snapshotIt)
+	return it.checkErr()
 }
 
 // Delete implements the Store Delete interface.
@@ -125,6 +230,9 @@ func (us *UnionStore) Delete(k []byte) error {
 		}
 
 		// miss in dirty
+		if us.isDeleted(k) {
+			return ErrNotExist
+		}
 		val, err = us.Snapshot.Get(k)
 		if err != nil {
 			if IsErrNotFound(err) {
@@ -137,7 +245,78 @@ func (us *UnionStore) Delete(k []byte) error {
 		return ErrNotExist
 	}
 
-	return us.Dirty.Put(k, nil)
+	if err = us.Dirty.Put(k, nil); err != nil {
+		return err
+	}
+	return us.checkLimit()
+}
+
+// DeleteRange deletes the keys in [start, end), the keys in Dirty are removed,
+// and the keys in Snapshot are hidden.
+func (us *UnionStore) DeleteRange(start, end []byte) error {
+	var keys [][]byte
+	it := us.Dirty.NewIterator(&util.Range{Start: start, Limit: end})
+	for it.Next() {
+		keys = append(keys, append([]byte(nil), it.Key()...))
+	}
+	it.Release()
+	for _, k := range keys {
+		if err := us.Dirty.Delete(k); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	us.DeletedRanges = append(us.DeletedRanges, KeyRange{StartKey: start, EndKey: end})
+	return nil
+}
+
+func (us *UnionStore) isDeleted(k []byte) bool {
+	for _, r := range us.DeletedRanges {
+		if r.Contains(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// hideDeleted wraps it to skip the keys in DeletedRanges.
+func (us *UnionStore) hideDeleted(it Iterator) (Iterator, error) {
+	if len(us.DeletedRanges) == 0 {
+		return it, nil
+	}
+	dit := &deletedRangeIter{Iterator: it, us: us}
+	if err := dit.skip(); err != nil {
+		it.Close()
+		return nil, errors.Trace(err)
+	}
+	return dit, nil
+}
+
+// deletedRangeIter is an iterator on the Snapshot of an UnionStore, which skips
+// the keys in the DeletedRanges.
+type deletedRangeIter struct {
+	Iterator
+	us *UnionStore
+}
+
+func (it *deletedRangeIter) skip() error {
+	for it.Iterator.Valid() && it.us.isDeleted([]byte(it.Iterator.Key())) {
+		next, err := it.Iterator.Next(nil)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		it.Iterator = next
+	}
+	return nil
+}
+
+// Next implements the Iterator Next interface.
+func (it *deletedRangeIter) Next(fn FnKeyCmp) (Iterator, error) {
+	next, err := it.Iterator.Next(fn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	it.Iterator = next
+	return it, errors.Trace(it.skip())
 }
 
 // Close implements the Store Close interface.
@@ -26,6 +26,17 @@ type ColumnInfo struct {
 	Offset          int         `json:"offset"`
 	DefaultValue    interface{} `json:"default"` // Default Value.
 	types.FieldType `json:"type"`
+	// GeneratedExprString is the expression of a generated column, empty if
+	// the column is not generated.
+	GeneratedExprString string `json:"generated_expr"`
+	// GeneratedStored is true if the values of the generated column are
+	// stored, they are evaluated on read if it is false.
+	GeneratedStored bool `json:"generated_stored"`
+}
+
+// IsGenerated returns true if the column is a generated column.
+func (c *ColumnInfo) IsGenerated() bool {
+	return c.GeneratedExprString != ""
 }
 
 // TableInfo provides meta data describing a DB table.
@@ -38,8 +49,74 @@ type TableInfo struct {
 	// Columns are listed in the order in which they appear in the schema.
 	Columns []*ColumnInfo `json:"cols"`
 	Indices []*IndexInfo  `json:"index_info"`
+	// RowFormat is the format the rows are written in, the tables saved
+	// before it is added are in RowFormatColumns.
+	RowFormat int `json:"row_format"`
+	// PKIsHandle is true if the primary key is a single integer column, its
+	// values are the row handles and there is no index for it.
+	PKIsHandle bool `json:"pk_is_handle"`
+	// Partition is the partitioning of the table, nil if the table is not partitioned.
+	Partition *PartitionInfo `json:"partition"`
+	// Temporary is true if the table is a temporary table of a session, it is never saved.
+	Temporary bool `json:"-"`
+}
+
+// Partition types.
+const (
+	PartitionTypeRange = iota + 1
+	PartitionTypeHash
+)
+
+// PartitionDefinition provides meta data describing a partition, every
+// partition stores its rows and indices under its own ID.
+type PartitionDefinition struct {
+	ID   int64 `json:"id"`
+	Name CIStr `json:"name"`
+	// LessThan is the exclusive upper bound of a RANGE partition, it is
+	// unbounded if MaxValue is true.
+	LessThan int64 `json:"less_than"`
+	MaxValue bool  `json:"max_value"`
 }
 
+// PartitionInfo provides meta data describing the partitioning of a table.
+// It corresponds to the `PARTITION BY` clause of `CREATE TABLE`.
+// See: https://dev.mysql.com/doc/refman/5.7/en/partitioning-types.html
+type PartitionInfo struct {
+	Type int `json:"type"`
+	// Expr is the partitioning expression whose value is an integer.
+	Expr string `json:"expr"`
+	// Columns are the columns Expr mentions.
+	Columns []CIStr `json:"columns"`
+	// Definitions are ordered by their bounds for RANGE partitioning.
+	Definitions []*PartitionDefinition `json:"definitions"`
+}
+
+// Locate returns the offset of the partition in Definitions which the value v
+// of the partitioning expression belongs to, -1 if there is no such partition.
+func (pi *PartitionInfo) Locate(v int64) int {
+	if pi.Type == PartitionTypeHash {
+		n := v % int64(len(pi.Definitions))
+		if n < 0 {
+			n = -n
+		}
+		return int(n)
+	}
+	for i, def := range pi.Definitions {
+		if def.MaxValue || v < def.LessThan {
+			return i
+		}
+	}
+	return -1
+}
+
+// Row formats.
+const (
+	// RowFormatColumns stores a row as a lock key and a key for every column.
+	RowFormatColumns = iota
+	// RowFormatCompact stores all the columns of a row in the row key.
+	RowFormatCompact
+)
+
 // IndexColumn provides index column info.
 type IndexColumn struct {
 	Name   CIStr `json:"name"`   // Index name
@@ -162,6 +162,20 @@ func checkDefaultValue(c *column.Col, hasDefaultValue bool) error {
 	return nil
 }
 
+// checkGeneratedColumn checks the generated column c has no other way to get its values.
+func checkGeneratedColumn(c *column.Col, hasDefaultValue bool, setOnUpdateNow bool) error {
+	if hasDefaultValue {
+		return errors.Errorf("generated column %s can't have a default value", c.Name)
+	}
+	if setOnUpdateNow {
+		return errors.Errorf("generated column %s can't have ON UPDATE", c.Name)
+	}
+	if mysql.HasAutoIncrementFlag(c.Flag) {
+		return errors.Errorf("generated column %s can't be AUTO_INCREMENT", c.Name)
+	}
+	return nil
+}
+
 // ColumnDefToCol converts converts ColumnDef to Col and TableConstraints.
 func ColumnDefToCol(offset int, colDef *ColumnDef) (*column.Col, []*TableConstraint, error) {
 	constraints := []*TableConstraint{}
@@ -242,15 +256,26 @@ func ColumnDefToCol(offset int, colDef *ColumnDef) (*column.Col, []*TableConstra
 				setOnUpdateNow = true
 			case ConstrFulltext:
 				// Do nothing.
+			case ConstrGenerated:
+				col.GeneratedExprString = v.Evalue.String()
+				col.GeneratedStored = v.Bvalue
 			}
 		}
 	}
 
-	setTimestampDefaultValue(col, hasDefaultValue, setOnUpdateNow)
-
-	// Set `NoDefaultValueFlag` if this field doesn't have a default value and
-	// it is `not null` and not an `AUTO_INCREMENT` field or `TIMESTAMP` field.
-	setNoDefaultValueFlag(col, hasDefaultValue)
+	if col.IsGenerated() {
+		if err := checkGeneratedColumn(col, hasDefaultValue, setOnUpdateNow); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		// The values of a generated column are always computed, it has no default value.
+		col.Flag &= ^uint(mysql.OnUpdateNowFlag)
+	} else {
+		setTimestampDefaultValue(col, hasDefaultValue, setOnUpdateNow)
+
+		// Set `NoDefaultValueFlag` if this field doesn't have a default value and
+		// it is `not null` and not an `AUTO_INCREMENT` field or `TIMESTAMP` field.
+		setNoDefaultValueFlag(col, hasDefaultValue)
+	}
 
 	err := checkDefaultValue(col, hasDefaultValue)
 	if err != nil {
@@ -71,6 +71,11 @@ func (c *ConstraintOpt) String() string {
 		return "DEFAULT " + c.Evalue.String()
 	case ConstrOnUpdate:
 		return "ON UPDATE " + c.Evalue.String()
+	case ConstrGenerated:
+		if c.Bvalue {
+			return "AS (" + c.Evalue.String() + ") STORED"
+		}
+		return "AS (" + c.Evalue.String() + ") VIRTUAL"
 	default:
 		return ""
 	}
@@ -105,6 +110,7 @@ const (
 	ConstrNull
 	ConstrOnUpdate
 	ConstrFulltext
+	ConstrGenerated
 )
 
 // LockType is select lock type.
@@ -124,6 +130,7 @@ const (
 	TblOptCharset
 	TblOptCollate
 	TblOptAutoIncrement
+	TblOptRowFormat
 )
 
 // TableOpt is used for parsing table option from SQL.
@@ -140,6 +147,7 @@ type TableOption struct {
 	Charset       string
 	Collate       string
 	AutoIncrement uint64 // TODO: apply this value to autoid.Allocator.
+	RowFormat     string
 }
 
 // String implements fmt.Stringer interface.
@@ -157,6 +165,10 @@ func (o *TableOption) String() string {
 		x := fmt.Sprintf("COLLATE=%s", o.Collate)
 		strs = append(strs, x)
 	}
+	if o.RowFormat != "" {
+		x := fmt.Sprintf("ROW_FORMAT=%s", o.RowFormat)
+		strs = append(strs, x)
+	}
 
 	return strings.Join(strs, " ")
 }
@@ -221,3 +233,47 @@ func (tc *TableConstraint) String() string {
 	}
 	return strings.Join(tokens, " ")
 }
+
+// Partition types.
+const (
+	PartitionRange = iota + 1
+	PartitionHash
+)
+
+// PartitionDefinition is the definition of a RANGE partition.
+type PartitionDefinition struct {
+	Name string
+	// LessThan is the exclusive upper bound of the partition, nil for MAXVALUE.
+	LessThan expression.Expression
+}
+
+// String implements fmt.Stringer interface.
+func (pd *PartitionDefinition) String() string {
+	if pd.LessThan == nil {
+		return fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", pd.Name)
+	}
+	return fmt.Sprintf("PARTITION %s VALUES LESS THAN (%s)", pd.Name, pd.LessThan)
+}
+
+// PartitionOption is the `PARTITION BY` clause of a table definition.
+// See: https://dev.mysql.com/doc/refman/5.7/en/create-table.html
+type PartitionOption struct {
+	Tp   int
+	Expr expression.Expression
+	// Num is the number of HASH partitions.
+	Num uint64
+	// Definitions are the partitions of RANGE partitioning.
+	Definitions []*PartitionDefinition
+}
+
+// String implements fmt.Stringer interface.
+func (po *PartitionOption) String() string {
+	if po.Tp == PartitionHash {
+		return fmt.Sprintf("PARTITION BY HASH (%s) PARTITIONS %d", po.Expr, po.Num)
+	}
+	defs := make([]string, 0, len(po.Definitions))
+	for _, pd := range po.Definitions {
+		defs = append(defs, pd.String())
+	}
+	return fmt.Sprintf("PARTITION BY RANGE (%s) (%s)", po.Expr, strings.Join(defs, ", "))
+}
@@ -68,6 +68,7 @@ import (
 	after		"AFTER"
 	all 		"ALL"
 	alter		"ALTER"
+	always		"ALWAYS"
 	and		"AND"
 	andand		"&&"
 	andnot		"&^"
@@ -130,6 +131,7 @@ import (
 	full		"FULL"
 	fulltext	"FULLTEXT"
 	ge		">="
+	generated	"GENERATED"
 	global		"GLOBAL"
 	group		"GROUP"
 	groupConcat	"GROUP_CONCAT"
@@ -137,6 +139,7 @@ import (
 	highPriority	"HIGH_PRIORITY"
 	hour		"HOUR"
 	ignore		"IGNORE"
+	hash		"HASH"
 	ifKwd		"IF"
 	ifNull		"IFNULL"
 	in		"IN"
@@ -150,6 +153,7 @@ import (
 	le		"<="
 	left		"LEFT"
 	length		"LENGTH"
+	less		"LESS"
 	like		"LIKE"
 	limit		"LIMIT"
 	local		"LOCAL"
@@ -157,6 +161,7 @@ import (
 	lowPriority	"LOW_PRIORITY"
 	lsh		"<<"
 	max		"MAX"
+	maxValue	"MAXVALUE"
 	microsecond	"MICROSECOND"
 	min		"MIN"
 	minute		"MINUTE"
@@ -176,11 +181,15 @@ import (
 	order		"ORDER"
 	oror		"||"
 	outer		"OUTER"
+	partition	"PARTITION"
+	partitions	"PARTITIONS"
 	password	"PASSWORD"
 	placeholder	"PLACEHOLDER"
 	prepare		"PREPARE"
 	primary		"PRIMARY"
+	processlist	"PROCESSLIST"
 	quick		"QUICK"
+	rangeKwd	"RANGE"
 	references	"REFERENCES"
 	regexp		"REGEXP"
 	repeat		"REPEAT"
@@ -188,6 +197,7 @@ import (
 	rlike		"RLIKE"
 	rollback	"ROLLBACK"
 	row 		"ROW"
+	rowFormat	"ROW_FORMAT"
 	rsh		">>"
 	schema		"SCHEMA"
 	schemas		"SCHEMAS"
@@ -200,12 +210,15 @@ import (
 	signed		"SIGNED"
 	some 		"SOME"
 	start		"START"
+	stored		"STORED"
 	stringType	"string"
 	substring	"SUBSTRING"
 	sum		"SUM"
 	sysVar		"SYS_VAR"
 	tableKwd	"TABLE"
 	tables		"TABLES"
+	temporary	"TEMPORARY"
+	than		"THAN"
 	then		"THEN"
 	transaction	"TRANSACTION"
 	trueKwd		"true"
@@ -220,6 +233,7 @@ import (
 	userVar		"USER_VAR"
 	value		"VALUE"
 	values		"VALUES"
+	virtual		"VIRTUAL"
 	variables	"VARIABLES"
 	warnings	"WARNINGS"
 	week		"WEEK"
@@ -362,6 +376,8 @@ import (
 	FunctionCallKeyword	"Function call with keyword as function name"
 	FunctionCallNonKeyword	"Function call with nonkeyword as function name"
 	FunctionNameConflict	"Built-in function call names which are conflict with keywords"
+	GeneratedAlwaysOpt	"GENERATED ALWAYS or empty"
+	GeneratedStoredOpt	"VIRTUAL, STORED or empty"
 	GlobalScope		"The scope of variable"
 	GroupByClause		"GROUP BY clause"
 	GroupByList		"GROUP BY list"
@@ -400,6 +416,12 @@ import (
 	OuterOpt		"optional OUTER clause"
 	QualifiedIdent		"qualified identifier"
 	QuickOptional		"QUICK or empty"
+	PartitionDefinition	"RANGE partition definition"
+	PartitionDefinitionList	"RANGE partition definition list"
+	PartitionLessThan	"RANGE partition upper bound"
+	PartitionNameList	"partition name list"
+	PartitionNumOpt		"optional number of HASH partitions"
+	PartitionOpt		"optional PARTITION BY clause"
 	PasswordOpt		"Password option"
 	ColumnPosition		"Column position [First|After ColumnName]"
 	PreparedStmt		"PreparedStmt"
@@ -445,6 +467,7 @@ import (
 	TableOptListOpt		"create table option list opt"
 	TableRef 		"table reference"
 	TableRefs 		"table references"
+	TemporaryOpt		"TEMPORARY or empty"
 	TruncateTableStmt	"TRANSACTION TABLE statement"
 	UnionOpt		"Union Option(empty/ALL/DISTINCT)"
 	UnionStmt		"Union statement"
@@ -610,6 +633,27 @@ AlterSpecification:
 			Name: $4.(string),
 		}
 	}
+|	"ADD" "PARTITION" '(' PartitionDefinitionList ')'
+	{
+		$$ = &ddl.AlterSpecification{
+			Action: ddl.AlterAddPartition,
+			Partitions: $4.([]*coldef.PartitionDefinition),
+		}
+	}
+|	"DROP" "PARTITION" PartitionNameList
+	{
+		$$ = &ddl.AlterSpecification{
+			Action: ddl.AlterDropPartition,
+			PartitionNames: $3.([]string),
+		}
+	}
+|	"TRUNCATE" "PARTITION" PartitionNameList
+	{
+		$$ = &ddl.AlterSpecification{
+			Action: ddl.AlterTruncatePartition,
+			PartitionNames: $3.([]string),
+		}
+	}
 
 KeyOrIndex:
 	"KEY"|"INDEX"
@@ -764,6 +808,27 @@ Constraint:
 	{
 		$$ = &coldef.ConstraintOpt{Tp: coldef.ConstrOnUpdate, Evalue: $3.(expression.Expression)}
 	}
+|	GeneratedAlwaysOpt "AS" '(' Expression ')' GeneratedStoredOpt
+	{
+		$$ = &coldef.ConstraintOpt{Tp: coldef.ConstrGenerated, Evalue: $4.(expression.Expression), Bvalue: $6.(bool)}
+	}
+
+GeneratedAlwaysOpt:
+	{}
+|	"GENERATED" "ALWAYS"
+
+GeneratedStoredOpt:
+	{
+		$$ = false
+	}
+|	"VIRTUAL"
+	{
+		$$ = false
+	}
+|	"STORED"
+	{
+		$$ = true
+	}
 
 ConstraintElem:
 	"PRIMARY" "KEY" '(' IndexColNameList ')'
@@ -1069,9 +1134,9 @@ CreateSpecificationList:
  *      )
  *******************************************************************/
 CreateTableStmt:
-	"CREATE" "TABLE" IfNotExists TableIdent '(' TableElementListOpt ')' TableOptListOpt
+	"CREATE" TemporaryOpt "TABLE" IfNotExists TableIdent '(' TableElementListOpt ')' TableOptListOpt PartitionOpt
 	{
-		tes := $6.([]interface {})
+		tes := $7.([]interface {})
 		var columnDefs []*coldef.ColumnDef
 		var tableConstraints []*coldef.TableConstraint
 		for _, te := range tes {
@@ -1088,8 +1153,8 @@ CreateTableStmt:
 		}
 
 		opt := &coldef.TableOption{}
-		if $8 != nil {
-			for _, o := range $8.([]*coldef.TableOpt) {
+		if $9 != nil {
+			for _, o := range $9.([]*coldef.TableOpt) {
 				switch o.Tp {
 				case coldef.TblOptEngine:
 					opt.Engine = o.StrValue
@@ -1099,15 +1164,105 @@ CreateTableStmt:
 					opt.Collate = o.StrValue
 				case coldef.TblOptAutoIncrement:
 					opt.AutoIncrement = o.UintValue
+				case coldef.TblOptRowFormat:
+					opt.RowFormat = o.StrValue
 				}
 			}
 		}
-		$$ = &stmts.CreateTableStmt{
-			Ident:          $4.(table.Ident),
-			IfNotExists:    $3.(bool),
+		ct := &stmts.CreateTableStmt{
+			Ident:          $5.(table.Ident),
+			IfNotExists:    $4.(bool),
+			Temporary:      $2.(bool),
 			Cols:           columnDefs, 
 			Constraints:    tableConstraints,
 			Opt:            opt}
+		if $10 != nil {
+			ct.Partition = $10.(*coldef.PartitionOption)
+		}
+		$$ = ct
+	}
+
+TemporaryOpt:
+	{
+		$$ = false
+	}
+|	"TEMPORARY"
+	{
+		$$ = true
+	}
+
+PartitionOpt:
+	{
+		$$ = nil
+	}
+|	"PARTITION" "BY" "RANGE" '(' Expression ')' '(' PartitionDefinitionList ')'
+	{
+		$$ = &coldef.PartitionOption{
+			Tp:          coldef.PartitionRange,
+			Expr:        $5.(expression.Expression),
+			Definitions: $8.([]*coldef.PartitionDefinition),
+		}
+	}
+|	"PARTITION" "BY" "HASH" '(' Expression ')' PartitionNumOpt
+	{
+		$$ = &coldef.PartitionOption{
+			Tp:   coldef.PartitionHash,
+			Expr: $5.(expression.Expression),
+			Num:  $7.(uint64),
+		}
+	}
+
+PartitionNumOpt:
+	{
+		$$ = uint64(1)
+	}
+|	"PARTITIONS" LengthNum
+	{
+		$$ = $2
+	}
+
+PartitionDefinitionList:
+	PartitionDefinition
+	{
+		$$ = []*coldef.PartitionDefinition{$1.(*coldef.PartitionDefinition)}
+	}
+|	PartitionDefinitionList ',' PartitionDefinition
+	{
+		$$ = append($1.([]*coldef.PartitionDefinition), $3.(*coldef.PartitionDefinition))
+	}
+
+PartitionDefinition:
+	"PARTITION" Identifier "VALUES" "LESS" "THAN" PartitionLessThan
+	{
+		pd := &coldef.PartitionDefinition{Name: $2.(string)}
+		if $6 != nil {
+			pd.LessThan = $6.(expression.Expression)
+		}
+		$$ = pd
+	}
+
+PartitionLessThan:
+	"MAXVALUE"
+	{
+		$$ = nil
+	}
+|	'(' "MAXVALUE" ')'
+	{
+		$$ = nil
+	}
+|	'(' Expression ')'
+	{
+		$$ = $2
+	}
+
+PartitionNameList:
+	Identifier
+	{
+		$$ = []string{$1.(string)}
+	}
+|	PartitionNameList ',' Identifier
+	{
+		$$ = append($1.([]string), $3.(string))
 	}
 
 Default:
@@ -1226,16 +1381,16 @@ DropIndexStmt:
 	}
 
 DropTableStmt:
-	"DROP" "TABLE" TableIdentList
+	"DROP" TemporaryOpt "TABLE" TableIdentList
 	{
-		$$ = &stmts.DropTableStmt{TableIdents: $3.([]table.Ident)}
+		$$ = &stmts.DropTableStmt{Temporary: $2.(bool), TableIdents: $4.([]table.Ident)}
 		if yylex.(*lexer).root {
 			break
 		}
 	}
-|	"DROP" "TABLE" "IF" "EXISTS" TableIdentList
+|	"DROP" TemporaryOpt "TABLE" "IF" "EXISTS" TableIdentList
 	{
-		$$ = &stmts.DropTableStmt{IfExists: true, TableIdents: $5.([]table.Ident)}
+		$$ = &stmts.DropTableStmt{IfExists: true, Temporary: $2.(bool), TableIdents: $6.([]table.Ident)}
 		if yylex.(*lexer).root {
 			break
 		}
@@ -1590,9 +1745,9 @@ Identifier:
 UnReservedKeyword:
 	"AUTO_INCREMENT" | "AFTER" | "AVG" | "BEGIN" | "BIT" | "BOOL" | "BOOLEAN" | "CHARSET" | "COLUMNS" | "COMMIT" 
 |	"DATE" | "DATETIME" | "DEALLOCATE" | "DO" | "END" | "ENGINE" | "ENGINES" | "EXECUTE" | "FIRST" | "FULL" 
-|	"LOCAL" | "NAMES" | "OFFSET" | "PASSWORD" %prec lowerThanEq | "PREPARE" | "QUICK" | "ROLLBACK" | "SESSION" | "SIGNED" 
-|	"START" | "GLOBAL" | "TABLES"| "TEXT" | "TIME" | "TIMESTAMP" | "TRANSACTION" | "TRUNCATE" | "UNKNOWN" 
-|	"VALUE" | "WARNINGS" | "YEAR" |	"MODE" | "WEEK" | "ANY" | "SOME"
+|	"HASH" | "LESS" | "LOCAL" | "NAMES" | "OFFSET" | "PARTITIONS" | "PASSWORD" %prec lowerThanEq | "PREPARE" | "PROCESSLIST" | "QUICK" | "ROLLBACK" | "ROW_FORMAT" | "SESSION" | "SIGNED" 
+|	"START" | "GLOBAL" | "TABLES"| "TEMPORARY" | "TEXT" | "THAN" | "TIME" | "TIMESTAMP" | "TRANSACTION" | "TRUNCATE" | "UNKNOWN" 
+|	"VALUE" | "WARNINGS" | "YEAR" |	"MODE" | "WEEK" | "ANY" | "SOME" | "ALWAYS" | "GENERATED" | "STORED" | "VIRTUAL"
 
 NotKeywordToken:
 	"ABS" | "COALESCE" | "CONCAT" | "CONCAT_WS" | "COUNT" | "DAY" | "DAYOFMONTH" | "DAYOFWEEK" | "DAYOFYEAR" | "FOUND_ROWS" | "GROUP_CONCAT" 
@@ -3063,6 +3218,13 @@ ShowStmt:
 	{
 		$$ = &stmts.ShowStmt{Target: stmt.ShowWarnings}
 	}
+|	"SHOW" OptFull "PROCESSLIST"
+	{
+		$$ = &stmts.ShowStmt{
+			Target: stmt.ShowProcessList,
+			Full:   $2.(bool),
+		}
+	}
 // See: https://dev.mysql.com/doc/refman/5.7/en/show-variables.html
 // TODO: Support show variables with where clause. 
 |	"SHOW" GlobalScope "VARIABLES"
@@ -3245,6 +3407,10 @@ TableOpt:
 	{
 		$$ = &coldef.TableOpt{Tp: coldef.TblOptAutoIncrement, UintValue: $3.(uint64)}
 	}
+|	"ROW_FORMAT" EqOpt Identifier
+	{
+		$$ = &coldef.TableOpt{Tp: coldef.TblOptRowFormat, StrValue: $3.(string)}
+	}
 
 TableOptListOpt:
 	{
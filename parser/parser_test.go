@@ -230,6 +230,29 @@ func (s *testParserSuite) TestParser0(c *C) {
 		{"ALTER TABLE t ADD COLUMN a SMALLINT UNSIGNED", true},
 		{"ALTER TABLE t ADD COLUMN a SMALLINT UNSIGNED FIRST", true},
 		{"ALTER TABLE t ADD COLUMN a SMALLINT UNSIGNED AFTER b", true},
+		{"ALTER TABLE t ROW_FORMAT = COMPACT", true},
+		{"ALTER TABLE t ROW_FORMAT REDUNDANT", true},
+		{"ALTER TABLE t ROW_FORMAT =", false},
+		{"CREATE TABLE t (a int) ROW_FORMAT = REDUNDANT", true},
+		{"CREATE TABLE t (a int) PARTITION BY RANGE (a) (PARTITION p0 VALUES LESS THAN (10), PARTITION p1 VALUES LESS THAN MAXVALUE)", true},
+		{"CREATE TABLE t (a int, d datetime) PARTITION BY RANGE (year(d)) (PARTITION p0 VALUES LESS THAN (2000))", true},
+		{"CREATE TABLE t (a int) PARTITION BY RANGE (a) ()", false},
+		{"CREATE TABLE t (a int) PARTITION BY HASH (a) PARTITIONS 4", true},
+		{"CREATE TABLE t (a int) PARTITION BY HASH (a % 3)", true},
+		{"CREATE TABLE t (a int) PARTITION BY HASH (a) PARTITIONS", false},
+		{"ALTER TABLE t ADD PARTITION (PARTITION p2 VALUES LESS THAN (30))", true},
+		{"ALTER TABLE t DROP PARTITION p0, p1", true},
+		{"ALTER TABLE t TRUNCATE PARTITION p0", true},
+		{"ALTER TABLE t DROP PARTITION", false},
+		{"CREATE TABLE hash (partitions int, less int, than int)", true},
+		{"CREATE TEMPORARY TABLE IF NOT EXISTS t (a int, KEY idx_a (a))", true},
+		{"CREATE TEMPORARY t (a int)", false},
+		{"DROP TEMPORARY TABLE IF EXISTS t1, t2", true},
+		{"CREATE TABLE temporary (temporary int)", true},
+		{"CREATE TABLE t (a int, b int AS (a + 1), c int GENERATED ALWAYS AS (a * 2) VIRTUAL, d int AS (b + c) STORED NOT NULL)", true},
+		{"CREATE TABLE t (a int, b int AS a + 1)", false},
+		{"CREATE TABLE t (a int, b int GENERATED AS (a + 1))", false},
+		{"CREATE TABLE stored (virtual int, generated int, always int)", true},
 
 		// from join
 		{"SELECT * from t1, t2, t3", true},
@@ -287,6 +310,8 @@ func (s *testParserSuite) TestParser0(c *C) {
 		{"SHOW SESSION VARIABLES LIKE 'character_set_results'", true},
 		{"SHOW VARIABLES", true},
 		{"SHOW GLOBAL VARIABLES", true},
+		{"SHOW PROCESSLIST", true},
+		{"SHOW FULL PROCESSLIST", true},
 
 		// For compare subquery
 		{"SELECT 1 > (select 1)", true},
@@ -342,7 +367,7 @@ func (s *testParserSuite) TestParser0(c *C) {
 	unreservedKws := []string{
 		"auto_increment", "after", "begin", "bit", "bool", "boolean", "charset", "columns", "commit",
 		"date", "datetime", "deallocate", "do", "end", "engine", "engines", "execute", "first", "full",
-		"local", "names", "offset", "password", "prepare", "quick", "rollback", "session", "signed",
+		"local", "names", "offset", "password", "prepare", "processlist", "quick", "rollback", "session", "signed",
 		"start", "global", "tables", "text", "time", "timestamp", "transaction", "truncate", "unknown",
 		"value", "warnings", "year", "now", "substring", "mode", "any", "some",
 	}
@@ -13,7 +13,30 @@
 
 package parser
 
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/stmt/stmts"
+)
+
 // YYParse is an wrapper of `yyParse` to make it exported.
 func YYParse(yylex yyLexer) int {
 	return yyParse(yylex)
 }
+
+// ParseExpr parses an expression, e.g. the partitioning expression of a table.
+func ParseExpr(src string) (expression.Expression, error) {
+	l := NewLexer("SELECT " + src)
+	if yyParse(l) != 0 {
+		return nil, errors.Trace(l.Errors()[0])
+	}
+	sms := l.Stmts()
+	if len(sms) != 1 {
+		return nil, errors.Errorf("invalid expression %s", src)
+	}
+	s, ok := sms[0].(*stmts.SelectStmt)
+	if !ok || len(s.Fields) != 1 || s.From != nil {
+		return nil, errors.Errorf("invalid expression %s", src)
+	}
+	return s.Fields[0].Expr, nil
+}
@@ -32,7 +32,6 @@ import (
 	"github.com/pingcap/tidb/table"
 	"github.com/pingcap/tidb/util"
 	"github.com/pingcap/tidb/util/format"
-	"github.com/pingcap/tidb/util/types"
 )
 
 var (
@@ -65,7 +64,7 @@ func (r *TableNilPlan) Filter(ctx context.Context, expr expression.Expression) (
 func (r *TableNilPlan) Next(ctx context.Context) (row *plan.Row, err error) {
 	if r.iter == nil {
 		var txn kv.Transaction
-		txn, err = ctx.GetTxn(false)
+		txn, err = r.T.GetTxn(ctx)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -127,27 +126,35 @@ func (r *TableDefaultPlan) filterBinOp(ctx context.Context, x *expressions.Binar
 		return nil, false, errors.Errorf("No such column: %s", cn)
 	}
 
+	pk := t.PKHandleCol()
 	ix := t.FindIndexByColName(cn)
-	if ix == nil { // Column cn has no index.
+	if ix == nil && pk != c { // Column cn has no index.
 		return r, false, nil
 	}
 
-	if rval, err = types.Convert(rval, &c.FieldType); err != nil {
-		return nil, false, err
-	}
-
 	if rval == nil {
 		// if nil, any <, <=, >, >=, =, != operator will do nothing
 		// any value compared null returns null
 		// TODO: if we support <=> later, we must handle null
 		return &NullPlan{r.GetFields()}, true, nil
 	}
+	spans, err := columnSpans(x.Op, rval, &c.FieldType)
+	if err != nil {
+		return nil, false, err
+	}
+	if pk == c {
+		// The primary key is the handle, the rows are read by their record keys.
+		return &pkPlan{
+			src:   t,
+			spans: spans,
+		}, true, nil
+	}
 	return &indexPlan{
 		src:     t,
 		colName: cn,
 		idxName: ix.Name.O,
 		idx:     ix.X,
-		spans:   toSpans(x.Op, rval),
+		spans:   spans,
 	}, true, nil
 }
 
@@ -266,7 +273,7 @@ func (r *TableDefaultPlan) GetFields() []*field.ResultField {
 func (r *TableDefaultPlan) Next(ctx context.Context) (row *plan.Row, err error) {
 	if r.iter == nil {
 		var txn kv.Transaction
-		txn, err = ctx.GetTxn(false)
+		txn, err = r.T.GetTxn(ctx)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -15,6 +15,7 @@ package plans
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/juju/errors"
 	"github.com/pingcap/tidb/column"
@@ -23,6 +24,7 @@ import (
 	"github.com/pingcap/tidb/expression/expressions"
 	"github.com/pingcap/tidb/field"
 	"github.com/pingcap/tidb/kv"
+	mysql "github.com/pingcap/tidb/mysqldef"
 	"github.com/pingcap/tidb/parser/opcode"
 	"github.com/pingcap/tidb/plan"
 	"github.com/pingcap/tidb/table"
@@ -119,6 +121,9 @@ func (span *indexSpan) cutOffHigh(val interface{}, exclude bool) *indexSpan {
 	}
 }
 
+// maxIndexBatch is the max number of rows an indexPlan reads in one batch.
+const maxIndexBatch = 64
+
 type indexPlan struct {
 	src        table.Table
 	colName    string
@@ -128,6 +133,11 @@ type indexPlan struct {
 	cursor     int
 	skipLowCmp bool
 	iter       kv.IndexIterator
+	// desc is true if the spans are scanned backward, from the greatest value to the least.
+	desc bool
+	// rows are read in batches, batch is the size of the last one.
+	rows  []*plan.Row
+	batch int
 }
 
 // comparison function that takes minNotNullVal and maxVal into account.
@@ -136,7 +146,7 @@ func indexCompare(a interface{}, b interface{}) int {
 		return 0
 	} else if b == nil {
 		return 1
-	} else if b == nil {
+	} else if a == nil {
 		return -1
 	}
 	// a and b both not nil
@@ -168,7 +178,11 @@ func indexCompare(a interface{}, b interface{}) int {
 
 // Explain implements plan.Plan Explain interface.
 func (r *indexPlan) Explain(w format.Formatter) {
-	w.Format("┌Iterate rows of table %q using index %q where %s in ", r.src.TableName(), r.idxName, r.colName)
+	order := ""
+	if r.desc {
+		order = " backward"
+	}
+	w.Format("┌Iterate rows of table %q%s using index %q where %s in ", r.src.TableName(), order, r.idxName, r.colName)
 	for _, span := range r.spans {
 		open := "["
 		close := "]"
@@ -207,10 +221,11 @@ func (r *indexPlan) Filter(ctx context.Context, expr expression.Expression) (pla
 			break
 		}
 
-		if val, err = types.Convert(val, &col.FieldType); err != nil {
+		spans, err := columnSpans(x.Op, val, &col.FieldType)
+		if err != nil {
 			return nil, false, err
 		}
-		r.spans = filterSpans(r.spans, toSpans(x.Op, val))
+		r.spans = filterSpans(r.spans, spans)
 		return r, true, nil
 	case *expressions.Ident:
 		if r.colName != x.L {
@@ -258,6 +273,39 @@ func filterSpans(origin []*indexSpan, filter []*indexSpan) []*indexSpan {
 	return newSpans
 }
 
+// columnSpans generates a slice of span of the values of a column of type ft
+// which satisfy `column op val`. The value is converted to ft, but a fractional
+// value compared with an integer column is replaced by the integer next to it
+// in the direction of op, so the rounding never leaves out a matching row.
+func columnSpans(op opcode.Op, val interface{}, ft *types.FieldType) ([]*indexSpan, error) {
+	switch ft.Tp {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear:
+		switch val.(type) {
+		case float32, float64, mysql.Decimal, string, []byte:
+			f, err := types.ToFloat64(val)
+			if err != nil || f == math.Trunc(f) {
+				break
+			}
+			switch op {
+			case opcode.EQ:
+				// No integer equals a fractional value.
+				return nil, nil
+			case opcode.NE:
+				return toSpans(opcode.GE, minNotNullVal), nil
+			case opcode.GT, opcode.GE:
+				op, val = opcode.GE, int64(math.Ceil(f))
+			case opcode.LT, opcode.LE:
+				op, val = opcode.LE, int64(math.Floor(f))
+			}
+		}
+	}
+	val, err := types.Convert(val, ft)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return toSpans(op, val), nil
+}
+
 // generate a slice of span from operator and value.
 func toSpans(op opcode.Op, val interface{}) []*indexSpan {
 	var spans []*indexSpan
@@ -310,11 +358,118 @@ func toSpans(op opcode.Op, val interface{}) []*indexSpan {
 	return spans
 }
 
+// ScanIndexDesc makes the rows of p, which are read from a single table, come
+// in the descending order of column col by scanning the index of col backward.
+// It returns false and leaves p unchanged if the rows can't be read that way.
+func ScanIndexDesc(p plan.Plan, col string) bool {
+	return scanIndexDesc(&p, col)
+}
+
+func scanIndexDesc(p *plan.Plan, col string) bool {
+	switch x := (*p).(type) {
+	case *SelectFieldsDefaultPlan:
+		return scanIndexDesc(&x.Src, col)
+	case *SelectLockPlan:
+		return scanIndexDesc(&x.Src, col)
+	case *RowStackFromPlan:
+		return scanIndexDesc(&x.Src, col)
+	case *FilterDefaultPlan:
+		return scanIndexDesc(&x.Plan, col)
+	case *JoinPlan:
+		if x.Right != nil {
+			return false
+		}
+		return scanIndexDesc(&x.Left, col)
+	case *indexPlan:
+		if x.colName != col {
+			return false
+		}
+		x.desc = true
+		return true
+	case *TableDefaultPlan:
+		ix := x.T.FindIndexByColName(col)
+		if ix == nil {
+			return false
+		}
+		*p = &indexPlan{
+			src:     x.T,
+			colName: col,
+			idxName: ix.Name.O,
+			idx:     ix.X,
+			spans:   []*indexSpan{{lowVal: nil, highVal: maxVal}},
+			desc:    true,
+		}
+		return true
+	}
+	return false
+}
+
 // Next implements plan.Plan Next interface.
 func (r *indexPlan) Next(ctx context.Context) (row *plan.Row, err error) {
+	if len(r.rows) == 0 {
+		if err = r.fetchRows(ctx); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(r.rows) == 0 {
+			return
+		}
+	}
+	row = r.rows[0]
+	r.rows = r.rows[1:]
+	return
+}
+
+// fetchRows reads the rows of the next handles in one batch. The batch size
+// doubles from 1 to maxIndexBatch, so a LIMIT reads few rows it doesn't need.
+func (r *indexPlan) fetchRows(ctx context.Context) error {
+	r.batch *= 2
+	if r.batch == 0 {
+		r.batch = 1
+	} else if r.batch > maxIndexBatch {
+		r.batch = maxIndexBatch
+	}
+	var handles []int64
+	for len(handles) < r.batch {
+		var (
+			h   int64
+			ok  bool
+			err error
+		)
+		if r.desc {
+			h, ok, err = r.nextHandleDesc(ctx)
+		} else {
+			h, ok, err = r.nextHandle(ctx)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !ok {
+			break
+		}
+		handles = append(handles, h)
+	}
+	if len(handles) == 0 {
+		return nil
+	}
+	data, err := r.src.Rows(ctx, handles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for i, h := range handles {
+		rowKey := &plan.RowKeyEntry{
+			Tbl: r.src,
+			Key: string(r.src.RecordKey(h, nil)),
+		}
+		r.rows = append(r.rows, &plan.Row{Data: data[i], RowKeys: []*plan.RowKeyEntry{rowKey}})
+	}
+	return nil
+}
+
+// nextHandle returns the handle of the next index entry in the spans.
+func (r *indexPlan) nextHandle(ctx context.Context) (int64, bool, error) {
 	for {
 		if r.cursor == len(r.spans) {
-			return
+			return 0, false, nil
 		}
 		span := r.spans[r.cursor]
 		if r.iter == nil {
@@ -322,21 +477,18 @@ func (r *indexPlan) Next(ctx context.Context) (row *plan.Row, err error) {
 			if span.lowVal == minNotNullVal {
 				seekVal = []byte{}
 			}
-			var txn kv.Transaction
-			txn, err = ctx.GetTxn(false)
+			txn, err := r.src.GetTxn(ctx)
 			if err != nil {
-				return nil, errors.Trace(err)
+				return 0, false, errors.Trace(err)
 			}
 			r.iter, _, err = r.idx.Seek(txn, []interface{}{seekVal})
 			if err != nil {
-				return nil, types.EOFAsNil(err)
+				return 0, false, types.EOFAsNil(err)
 			}
 		}
-		var idxKey []interface{}
-		var h int64
-		idxKey, h, err = r.iter.Next()
+		idxKey, h, err := r.iter.Next()
 		if err != nil {
-			return nil, types.EOFAsNil(err)
+			return 0, false, types.EOFAsNil(err)
 		}
 		val := idxKey[0]
 		if !r.skipLowCmp {
@@ -355,18 +507,48 @@ func (r *indexPlan) Next(ctx context.Context) (row *plan.Row, err error) {
 			r.skipLowCmp = false
 			continue
 		}
-		row = &plan.Row{}
-		row.Data, err = r.src.Row(ctx, h)
+		return h, true, nil
+	}
+}
+
+// nextHandleDesc is nextHandle for a backward scan. The index is scanned from
+// its last entry, the cursor counts the spans finished from the last one, and
+// the entries above the current span are skipped.
+func (r *indexPlan) nextHandleDesc(ctx context.Context) (int64, bool, error) {
+	for r.cursor < len(r.spans) {
+		if r.iter == nil {
+			txn, err := r.src.GetTxn(ctx)
+			if err != nil {
+				return 0, false, errors.Trace(err)
+			}
+			r.iter, err = r.idx.SeekLast(txn)
+			if err != nil {
+				return 0, false, types.EOFAsNil(err)
+			}
+		}
+		idxKey, h, err := r.iter.Next()
 		if err != nil {
-			return nil, errors.Trace(err)
+			return 0, false, types.EOFAsNil(err)
 		}
-		rowKey := &plan.RowKeyEntry{
-			Tbl: r.src,
-			Key: string(r.src.RecordKey(h, nil)),
+		val := idxKey[0]
+		for ; r.cursor < len(r.spans); r.cursor++ {
+			span := r.spans[len(r.spans)-1-r.cursor]
+			cmp := indexCompare(val, span.lowVal)
+			if cmp > 0 || (cmp == 0 && !span.lowExclude) {
+				break
+			}
+		}
+		if r.cursor == len(r.spans) {
+			break
+		}
+		span := r.spans[len(r.spans)-1-r.cursor]
+		cmp := indexCompare(val, span.highVal)
+		if cmp > 0 || (cmp == 0 && span.highExclude) {
+			continue
 		}
-		row.RowKeys = append(row.RowKeys, rowKey)
-		return
+		return h, true, nil
 	}
+	return 0, false, nil
 }
 
 // Close implements plan.Plan Close interface.
@@ -377,5 +559,7 @@ func (r *indexPlan) Close() error {
 	}
 	r.cursor = 0
 	r.skipLowCmp = false
+	r.rows = nil
+	r.batch = 0
 	return nil
 }
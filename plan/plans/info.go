@@ -144,6 +144,7 @@ func buildResultFieldsForColumns() (rfs []*field.ResultField) {
 	rfs = append(rfs, buildResultField(tbName, "EXTRA", mysql.TypeVarchar, 30))
 	rfs = append(rfs, buildResultField(tbName, "PRIVILEGES", mysql.TypeVarchar, 80))
 	rfs = append(rfs, buildResultField(tbName, "COLUMN_COMMENT", mysql.TypeVarchar, 1024))
+	rfs = append(rfs, buildResultField(tbName, "GENERATION_EXPRESSION", mysql.TypeBlob, 589779))
 	for i, f := range rfs {
 		f.Offset = i
 	}
@@ -328,7 +329,7 @@ func (isp *InfoSchemaPlan) fetchTables(schemas []*model.DBInfo) {
 				"BASE_TABLE",        // TABLE_TYPE
 				"InnoDB",            // ENGINE
 				uint64(10),          // VERSION
-				"Compact",           // ROW_FORMAT
+				rowFormat(table),    // ROW_FORMAT
 				uint64(0),           // TABLE_ROWS
 				uint64(0),           // AVG_ROW_LENGTH
 				uint64(16384),       // DATA_LENGTH
@@ -349,6 +350,13 @@ func (isp *InfoSchemaPlan) fetchTables(schemas []*model.DBInfo) {
 	}
 }
 
+func rowFormat(table *model.TableInfo) string {
+	if table.RowFormat == model.RowFormatCompact {
+		return "Compact"
+	}
+	return "Redundant"
+}
+
 func (isp *InfoSchemaPlan) fetchColumns(schemas []*model.DBInfo) {
 	for _, schema := range schemas {
 		for _, table := range schema.Tables {
@@ -364,6 +372,9 @@ func (isp *InfoSchemaPlan) fetchColumns(schemas []*model.DBInfo) {
 				dataType := types.TypeToStr(col.Tp, col.Charset == charset.CharsetBin)
 				columnType := fmt.Sprintf("%s(%d)", dataType, colLen)
 				columnDesc := column.NewColDesc(&column.Col{ColumnInfo: *col})
+				if table.PKIsHandle && mysql.HasPriKeyFlag(col.Flag) {
+					setClustered(columnDesc)
+				}
 				var columnDefault interface{}
 				if columnDesc.DefaultValue != nil {
 					columnDefault = fmt.Sprintf("%v", columnDesc.DefaultValue)
@@ -389,6 +400,7 @@ func (isp *InfoSchemaPlan) fetchColumns(schemas []*model.DBInfo) {
 					columnDesc.Extra,                  // EXTRA
 					"select,insert,update,references", // PRIVILEGES
 					"", // COLUMN_COMMENT
+					col.GeneratedExprString, // GENERATION_EXPRESSION
 				}
 				isp.rows = append(isp.rows, &plan.Row{Data: record})
 			}
@@ -399,6 +411,9 @@ func (isp *InfoSchemaPlan) fetchColumns(schemas []*model.DBInfo) {
 func (isp *InfoSchemaPlan) fetchStatistics(is infoschema.InfoSchema, schemas []*model.DBInfo) {
 	for _, schema := range schemas {
 		for _, table := range schema.Tables {
+			if table.PKIsHandle {
+				isp.fetchClusteredPK(schema, table)
+			}
 			for _, index := range table.Indices {
 				nonUnique := "1"
 				if index.Unique {
@@ -435,6 +450,36 @@ func (isp *InfoSchemaPlan) fetchStatistics(is infoschema.InfoSchema, schemas []*
 	}
 }
 
+// fetchClusteredPK adds the statistics of the primary key whose values are the
+// row handles, it has no index but is reported as a clustered one.
+func (isp *InfoSchemaPlan) fetchClusteredPK(schema *model.DBInfo, table *model.TableInfo) {
+	for _, col := range table.Columns {
+		if !mysql.HasPriKeyFlag(col.Flag) {
+			continue
+		}
+		record := []interface{}{
+			catalogVal,            // TABLE_CATALOG
+			schema.Name.O,         // TABLE_SCHEMA
+			table.Name.O,          // TABLE_NAME
+			"0",                   // NON_UNIQUE
+			schema.Name.O,         // INDEX_SCHEMA
+			column.PrimaryKeyName, // INDEX_NAME
+			1,                     // SEQ_IN_INDEX
+			col.Name.O,            // COLUMN_NAME
+			"A",                   // COLLATION
+			0,                     // CARDINALITY
+			nil,                   // SUB_PART
+			nil,                   // PACKED
+			"",                    // NULLABLE
+			"BTREE",               // INDEX_TYPE
+			"clustered",           // COMMENT
+			"",                    // INDEX_COMMENT
+		}
+		isp.rows = append(isp.rows, &plan.Row{Data: record})
+		return
+	}
+}
+
 func (isp *InfoSchemaPlan) fetchCharacterSets() {
 	for _, record := range characterSetsRecords {
 		isp.rows = append(isp.rows, &plan.Row{Data: record})
@@ -64,11 +64,11 @@ func (r *SelectLockPlan) Next(ctx context.Context) (row *plan.Row, err error) {
 	}
 	if len(row.RowKeys) != 0 && r.Lock == coldef.SelectLockForUpdate {
 		forupdate.SetForUpdate(ctx)
-		txn, err := ctx.GetTxn(false)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
 		for _, k := range row.RowKeys {
+			txn, err := k.Tbl.GetTxn(ctx)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
 			err = txn.LockKeys([]byte(k.Key))
 			if err != nil {
 				return nil, errors.Trace(err)
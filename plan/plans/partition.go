@@ -0,0 +1,337 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plans
+
+import (
+	"math"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/expression/expressions"
+	"github.com/pingcap/tidb/field"
+	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/parser/opcode"
+	"github.com/pingcap/tidb/plan"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/util/format"
+)
+
+var _ plan.Plan = (*PartitionPlan)(nil)
+
+// PartitionPlan iterates the rows of a partitioned table partition by partition,
+// the partitions which can't have the rows matching the filters are pruned.
+// The filters are passed to the plans of the partitions left, so every partition
+// may use its own index.
+type PartitionPlan struct {
+	T      table.Table
+	Fields []*field.ResultField
+	// plans iterate the partitions of the offsets parts in the partitions of T.
+	plans []plan.Plan
+	parts []int
+	// conds are the filters which prune the partitions but are not applied by
+	// plans, the rows of plans are filtered by them.
+	conds  []expression.Expression
+	cursor int
+	cur    plan.Plan
+}
+
+// init creates the plans of all the partitions if the partitions are not pruned.
+func (r *PartitionPlan) init() {
+	if r.plans != nil {
+		return
+	}
+	fields := r.Fields
+	if fields == nil {
+		fields = field.ColsToResultFields(r.T.Cols(), r.T.TableName().O)
+	}
+	for i, p := range r.T.Partitions() {
+		r.plans = append(r.plans, &TableDefaultPlan{T: p, Fields: fields})
+		r.parts = append(r.parts, i)
+	}
+}
+
+// Explain implements the plan.Plan Explain interface.
+func (r *PartitionPlan) Explain(w format.Formatter) {
+	r.init()
+	defs := r.T.Meta().Partition.Definitions
+	names := make([]string, 0, len(r.parts))
+	for _, i := range r.parts {
+		names = append(names, defs[i].Name.O)
+	}
+	w.Format("┌Iterate partitions %s of table %q\n", strings.Join(names, ", "), r.T.TableName())
+	for _, p := range r.plans {
+		p.Explain(w)
+	}
+	for _, cond := range r.conds {
+		w.Format("┌Filter on %v\n", cond)
+	}
+	w.Format("└Output field names %v\n", field.RFQNames(r.GetFields()))
+}
+
+// GetFields implements the plan.Plan GetFields interface.
+func (r *PartitionPlan) GetFields() []*field.ResultField {
+	return r.Fields
+}
+
+// FilterForUpdateAndDelete is for updating and deleting (without checking return
+// columns), in order to check whether the partitions can be pruned or not.
+func (r *PartitionPlan) FilterForUpdateAndDelete(ctx context.Context, expr expression.Expression) (plan.Plan, bool, error) {
+	return r.filter(ctx, expr, false)
+}
+
+// Filter implements plan.Plan Filter interface.
+func (r *PartitionPlan) Filter(ctx context.Context, expr expression.Expression) (plan.Plan, bool, error) {
+	return r.filter(ctx, expr, true)
+}
+
+func (r *PartitionPlan) filter(ctx context.Context, expr expression.Expression, checkColumns bool) (plan.Plan, bool, error) {
+	if checkColumns {
+		colNames := expressions.MentionedColumns(expr)
+		if !field.ContainAllFieldNames(colNames, r.Fields, field.DefaultFieldFlag) {
+			return r, false, nil
+		}
+	}
+	r.init()
+	keep, err := r.prune(ctx, expr)
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	// offsets are the offsets of the plans left.
+	var offsets []int
+	for i, part := range r.parts {
+		if keep == nil || keep[part] {
+			offsets = append(offsets, i)
+		}
+	}
+	pruned := len(offsets) < len(r.plans)
+	if len(offsets) == 0 {
+		return &NullPlan{r.GetFields()}, true, nil
+	}
+
+	np := &PartitionPlan{T: r.T, Fields: r.Fields, conds: r.conds}
+	filtered := true
+	for _, i := range offsets {
+		var (
+			p  plan.Plan
+			ok bool
+		)
+		if tp, isTable := r.plans[i].(*TableDefaultPlan); isTable {
+			p, ok, err = tp.filter(ctx, expr, checkColumns)
+		} else {
+			p, ok, err = r.plans[i].Filter(ctx, expr)
+		}
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		}
+		if !ok {
+			filtered = false
+			break
+		}
+		np.plans = append(np.plans, p)
+		np.parts = append(np.parts, r.parts[i])
+	}
+	if filtered {
+		return np, true, nil
+	}
+	if !pruned {
+		return r, false, nil
+	}
+	// The partitions left are filtered by expr.
+	np.plans, np.parts = nil, nil
+	for _, i := range offsets {
+		np.plans = append(np.plans, r.plans[i])
+		np.parts = append(np.parts, r.parts[i])
+	}
+	np.conds = append(append([]expression.Expression(nil), r.conds...), expr)
+	return np, true, nil
+}
+
+// monotonicFuncs are the functions whose value never decreases when their
+// argument increases, a RANGE partitioning by one of them on a column is pruned
+// with the value of the function at the bounds of the column.
+// TO_DAYS and UNIX_TIMESTAMP are not supported by the builtin functions yet.
+var monotonicFuncs = []string{"year"}
+
+// prune returns whether the partitions of T may have the rows matching expr,
+// it is nil if expr can't prune the partitions. A partitioning expression which
+// is a column prunes the partitions, or which is a monotonic function of a column
+// for RANGE partitioning. Any other partitioning expression of a column only
+// prunes the partitions if the column equals a value.
+func (r *PartitionPlan) prune(ctx context.Context, expr expression.Expression) ([]bool, error) {
+	pi := r.T.Meta().Partition
+	if len(pi.Columns) != 1 {
+		return nil, nil
+	}
+	x, ok := expr.(*expressions.BinaryOperation)
+	if !ok || x.Op == opcode.NullEQ {
+		return nil, nil
+	}
+	ok, cn, val, err := x.IsIdentRelOpVal()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !ok || !strings.EqualFold(cn, pi.Columns[0].O) {
+		return nil, nil
+	}
+	col := column.FindCol(r.T.Cols(), cn)
+	if col == nil {
+		return nil, errors.Errorf("No such column: %s", cn)
+	}
+	keep := make([]bool, len(pi.Definitions))
+	if val == nil {
+		// any value compared null returns null
+		return keep, nil
+	}
+	spans, err := columnSpans(x.Op, val, &col.FieldType)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !strings.EqualFold(pi.Expr, cn) {
+		for _, span := range spans {
+			if !r.pruneByExpr(ctx, col, span, keep) {
+				return nil, nil
+			}
+		}
+		return keep, nil
+	}
+	for _, span := range spans {
+		low, high, ok, err := spanHandles(span)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !ok {
+			continue
+		}
+		if pi.Type == model.PartitionTypeHash {
+			if low != high {
+				return nil, nil
+			}
+			keep[pi.Locate(low)] = true
+			continue
+		}
+		lower := int64(math.MinInt64)
+		for i, def := range pi.Definitions {
+			upper := int64(math.MaxInt64)
+			if !def.MaxValue {
+				upper = def.LessThan - 1
+			}
+			if low <= upper && high >= lower {
+				keep[i] = true
+			}
+			lower = def.LessThan
+		}
+	}
+	return keep, nil
+}
+
+// pruneByExpr marks the partitions which may have the rows whose column col is in
+// span, the partitions are located by the values of the partitioning expression
+// at the bounds of span. It returns false if the partitions can't be pruned.
+func (r *PartitionPlan) pruneByExpr(ctx context.Context, col *column.Col, span *indexSpan, keep []bool) bool {
+	pi := r.T.Meta().Partition
+	point := indexCompare(span.lowVal, span.highVal) == 0 && !span.lowExclude && !span.highExclude
+	if !point && (pi.Type == model.PartitionTypeHash || !isMonotonic(pi.Expr, col.Name.O)) {
+		return false
+	}
+	// The bounds of span are regarded as inclusive, which only keeps more partitions.
+	first, last := 0, len(pi.Definitions)-1
+	if span.lowVal != minNotNullVal {
+		first = r.locate(ctx, col, span.lowVal)
+		if first < 0 {
+			return false
+		}
+	}
+	if point {
+		last = first
+	} else if span.highVal != maxVal {
+		// The partitions after the last one located are kept if it is not located.
+		if i := r.locate(ctx, col, span.highVal); i >= 0 {
+			last = i
+		}
+	}
+	for i := first; i <= last; i++ {
+		keep[i] = true
+	}
+	return true
+}
+
+// locate returns the offset of the partition which has the row whose column col
+// is val, it is -1 if the row can't be located, e.g. the value of the partitioning
+// expression is out of the partitions.
+func (r *PartitionPlan) locate(ctx context.Context, col *column.Col, val interface{}) int {
+	row := make([]interface{}, len(r.T.Cols()))
+	row[col.Offset] = val
+	p, err := r.T.LocatePartition(ctx, row)
+	if err != nil {
+		return -1
+	}
+	for i, def := range r.T.Meta().Partition.Definitions {
+		if def.ID == p.TableID() {
+			return i
+		}
+	}
+	return -1
+}
+
+// isMonotonic returns whether the partitioning expression expr is a monotonic
+// function of column cn.
+func isMonotonic(expr string, cn string) bool {
+	for _, f := range monotonicFuncs {
+		if strings.EqualFold(expr, f+"("+cn+")") {
+			return true
+		}
+	}
+	return false
+}
+
+// Next implements plan.Plan Next interface.
+func (r *PartitionPlan) Next(ctx context.Context) (row *plan.Row, err error) {
+	r.init()
+	for r.cursor < len(r.plans) {
+		if r.cur == nil {
+			r.cur = r.plans[r.cursor]
+			if len(r.conds) > 0 {
+				cond := r.conds[0]
+				for _, c := range r.conds[1:] {
+					cond = expressions.NewBinaryOperation(opcode.AndAnd, cond, c)
+				}
+				r.cur = &FilterDefaultPlan{Plan: r.cur, Expr: cond}
+			}
+		}
+		row, err = r.cur.Next(ctx)
+		if row != nil || err != nil {
+			return row, errors.Trace(err)
+		}
+		if err = r.cur.Close(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		r.cur = nil
+		r.cursor++
+	}
+	return nil, nil
+}
+
+// Close implements plan.Plan Close interface.
+func (r *PartitionPlan) Close() error {
+	var err error
+	if r.cur != nil {
+		err = r.cur.Close()
+		r.cur = nil
+	}
+	r.cursor = 0
+	return errors.Trace(err)
+}
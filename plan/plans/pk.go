@@ -0,0 +1,254 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plans
+
+import (
+	"math"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/expression/expressions"
+	"github.com/pingcap/tidb/field"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/plan"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/util"
+	"github.com/pingcap/tidb/util/format"
+	"github.com/pingcap/tidb/util/types"
+)
+
+var _ plan.Plan = (*pkPlan)(nil)
+
+// pkPlan iterates the rows in the spans of the primary key whose values are
+// the row handles, the rows are read from the record keys directly.
+type pkPlan struct {
+	src    table.Table
+	spans  []*indexSpan // multiple spans are ordered by their values and without overlapping.
+	cursor int
+	iter   kv.Iterator
+	// rows are read in batches, batch is the size of the last one.
+	rows  []*plan.Row
+	batch int
+}
+
+// Explain implements plan.Plan Explain interface.
+func (r *pkPlan) Explain(w format.Formatter) {
+	w.Format("┌Iterate rows of table %q using primary key where %s in ", r.src.TableName(), r.src.PKHandleCol().Name.L)
+	for _, span := range r.spans {
+		open := "["
+		close := "]"
+		if span.lowExclude {
+			open = "("
+		}
+		if span.highExclude {
+			close = ")"
+		}
+		w.Format("%s%v,%v%s ", open, span.lowVal, span.highVal, close)
+	}
+	w.Format("\n└Output field names %v\n", field.RFQNames(r.GetFields()))
+}
+
+// GetFields implements plan.Plan GetFields interface.
+func (r *pkPlan) GetFields() []*field.ResultField {
+	return field.ColsToResultFields(r.src.Cols(), r.src.TableName().O)
+}
+
+// Filter implements plan.Plan Filter interface, it merges the spans of the BinaryOperations
+// on the primary key.
+func (r *pkPlan) Filter(ctx context.Context, expr expression.Expression) (plan.Plan, bool, error) {
+	x, ok := expr.(*expressions.BinaryOperation)
+	if !ok {
+		return r, false, nil
+	}
+	ok, cname, val, err := x.IsIdentRelOpVal()
+	if err != nil {
+		return nil, false, err
+	}
+	pk := r.src.PKHandleCol()
+	if !ok || pk.Name.L != strings.ToLower(cname) {
+		return r, false, nil
+	}
+	if val == nil {
+		return &NullPlan{r.GetFields()}, true, nil
+	}
+	spans, err := columnSpans(x.Op, val, &pk.FieldType)
+	if err != nil {
+		return nil, false, err
+	}
+	r.spans = filterSpans(r.spans, spans)
+	return r, true, nil
+}
+
+// spanHandles returns the range [low, high] of the handles in span, ok is false if it is empty.
+func spanHandles(span *indexSpan) (low, high int64, ok bool, err error) {
+	low, high = math.MinInt64, math.MaxInt64
+	if span.lowVal != minNotNullVal {
+		if low, err = types.ToInt64(span.lowVal); err != nil {
+			return 0, 0, false, errors.Trace(err)
+		}
+		if span.lowExclude {
+			if low == math.MaxInt64 {
+				return 0, 0, false, nil
+			}
+			low++
+		}
+	}
+	if span.highVal != maxVal {
+		if high, err = types.ToInt64(span.highVal); err != nil {
+			return 0, 0, false, errors.Trace(err)
+		}
+		if span.highExclude {
+			if high == math.MinInt64 {
+				return 0, 0, false, nil
+			}
+			high--
+		}
+	}
+	return low, high, low <= high, nil
+}
+
+// Next implements plan.Plan Next interface.
+func (r *pkPlan) Next(ctx context.Context) (row *plan.Row, err error) {
+	if len(r.rows) == 0 {
+		if err = r.fetchRows(ctx); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(r.rows) == 0 {
+			return
+		}
+	}
+	row = r.rows[0]
+	r.rows = r.rows[1:]
+	return
+}
+
+// fetchRows reads the rows of the next handles in the spans in one batch, the
+// batch size grows like the one of indexPlan.
+func (r *pkPlan) fetchRows(ctx context.Context) error {
+	r.batch *= 2
+	if r.batch == 0 {
+		r.batch = 1
+	} else if r.batch > maxIndexBatch {
+		r.batch = maxIndexBatch
+	}
+	var handles []int64
+	for len(handles) < r.batch {
+		if r.iter == nil {
+			if r.cursor == len(r.spans) {
+				break
+			}
+			low, high, ok, err := spanHandles(r.spans[r.cursor])
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if !ok {
+				r.cursor++
+				continue
+			}
+			if low == high {
+				// A point lookup reads the row directly, after the rows of the
+				// handles before it.
+				if len(handles) > 0 {
+					break
+				}
+				r.cursor++
+				row, err1 := r.row(ctx, low)
+				if kv.IsErrNotFound(err1) {
+					continue
+				}
+				if err1 != nil {
+					return errors.Trace(err1)
+				}
+				r.rows = append(r.rows, row)
+				return nil
+			}
+			txn, err := r.src.GetTxn(ctx)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			// The scan stops at the record keys after high.
+			r.iter, err = txn.Scan(r.src.RecordKey(low, nil), r.recordEnd(high), 0)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if !r.iter.Valid() {
+			// This span has finished iteration.
+			// Move to the next span.
+			r.iter.Close()
+			r.iter = nil
+			r.cursor++
+			continue
+		}
+		h, err := util.DecodeHandleFromRowKey(r.iter.Key())
+		if err != nil {
+			return errors.Trace(err)
+		}
+		handles = append(handles, h)
+		r.iter, err = kv.NextUntil(r.iter, util.RowKeyPrefixFilter(r.src.RecordKey(h, nil)))
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if len(handles) == 0 {
+		return nil
+	}
+	data, err := r.src.Rows(ctx, handles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for i, h := range handles {
+		rowKey := &plan.RowKeyEntry{
+			Tbl: r.src,
+			Key: string(r.src.RecordKey(h, nil)),
+		}
+		r.rows = append(r.rows, &plan.Row{Data: data[i], RowKeys: []*plan.RowKeyEntry{rowKey}})
+	}
+	return nil
+}
+
+// recordEnd returns the key after all the record keys of the handles up to high.
+func (r *pkPlan) recordEnd(high int64) []byte {
+	if high == math.MaxInt64 {
+		return kv.PrefixNext([]byte(r.src.KeyPrefix()))
+	}
+	return r.src.RecordKey(high+1, nil)
+}
+
+func (r *pkPlan) row(ctx context.Context, h int64) (*plan.Row, error) {
+	data, err := r.src.Row(ctx, h)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	row := &plan.Row{Data: data}
+	row.RowKeys = append(row.RowKeys, &plan.RowKeyEntry{
+		Tbl: r.src,
+		Key: string(r.src.RecordKey(h, nil)),
+	})
+	return row, nil
+}
+
+// Close implements plan.Plan Close interface.
+func (r *pkPlan) Close() error {
+	if r.iter != nil {
+		r.iter.Close()
+		r.iter = nil
+	}
+	r.cursor = 0
+	r.rows = nil
+	r.batch = 0
+	return nil
+}
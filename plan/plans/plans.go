@@ -40,6 +40,8 @@ func isTableOrIndex(p plan.Plan) bool {
 	switch p.(type) {
 	case
 		*indexPlan,
+		*pkPlan,
+		*PartitionPlan,
 		*TableDefaultPlan:
 		return true
 	default:
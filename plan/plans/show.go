@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/pingcap/tidb/column"
@@ -90,6 +91,8 @@ func (s *ShowPlan) GetFields() []*field.ResultField {
 		names = []string{"Charset", "Description", "Default collation", "Maxlen"}
 	case stmt.ShowVariables:
 		names = []string{"Variable_name", "Value"}
+	case stmt.ShowProcessList:
+		names = []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info", "Txn_entries", "Txn_size"}
 	}
 	fields := make([]*field.ResultField, 0, len(names))
 	for _, name := range names {
@@ -117,6 +120,11 @@ func (s *ShowPlan) Next(ctx context.Context) (row *plan.Row, err error) {
 	return
 }
 
+// setClustered marks the description of the primary key column whose values are the row handles.
+func setClustered(desc *column.ColDesc) {
+	desc.Extra = strings.TrimSpace(desc.Extra + " clustered")
+}
+
 func (s *ShowPlan) fetchAll(ctx context.Context) error {
 	switch s.Target {
 	case stmt.ShowEngines:
@@ -158,7 +166,7 @@ func (s *ShowPlan) fetchAll(ctx context.Context) error {
 			return errors.Errorf("Can not find DB: %s", dbName)
 		}
 		tbName := model.NewCIStr(s.TableName)
-		tb, err := is.TableByName(dbName, tbName)
+		tb, err := sessionctx.GetTable(ctx, dbName, tbName)
 		if err != nil {
 			return errors.Errorf("Can not find table: %s", s.TableName)
 		}
@@ -170,6 +178,9 @@ func (s *ShowPlan) fetchAll(ctx context.Context) error {
 			}
 
 			desc := column.NewColDesc(col)
+			if col == tb.PKHandleCol() {
+				setClustered(desc)
+			}
 
 			// The FULL keyword causes the output to include the column collation and comments,
 			// as well as the privileges you have for each column.
@@ -241,6 +252,28 @@ func (s *ShowPlan) fetchAll(ctx context.Context) error {
 			row := &plan.Row{Data: []interface{}{v.Name, value}}
 			s.rows = append(s.rows, row)
 		}
+	case stmt.ShowProcessList:
+		pl := sessionctx.GetProcessLister(ctx)
+		if pl == nil {
+			return nil
+		}
+		now := time.Now()
+		for _, pi := range pl.ProcessList(ctx) {
+			// Without FULL, only the first 100 characters of the statement are shown.
+			info := pi.Info
+			if !s.Full && len(info) > 100 {
+				info = info[:100]
+			}
+			var infoVal interface{}
+			if info != "" {
+				infoVal = info
+			}
+			row := &plan.Row{Data: []interface{}{
+				pi.ID, pi.User, "", pi.DB, pi.Command, int64(now.Sub(pi.Time) / time.Second), "", infoVal,
+				int64(pi.TxnEntries), int64(pi.TxnSize),
+			}}
+			s.rows = append(s.rows, row)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,130 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tidb
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/sessionctx"
+)
+
+// processes is the sessions which are created and not closed.
+var processes = &processList{sessions: make(map[int64]*session)}
+
+type processList struct {
+	mu       sync.Mutex
+	sessions map[int64]*session
+}
+
+func (pl *processList) add(s *session) {
+	pl.mu.Lock()
+	pl.sessions[s.sid] = s
+	pl.mu.Unlock()
+}
+
+func (pl *processList) remove(s *session) {
+	pl.mu.Lock()
+	delete(pl.sessions, s.sid)
+	pl.mu.Unlock()
+}
+
+// ProcessList implements sessionctx.ProcessLister ProcessList interface.
+func (pl *processList) ProcessList(ctx context.Context) []*sessionctx.ProcessInfo {
+	pl.mu.Lock()
+	list := make([]*sessionctx.ProcessInfo, 0, len(pl.sessions))
+	for _, s := range pl.sessions {
+		list = append(list, s.process.info(s.sid, s == ctx))
+	}
+	pl.mu.Unlock()
+
+	sort.Sort(processInfos(list))
+	return list
+}
+
+type processInfos []*sessionctx.ProcessInfo
+
+func (p processInfos) Len() int           { return len(p) }
+func (p processInfos) Less(i, j int) bool { return p[i].ID < p[j].ID }
+func (p processInfos) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// processState is the state of a session which can be read by other sessions.
+type processState struct {
+	mu      sync.Mutex
+	user    string
+	db      string
+	command string
+	time    time.Time
+	sql     string
+	txn     kv.Transaction
+	// start and last are the start time and the text of the last statement.
+	start time.Time
+	last  string
+}
+
+func (ps *processState) setUser(user string) {
+	ps.mu.Lock()
+	ps.user = user
+	ps.mu.Unlock()
+}
+
+func (ps *processState) setTxn(txn kv.Transaction) {
+	ps.mu.Lock()
+	ps.txn = txn
+	ps.mu.Unlock()
+}
+
+// begin is called before the session runs sql.
+func (ps *processState) begin(db string, sql string) {
+	ps.mu.Lock()
+	ps.db, ps.command, ps.time, ps.sql = db, "Query", time.Now(), sql
+	ps.start, ps.last = ps.time, sql
+	ps.mu.Unlock()
+}
+
+// end is called after the session becomes idle.
+func (ps *processState) end(db string) {
+	ps.mu.Lock()
+	ps.db, ps.command, ps.time, ps.sql = db, "Sleep", time.Now(), ""
+	ps.mu.Unlock()
+}
+
+// info returns the ProcessInfo of the session, self means the session is
+// the one listing the processes. Its statement may have been returned already
+// while the results are still being read, so it is always shown as running.
+func (ps *processState) info(id int64, self bool) *sessionctx.ProcessInfo {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pi := &sessionctx.ProcessInfo{
+		ID:      id,
+		User:    ps.user,
+		DB:      ps.db,
+		Command: ps.command,
+		Time:    ps.time,
+		Info:    ps.sql,
+	}
+	if self {
+		pi.Command, pi.Time, pi.Info = "Query", ps.start, ps.last
+	}
+	// The buffer of the transaction is safe for concurrent reads.
+	if r, ok := ps.txn.(kv.TxnBufferReporter); ok {
+		pi.TxnEntries = r.BufferLen()
+		pi.TxnSize = r.BufferSize()
+	}
+	return pi
+}
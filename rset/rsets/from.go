@@ -43,13 +43,12 @@ type TableRset struct {
 	Name   string
 }
 
-// Plan gets InfoSchemaPlan/TableDefaultPlan.
+// Plan gets InfoSchemaPlan/TableDefaultPlan/PartitionPlan.
 func (r *TableRset) Plan(ctx context.Context) (plan.Plan, error) {
 	if strings.EqualFold(r.Schema, infoschema.Name) {
 		return plans.NewInfoSchemaPlan(r.Name)
 	}
-	is := sessionctx.GetDomain(ctx).InfoSchema()
-	t, err := is.TableByName(model.NewCIStr(r.Schema), model.NewCIStr(r.Name))
+	t, err := sessionctx.GetTable(ctx, model.NewCIStr(r.Schema), model.NewCIStr(r.Name))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -60,6 +59,9 @@ func (r *TableRset) Plan(ctx context.Context) (plan.Plan, error) {
 		f.DBName = r.Schema
 		tdp.Fields = append(tdp.Fields, f)
 	}
+	if t.Partitions() != nil {
+		return &plans.PartitionPlan{T: t, Fields: tdp.Fields}, nil
+	}
 	return tdp, nil
 }
 
@@ -156,6 +156,47 @@ func (r *OrderByRset) Plan(ctx context.Context) (plan.Plan, error) {
 		return r.Src, nil
 	}
 
+	// if the rows can be read by the index of the order by column backward, no need to sort them.
+	if len(by) == 1 && !ascs[0] {
+		if col := r.orderByColumn(by[0]); col != "" && plans.ScanIndexDesc(r.Src, col) {
+			return r.Src, nil
+		}
+	}
+
 	return &plans.OrderByDefaultPlan{By: by, Ascs: ascs, Src: r.Src,
 		SelectList: r.SelectList}, nil
 }
+
+// orderByColumn returns the name of the table column which expr orders by,
+// or "" if expr is not a column of the select list.
+func (r *OrderByRset) orderByColumn(expr expression.Expression) string {
+	if r.SelectList == nil {
+		return ""
+	}
+	var i int
+	switch x := expr.(type) {
+	case *expressions.Ident:
+		// A field may match by both its column name and its alias.
+		indices := field.GetResultFieldIndex(x.L, r.SelectList.ResultFields, field.CheckFieldFlag)
+		if len(indices) == 0 {
+			return ""
+		}
+		i = indices[0]
+		for _, j := range indices {
+			if j != i {
+				return ""
+			}
+		}
+	case *expressions.Position:
+		i = x.N - 1
+	default:
+		return ""
+	}
+	if i < 0 || i >= len(r.SelectList.Fields) || i >= len(r.SelectList.ResultFields) {
+		return ""
+	}
+	if _, ok := r.SelectList.Fields[i].Expr.(*expressions.Ident); !ok {
+		return ""
+	}
+	return r.SelectList.ResultFields[i].ColumnInfo.Name.L
+}
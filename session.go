@@ -32,6 +32,7 @@ import (
 	"github.com/pingcap/tidb/sessionctx"
 	"github.com/pingcap/tidb/sessionctx/db"
 	"github.com/pingcap/tidb/sessionctx/forupdate"
+	"github.com/pingcap/tidb/sessionctx/temptable"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/stmt"
 	"github.com/pingcap/tidb/stmt/stmts"
@@ -103,6 +104,8 @@ type session struct {
 	store    kv.Storage
 	sid      int64
 	history  stmtHistory
+	// process is read by SHOW PROCESSLIST in other sessions.
+	process processState
 }
 
 func (s *session) Status() uint16 {
@@ -119,6 +122,7 @@ func (s *session) AffectedRows() uint64 {
 
 func (s *session) SetUsername(name string) {
 	s.userName = name
+	s.process.setUser(name)
 }
 
 func (s *session) resetHistory() {
@@ -135,20 +139,29 @@ func (s *session) FinishTxn(rollback bool) error {
 	if s.txn == nil {
 		return nil
 	}
+	s.process.setTxn(nil)
 	defer func() {
 		s.txn = nil
 		variable.GetSessionVars(s).SetStatusFlag(mysql.ServerStatusInTrans, false)
 	}()
 
+	// The temporary tables are finished after s.txn, they are rolled back
+	// if s.txn fails to commit, so the statements can be retried.
+	temp := temptable.GetTables(s)
 	if rollback {
+		temp.FinishTxn(true)
 		return s.txn.Rollback()
 	}
 
 	err := s.txn.Commit()
 	if err != nil {
+		temp.FinishTxn(true)
 		log.Warnf("txn:%s, %v", s.txn, err)
 		return errors.Trace(err)
 	}
+	if err = temp.FinishTxn(false); err != nil {
+		return errors.Trace(err)
+	}
 
 	s.resetHistory()
 	return nil
@@ -230,6 +243,11 @@ func (s *session) Retry() error {
 }
 
 func (s *session) Execute(sql string) ([]rset.Recordset, error) {
+	s.process.begin(db.GetCurrentSchema(s), sql)
+	defer func() {
+		s.process.end(db.GetCurrentSchema(s))
+	}()
+
 	statements, err := Compile(sql)
 	if err != nil {
 		log.Errorf("Syntax error: %s", sql)
@@ -322,6 +340,10 @@ func (s *session) ExecutePreparedStmt(stmtID uint32, args ...interface{}) (rset.
 
 	st := &stmts.ExecuteStmt{ID: stmtID}
 	s.history.add(stmtID, st, args...)
+	s.process.begin(db.GetCurrentSchema(s), fmt.Sprintf("EXECUTE %d", stmtID))
+	defer func() {
+		s.process.end(db.GetCurrentSchema(s))
+	}()
 	return runStmt(s, st, args...)
 }
 
@@ -340,6 +362,7 @@ func (s *session) GetTxn(forceNew bool) (kv.Transaction, error) {
 		if err != nil {
 			return nil, err
 		}
+		s.initTxn()
 		if !variable.IsAutocommit(s) {
 			variable.GetSessionVars(s).SetStatusFlag(mysql.ServerStatusInTrans, true)
 		}
@@ -348,7 +371,13 @@ func (s *session) GetTxn(forceNew bool) (kv.Transaction, error) {
 	}
 	if forceNew {
 		err = s.txn.Commit()
+		s.process.setTxn(nil)
 		variable.GetSessionVars(s).SetStatusFlag(mysql.ServerStatusInTrans, false)
+		if err == nil {
+			err = temptable.GetTables(s).FinishTxn(false)
+		} else {
+			temptable.GetTables(s).FinishTxn(true)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -357,6 +386,7 @@ func (s *session) GetTxn(forceNew bool) (kv.Transaction, error) {
 		if err != nil {
 			return nil, err
 		}
+		s.initTxn()
 		if !variable.IsAutocommit(s) {
 			variable.GetSessionVars(s).SetStatusFlag(mysql.ServerStatusInTrans, true)
 		}
@@ -365,6 +395,15 @@ func (s *session) GetTxn(forceNew bool) (kv.Transaction, error) {
 	return s.txn, nil
 }
 
+// initTxn sets the options of the new transaction from the system variables.
+func (s *session) initTxn() {
+	s.txn.SetOption(kv.LockWaitTimeout, variable.GetLockWaitTimeout(s))
+	entries, size := variable.GetTxnLimits(s)
+	s.txn.SetOption(kv.TxnEntryLimit, entries)
+	s.txn.SetOption(kv.TxnSizeLimit, size)
+	s.process.setTxn(s.txn)
+}
+
 func (s *session) SetValue(key fmt.Stringer, value interface{}) {
 	s.values[key] = value
 }
@@ -379,8 +418,14 @@ func (s *session) ClearValue(key fmt.Stringer) {
 }
 
 // Close function does some clean work when session end.
+// The temporary tables of the session are dropped.
 func (s *session) Close() error {
-	return s.FinishTxn(true)
+	processes.remove(s)
+	err := s.FinishTxn(true)
+	if err1 := temptable.GetTables(s).Close(); err == nil {
+		err = err1
+	}
+	return errors.Trace(err)
 }
 
 // CreateSession creates a new session environment.
@@ -395,8 +440,15 @@ func CreateSession(store kv.Storage) (Session, error) {
 		return nil, err
 	}
 	sessionctx.BindDomain(s, domain)
+	sessionctx.BindProcessLister(s, processes)
+	s.process.end("")
+	processes.add(s)
 
 	variable.BindSessionVars(s)
+	temptable.BindTables(s)
 	variable.GetSessionVars(s).SetStatusFlag(mysql.ServerStatusAutocommit, true)
+	if kv.IsReadOnly(store) {
+		variable.GetSessionVars(s).Systems["read_only"] = "ON"
+	}
 	return s, nil
 }
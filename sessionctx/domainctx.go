@@ -16,6 +16,9 @@ package sessionctx
 import (
 	"github.com/pingcap/tidb/context"
 	"github.com/pingcap/tidb/domain"
+	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/sessionctx/temptable"
+	"github.com/pingcap/tidb/table"
 )
 
 // A dummy type to avoid naming collision in context.
@@ -41,3 +44,12 @@ func GetDomain(ctx context.Context) *domain.Domain {
 	}
 	return v
 }
+
+// GetTable gets the table schema.name from the InfoSchema of the domain of
+// context, a temporary table of the session shadows the table of the same name.
+func GetTable(ctx context.Context, schema, name model.CIStr) (table.Table, error) {
+	if t := temptable.GetTables(ctx).TableByName(schema, name); t != nil {
+		return t, nil
+	}
+	return GetDomain(ctx).InfoSchema().TableByName(schema, name)
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessionctx
+
+import (
+	"time"
+
+	"github.com/pingcap/tidb/context"
+)
+
+// ProcessInfo is the information of a session shown by SHOW PROCESSLIST.
+type ProcessInfo struct {
+	ID   int64
+	User string
+	DB   string
+	// Command is Query if a statement is running, or Sleep.
+	Command string
+	// Time is when the session changed to the current Command.
+	Time time.Time
+	// Info is the running statement.
+	Info string
+	// TxnEntries and TxnSize are the number of the entries and the bytes
+	// buffered by the current transaction.
+	TxnEntries int
+	TxnSize    int
+}
+
+// ProcessLister lists the sessions.
+type ProcessLister interface {
+	// ProcessList returns the sessions, ctx is the session which lists them.
+	ProcessList(ctx context.Context) []*ProcessInfo
+}
+
+type processListerKeyType int
+
+func (k processListerKeyType) String() string {
+	return "process lister"
+}
+
+const processListerKey processListerKeyType = 0
+
+// BindProcessLister binds the ProcessLister to context.
+func BindProcessLister(ctx context.Context, pl ProcessLister) {
+	ctx.SetValue(processListerKey, pl)
+}
+
+// GetProcessLister gets the ProcessLister from context.
+func GetProcessLister(ctx context.Context) ProcessLister {
+	v, ok := ctx.Value(processListerKey).(ProcessLister)
+	if !ok {
+		return nil
+	}
+	return v
+}
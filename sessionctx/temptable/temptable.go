@@ -0,0 +1,154 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package temptable
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/memkv"
+	"github.com/pingcap/tidb/table"
+)
+
+// Tables are the temporary tables of a session. Their rows and indices are
+// stored in an in-memory store which only the session uses, and they are
+// dropped with the store when the session is closed.
+type Tables struct {
+	// store is opened when the first temporary table is created.
+	store kv.Storage
+	// txn is the transaction of the temporary tables, it is finished with
+	// the transaction of the session.
+	txn    kv.Transaction
+	tables map[string]table.Table
+}
+
+// tablesKeyType is a dummy type to avoid naming collision in context.
+type tablesKeyType int
+
+// String defines a Stringer function for debugging and pretty printing.
+func (k tablesKeyType) String() string {
+	return "temporary_tables"
+}
+
+const tablesKey tablesKeyType = 0
+
+// storeID makes the paths of the stores of the sessions unique.
+var storeID int64
+
+// BindTables creates an empty set of temporary tables and binds it to context.
+func BindTables(ctx context.Context) {
+	ctx.SetValue(tablesKey, &Tables{tables: make(map[string]table.Table)})
+}
+
+// GetTables gets the temporary tables from context, nil if they are not bound.
+func GetTables(ctx context.Context) *Tables {
+	v, ok := ctx.Value(tablesKey).(*Tables)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func tableKey(schema, name model.CIStr) string {
+	return schema.L + "." + name.L
+}
+
+// TableByName returns the temporary table schema.name, nil if there is none.
+func (ts *Tables) TableByName(schema, name model.CIStr) table.Table {
+	if ts == nil {
+		return nil
+	}
+	return ts.tables[tableKey(schema, name)]
+}
+
+// AddTable adds the temporary table t in schema.
+func (ts *Tables) AddTable(schema model.CIStr, t table.Table) {
+	ts.tables[tableKey(schema, t.TableName())] = t
+}
+
+// RemoveTable removes the temporary table schema.name, its data is left in the store.
+func (ts *Tables) RemoveTable(schema, name model.CIStr) {
+	delete(ts.tables, tableKey(schema, name))
+}
+
+// Store returns the store of the temporary tables, it is opened on the first call.
+func (ts *Tables) Store() (kv.Storage, error) {
+	if ts.store != nil {
+		return ts.store, nil
+	}
+	path := fmt.Sprintf("temptable-%d", atomic.AddInt64(&storeID, 1))
+	store, err := localstore.Driver{Driver: memkv.Driver{}}.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ts.store = store
+	return store, nil
+}
+
+// FinishTxn commits or rolls back the transaction of the temporary tables.
+// The session calls it after its own transaction is finished.
+func (ts *Tables) FinishTxn(rollback bool) error {
+	if ts == nil || ts.txn == nil {
+		return nil
+	}
+	txn := ts.txn
+	ts.txn = nil
+	if rollback {
+		return errors.Trace(txn.Rollback())
+	}
+	return errors.Trace(txn.Commit())
+}
+
+// Close rolls back the running transaction and drops all the temporary tables.
+func (ts *Tables) Close() error {
+	if ts == nil {
+		return nil
+	}
+	err := ts.FinishTxn(true)
+	ts.tables = make(map[string]table.Table)
+	if ts.store != nil {
+		err1 := ts.store.Close()
+		ts.store = nil
+		if err == nil {
+			err = err1
+		}
+	}
+	return errors.Trace(err)
+}
+
+// GetTxn returns the transaction to access the temporary tables of ctx in.
+// The transaction of ctx is begun too, so they are finished together.
+func GetTxn(ctx context.Context) (kv.Transaction, error) {
+	ts := GetTables(ctx)
+	if ts == nil {
+		return nil, errors.New("temporary tables are not bound to the context")
+	}
+	if _, err := ctx.GetTxn(false); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if ts.txn != nil {
+		return ts.txn, nil
+	}
+	store, err := ts.Store()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ts.txn, err = store.Begin()
+	return ts.txn, errors.Trace(err)
+}
@@ -14,6 +14,9 @@
 package variable
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/pingcap/tidb/context"
 	mysql "github.com/pingcap/tidb/mysqldef"
 	"github.com/pingcap/tidb/stmt"
@@ -136,3 +139,41 @@ func ShouldAutocommit(ctx context.Context) bool {
 
 	return false
 }
+
+// getSystemVar gets the value of the system variable name in current session.
+func getSystemVar(ctx context.Context, name string) string {
+	v, ok := GetSessionVars(ctx).Systems[name]
+	if !ok {
+		v = GetSysVar(name).Value
+	}
+	return v
+}
+
+// GetLockWaitTimeout gets the duration a transaction waits for the locked keys.
+// It is zero unless tidb_lock_wait is enabled, then it is innodb_lock_wait_timeout seconds.
+func GetLockWaitTimeout(ctx context.Context) time.Duration {
+	switch getSystemVar(ctx, "tidb_lock_wait") {
+	case "ON", "on", "1":
+	default:
+		return 0
+	}
+
+	seconds, err := strconv.ParseInt(getSystemVar(ctx, "innodb_lock_wait_timeout"), 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// GetTxnLimits gets tidb_txn_entry_limit and tidb_txn_size_limit, an invalid value means no limit.
+func GetTxnLimits(ctx context.Context) (entries int, size int) {
+	entries, err := strconv.Atoi(getSystemVar(ctx, "tidb_txn_entry_limit"))
+	if err != nil || entries < 0 {
+		entries = 0
+	}
+	size, err = strconv.Atoi(getSystemVar(ctx, "tidb_txn_size_limit"))
+	if err != nil || size < 0 {
+		size = 0
+	}
+	return entries, size
+}
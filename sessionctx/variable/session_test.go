@@ -14,6 +14,8 @@
 package variable
 
 import (
+	"time"
+
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb/util/mock"
 )
@@ -47,3 +49,38 @@ func (*testSessionSuite) TestSession(c *C) {
 	v.SetLastInsertID(uint64(1))
 	c.Assert(v.LastInsertID, Equals, uint64(1))
 }
+
+func (*testSessionSuite) TestLockWaitTimeout(c *C) {
+	ctx := mock.NewContext()
+
+	BindSessionVars(ctx)
+
+	v := GetSessionVars(ctx)
+	c.Assert(GetLockWaitTimeout(ctx), Equals, time.Duration(0))
+
+	v.Systems["tidb_lock_wait"] = "ON"
+	c.Assert(GetLockWaitTimeout(ctx), Equals, 50*time.Second)
+
+	v.Systems["innodb_lock_wait_timeout"] = "3"
+	c.Assert(GetLockWaitTimeout(ctx), Equals, 3*time.Second)
+
+	v.Systems["tidb_lock_wait"] = "0"
+	c.Assert(GetLockWaitTimeout(ctx), Equals, time.Duration(0))
+}
+
+func (*testSessionSuite) TestTxnLimits(c *C) {
+	ctx := mock.NewContext()
+
+	BindSessionVars(ctx)
+
+	v := GetSessionVars(ctx)
+	entries, size := GetTxnLimits(ctx)
+	c.Assert(entries, Equals, 300000)
+	c.Assert(size, Equals, 100*1024*1024)
+
+	v.Systems["tidb_txn_entry_limit"] = "10"
+	v.Systems["tidb_txn_size_limit"] = "abc"
+	entries, size = GetTxnLimits(ctx)
+	c.Assert(entries, Equals, 10)
+	c.Assert(size, Equals, 0)
+}
@@ -558,4 +558,11 @@ var defaultSysVars = []*SysVar{
 	{ScopeGlobal | ScopeSession, "min_examined_row_limit", "0"},
 	{ScopeGlobal, "sync_frm", "ON"},
 	{ScopeGlobal, "innodb_online_alter_log_max_size", "134217728"},
+	// TiDB specific system variables.
+	// tidb_lock_wait enables waiting for the locked keys up to innodb_lock_wait_timeout.
+	{ScopeGlobal | ScopeSession, "tidb_lock_wait", "OFF"},
+	// tidb_txn_entry_limit and tidb_txn_size_limit limit the entries and the bytes
+	// buffered by a transaction, 0 means no limit.
+	{ScopeGlobal | ScopeSession, "tidb_txn_entry_limit", "300000"},
+	{ScopeGlobal | ScopeSession, "tidb_txn_size_limit", "104857600"},
 }
@@ -84,10 +84,14 @@ func (s *CreateDatabaseStmt) Exec(ctx context.Context) (_ rset.Recordset, err er
 // See: https://dev.mysql.com/doc/refman/5.7/en/create-table.html
 type CreateTableStmt struct {
 	IfNotExists bool
+	// Temporary is true for CREATE TEMPORARY TABLE, the table is only visible
+	// to the session and dropped when it is closed.
+	Temporary   bool
 	Ident       table.Ident
 	Cols        []*coldef.ColumnDef
 	Constraints []*coldef.TableConstraint
 	Opt         *coldef.TableOption
+	Partition   *coldef.PartitionOption
 
 	Text string
 }
@@ -114,7 +118,15 @@ func (s *CreateTableStmt) SetText(text string) {
 
 // Exec implements the stmt.Statement Exec interface.
 func (s *CreateTableStmt) Exec(ctx context.Context) (_ rset.Recordset, err error) {
-	err = sessionctx.GetDomain(ctx).DDL().CreateTable(ctx, s.Ident.Full(ctx), s.Cols, s.Constraints)
+	d := sessionctx.GetDomain(ctx).DDL()
+	if s.Temporary {
+		if s.Partition != nil {
+			return nil, errors.Errorf("CREATE TABLE: temporary table %s can't be partitioned", s.Ident)
+		}
+		err = d.CreateTemporaryTable(ctx, s.Ident.Full(ctx), s.Cols, s.Constraints, s.Opt)
+	} else {
+		err = d.CreateTable(ctx, s.Ident.Full(ctx), s.Cols, s.Constraints, s.Opt, s.Partition)
+	}
 	if errors2.ErrorEqual(err, ddl.ErrExists) {
 		if s.IfNotExists {
 			return nil, nil
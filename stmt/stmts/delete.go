@@ -96,7 +96,15 @@ func (s *DeleteStmt) indexPlan(ctx context.Context) (plan.Plan, error) {
 		return nil, err
 	}
 
-	p, filtered, err := (&plans.TableDefaultPlan{T: t}).FilterForUpdateAndDelete(ctx, s.Where)
+	var (
+		p        plan.Plan
+		filtered bool
+	)
+	if t.Partitions() != nil {
+		p, filtered, err = (&plans.PartitionPlan{T: t}).FilterForUpdateAndDelete(ctx, s.Where)
+	} else {
+		p, filtered, err = (&plans.TableDefaultPlan{T: t}).FilterForUpdateAndDelete(ctx, s.Where)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -182,7 +190,8 @@ func (s *DeleteStmt) tryDeleteUsingIndex(ctx context.Context, t table.Table) (bo
 		if err != nil {
 			return false, errors.Trace(err)
 		}
-		data, err := t.Row(ctx, handle)
+		// The row is read from the partition it is in if the table is partitioned.
+		data, err := rowKey.Tbl.Row(ctx, handle)
 		if err != nil {
 			return false, err
 		}
@@ -194,7 +203,7 @@ func (s *DeleteStmt) tryDeleteUsingIndex(ctx context.Context, t table.Table) (bo
 		if !ok {
 			return true, nil
 		}
-		err = s.removeRow(ctx, t, handle, data)
+		err = s.removeRow(ctx, rowKey.Tbl, handle, data)
 		if err != nil {
 			return false, err
 		}
@@ -285,6 +294,10 @@ func (s *DeleteStmt) execMultiTable(ctx context.Context) (_ rset.Recordset, err
 			return nil, errors.Trace(err)
 		}
 		tblIDMap[tbl.TableID()] = true
+		// The row keys of a partitioned table are in its partitions.
+		for _, p := range tbl.Partitions() {
+			tblIDMap[p.TableID()] = true
+		}
 	}
 	rowKeyMap := make(map[string]table.Table)
 	for {
@@ -303,18 +316,25 @@ func (s *DeleteStmt) execMultiTable(ctx context.Context) (_ rset.Recordset, err
 			rowKeyMap[entry.Key] = entry.Tbl
 		}
 	}
+	// The rows of a table are read in one batch.
+	handles := make(map[table.Table][]int64)
 	for k, t := range rowKeyMap {
 		handle, err := util.DecodeHandleFromRowKey(k)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		data, err := t.Row(ctx, handle)
+		handles[t] = append(handles[t], handle)
+	}
+	for t, hs := range handles {
+		rows, err := t.Rows(ctx, hs)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
-		err = s.removeRow(ctx, t, handle, data)
-		if err != nil {
-			return nil, errors.Trace(err)
+		for i, handle := range hs {
+			err = s.removeRow(ctx, t, handle, rows[i])
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
 		}
 	}
 	return nil, nil
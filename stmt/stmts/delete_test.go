@@ -106,11 +106,11 @@ func (s *testStmtSuite) TestDelete(c *C) {
 	r = mustExec(c, s.testDB, `DELETE from test;`)
 	checkResult(c, r, 1, 0)
 
-	// Should use index
+	// Should use index or the primary key
 	strs := s.queryStrings(s.testDB, `explain DELETE from test where id = 2;`, c)
 	var useIndex bool
 	for _, str := range strs {
-		if strings.Index(str, "index") > 0 {
+		if strings.Index(str, "index") > 0 || strings.Index(str, "primary key") > 0 {
 			useIndex = true
 		}
 	}
@@ -80,7 +80,9 @@ func (s *DropDatabaseStmt) Exec(ctx context.Context) (rset.Recordset, error) {
 // DropTableStmt is a statement to drop one or more tables.
 // See: https://dev.mysql.com/doc/refman/5.7/en/drop-table.html
 type DropTableStmt struct {
-	IfExists    bool
+	IfExists bool
+	// Temporary is true for DROP TEMPORARY TABLE, which only drops temporary tables.
+	Temporary   bool
 	TableIdents []table.Ident
 
 	Text string
@@ -109,8 +111,14 @@ func (s *DropTableStmt) SetText(text string) {
 // Exec implements the stmt.Statement Exec interface.
 func (s *DropTableStmt) Exec(ctx context.Context) (rset.Recordset, error) {
 	var notExistTables []string
+	d := sessionctx.GetDomain(ctx).DDL()
 	for _, ti := range s.TableIdents {
-		err := sessionctx.GetDomain(ctx).DDL().DropTable(ctx, ti.Full(ctx))
+		var err error
+		if s.Temporary {
+			err = d.DropTemporaryTable(ctx, ti.Full(ctx))
+		} else {
+			err = d.DropTable(ctx, ti.Full(ctx))
+		}
 		if err != nil && strings.HasSuffix(err.Error(), "not exist") {
 			notExistTables = append(notExistTables, ti.String())
 		} else if err != nil {
@@ -90,6 +90,11 @@ func (s *InsertIntoStmt) execSelect(t table.Table, cols []*column.Col, ctx conte
 	if len(r.GetFields()) != len(cols) {
 		return nil, errors.Errorf("Column count %d doesn't match value count %d", len(cols), len(r.GetFields()))
 	}
+	for _, c := range cols {
+		if c.IsGenerated() {
+			return nil, errors.Errorf("INSERT INTO %s: generated column %s can't be set", s.TableIdent, c.Name)
+		}
+	}
 
 	var bufRecords [][]interface{}
 	var lastInsertIds []uint64
@@ -258,6 +263,13 @@ func (s *InsertIntoStmt) Exec(ctx context.Context) (_ rset.Recordset, err error)
 
 		marked := make(map[int]struct{}, len(list))
 		for i, expr := range list {
+			if cols[i].IsGenerated() {
+				// Only DEFAULT is allowed for a generated column, it is computed by the table.
+				if _, ok := expr.(*expressions.Default); !ok {
+					return nil, errors.Errorf("INSERT INTO %s: generated column %s can't be set", s.TableIdent, cols[i].Name)
+				}
+				continue
+			}
 			// For "insert into t values (default)" Default Eval.
 			m[expressions.ExprEvalDefaultName] = cols[i].Name.O
 
@@ -316,8 +328,8 @@ func (s *InsertIntoStmt) initDefaultValues(ctx context.Context, t table.Table, c
 	var err error
 	var defaultValueCols []*column.Col
 	for i, c := range cols {
-		if row[i] != nil {
-			// Column value is not nil, continue.
+		if row[i] != nil || c.IsGenerated() {
+			// Column value is not nil or is computed by the table, continue.
 			continue
 		}
 
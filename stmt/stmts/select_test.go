@@ -39,8 +39,8 @@ func (s *testStmtSuite) TestSelectExplain(c *C) {
 	s.fillData(s.testDB, c)
 
 	strs := s.queryStrings(s.testDB, "explain select * from test where id = 1;", c)
-	// Must use index
-	if strings.Index(strs[0], "index") < 0 {
+	// Must use index or the primary key
+	if strings.Index(strs[0], "index") < 0 && strings.Index(strs[0], "primary key") < 0 {
 		c.Fatalf("Should use index")
 	}
 }
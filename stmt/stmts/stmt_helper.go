@@ -48,5 +48,5 @@ func getDefaultValue(ctx context.Context, c *column.Col) (interface{}, bool, err
 
 func getTable(ctx context.Context, tableIdent table.Ident) (table.Table, error) {
 	full := tableIdent.Full(ctx)
-	return sessionctx.GetDomain(ctx).InfoSchema().TableByName(full.Schema, full.Name)
+	return sessionctx.GetTable(ctx, full.Schema, full.Name)
 }
@@ -111,6 +111,9 @@ func getUpdateColumns(t table.Table, assignList []expressions.Assignment, isMult
 			}
 			return nil, errors.Errorf("UPDATE: unknown column %s", asgn.ColName)
 		}
+		if col.IsGenerated() {
+			return nil, errors.Errorf("UPDATE: generated column %s can't be set", col.Name)
+		}
 		tcols = append(tcols, col)
 	}
 	return tcols, nil
@@ -311,6 +314,20 @@ func (s *UpdateStmt) Exec(ctx context.Context) (_ rset.Recordset, err error) {
 				return nil, errors.Trace(err2)
 			}
 			updatedRowKeys[k] = true
+			// The row is moved to a new key if its primary key or its partition
+			// is updated, it must not be updated again when the new key is iterated.
+			newHandle := handle
+			if pk := tbl.PKHandleCol(); pk != nil {
+				newHandle, err2 = types.ToInt64(data[pk.Offset])
+				if err2 != nil {
+					return nil, errors.Trace(err2)
+				}
+			}
+			dst, err2 := tbl.LocatePartition(ctx, data)
+			if err2 != nil {
+				return nil, errors.Trace(err2)
+			}
+			updatedRowKeys[string(dst.RecordKey(newHandle, nil))] = true
 		}
 	}
 	return nil, nil
@@ -54,11 +54,11 @@ func (s *testStmtSuite) TestUpdate(c *C) {
 	rows.Close()
 	mustCommit(c, tx)
 
-	// Should use index
+	// Should use index or the primary key
 	strs := s.queryStrings(testDB, `explain `+updateStr, c)
 	var useIndex bool
 	for _, str := range strs {
-		if strings.Index(str, "index") > 0 {
+		if strings.Index(str, "index") > 0 || strings.Index(str, "primary key") > 0 {
 			useIndex = true
 		}
 	}
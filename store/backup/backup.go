@@ -0,0 +1,282 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup dumps all the key/value pairs of a kv.Storage to an archive
+// and loads them back to another kv.Storage, which may use another engine.
+//
+// The archive starts with the magic bytes, followed by blocks of pairs:
+//
+//	block   = count(uvarint) length(uvarint) payload checksum(4 bytes)
+//	payload = pair*
+//	pair    = key length(uvarint) key value length(uvarint) value
+//
+// The checksum is the big endian CRC-32 (IEEE) of the payload. The last block
+// has a zero count, its payload is the total count of the pairs(uvarint).
+// The payload of a block is at most 2MB unless the block has only one pair.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+)
+
+const magic = "TIDBBAK1"
+
+// blockSize is the payload size to end a block, a block is restored in a transaction.
+const blockSize = 1024 * 1024
+
+// maxBlockSize is the max payload size of a block which has more than one pair,
+// a pair larger than blockSize is written in a block of its own.
+const maxBlockSize = 2 * blockSize
+
+var (
+	// ErrInvalidArchive is returned if the archive is not written by Backup.
+	ErrInvalidArchive = errors.New("invalid backup archive")
+	// ErrChecksumMismatch is returned if a block of the archive is corrupted.
+	ErrChecksumMismatch = errors.New("backup archive checksum mismatch")
+	// ErrStoreNotEmpty is returned if restoring to a store which has data.
+	ErrStoreNotEmpty = errors.New("restore to a store which is not empty")
+)
+
+// Backup writes all the key/value pairs in a snapshot of the current version of store to w,
+// it returns the count of the pairs.
+func Backup(store kv.Storage, w io.Writer) (int, error) {
+	ver, err := store.CurrentVersion()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	snap, err := store.GetSnapshot(ver)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer snap.Release()
+
+	it, err := snap.Scan(kv.EncodeKey(nil), kv.EncodeEndKey(nil), 0)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer it.Close()
+
+	bw := bufio.NewWriter(w)
+	if _, err = bw.WriteString(magic); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	var (
+		payload bytes.Buffer
+		n       int
+		total   int
+	)
+	flush := func() error {
+		if err1 := writeBlock(bw, n, payload.Bytes()); err1 != nil {
+			return errors.Trace(err1)
+		}
+		total += n
+		n = 0
+		payload.Reset()
+		return nil
+	}
+	for it.Valid() {
+		key := kv.DecodeKey([]byte(it.Key()))
+		if n > 0 && len(key)+len(it.Value()) > blockSize {
+			if err = flush(); err != nil {
+				return 0, errors.Trace(err)
+			}
+		}
+		writePair(&payload, key, it.Value())
+		n++
+		if payload.Len() >= blockSize {
+			if err = flush(); err != nil {
+				return 0, errors.Trace(err)
+			}
+		}
+
+		it, err = it.Next(nil)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+	}
+	if n > 0 {
+		if err = flush(); err != nil {
+			return 0, errors.Trace(err)
+		}
+	}
+
+	payload.Reset()
+	writeUvarint(&payload, uint64(total))
+	if err = writeBlock(bw, 0, payload.Bytes()); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if err = bw.Flush(); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	log.Infof("backup %d pairs at version %d", total, ver.Ver)
+	return total, nil
+}
+
+// Restore loads the pairs in the archive read from r to store, which must be empty.
+// Every block is verified before it is written in a transaction, so a corrupted
+// archive may be partly restored.
+func Restore(store kv.Storage, r io.Reader) (int, error) {
+	if err := checkEmpty(store); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	br := bufio.NewReader(r)
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, m); err != nil || string(m) != magic {
+		return 0, errors.Trace(ErrInvalidArchive)
+	}
+
+	total := 0
+	for {
+		n, payload, err := readBlock(br)
+		if err != nil {
+			return total, errors.Trace(err)
+		}
+		if n == 0 {
+			cnt, err1 := binary.ReadUvarint(bytes.NewReader(payload))
+			if err1 != nil || int(cnt) != total {
+				return total, errors.Trace(ErrInvalidArchive)
+			}
+			log.Infof("restore %d pairs", total)
+			return total, nil
+		}
+
+		err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+			return restoreBlock(txn, n, payload)
+		})
+		if err != nil {
+			return total, errors.Trace(err)
+		}
+		total += n
+	}
+}
+
+func checkEmpty(store kv.Storage) error {
+	txn, err := store.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer txn.Rollback()
+
+	it, err := txn.Scan(nil, nil, 1)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer it.Close()
+	if it.Valid() {
+		return errors.Trace(ErrStoreNotEmpty)
+	}
+	return nil
+}
+
+func restoreBlock(txn kv.Transaction, n int, payload []byte) error {
+	r := bytes.NewReader(payload)
+	for i := 0; i < n; i++ {
+		key, err := readBytes(r)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		value, err := readBytes(r)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = txn.Set(key, value); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if r.Len() != 0 {
+		return errors.Trace(ErrInvalidArchive)
+	}
+	return nil
+}
+
+func writeUvarint(w *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+func writePair(w *bytes.Buffer, key []byte, value []byte) {
+	writeUvarint(w, uint64(len(key)))
+	w.Write(key)
+	writeUvarint(w, uint64(len(value)))
+	w.Write(value)
+}
+
+func writeBlock(w *bufio.Writer, n int, payload []byte) error {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(n))
+	writeUvarint(&buf, uint64(len(payload)))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(payload)))
+}
+
+// readBlock reads a block and verifies its checksum.
+func readBlock(r *bufio.Reader) (int, []byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, errors.Trace(ErrInvalidArchive)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil || size > maxBlockSize && n != 1 || size > math.MaxInt64 {
+		return 0, nil, errors.Trace(ErrInvalidArchive)
+	}
+	var payload []byte
+	if size <= maxBlockSize {
+		payload = make([]byte, size)
+		_, err = io.ReadFull(r, payload)
+	} else {
+		// The block of a large pair is buffered as it is read, so a corrupted
+		// size fails at the end of the archive but is never allocated at once.
+		var buf bytes.Buffer
+		_, err = io.CopyN(&buf, r, int64(size))
+		payload = buf.Bytes()
+	}
+	if err != nil {
+		return 0, nil, errors.Trace(ErrInvalidArchive)
+	}
+	var checksum uint32
+	if err = binary.Read(r, binary.BigEndian, &checksum); err != nil {
+		return 0, nil, errors.Trace(ErrInvalidArchive)
+	}
+	if checksum != crc32.ChecksumIEEE(payload) {
+		return 0, nil, errors.Trace(ErrChecksumMismatch)
+	}
+	return int(n), payload, nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, errors.Trace(ErrInvalidArchive)
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
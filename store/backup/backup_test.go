@@ -0,0 +1,209 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/boltdb"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/store/localstore/memkv"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+const testPath = "/tmp/test-tidb-backup"
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testBackupSuite{})
+
+type testBackupSuite struct {
+	s kv.Storage
+	n int
+}
+
+func (t *testBackupSuite) SetUpSuite(c *C) {
+	d := localstore.Driver{Driver: goleveldb.MemoryDriver{}}
+	var err error
+	t.s, err = d.Open("memory:backup")
+	c.Assert(err, IsNil)
+
+	// Write enough pairs for several blocks.
+	t.n = 3000
+	value := []byte(strings.Repeat("v", 1024))
+	for i := 0; i < t.n; i += 500 {
+		err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+			for j := i; j < i+500; j++ {
+				if err1 := txn.Set([]byte(fmt.Sprintf("k%04d", j)), value); err1 != nil {
+					return err1
+				}
+			}
+			return nil
+		})
+		c.Assert(err, IsNil)
+	}
+	// The deleted key is not in the backup.
+	err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		if err1 := txn.Set([]byte("deleted"), []byte("1")); err1 != nil {
+			return err1
+		}
+		return txn.Delete([]byte("deleted"))
+	})
+	c.Assert(err, IsNil)
+}
+
+func (t *testBackupSuite) TearDownSuite(c *C) {
+	err := t.s.Close()
+	c.Assert(err, IsNil)
+}
+
+func (t *testBackupSuite) backup(c *C) []byte {
+	var buf bytes.Buffer
+	n, err := Backup(t.s, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, t.n)
+	return buf.Bytes()
+}
+
+func (t *testBackupSuite) TestRestore(c *C) {
+	archive := t.backup(c)
+
+	os.RemoveAll(testPath)
+	defer os.RemoveAll(testPath)
+	for _, d := range []localstore.Driver{
+		{Driver: boltdb.Driver{}},
+		{Driver: memkv.Driver{}},
+	} {
+		s, err := d.Open(testPath)
+		c.Assert(err, IsNil)
+
+		n, err := Restore(s, bytes.NewReader(archive))
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, t.n)
+
+		txn, err := s.Begin()
+		c.Assert(err, IsNil)
+		it, err := txn.Scan(nil, nil, 0)
+		c.Assert(err, IsNil)
+		cnt := 0
+		for it.Valid() {
+			c.Assert(it.Key(), Equals, fmt.Sprintf("k%04d", cnt))
+			c.Assert(it.Value(), HasLen, 1024)
+			cnt++
+			it, err = it.Next(nil)
+			c.Assert(err, IsNil)
+		}
+		it.Close()
+		c.Assert(cnt, Equals, t.n)
+		txn.Rollback()
+
+		// The store isn't empty now.
+		_, err = Restore(s, bytes.NewReader(archive))
+		c.Assert(errors2.ErrorEqual(err, ErrStoreNotEmpty), IsTrue)
+
+		err = s.Close()
+		c.Assert(err, IsNil)
+		os.RemoveAll(testPath)
+	}
+}
+
+func (t *testBackupSuite) TestInvalidArchive(c *C) {
+	archive := t.backup(c)
+
+	restore := func(b []byte) error {
+		s, err := localstore.Driver{Driver: memkv.Driver{}}.Open("memkv:backup")
+		c.Assert(err, IsNil)
+		defer s.Close()
+		_, err = Restore(s, bytes.NewReader(b))
+		return err
+	}
+
+	err := restore([]byte("not an archive"))
+	c.Assert(errors2.ErrorEqual(err, ErrInvalidArchive), IsTrue)
+
+	corrupted := append([]byte(nil), archive...)
+	corrupted[len(magic)+100]++
+	err = restore(corrupted)
+	c.Assert(errors2.ErrorEqual(err, ErrChecksumMismatch), IsTrue)
+
+	err = restore(archive[:len(archive)-10])
+	c.Assert(errors2.ErrorEqual(err, ErrInvalidArchive), IsTrue)
+
+	// A corrupted block header is rejected before its payload is allocated.
+	header := func(n, size uint64) []byte {
+		var buf bytes.Buffer
+		buf.WriteString(magic)
+		writeUvarint(&buf, n)
+		writeUvarint(&buf, size)
+		return append(buf.Bytes(), archive[len(magic)+4:]...)
+	}
+	err = restore(header(2, maxBlockSize+1))
+	c.Assert(errors2.ErrorEqual(err, ErrInvalidArchive), IsTrue)
+	err = restore(header(1, 1<<62))
+	c.Assert(errors2.ErrorEqual(err, ErrInvalidArchive), IsTrue)
+	err = restore(header(1, 1<<63))
+	c.Assert(errors2.ErrorEqual(err, ErrInvalidArchive), IsTrue)
+}
+
+func (t *testBackupSuite) TestLargePair(c *C) {
+	d := localstore.Driver{Driver: memkv.Driver{}}
+	s, err := d.Open("memkv:backup-large")
+	c.Assert(err, IsNil)
+	defer s.Close()
+	large := []byte(strings.Repeat("v", maxBlockSize+1))
+	err = kv.RunInNewTxn(s, false, func(txn kv.Transaction) error {
+		for _, k := range []string{"a", "c"} {
+			if err1 := txn.Set([]byte(k), []byte(k)); err1 != nil {
+				return err1
+			}
+		}
+		return txn.Set([]byte("b"), large)
+	})
+	c.Assert(err, IsNil)
+
+	// The large pair is written in a block of its own.
+	var buf bytes.Buffer
+	n, err := Backup(s, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	r := bufio.NewReader(bytes.NewReader(buf.Bytes()[len(magic):]))
+	for _, cnt := range []int{1, 1, 1, 0} {
+		n, _, err = readBlock(r)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, cnt)
+	}
+
+	s2, err := d.Open("memkv:backup-large-restore")
+	c.Assert(err, IsNil)
+	defer s2.Close()
+	n, err = Restore(s2, bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	txn, err := s2.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	v, err := txn.Get([]byte("b"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, large)
+}
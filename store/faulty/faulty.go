@@ -0,0 +1,208 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faulty wraps a kv storage to inject faults for testing.
+//
+// The failpoints are armed on a Store with Enable, like
+//
+//	s.(*faulty.Store).Enable(faulty.Commit, faulty.Action{Err: kv.ErrConditionNotMatch, Nth: 2, Times: 1})
+//
+// which makes the second commit after it fail with kv.ErrConditionNotMatch.
+package faulty
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	_ kv.Driver          = Driver{}
+	_ kv.Storage         = (*Store)(nil)
+	_ kv.ReadOnlyChecker = (*Store)(nil)
+)
+
+// Failpoint names.
+const (
+	// Begin fails Storage Begin.
+	Begin = "begin"
+	// Get fails Get and BatchGet of the transactions and the snapshots.
+	Get = "get"
+	// Seek fails Seek, Scan and SeekReverse of the transactions and Scan of the snapshots.
+	Seek = "seek"
+	// Commit fails Transaction Commit, the transaction is rolled back.
+	Commit = "commit"
+)
+
+// Action is what a failpoint does when it is triggered.
+type Action struct {
+	// Err is returned by the call, a nil Err only injects Delay.
+	Err error
+	// Delay is the time the call sleeps before it runs or fails.
+	Delay time.Duration
+	// Nth triggers the failpoint from the Nth matched call after it is enabled,
+	// 0 is the same as 1.
+	Nth int
+	// Times is the number of the times the failpoint is triggered, 0 means no limit.
+	Times int
+	// Match filters the calls by the key, a commit matches if any of the
+	// written keys matches. A nil Match matches all the calls.
+	Match func(key []byte) bool
+	// Partial only works for Commit with a non-nil Err, the first Partial keys
+	// written by the transaction are committed before Err is returned, like a
+	// batch which is partially written.
+	Partial int
+}
+
+type failpoint struct {
+	action Action
+	calls  int
+	hits   int
+}
+
+// Driver implements kv.Driver interface, it opens a Store on the storage of Driver.
+type Driver struct {
+	Driver kv.Driver
+}
+
+// Open opens the storage and wraps it with a Store without any failpoint.
+func (d Driver) Open(schema string) (kv.Storage, error) {
+	s, err := d.Driver.Open(schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return NewStore(s), nil
+}
+
+// Store implements kv.Storage interface, it injects the faults
+// of the enabled failpoints to the wrapped storage.
+type Store struct {
+	kv.Storage
+
+	mu     sync.Mutex
+	points map[string]*failpoint
+	hits   map[string]int
+}
+
+// NewStore returns a Store which wraps s.
+func NewStore(s kv.Storage) *Store {
+	return &Store{
+		Storage: s,
+		points:  make(map[string]*failpoint),
+		hits:    make(map[string]int),
+	}
+}
+
+// Enable arms the failpoint name with the action, it replaces the one armed before.
+func (s *Store) Enable(name string, action Action) {
+	s.mu.Lock()
+	s.points[name] = &failpoint{action: action}
+	s.mu.Unlock()
+}
+
+// Disable disarms the failpoint name.
+func (s *Store) Disable(name string) {
+	s.mu.Lock()
+	delete(s.points, name)
+	s.mu.Unlock()
+}
+
+// DisableAll disarms all the failpoints.
+func (s *Store) DisableAll() {
+	s.mu.Lock()
+	s.points = make(map[string]*failpoint)
+	s.mu.Unlock()
+}
+
+// Hits returns the number of the times the failpoint name is triggered
+// since the Store is opened.
+func (s *Store) Hits(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[name]
+}
+
+// trigger checks the failpoint name for a call on keys, it sleeps for the Delay
+// of the triggered action, and returns the action or nil if not triggered.
+func (s *Store) trigger(name string, keys ...[]byte) *Action {
+	s.mu.Lock()
+	p, ok := s.points[name]
+	if !ok || !p.match(keys) {
+		s.mu.Unlock()
+		return nil
+	}
+	p.calls++
+	if p.calls < p.action.Nth || p.action.Times > 0 && p.hits >= p.action.Times {
+		s.mu.Unlock()
+		return nil
+	}
+	p.hits++
+	s.hits[name]++
+	action := p.action
+	s.mu.Unlock()
+
+	log.Warnf("[faulty] failpoint %s is triggered, err %v, delay %v", name, action.Err, action.Delay)
+	if action.Delay > 0 {
+		time.Sleep(action.Delay)
+	}
+	return &action
+}
+
+// inject returns the error of the failpoint name triggered by a call on keys.
+func (s *Store) inject(name string, keys ...[]byte) error {
+	if action := s.trigger(name, keys...); action != nil && action.Err != nil {
+		return errors.Trace(action.Err)
+	}
+	return nil
+}
+
+func (p *failpoint) match(keys [][]byte) bool {
+	if p.action.Match == nil {
+		return true
+	}
+	for _, k := range keys {
+		if p.action.Match(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Begin implements kv.Storage Begin interface.
+func (s *Store) Begin() (kv.Transaction, error) {
+	if err := s.inject(Begin); err != nil {
+		return nil, errors.Trace(err)
+	}
+	txn, err := s.Storage.Begin()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &txnWrapper{Transaction: txn, store: s, written: make(map[string]struct{})}, nil
+}
+
+// IsReadOnly implements kv.ReadOnlyChecker IsReadOnly interface.
+func (s *Store) IsReadOnly() bool {
+	return kv.IsReadOnly(s.Storage)
+}
+
+// GetSnapshot implements kv.Storage GetSnapshot interface.
+func (s *Store) GetSnapshot(ver kv.Version) (kv.Snapshot, error) {
+	snap, err := s.Storage.GetSnapshot(ver)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &snapshotWrapper{Snapshot: snap, store: s}, nil
+}
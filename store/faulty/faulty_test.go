@@ -0,0 +1,153 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faulty
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testFaultySuite{})
+
+type testFaultySuite struct {
+	s *Store
+}
+
+var errInjected = errors.New("injected")
+
+func (t *testFaultySuite) SetUpTest(c *C) {
+	s, err := Driver{localstore.Driver{Driver: goleveldb.MemoryDriver{}}}.Open("memory:faulty")
+	c.Assert(err, IsNil)
+	t.s = s.(*Store)
+}
+
+func (t *testFaultySuite) TearDownTest(c *C) {
+	t.s.Close()
+}
+
+func (t *testFaultySuite) set(c *C, keys ...string) error {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	for _, k := range keys {
+		c.Assert(txn.Set([]byte(k), []byte(k)), IsNil)
+	}
+	return txn.Commit()
+}
+
+func (t *testFaultySuite) get(c *C, key string) []byte {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	v, err := txn.Get([]byte(key))
+	if kv.IsErrNotFound(err) {
+		return nil
+	}
+	c.Assert(err, IsNil)
+	return v
+}
+
+func (t *testFaultySuite) TestGetAndSeek(c *C) {
+	c.Assert(t.set(c, "a", "b"), IsNil)
+
+	t.s.Enable(Get, Action{Err: errInjected, Match: func(k []byte) bool {
+		return bytes.Equal(k, []byte("b"))
+	}})
+	c.Assert(t.get(c, "a"), DeepEquals, []byte("a"))
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("b"))
+	c.Assert(errors2.ErrorEqual(err, errInjected), IsTrue)
+	_, err = txn.BatchGet([][]byte{[]byte("a"), []byte("b")})
+	c.Assert(errors2.ErrorEqual(err, errInjected), IsTrue)
+	c.Assert(t.s.Hits(Get), Equals, 2)
+
+	t.s.Enable(Seek, Action{Err: errInjected, Times: 1})
+	_, err = txn.Seek([]byte("a"), nil)
+	c.Assert(errors2.ErrorEqual(err, errInjected), IsTrue)
+	it, err := txn.Scan([]byte("a"), nil, 0)
+	c.Assert(err, IsNil)
+	it.Close()
+	txn.Rollback()
+
+	snap, err := t.s.GetSnapshot(kv.MaxVersion)
+	c.Assert(err, IsNil)
+	_, err = snap.Get([]byte("b"))
+	c.Assert(errors2.ErrorEqual(err, errInjected), IsTrue)
+	snap.Release()
+
+	t.s.DisableAll()
+	c.Assert(t.get(c, "b"), DeepEquals, []byte("b"))
+	c.Assert(t.s.Hits(Get), Equals, 3)
+	c.Assert(t.s.Hits(Seek), Equals, 1)
+}
+
+func (t *testFaultySuite) TestCommit(c *C) {
+	t.s.Enable(Commit, Action{Err: kv.ErrConditionNotMatch, Nth: 2, Times: 1})
+	c.Assert(t.set(c, "a"), IsNil)
+	err := t.set(c, "b")
+	c.Assert(kv.IsRetryableError(err), IsTrue)
+	c.Assert(t.get(c, "b"), IsNil)
+	c.Assert(t.set(c, "c"), IsNil)
+	c.Assert(t.s.Hits(Commit), Equals, 1)
+
+	// RunInNewTxn retries the transaction.
+	t.s.Enable(Commit, Action{Err: kv.ErrConditionNotMatch, Times: 2})
+	n := 0
+	err = kv.RunInNewTxn(t.s, true, func(txn kv.Transaction) error {
+		n++
+		return txn.Set([]byte("d"), []byte("d"))
+	})
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(t.get(c, "d"), DeepEquals, []byte("d"))
+	c.Assert(t.s.Hits(Commit), Equals, 3)
+}
+
+func (t *testFaultySuite) TestPartialCommit(c *C) {
+	c.Assert(t.set(c, "c"), IsNil)
+
+	t.s.Enable(Commit, Action{Err: errInjected, Partial: 2})
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("a"), []byte("a")), IsNil)
+	c.Assert(txn.Delete([]byte("c")), IsNil)
+	c.Assert(txn.Set([]byte("b"), []byte("b")), IsNil)
+	err = txn.Commit()
+	c.Assert(errors2.ErrorEqual(err, errInjected), IsTrue)
+	t.s.Disable(Commit)
+
+	c.Assert(t.get(c, "a"), DeepEquals, []byte("a"))
+	c.Assert(t.get(c, "c"), IsNil)
+	c.Assert(t.get(c, "b"), IsNil)
+}
+
+func (t *testFaultySuite) TestDelay(c *C) {
+	t.s.Enable(Begin, Action{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	c.Assert(t.set(c, "a"), IsNil)
+	c.Assert(time.Since(start) >= 50*time.Millisecond, IsTrue)
+	c.Assert(t.s.Hits(Begin), Equals, 1)
+}
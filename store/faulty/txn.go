@@ -0,0 +1,208 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faulty
+
+import (
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	_ kv.Transaction       = (*txnWrapper)(nil)
+	_ kv.TxnBufferReporter = (*txnWrapper)(nil)
+	_ kv.Snapshot          = (*snapshotWrapper)(nil)
+)
+
+type txnWrapper struct {
+	kv.Transaction
+	store *Store
+	// keys is the keys written by the transaction in the order they are first written.
+	keys    [][]byte
+	written map[string]struct{}
+}
+
+func (txn *txnWrapper) markWritten(k []byte) {
+	if _, ok := txn.written[string(k)]; ok {
+		return
+	}
+	txn.written[string(k)] = struct{}{}
+	txn.keys = append(txn.keys, append([]byte(nil), k...))
+}
+
+// Get implements kv.Transaction Get interface.
+func (txn *txnWrapper) Get(k []byte) ([]byte, error) {
+	if err := txn.store.inject(Get, k); err != nil {
+		return nil, errors.Trace(err)
+	}
+	v, err := txn.Transaction.Get(k)
+	return v, errors.Trace(err)
+}
+
+// BatchGet implements kv.Transaction BatchGet interface.
+func (txn *txnWrapper) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	if err := txn.store.inject(Get, keys...); err != nil {
+		return nil, errors.Trace(err)
+	}
+	m, err := txn.Transaction.BatchGet(keys)
+	return m, errors.Trace(err)
+}
+
+// Set implements kv.Transaction Set interface.
+func (txn *txnWrapper) Set(k []byte, v []byte) error {
+	if err := txn.Transaction.Set(k, v); err != nil {
+		return errors.Trace(err)
+	}
+	txn.markWritten(k)
+	return nil
+}
+
+// Inc implements kv.Transaction Inc interface.
+func (txn *txnWrapper) Inc(k []byte, step int64) (int64, error) {
+	n, err := txn.Transaction.Inc(k, step)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	txn.markWritten(k)
+	return n, nil
+}
+
+// Delete implements kv.Transaction Delete interface.
+func (txn *txnWrapper) Delete(k []byte) error {
+	if err := txn.Transaction.Delete(k); err != nil {
+		return errors.Trace(err)
+	}
+	txn.markWritten(k)
+	return nil
+}
+
+// Seek implements kv.Transaction Seek interface.
+func (txn *txnWrapper) Seek(k []byte, fnKeyCmp func(key []byte) bool) (kv.Iterator, error) {
+	if err := txn.store.inject(Seek, k); err != nil {
+		return nil, errors.Trace(err)
+	}
+	it, err := txn.Transaction.Seek(k, fnKeyCmp)
+	return it, errors.Trace(err)
+}
+
+// Scan implements kv.Transaction Scan interface.
+func (txn *txnWrapper) Scan(start, end []byte, limit int) (kv.Iterator, error) {
+	if err := txn.store.inject(Seek, start); err != nil {
+		return nil, errors.Trace(err)
+	}
+	it, err := txn.Transaction.Scan(start, end, limit)
+	return it, errors.Trace(err)
+}
+
+// SeekReverse implements kv.Transaction SeekReverse interface.
+func (txn *txnWrapper) SeekReverse(k []byte) (kv.Iterator, error) {
+	if err := txn.store.inject(Seek, k); err != nil {
+		return nil, errors.Trace(err)
+	}
+	it, err := txn.Transaction.SeekReverse(k)
+	return it, errors.Trace(err)
+}
+
+// Commit implements kv.Transaction Commit interface.
+func (txn *txnWrapper) Commit() error {
+	action := txn.store.trigger(Commit, txn.keys...)
+	if action == nil || action.Err == nil {
+		return errors.Trace(txn.Transaction.Commit())
+	}
+	if action.Partial > 0 {
+		if err := txn.commitPartial(action.Partial); err != nil {
+			log.Errorf("[faulty] commit partial transaction error %v", err)
+		}
+	}
+	txn.Transaction.Rollback()
+	return errors.Trace(action.Err)
+}
+
+// commitPartial commits the first n keys written by txn in a new transaction.
+func (txn *txnWrapper) commitPartial(n int) error {
+	if n > len(txn.keys) {
+		n = len(txn.keys)
+	}
+	values := make([][]byte, n)
+	for i, k := range txn.keys[:n] {
+		v, err := txn.Transaction.Get(k)
+		if err != nil && !kv.IsErrNotFound(err) {
+			return errors.Trace(err)
+		}
+		values[i] = v
+	}
+
+	return kv.RunInNewTxn(txn.store.Storage, false, func(partial kv.Transaction) error {
+		for i, k := range txn.keys[:n] {
+			var err error
+			if values[i] == nil {
+				err = partial.Delete(k)
+			} else {
+				err = partial.Set(k, values[i])
+			}
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	})
+}
+
+// BufferLen implements kv.TxnBufferReporter BufferLen interface.
+func (txn *txnWrapper) BufferLen() int {
+	if r, ok := txn.Transaction.(kv.TxnBufferReporter); ok {
+		return r.BufferLen()
+	}
+	return 0
+}
+
+// BufferSize implements kv.TxnBufferReporter BufferSize interface.
+func (txn *txnWrapper) BufferSize() int {
+	if r, ok := txn.Transaction.(kv.TxnBufferReporter); ok {
+		return r.BufferSize()
+	}
+	return 0
+}
+
+type snapshotWrapper struct {
+	kv.Snapshot
+	store *Store
+}
+
+// Get implements kv.Snapshot Get interface.
+func (s *snapshotWrapper) Get(k []byte) ([]byte, error) {
+	if err := s.store.inject(Get, k); err != nil {
+		return nil, errors.Trace(err)
+	}
+	v, err := s.Snapshot.Get(k)
+	return v, errors.Trace(err)
+}
+
+// BatchGet implements kv.Snapshot BatchGet interface.
+func (s *snapshotWrapper) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	if err := s.store.inject(Get, keys...); err != nil {
+		return nil, errors.Trace(err)
+	}
+	m, err := s.Snapshot.BatchGet(keys)
+	return m, errors.Trace(err)
+}
+
+// Scan implements kv.Snapshot Scan interface.
+func (s *snapshotWrapper) Scan(start, end []byte, limit int) (kv.Iterator, error) {
+	if err := s.store.inject(Seek, start); err != nil {
+		return nil, errors.Trace(err)
+	}
+	it, err := s.Snapshot.Scan(start, end, limit)
+	return it, errors.Trace(err)
+}
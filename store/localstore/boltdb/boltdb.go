@@ -14,6 +14,7 @@
 package boltdb
 
 import (
+	"bytes"
 	"os"
 	"path"
 
@@ -75,7 +76,7 @@ func (d *db) Commit(b engine.Batch) error {
 		// err1 is used for passing `go tool vet --shadow` check.
 		var err1 error
 		for _, w := range bt.Writes {
-			if w.Value != nil {
+			if !w.isDelete {
 				err1 = b.Put(w.Key, w.Value)
 			} else {
 				err1 = b.Delete(w.Key)
@@ -91,6 +92,29 @@ func (d *db) Commit(b engine.Batch) error {
 	return errors.Trace(err)
 }
 
+// DeleteRange implements engine.DB DeleteRange interface, the keys are deleted in one transaction.
+func (d *db) DeleteRange(start, end []byte) error {
+	err := d.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		// The keys are collected first, a cursor may skip a key after a deletion.
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.Seek(start); k != nil; k, _ = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				break
+			}
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	})
+	return errors.Trace(err)
+}
+
 func (d *db) Close() error {
 	return d.DB.Close()
 }
@@ -111,8 +135,12 @@ func (s *snapshot) Get(key []byte) ([]byte, error) {
 	return value, nil
 }
 
-func (s *snapshot) NewIterator(startKey []byte) engine.Iterator {
-	return &iterator{tx: s.Tx, key: startKey}
+func (s *snapshot) NewIterator(startKey []byte, endKey []byte) engine.Iterator {
+	return &iterator{tx: s.Tx, key: startKey, end: endKey}
+}
+
+func (s *snapshot) NewReverseIterator(endKey []byte) engine.Iterator {
+	return &iterator{tx: s.Tx, key: endKey, reverse: true}
 }
 
 func (s *snapshot) Release() {
@@ -126,11 +154,17 @@ type iterator struct {
 	tx *bolt.Tx
 	*bolt.Cursor
 
-	key   []byte
-	value []byte
+	key     []byte
+	value   []byte
+	end     []byte
+	reverse bool
 }
 
 func (i *iterator) Next() bool {
+	if i.reverse {
+		return i.prev()
+	}
+
 	if i.Cursor == nil {
 		i.Cursor = i.tx.Bucket(bucketName).Cursor()
 		if i.key == nil {
@@ -142,6 +176,27 @@ func (i *iterator) Next() bool {
 		i.key, i.value = i.Cursor.Next()
 	}
 
+	if i.end != nil && bytes.Compare(i.key, i.end) >= 0 {
+		i.key, i.value = nil, nil
+	}
+	return i.key != nil
+}
+
+func (i *iterator) prev() bool {
+	if i.Cursor == nil {
+		i.Cursor = i.tx.Bucket(bucketName).Cursor()
+		if i.key == nil {
+			i.key, i.value = i.Cursor.Last()
+		} else if i.key, i.value = i.Cursor.Seek(i.key); i.key == nil {
+			// All keys are less than the end key.
+			i.key, i.value = i.Cursor.Last()
+		} else {
+			i.key, i.value = i.Cursor.Prev()
+		}
+	} else {
+		i.key, i.value = i.Cursor.Prev()
+	}
+
 	return i.key != nil
 }
 
@@ -158,8 +213,9 @@ func (i *iterator) Release() {
 }
 
 type write struct {
-	Key   []byte
-	Value []byte
+	Key      []byte
+	Value    []byte
+	isDelete bool
 }
 
 type batch struct {
@@ -167,17 +223,20 @@ type batch struct {
 }
 
 func (b *batch) Put(key []byte, value []byte) {
+	// Value may be empty, so use isDelete instead of a nil Value
+	// to distinguish a put from a delete.
 	w := write{
 		Key:   append([]byte(nil), key...),
-		Value: append([]byte(nil), value...),
+		Value: append([]byte{}, value...),
 	}
 	b.Writes = append(b.Writes, w)
 }
 
 func (b *batch) Delete(key []byte) {
 	w := write{
-		Key:   append([]byte(nil), key...),
-		Value: nil,
+		Key:      append([]byte(nil), key...),
+		Value:    nil,
+		isDelete: true,
 	}
 	b.Writes = append(b.Writes, w)
 }
@@ -187,7 +246,31 @@ type Driver struct {
 }
 
 // Open opens or creates a local storage database with given path.
+// The options of the database are in the query of the path, which are
+//
+//	bolt_nosync  skip fsync after every commit, false by default.
+//	read_only    open the database in read-only mode, false by default.
 func (driver Driver) Open(dbPath string) (engine.DB, error) {
+	dbPath, opts, err := engine.ParsePath(dbPath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	noSync, err := opts.Bool("bolt_nosync", false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	readOnly, err := opts.Bool("read_only", false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = opts.Check("boltdb"); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if readOnly {
+		return openReadOnly(dbPath)
+	}
+
 	base := path.Dir(dbPath)
 	os.MkdirAll(base, 0755)
 
@@ -195,6 +278,7 @@ func (driver Driver) Open(dbPath string) (engine.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	d.NoSync = noSync
 
 	tx, err := d.Begin(true)
 	if err != nil {
@@ -212,3 +296,27 @@ func (driver Driver) Open(dbPath string) (engine.DB, error) {
 
 	return &db{d}, nil
 }
+
+// openReadOnly opens an existing database in read-only mode.
+func openReadOnly(dbPath string) (engine.DB, error) {
+	// bolt creates the file if it doesn't exist, and leaks the file lock when it fails to
+	// initialize the file in read-only mode.
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, errors.Trace(err)
+	}
+	d, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	err = d.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketName) == nil {
+			return errors.Errorf("no bucket %s in %s", bucketName, dbPath)
+		}
+		return nil
+	})
+	if err != nil {
+		d.Close()
+		return nil, errors.Trace(err)
+	}
+	return &db{d}, nil
+}
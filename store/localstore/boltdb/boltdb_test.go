@@ -14,6 +14,7 @@
 package boltdb
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -77,7 +78,7 @@ func (s *testSuite) TestDB(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(v, IsNil)
 
-	iter := snap.NewIterator(nil)
+	iter := snap.NewIterator(nil, nil)
 	c.Assert(iter.Next(), Equals, true)
 	c.Assert(iter.Key(), DeepEquals, []byte("a"))
 	c.Assert(iter.Next(), Equals, true)
@@ -85,7 +86,7 @@ func (s *testSuite) TestDB(c *C) {
 	c.Assert(iter.Next(), Equals, false)
 	iter.Release()
 
-	iter = snap.NewIterator([]byte("b"))
+	iter = snap.NewIterator([]byte("b"), nil)
 	c.Assert(iter.Next(), Equals, true)
 	c.Assert(iter.Key(), DeepEquals, []byte("b"))
 	c.Assert(iter.Value(), DeepEquals, []byte("2"))
@@ -93,3 +94,166 @@ func (s *testSuite) TestDB(c *C) {
 
 	snap.Release()
 }
+
+func (s *testSuite) TestEmptyValue(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("e"), []byte{})
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewIterator([]byte("e"), nil)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("e"))
+	c.Assert(iter.Value(), HasLen, 0)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("e"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestReverseIterator(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("r1"), []byte("1"))
+	b.Put([]byte("r2"), []byte("2"))
+	b.Put([]byte("r3"), []byte("3"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewReverseIterator([]byte("r3"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r2"))
+	c.Assert(iter.Value(), DeepEquals, []byte("2"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r1"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("r25"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r2"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("s"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r3"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator(nil)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r3"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("0"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("r1"))
+	b.Delete([]byte("r2"))
+	b.Delete([]byte("r3"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestRangeIterator(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("s1"), []byte("1"))
+	b.Put([]byte("s2"), []byte("2"))
+	b.Put([]byte("s3"), []byte("3"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewIterator([]byte("s1"), []byte("s3"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("s1"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("s2"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	iter = snap.NewIterator([]byte("s2"), []byte("s2"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("s1"))
+	b.Delete([]byte("s2"))
+	b.Delete([]byte("s3"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestOptions(c *C) {
+	path := testPath + "-options"
+	defer os.Remove(path)
+
+	var d Driver
+	_, err := d.Open(path + "?read_only=true")
+	c.Assert(err, NotNil)
+	_, err = d.Open(path + "?sync=true")
+	c.Assert(err, NotNil)
+
+	db, err := d.Open(path + "?bolt_nosync=1")
+	c.Assert(err, IsNil)
+	b := db.NewBatch()
+	b.Put([]byte("a"), []byte("1"))
+	c.Assert(db.Commit(b), IsNil)
+	db.Close()
+
+	db, err = d.Open(path + "?read_only=true")
+	c.Assert(err, IsNil)
+	v, err := db.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("1"))
+	b = db.NewBatch()
+	b.Put([]byte("b"), []byte("2"))
+	c.Assert(db.Commit(b), NotNil)
+	db.Close()
+}
+
+func (s *testSuite) TestDeleteRange(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	for i := 0; i < 3000; i++ {
+		b.Put([]byte(fmt.Sprintf("d%04d", i)), []byte("v"))
+	}
+	b.Put([]byte("e"), []byte("v"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	err = db.DeleteRange([]byte("d0010"), []byte("e"))
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	iter := snap.NewIterator([]byte("d"), nil)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	c.Assert(keys, HasLen, 11)
+	c.Assert(keys[9], Equals, "d0009")
+	c.Assert(keys[10], Equals, "e")
+}
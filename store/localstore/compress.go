@@ -0,0 +1,160 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// Compression modes, set by the compression parameter of the store path,
+// like goleveldb:///path?compression=snappy.
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+)
+
+// The header byte of the values written after the compression is enabled.
+const (
+	valueRaw byte = iota
+	valueSnappy
+)
+
+// compressThreshold is the minimum size of the values to be compressed.
+const compressThreshold = 64
+
+// compressMetaKey stores the compression mode and the version it is enabled at.
+// It is out of the range of the mvcc encoded keys, see mvccEncodeEndKey.
+var compressMetaKey = []byte("\xff\xffcompression")
+
+// compressor encodes the values of a store. Once the compression is enabled,
+// all the values committed after version since have a header byte, the older
+// values are read as they are, so they don't need to be rewritten.
+type compressor struct {
+	snappy bool
+	since  kv.Version
+
+	values     int64
+	compressed int64
+	rawSize    int64
+	storedSize int64
+}
+
+// parseCompression removes the compression option from the path.
+func parseCompression(path string) (string, string, error) {
+	path, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	mode := opts.String("compression", "")
+	if mode != "" && mode != CompressionNone && mode != CompressionSnappy {
+		return "", "", errors.Errorf("invalid compression %s", mode)
+	}
+	return engine.JoinPath(path, opts), mode, nil
+}
+
+// loadCompressor returns the compressor of db, or nil if the compression has never been enabled.
+// If mode is not empty, it is saved as the mode of db, enabled at version cur if it is the first time.
+func loadCompressor(db engine.DB, mode string, cur kv.Version) (*compressor, error) {
+	data, err := db.Get(compressMetaKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c := &compressor{since: cur}
+	if data != nil {
+		if len(data) == 0 {
+			return nil, errors.Errorf("invalid compression meta %q", data)
+		}
+		_, since, err1 := codec.DecodeUint(data[1:])
+		if err1 != nil {
+			return nil, errors.Trace(err1)
+		}
+		c.snappy, c.since = data[0] == valueSnappy, kv.NewVersion(since)
+	} else if mode == "" {
+		return nil, nil
+	}
+	if mode == "" || data != nil && (mode == CompressionSnappy) == c.snappy {
+		return c, nil
+	}
+
+	c.snappy = mode == CompressionSnappy
+	header := valueRaw
+	if c.snappy {
+		header = valueSnappy
+	}
+	b := db.NewBatch()
+	b.Put(compressMetaKey, codec.EncodeUint([]byte{header}, c.since.Ver))
+	if err = db.Commit(b); err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.Infof("set compression %s since version %d", mode, c.since.Ver)
+	return c, nil
+}
+
+// encode returns the value to be stored, the result is never empty.
+func (c *compressor) encode(v []byte) []byte {
+	if c == nil {
+		return v
+	}
+	atomic.AddInt64(&c.values, 1)
+	atomic.AddInt64(&c.rawSize, int64(len(v)))
+	if c.snappy && len(v) >= compressThreshold {
+		b := make([]byte, 1+snappy.MaxEncodedLen(len(v)))
+		b[0] = valueSnappy
+		b = b[:1+len(snappy.Encode(b[1:], v))]
+		// Keep the value which is not compressible.
+		if len(b) < len(v) {
+			atomic.AddInt64(&c.compressed, 1)
+			atomic.AddInt64(&c.storedSize, int64(len(b)))
+			return b
+		}
+	}
+	atomic.AddInt64(&c.storedSize, int64(len(v)+1))
+	return append([]byte{valueRaw}, v...)
+}
+
+// decode returns the value of a stored one committed at version ver.
+// A tombstone is returned as it is.
+func (c *compressor) decode(v []byte, ver kv.Version) ([]byte, error) {
+	if c == nil || len(v) == 0 || ver.Cmp(c.since) <= 0 {
+		return v, nil
+	}
+	switch v[0] {
+	case valueRaw:
+		return v[1:], nil
+	case valueSnappy:
+		b, err := snappy.Decode(nil, v[1:])
+		return b, errors.Trace(err)
+	default:
+		return nil, errors.Errorf("invalid value header %d", v[0])
+	}
+}
+
+func (c *compressor) stats() kv.CompressionStats {
+	if c == nil {
+		return kv.CompressionStats{}
+	}
+	return kv.CompressionStats{
+		Values:     atomic.LoadInt64(&c.values),
+		Compressed: atomic.LoadInt64(&c.compressed),
+		RawSize:    atomic.LoadInt64(&c.rawSize),
+		StoredSize: atomic.LoadInt64(&c.storedSize),
+	}
+}
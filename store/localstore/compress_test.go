@@ -0,0 +1,213 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+const testCompressPath = "/tmp/test-tidb-compress"
+
+var _ = Suite(&testCompressSuite{})
+
+type testCompressSuite struct {
+}
+
+func (t *testCompressSuite) SetUpTest(c *C) {
+	os.RemoveAll(testCompressPath)
+}
+
+func (t *testCompressSuite) TearDownTest(c *C) {
+	os.RemoveAll(testCompressPath)
+}
+
+func (t *testCompressSuite) open(c *C, params string) kv.Storage {
+	s, err := Driver{goleveldb.Driver{}}.Open(testCompressPath + params)
+	c.Assert(err, IsNil)
+	return s
+}
+
+func (t *testCompressSuite) set(c *C, s kv.Storage, key string, value []byte) {
+	err := kv.RunInNewTxn(s, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte(key), value)
+	})
+	c.Assert(err, IsNil)
+}
+
+func (t *testCompressSuite) check(c *C, s kv.Storage, values map[string][]byte) {
+	txn, err := s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	for k, v := range values {
+		got, err1 := txn.Get([]byte(k))
+		c.Assert(err1, IsNil)
+		c.Assert(got, DeepEquals, v)
+	}
+
+	// The reverse iterator reads the values in another way.
+	it, err := txn.SeekReverse(nil)
+	c.Assert(err, IsNil)
+	n := 0
+	for it.Valid() {
+		c.Assert(it.Value(), DeepEquals, values[it.Key()])
+		n++
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	it.Close()
+	c.Assert(n, Equals, len(values))
+}
+
+// rawValue returns the newest value of key stored in the engine.
+func rawValue(c *C, s kv.Storage, key string) []byte {
+	snap, err := s.(*dbStore).db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	v, _, err := mvccSeek(snap, kv.EncodeKey([]byte(key)), kv.NewVersion(kv.MaxVersion.Ver-1))
+	c.Assert(err, IsNil)
+	return v
+}
+
+func (t *testCompressSuite) TestCompress(c *C) {
+	large := []byte(strings.Repeat("tidb", 100))
+	values := map[string][]byte{
+		"old":   large,
+		"large": large,
+		"small": []byte("small"),
+	}
+
+	s := t.open(c, "")
+	t.set(c, s, "old", large)
+	c.Assert(s.(kv.CompressionReporter).CompressionStats().Values, Equals, int64(0))
+	c.Assert(s.Close(), IsNil)
+
+	s = t.open(c, "?compression=snappy")
+	t.set(c, s, "large", large)
+	t.set(c, s, "small", values["small"])
+	t.check(c, s, values)
+	c.Assert(rawValue(c, s, "old"), DeepEquals, large)
+	c.Assert(rawValue(c, s, "small")[0], Equals, valueRaw)
+	raw := rawValue(c, s, "large")
+	c.Assert(raw[0], Equals, valueSnappy)
+	c.Assert(len(raw), Less, len(large))
+
+	stats := s.(kv.CompressionReporter).CompressionStats()
+	c.Assert(stats.Values, Equals, int64(2))
+	c.Assert(stats.Compressed, Equals, int64(1))
+	c.Assert(stats.RawSize, Equals, int64(len(large)+len("small")))
+	c.Assert(stats.Ratio() > 1, IsTrue)
+	c.Assert(s.Close(), IsNil)
+
+	// The mode is saved in the store.
+	s = t.open(c, "")
+	t.set(c, s, "large2", large)
+	values["large2"] = large
+	c.Assert(rawValue(c, s, "large2")[0], Equals, valueSnappy)
+	c.Assert(s.Close(), IsNil)
+
+	s = t.open(c, "?compression=none")
+	t.set(c, s, "large3", large)
+	values["large3"] = large
+	raw = rawValue(c, s, "large3")
+	c.Assert(raw[0], Equals, valueRaw)
+	c.Assert(bytes.Equal(raw[1:], large), IsTrue)
+	t.check(c, s, values)
+	c.Assert(s.Close(), IsNil)
+}
+
+func (t *testCompressSuite) TestParseCompression(c *C) {
+	path, mode, err := parseCompression("/tmp/a")
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, "/tmp/a")
+	c.Assert(mode, Equals, "")
+
+	path, mode, err = parseCompression("/tmp/a?compression=snappy")
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, "/tmp/a")
+	c.Assert(mode, Equals, CompressionSnappy)
+
+	path, mode, err = parseCompression("/tmp/a?keyfile=k&compression=none")
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, "/tmp/a?keyfile=k")
+	c.Assert(mode, Equals, CompressionNone)
+
+	_, _, err = parseCompression("/tmp/a?compression=zlib")
+	c.Assert(err, NotNil)
+}
+
+// putRaw writes the entry key/value to the engine of s.
+func putRaw(c *C, s kv.Storage, key, value []byte) {
+	db := s.(*dbStore).db
+	b := db.NewBatch()
+	b.Put(key, value)
+	c.Assert(db.Commit(b), IsNil)
+}
+
+// scanErr returns the error of scanning all the keys of txn.
+func scanErr(txn kv.Transaction, reverse bool) error {
+	var it kv.Iterator
+	var err error
+	if reverse {
+		it, err = txn.SeekReverse(nil)
+	} else {
+		it, err = txn.Scan(nil, nil, 0)
+	}
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Valid() {
+		if it, err = it.Next(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *testCompressSuite) TestCorrupt(c *C) {
+	s := t.open(c, "?compression=snappy")
+	defer s.Close()
+	t.set(c, s, "a", []byte("1"))
+	t.set(c, s, "c", []byte("1"))
+
+	// A value which can't be decompressed fails the scans like Get.
+	ver, err := s.CurrentVersion()
+	c.Assert(err, IsNil)
+	putRaw(c, s, MvccEncodeVersionKey(kv.EncodeKey([]byte("b")), ver), []byte{valueSnappy, 0xff, 0xff})
+	txn, err := s.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("b"))
+	c.Assert(err, NotNil)
+	c.Assert(scanErr(txn, false), NotNil)
+	c.Assert(scanErr(txn, true), NotNil)
+	_, err = txn.BatchGet([][]byte{[]byte("a"), []byte("b")})
+	c.Assert(err, NotNil)
+	c.Assert(txn.Rollback(), IsNil)
+	t.set(c, s, "b", []byte("1"))
+
+	// So does a key which is not an MVCC key.
+	putRaw(c, s, codec.EncodeBytes(nil, kv.EncodeKey([]byte("bb"))), []byte("1"))
+	txn, err = s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(scanErr(txn, false), NotNil)
+	c.Assert(scanErr(txn, true), NotNil)
+	c.Assert(txn.Rollback(), IsNil)
+}
@@ -0,0 +1,326 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+var (
+	// gcRangePrefix is the prefix of the keys which store the tombstones of the
+	// dropped ranges. The key of a tombstone is
+	//
+	//	prefix + EncodeUint(commitVersion) + EncodeBytes(startKey)
+	//
+	// and the value is EncodeBytes(endKey). They are out of the range of the mvcc
+	// encoded keys, see mvccEncodeEndKey.
+	gcRangePrefix = []byte("\xff\xffgc_range")
+	// deletedRangePrefix is the prefix of the keys which store the tombstones of
+	// the ranges deleted by DeleteRange, the layout is the same as gcRangePrefix.
+	deletedRangePrefix = []byte("\xff\xffdel_range")
+)
+
+const (
+	// gcInterval is the interval of the gc worker checking the range tombstones.
+	gcInterval = time.Minute
+	// gcBatchSize is the max number of the versions removed in a batch by the gc worker.
+	gcBatchSize = 1024
+)
+
+// rangeTombstone deletes all the keys in a range at version ver. The versions
+// of the keys older than ver are hidden from the reads of the versions >= ver,
+// no key in the range is written when it is committed. The gc worker removes
+// the hidden versions and the tombstone after no transaction reads them.
+type rangeTombstone struct {
+	kv.KeyRange
+	ver uint64
+	// drop means all the versions of the keys are removed by the gc worker,
+	// the keys in a dropped range are never written again.
+	drop bool
+}
+
+func (t rangeTombstone) metaKey() []byte {
+	prefix := deletedRangePrefix
+	if t.drop {
+		prefix = gcRangePrefix
+	}
+	key := codec.EncodeUint(append([]byte(nil), prefix...), t.ver)
+	return codec.EncodeBytes(key, t.StartKey)
+}
+
+// rangeTombstones is never changed once it is read by a snapshot,
+// it is copied to add or remove a tombstone.
+type rangeTombstones []rangeTombstone
+
+// visibleTo returns the tombstones read by the snapshot of ver.
+func (ts rangeTombstones) visibleTo(ver kv.Version) rangeTombstones {
+	var visible rangeTombstones
+	for _, t := range ts {
+		if t.ver <= ver.Ver {
+			visible = append(visible, t)
+		}
+	}
+	return visible
+}
+
+// hides returns true if the version ver of key is deleted by any of ts.
+func (ts rangeTombstones) hides(key []byte, ver kv.Version) bool {
+	for _, t := range ts {
+		if ver.Ver < t.ver && t.Contains(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts rangeTombstones) add(added rangeTombstones) rangeTombstones {
+	return append(append(rangeTombstones(nil), ts...), added...)
+}
+
+func (ts rangeTombstones) remove(t rangeTombstone) rangeTombstones {
+	var remain rangeTombstones
+	for _, v := range ts {
+		if v.ver != t.ver || !bytes.Equal(v.StartKey, t.StartKey) {
+			remain = append(remain, v)
+		}
+	}
+	return remain
+}
+
+// loadTombstones returns the range tombstones saved in db and their max version.
+func loadTombstones(db engine.DB) (rangeTombstones, uint64, error) {
+	snapshot, err := db.GetSnapshot()
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	defer snapshot.Release()
+
+	var (
+		ts     rangeTombstones
+		maxVer uint64
+	)
+	for _, prefix := range [][]byte{gcRangePrefix, deletedRangePrefix} {
+		it := snapshot.NewIterator(prefix, kv.PrefixNext(prefix))
+		for it.Next() {
+			remain, ver, err1 := codec.DecodeUint(it.Key()[len(prefix):])
+			if err1 != nil {
+				it.Release()
+				return nil, 0, errors.Trace(err1)
+			}
+			_, start, err1 := codec.DecodeBytes(remain)
+			if err1 != nil {
+				it.Release()
+				return nil, 0, errors.Trace(err1)
+			}
+			_, end, err1 := codec.DecodeBytes(it.Value())
+			if err1 != nil {
+				it.Release()
+				return nil, 0, errors.Trace(err1)
+			}
+			ts = append(ts, rangeTombstone{
+				KeyRange: kv.KeyRange{StartKey: start, EndKey: end},
+				ver:      ver,
+				drop:     bytes.Equal(prefix, gcRangePrefix),
+			})
+			if ver > maxVer {
+				maxVer = ver
+			}
+		}
+		it.Release()
+	}
+	return ts, maxVer, nil
+}
+
+// deleteRanges puts the tombstones of the deleted ranges of txn with commitVer
+// to b, they are added to s.tombstones after b is written. If withMutations is
+// true, it also returns the mutations of the deleted keys, then it must be called
+// with s.mu held and the writes committed before must be written, see writeExclusive.
+func (s *dbStore) deleteRanges(b engine.Batch, txn *dbTxn, commitVer kv.Version, withMutations bool) (rangeTombstones, []kv.Mutation, error) {
+	var ts rangeTombstones
+	for _, r := range txn.UnionStore.DeletedRanges {
+		t := rangeTombstone{KeyRange: r, ver: commitVer.Ver, drop: txn.isDropped(r)}
+		b.Put(t.metaKey(), codec.EncodeBytes(nil, r.EndKey))
+		ts = append(ts, t)
+	}
+	if len(ts) == 0 || !withMutations {
+		return ts, nil, nil
+	}
+
+	snapshot, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	defer snapshot.Release()
+
+	var mutations []kv.Mutation
+	for _, t := range ts {
+		it := snapshot.NewIterator(codec.EncodeBytes(nil, t.StartKey), mvccEncodeEndKey(t.EndKey))
+		var last []byte
+		for it.Next() {
+			key, ver, err1 := MvccDecode(it.Key())
+			if err1 != nil {
+				it.Release()
+				return nil, nil, errors.Trace(err1)
+			}
+			// Only the newest committed version of a key is checked.
+			if isLockVersion(ver) || last != nil && bytes.Equal(key, last) {
+				continue
+			}
+			last = key
+			if isTombstone(it.Value()) || s.tombstones.hides(key, ver) {
+				continue
+			}
+			old, err1 := s.compressor.decode(append([]byte(nil), it.Value()...), ver)
+			if err1 != nil {
+				it.Release()
+				return nil, nil, errors.Trace(err1)
+			}
+			mutations = append(mutations, kv.Mutation{Key: kv.DecodeKey(key), OldValue: old})
+		}
+		it.Release()
+	}
+	return ts, mutations, nil
+}
+
+// safePoint returns the min start version of the running transactions,
+// the data deleted before it is never read by them.
+func (s *dbStore) safePoint() kv.Version {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ver := kv.MaxVersion
+	for _, txn := range s.txns {
+		if txn.version.Cmp(ver) < 0 {
+			ver = txn.version
+		}
+	}
+	return ver
+}
+
+// gcDeletedRanges removes the versions hidden by the range tombstones committed
+// before the safe point, then the tombstones. It returns the number of the
+// removed tombstones. The snapshots got by GetSnapshot are not checked, they
+// can't read the deleted data after it is removed.
+func (s *dbStore) gcDeletedRanges() (int, error) {
+	safePoint := s.safePoint()
+	s.mu.Lock()
+	ts := s.tombstones
+	s.mu.Unlock()
+
+	n := 0
+	for _, t := range ts {
+		if t.ver >= safePoint.Ver {
+			continue
+		}
+		if err := s.removeTombstone(t); err != nil {
+			return n, errors.Trace(err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// removeTombstone removes the versions hidden by t, then t itself.
+// It runs without s.mu held, so the commits are not blocked by it.
+func (s *dbStore) removeTombstone(t rangeTombstone) error {
+	start, end := codec.EncodeBytes(nil, t.StartKey), mvccEncodeEndKey(t.EndKey)
+	if t.drop {
+		if err := s.db.DeleteRange(start, end); err != nil {
+			return errors.Trace(err)
+		}
+	} else if err := s.removeHidden(start, end, t.ver); err != nil {
+		return errors.Trace(err)
+	}
+
+	b := s.db.NewBatch()
+	b.Delete(t.metaKey())
+	if err := s.db.Commit(b); err != nil {
+		return errors.Trace(err)
+	}
+	s.mu.Lock()
+	s.tombstones = s.tombstones.remove(t)
+	s.mu.Unlock()
+	log.Infof("gc deleted range [%q, %q) at version %d drop %v", kv.DecodeKey(t.StartKey), kv.DecodeKey(t.EndKey), t.ver, t.drop)
+	return nil
+}
+
+// removeHidden removes the committed versions older than ver of the keys in
+// the mvcc encoded range [start, end), in the batches of gcBatchSize versions.
+func (s *dbStore) removeHidden(start, end []byte, ver uint64) error {
+	snapshot, err := s.db.GetSnapshot()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer snapshot.Release()
+
+	it := snapshot.NewIterator(start, end)
+	defer it.Release()
+	b := s.db.NewBatch()
+	n := 0
+	for it.Next() {
+		_, v, err1 := MvccDecode(it.Key())
+		if err1 != nil {
+			return errors.Trace(err1)
+		}
+		if isLockVersion(v) || v.Ver >= ver {
+			continue
+		}
+		b.Delete(append([]byte(nil), it.Key()...))
+		if n++; n < gcBatchSize {
+			continue
+		}
+		if err1 = s.db.Commit(b); err1 != nil {
+			return errors.Trace(err1)
+		}
+		b, n = s.db.NewBatch(), 0
+	}
+	if n == 0 {
+		return nil
+	}
+	return errors.Trace(s.db.Commit(b))
+}
+
+// runGC removes the deleted ranges in background until the store is closed.
+func (s *dbStore) runGC() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+		case <-s.gcCh:
+		}
+		if _, err := s.gcDeletedRanges(); err != nil {
+			log.Errorf("gc deleted ranges err %v", err)
+		}
+	}
+}
+
+// kickGC wakes up the gc worker.
+func (s *dbStore) kickGC() {
+	select {
+	case s.gcCh <- struct{}{}:
+	default:
+	}
+}
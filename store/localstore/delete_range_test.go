@@ -0,0 +1,251 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"fmt"
+	"os"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/codec"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+var _ = Suite(&testDeleteRangeSuite{})
+
+type testDeleteRangeSuite struct {
+	s *dbStore
+}
+
+func (t *testDeleteRangeSuite) SetUpTest(c *C) {
+	s, err := Driver{goleveldb.MemoryDriver{}}.Open("memory:delete-range")
+	c.Assert(err, IsNil)
+	t.s = s.(*dbStore)
+}
+
+func (t *testDeleteRangeSuite) TearDownTest(c *C) {
+	t.s.Close()
+}
+
+func (t *testDeleteRangeSuite) set(c *C, prefix string, n int) {
+	err := kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		for i := 0; i < n; i++ {
+			if err := txn.Set([]byte(fmt.Sprintf("%s%d", prefix, i)), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+}
+
+func (t *testDeleteRangeSuite) tombstones() rangeTombstones {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	return t.s.tombstones
+}
+
+func scanKeys(c *C, txn kv.Transaction, start, end []byte) []string {
+	it, err := txn.Scan(start, end, 0)
+	c.Assert(err, IsNil)
+	defer it.Close()
+	var keys []string
+	for it.Valid() {
+		keys = append(keys, it.Key())
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	return keys
+}
+
+func (t *testDeleteRangeSuite) TestDeleteRange(c *C) {
+	t.set(c, "a", 10)
+	t.set(c, "b", 1)
+	old, err := t.s.GetSnapshot(kv.MaxVersion)
+	c.Assert(err, IsNil)
+	defer old.Release()
+	sub := t.s.Subscribe()
+	defer sub.Close()
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.Set([]byte("a3"), []byte("v3")), IsNil)
+	c.Assert(kv.DeleteRange(txn, []byte("a"), []byte("b")), IsNil)
+	// The deleted keys are not buffered.
+	c.Assert(txn.(kv.TxnBufferReporter).BufferLen(), Equals, 0)
+	_, err = txn.Get([]byte("a3"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	c.Assert(kv.IsErrNotFound(txn.Delete([]byte("a4"))), IsTrue)
+	c.Assert(txn.Set([]byte("a2"), []byte("v2")), IsNil)
+	c.Assert(scanKeys(c, txn, []byte("a"), nil), DeepEquals, []string{"a2", "b0"})
+	it, err := txn.SeekReverse([]byte("b"))
+	c.Assert(err, IsNil)
+	c.Assert(it.Key(), Equals, "a2")
+	it.Close()
+	c.Assert(txn.Commit(), IsNil)
+
+	ev := <-sub.Events()
+	c.Assert(ev.Mutations, HasLen, 11)
+
+	txn, err = t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(scanKeys(c, txn, []byte("a"), nil), DeepEquals, []string{"a2", "b0"})
+	v, err := txn.Get([]byte("a2"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("v2"))
+	// The transaction only deletes a range.
+	c.Assert(kv.DeleteRange(txn, []byte("b"), nil), IsNil)
+	c.Assert(txn.Commit(), IsNil)
+
+	txn, err = t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(scanKeys(c, txn, []byte("a"), nil), DeepEquals, []string{"a2"})
+	txn.Rollback()
+
+	// The snapshot before the deletion still reads the keys.
+	v, err = old.Get(kv.EncodeKey([]byte("a3")))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("v"))
+}
+
+func (t *testDeleteRangeSuite) TestDropRange(c *C) {
+	t.set(c, "c", 5)
+	old, err := t.s.Begin()
+	c.Assert(err, IsNil)
+
+	err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return kv.DropRange(txn, []byte("c"), []byte("d"))
+	})
+	c.Assert(err, IsNil)
+
+	// The data is kept for the transaction began before the drop.
+	n, err := t.s.gcDeletedRanges()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	v, err := old.Get([]byte("c1"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("v"))
+	old.Rollback()
+
+	// The gc worker may remove it first.
+	_, err = t.s.gcDeletedRanges()
+	c.Assert(err, IsNil)
+	c.Assert(t.tombstones(), HasLen, 0)
+	snap, err := t.s.db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	// All the versions of the keys and the saved range are removed.
+	it := snap.NewIterator(codec.EncodeBytes(nil, kv.EncodeKey([]byte("c"))), mvccEncodeEndKey(kv.EncodeKey([]byte("d"))))
+	c.Assert(it.Next(), IsFalse)
+	it.Release()
+	it = snap.NewIterator(gcRangePrefix, kv.PrefixNext(gcRangePrefix))
+	c.Assert(it.Next(), IsFalse)
+	it.Release()
+}
+
+// countVersions returns the number of the versions of the keys in [start, end) in the engine.
+func (t *testDeleteRangeSuite) countVersions(c *C, start, end string) int {
+	snap, err := t.s.db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	it := snap.NewIterator(codec.EncodeBytes(nil, kv.EncodeKey([]byte(start))), mvccEncodeEndKey(kv.EncodeKey([]byte(end))))
+	defer it.Release()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	return n
+}
+
+func (t *testDeleteRangeSuite) TestDeleteRangeGC(c *C) {
+	t.set(c, "a", 5)
+	old, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(old.LockKeys([]byte("a2")), IsNil)
+
+	err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return kv.DeleteRange(txn, []byte("a"), []byte("b"))
+	})
+	c.Assert(err, IsNil)
+	// No key in the range is written.
+	c.Assert(t.countVersions(c, "a", "b"), Equals, 5)
+	t.set(c, "a", 2)
+	c.Assert(t.countVersions(c, "a", "b"), Equals, 7)
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(scanKeys(c, txn, []byte("a"), nil), DeepEquals, []string{"a0", "a1"})
+	it, err := txn.SeekReverse([]byte("b"))
+	c.Assert(err, IsNil)
+	c.Assert(it.Key(), Equals, "a1")
+	it.Close()
+	_, err = txn.Get([]byte("a3"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	txn.Rollback()
+
+	// The hidden versions are kept for the transaction began before the deletion,
+	// and the locked key is deleted after it began.
+	n, err := t.s.gcDeletedRanges()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	v, err := old.Get([]byte("a3"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("v"))
+	c.Assert(old.Set([]byte("a2"), []byte("v2")), IsNil)
+	c.Assert(errors2.ErrorEqual(old.Commit(), kv.ErrConditionNotMatch), IsTrue)
+
+	// The gc worker may remove it first.
+	_, err = t.s.gcDeletedRanges()
+	c.Assert(err, IsNil)
+	c.Assert(t.tombstones(), HasLen, 0)
+	c.Assert(t.countVersions(c, "a", "b"), Equals, 2)
+	txn, err = t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(scanKeys(c, txn, []byte("a"), nil), DeepEquals, []string{"a0", "a1"})
+	txn.Rollback()
+}
+
+func (t *testDeleteRangeSuite) TestReopen(c *C) {
+	path := "/tmp/test-tidb-delete-range"
+	defer os.RemoveAll(path)
+	d := Driver{goleveldb.Driver{}}
+	store, err := d.Open(path)
+	c.Assert(err, IsNil)
+	err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte("a"), []byte("v"))
+	})
+	c.Assert(err, IsNil)
+	// The running transaction keeps the tombstone until the store is closed.
+	old, err := store.Begin()
+	c.Assert(err, IsNil)
+	err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+		return kv.DeleteRange(txn, []byte("a"), []byte("b"))
+	})
+	c.Assert(err, IsNil)
+	c.Assert(store.(*dbStore).tombstones, HasLen, 1)
+	c.Assert(store.Close(), IsNil)
+	old.Rollback()
+
+	store, err = d.Open(path + "?read_only=true")
+	c.Assert(err, IsNil)
+	defer store.Close()
+	c.Assert(store.(*dbStore).tombstones, HasLen, 1)
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("a"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	txn.Rollback()
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// dataKeySize is the size of the generated keys, for AES-256.
+	dataKeySize = 32
+	// cipherVersion is the first byte of the encrypted data.
+	cipherVersion byte = 1
+	// cipherHeaderSize is the size of version, key ID and nonce before the ciphertext.
+	cipherHeaderSize = 1 + 4 + 12
+)
+
+// ErrUnknownKey is returned if the data is encrypted by a key which is not known.
+var ErrUnknownKey = errors.New("encrypt: unknown key")
+
+// keyID identifies a key without revealing it.
+func keyID(key []byte) uint32 {
+	sum := sha256.Sum256(key)
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+func newDataKey() ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	return key, errors.Trace(err)
+}
+
+// aead is an AES-GCM cipher, the encrypted data is
+// version(1) key ID(4) nonce(12) ciphertext.
+type aead struct {
+	id   uint32
+	gcm  cipher.AEAD
+	rand io.Reader
+}
+
+func newAEAD(key []byte) (*aead, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &aead{id: keyID(key), gcm: gcm, rand: rand.Reader}, nil
+}
+
+// seal encrypts plaintext, ad is authenticated but not encrypted.
+func (a *aead) seal(plaintext []byte, ad []byte) ([]byte, error) {
+	b := make([]byte, cipherHeaderSize, cipherHeaderSize+len(plaintext)+a.gcm.Overhead())
+	b[0] = cipherVersion
+	binary.BigEndian.PutUint32(b[1:5], a.id)
+	nonce := b[5:cipherHeaderSize]
+	if _, err := io.ReadFull(a.rand, nonce); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return a.gcm.Seal(b, nonce, plaintext, ad), nil
+}
+
+// cipherKeyID returns the ID of the key which encrypts data.
+func cipherKeyID(data []byte) (uint32, error) {
+	if len(data) < cipherHeaderSize || data[0] != cipherVersion {
+		return 0, errors.Errorf("encrypt: invalid encrypted data")
+	}
+	return binary.BigEndian.Uint32(data[1:5]), nil
+}
+
+// open decrypts data sealed with ad, the result is never nil.
+func (a *aead) open(data []byte, ad []byte) ([]byte, error) {
+	nonce := data[5:cipherHeaderSize]
+	b, err := a.gcm.Open(make([]byte, 0, len(data)), nonce, data[cipherHeaderSize:], ad)
+	return b, errors.Trace(err)
+}
+
+// keyring finds the cipher by the key ID in the encrypted data.
+type keyring map[uint32]*aead
+
+func (r keyring) open(data []byte, ad []byte) ([]byte, error) {
+	id, err := cipherKeyID(data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	a, ok := r[id]
+	if !ok {
+		return nil, errors.Trace(ErrUnknownKey)
+	}
+	return a.open(data, ad)
+}
+
+// orderCipher is a deterministic order-preserving cipher for the keys.
+// Every byte is mapped to a 2-byte code by a strictly increasing function
+// chosen by a PRF of the key and the bytes before it, so the encrypted keys
+// keep the lexicographic order, and a prefix is encrypted to a prefix.
+// The codes are in [1, 65280], so an encrypted key never starts with 0xFFFF.
+//
+// Like all order-preserving schemes, it reveals the order of the keys and the
+// length of their common prefixes, only the bytes are hidden.
+type orderCipher struct {
+	key []byte
+}
+
+// step returns the state after the byte b.
+func (c *orderCipher) step(state []byte, b byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(state)
+	h.Write([]byte{b})
+	return h.Sum(nil)
+}
+
+func (c *orderCipher) initState() []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte("order"))
+	return h.Sum(nil)
+}
+
+// codes returns the increasing codes of all the 256 bytes in state.
+func codes(state []byte) *[256]uint16 {
+	var t [256]uint16
+	var sum uint16
+	buf := make([]byte, len(state)+1)
+	copy(buf, state)
+	for i := 0; i < 8; i++ {
+		buf[len(state)] = byte(i)
+		block := sha256.Sum256(buf)
+		for j, r := range block {
+			sum += 1 + uint16(r)%255
+			t[i*32+j] = sum
+		}
+	}
+	return &t
+}
+
+func (c *orderCipher) encrypt(key []byte) []byte {
+	b := make([]byte, 0, 2*len(key))
+	state := c.initState()
+	for _, k := range key {
+		code := codes(state)[k]
+		b = append(b, byte(code>>8), byte(code))
+		state = c.step(state, k)
+	}
+	return b
+}
+
+func (c *orderCipher) decrypt(b []byte) ([]byte, error) {
+	if len(b)%2 != 0 {
+		return nil, errors.Errorf("encrypt: invalid encrypted key %q", b)
+	}
+	key := make([]byte, 0, len(b)/2)
+	state := c.initState()
+	for i := 0; i < len(b); i += 2 {
+		code := uint16(b[i])<<8 | uint16(b[i+1])
+		t := codes(state)
+		k := sort.Search(256, func(j int) bool { return t[j] >= code })
+		if k == 256 || t[k] != code {
+			return nil, errors.Errorf("encrypt: invalid encrypted key %q", b)
+		}
+		key = append(key, byte(k))
+		state = c.step(state, byte(k))
+	}
+	return key, nil
+}
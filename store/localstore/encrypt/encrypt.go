@@ -0,0 +1,431 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encrypt wraps a local storage engine to encrypt the data at rest.
+//
+// The values are encrypted with AES-GCM by a data key, the keys are left in
+// plaintext or encrypted with a deterministic order-preserving cipher. The data
+// keys are stored in the engine, encrypted by the master key read from a local
+// key file. The first key in the key file is the current master key, the others
+// are the old ones. When the current master key is changed, a new data key is
+// created, and the values are re-encrypted with it in the background. The
+// rotation is stopped by Close, it continues from where it stops when the
+// engine is opened again.
+// The key of the order-preserving cipher is never changed.
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+var (
+	_ engine.Driver = Driver{}
+	_ engine.DB     = (*db)(nil)
+)
+
+var (
+	// metaKey is the key of the encryption meta in the engine. It is greater than
+	// all the other keys, no key encoded by the order-preserving cipher starts
+	// with 0xFFFF, and the meta keys of localstore are 0xFFFF and a name.
+	metaKey = []byte("\xff\xff\xffencrypt")
+	// rotateKey is the key of the engine key the rotation continues from,
+	// it is after metaKey, so it is out of all the iterators too.
+	rotateKey = []byte("\xff\xff\xffencrypt_rotate")
+)
+
+// Key modes.
+const (
+	// KeysPlain leaves the keys in plaintext.
+	KeysPlain = "plain"
+	// KeysOrder encrypts the keys with the order-preserving cipher.
+	KeysOrder = "order"
+)
+
+// rotateBatchSize is the number of the values re-encrypted in a batch.
+const rotateBatchSize = 256
+
+// Driver implements engine.Driver interface, it encrypts the data of Engine.
+// The path is like /path?keyfile=/path/to/keyfile&keys=order, keys is plain by default.
+// The other options in the path are passed to Engine.
+type Driver struct {
+	Engine engine.Driver
+}
+
+// Open opens the engine at the path and checks the master keys.
+func (d Driver) Open(path string) (engine.DB, error) {
+	path, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	keyFile := opts.String("keyfile", "")
+	if keyFile == "" {
+		return nil, errors.Errorf("encrypt: no keyfile in %s", path)
+	}
+	masterKeys, err := readKeyFile(keyFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	mode := opts.String("keys", KeysPlain)
+	if mode != KeysPlain && mode != KeysOrder {
+		return nil, errors.Errorf("encrypt: invalid keys mode %s", mode)
+	}
+	if mode == KeysPlain {
+		log.Warnf("encrypt: the keys of %s are NOT encrypted, only the values are", path)
+	}
+
+	inner, err := d.Engine.Open(engine.JoinPath(path, opts))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &db{db: inner, stop: make(chan struct{}), done: make(chan struct{})}
+	rotate, err := s.loadMeta(masterKeys, mode)
+	if err != nil {
+		inner.Close()
+		return nil, errors.Trace(err)
+	}
+	if rotate {
+		start, err1 := inner.Get(rotateKey)
+		if err1 != nil {
+			inner.Close()
+			return nil, errors.Trace(err1)
+		}
+		go s.rotate(start)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// readKeyFile reads the master keys, one hex encoded key in a line.
+// The empty lines and the lines starting with # are skipped.
+func readKeyFile(name string) ([][]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	var keys [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err1 := hex.DecodeString(line)
+		if err1 != nil {
+			return nil, errors.Errorf("encrypt: invalid key in %s", name)
+		}
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return nil, errors.Errorf("encrypt: invalid key size %d in %s", len(key), name)
+		}
+		keys = append(keys, key)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("encrypt: no key in %s", name)
+	}
+	return keys, nil
+}
+
+// db encrypts the data written to the engine and decrypts the data read from it.
+type db struct {
+	db engine.DB
+
+	// mu is held by Commit and the rotation, so a value is never
+	// re-encrypted after it is changed.
+	mu sync.Mutex
+	// master encrypts meta.
+	master *aead
+	meta   *meta
+	// keys is nil in KeysPlain mode.
+	keys *orderCipher
+	// current encrypts the values, values decrypts them.
+	current *aead
+	values  keyring
+	// stop is closed by Close to stop the rotation, done is closed after
+	// the rotation stops or the values are all encrypted by current.
+	stop chan struct{}
+	done chan struct{}
+}
+
+// loadMeta decrypts the meta with one of the master keys, or creates the meta
+// if the engine is new. It returns true if the values need to be re-encrypted.
+func (s *db) loadMeta(masterKeys [][]byte, mode string) (bool, error) {
+	data, err := s.db.Get(metaKey)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	master, err := newAEAD(masterKeys[0])
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	var m *meta
+	if data == nil {
+		if m, err = newMeta(mode); err != nil {
+			return false, errors.Trace(err)
+		}
+	} else {
+		masters := make(keyring)
+		for _, key := range masterKeys {
+			a, err1 := newAEAD(key)
+			if err1 != nil {
+				return false, errors.Trace(err1)
+			}
+			masters[a.id] = a
+		}
+		plain, err1 := masters.open(data, metaKey)
+		if err1 != nil {
+			return false, errors.Annotate(err1, "encrypt: decrypt meta")
+		}
+		if m, err1 = unmarshalMeta(plain); err1 != nil {
+			return false, errors.Trace(err1)
+		}
+		if m.mode != mode {
+			return false, errors.Errorf("encrypt: the keys mode is %s, not %s", m.mode, mode)
+		}
+	}
+
+	id, _ := cipherKeyID(data)
+	changed := data != nil && id != master.id
+	if changed {
+		// The master key is changed, the values are encrypted by a new data key.
+		key, err1 := newDataKey()
+		if err1 != nil {
+			return false, errors.Trace(err1)
+		}
+		m.dataKeys = append(m.dataKeys, key)
+		log.Infof("encrypt: master key is changed, rotate the data key")
+	}
+	if data == nil || changed {
+		if err = s.saveMeta(master, m); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+	s.master = master
+	s.meta = m
+	// The old data keys are kept until the rotation is done, it may be
+	// interrupted by Close before.
+	return len(m.dataKeys) > 1, errors.Trace(s.setKeys(m))
+}
+
+// saveMeta saves m and removes the position of the rotation, the meta is only
+// changed when a rotation begins or ends.
+func (s *db) saveMeta(master *aead, m *meta) error {
+	data, err := master.seal(m.marshal(), metaKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	b := s.db.NewBatch()
+	b.Put(metaKey, data)
+	b.Delete(rotateKey)
+	return errors.Trace(s.db.Commit(b))
+}
+
+func (s *db) setKeys(m *meta) error {
+	if m.mode == KeysOrder {
+		s.keys = &orderCipher{key: m.orderKey}
+	}
+	s.values = make(keyring)
+	for _, key := range m.dataKeys {
+		a, err := newAEAD(key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		s.values[a.id] = a
+		s.current = a
+	}
+	return nil
+}
+
+// rotate re-encrypts the values encrypted by the old data keys from the engine
+// key start, then removes the old keys. It returns early if s.stop is closed.
+func (s *db) rotate(start []byte) {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.stop:
+			log.Infof("encrypt: rotate is stopped, it continues when the store is opened again")
+			return
+		default:
+		}
+		next, n, err := s.rotateBatch(start)
+		if err != nil {
+			log.Errorf("encrypt: rotate err %v, it continues when the store is opened again", err)
+			return
+		}
+		if next == nil {
+			log.Infof("encrypt: rotate done, %d values in the last batch", n)
+			break
+		}
+		start = next
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.meta
+	m.dataKeys = m.dataKeys[len(m.dataKeys)-1:]
+	if err := s.saveMeta(s.master, m); err != nil {
+		log.Errorf("encrypt: save meta err %v", err)
+	}
+}
+
+// rotateBatch re-encrypts at most rotateBatchSize values from start, it returns
+// the key to continue from, nil if there are no more keys. The key is saved with
+// the values, so the rotation continues from it after the engine is opened again.
+func (s *db) rotateBatch(start []byte) ([]byte, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	defer snap.Release()
+
+	b := s.db.NewBatch()
+	n := 0
+	it := snap.NewIterator(start, metaKey)
+	defer it.Release()
+	for it.Next() {
+		if n >= rotateBatchSize {
+			next := append([]byte(nil), it.Key()...)
+			b.Put(rotateKey, next)
+			return next, n, errors.Trace(s.db.Commit(b))
+		}
+		id, err1 := cipherKeyID(it.Value())
+		if err1 != nil {
+			return nil, 0, errors.Trace(err1)
+		}
+		if id == s.current.id {
+			continue
+		}
+		key, err1 := s.decryptKey(it.Key())
+		if err1 != nil {
+			return nil, 0, errors.Trace(err1)
+		}
+		value, err1 := s.values.open(it.Value(), key)
+		if err1 != nil {
+			return nil, 0, errors.Trace(err1)
+		}
+		value, err1 = s.current.seal(value, key)
+		if err1 != nil {
+			return nil, 0, errors.Trace(err1)
+		}
+		b.Put(it.Key(), value)
+		n++
+	}
+	return nil, n, errors.Trace(s.db.Commit(b))
+}
+
+func (s *db) encryptKey(key []byte) []byte {
+	if s.keys == nil {
+		return key
+	}
+	return s.keys.encrypt(key)
+}
+
+func (s *db) decryptKey(key []byte) ([]byte, error) {
+	if s.keys == nil {
+		return key, nil
+	}
+	return s.keys.decrypt(key)
+}
+
+// encryptEnd encrypts the upper bound of an iterator, the meta is always out of the range.
+func (s *db) encryptEnd(key []byte) []byte {
+	if key == nil {
+		return metaKey
+	}
+	if key = s.encryptKey(key); bytes.Compare(key, metaKey) > 0 {
+		return metaKey
+	}
+	return key
+}
+
+// Get implements engine.DB Get interface.
+func (s *db) Get(key []byte) ([]byte, error) {
+	v, err := s.db.Get(s.encryptKey(key))
+	if err != nil || v == nil {
+		return nil, errors.Trace(err)
+	}
+	v, err = s.values.open(v, key)
+	return v, errors.Trace(err)
+}
+
+// GetSnapshot implements engine.DB GetSnapshot interface.
+func (s *db) GetSnapshot() (engine.Snapshot, error) {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &snapshot{db: s, snap: snap}, nil
+}
+
+// NewBatch implements engine.DB NewBatch interface.
+func (s *db) NewBatch() engine.Batch {
+	return &batch{db: s, b: s.db.NewBatch()}
+}
+
+// Commit implements engine.DB Commit interface.
+func (s *db) Commit(b engine.Batch) error {
+	eb := b.(*batch)
+	if eb.err != nil {
+		return errors.Trace(eb.err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.Trace(s.db.Commit(eb.b))
+}
+
+// DeleteRange implements engine.DB DeleteRange interface, the encrypted keys
+// keep the order, so the range is deleted from the wrapped engine directly.
+func (s *db) DeleteRange(start, end []byte) error {
+	start, end = s.encryptKey(start), s.encryptEnd(end)
+	if bytes.Compare(start, end) >= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.Trace(s.db.DeleteRange(start, end))
+}
+
+// Close implements engine.DB Close interface, it stops the rotation after
+// the batch being re-encrypted.
+func (s *db) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return s.db.Close()
+}
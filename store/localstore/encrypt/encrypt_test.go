@@ -0,0 +1,314 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+)
+
+const (
+	testPath    = "/tmp/test-tidb-encrypt"
+	testKeyFile = "/tmp/test-tidb-encrypt.key"
+
+	masterKey1 = "000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"
+	masterKey2 = "f0e0d0c0b0a090807060504030201000f0e0d0c0b0a090807060504030201000"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testSuite{})
+
+type testSuite struct {
+}
+
+func (s *testSuite) SetUpTest(c *C) {
+	os.RemoveAll(testPath)
+}
+
+func (s *testSuite) TearDownTest(c *C) {
+	os.RemoveAll(testPath)
+	os.Remove(testKeyFile)
+}
+
+func writeKeyFile(c *C, keys ...string) {
+	data := "# master keys\n\n"
+	for _, key := range keys {
+		data += key + "\n"
+	}
+	err := ioutil.WriteFile(testKeyFile, []byte(data), 0600)
+	c.Assert(err, IsNil)
+}
+
+func open(c *C, keys string) engine.DB {
+	d, err := Driver{Engine: goleveldb.Driver{}}.Open(fmt.Sprintf("%s?keyfile=%s&keys=%s", testPath, testKeyFile, keys))
+	c.Assert(err, IsNil)
+	return d
+}
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("k%04d", i))
+}
+
+func fill(c *C, d engine.DB, n int) {
+	b := d.NewBatch()
+	for i := 0; i < n; i++ {
+		b.Put(testKey(i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	err := d.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func check(c *C, d engine.DB, n int) {
+	for i := 0; i < n; i++ {
+		v, err := d.Get(testKey(i))
+		c.Assert(err, IsNil)
+		c.Assert(string(v), Equals, fmt.Sprintf("value%d", i))
+	}
+}
+
+// rawScan returns the raw keys and values in the engine under the encryption.
+func rawScan(c *C, d engine.DB) ([][]byte, [][]byte) {
+	snap, err := d.(*db).db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	var keys, values [][]byte
+	it := snap.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		keys = append(keys, append([]byte(nil), it.Key()...))
+		values = append(values, append([]byte(nil), it.Value()...))
+	}
+	return keys, values
+}
+
+func (s *testSuite) TestOrderCipher(c *C) {
+	oc := &orderCipher{key: []byte("key")}
+	keys := [][]byte{{}, {0}, {0, 0}, {0, 1}, {1}, {0xff}, {0xff, 0xff}, []byte("a"), []byte("ab"), []byte("b")}
+	sort.Sort(byteSlices(keys))
+	var last []byte
+	for i, key := range keys {
+		e := oc.encrypt(key)
+		c.Assert(e, HasLen, 2*len(key))
+		if len(e) > 0 {
+			c.Assert(e[0] != 0xff || e[1] != 0xff, IsTrue)
+		}
+		if i > 0 {
+			c.Assert(bytes.Compare(last, e), Less, 0)
+		}
+		last = e
+
+		d, err := oc.decrypt(e)
+		c.Assert(err, IsNil)
+		c.Assert(d, DeepEquals, key)
+	}
+	c.Assert(bytes.HasPrefix(oc.encrypt([]byte("ab")), oc.encrypt([]byte("a"))), IsTrue)
+
+	_, err := oc.decrypt([]byte{0})
+	c.Assert(err, NotNil)
+}
+
+type byteSlices [][]byte
+
+func (s byteSlices) Len() int           { return len(s) }
+func (s byteSlices) Less(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
+func (s byteSlices) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *testSuite) TestEncrypt(c *C) {
+	writeKeyFile(c, masterKey1)
+	for _, mode := range []string{KeysPlain, KeysOrder} {
+		os.RemoveAll(testPath)
+		d := open(c, mode)
+		n := 100
+		fill(c, d, n)
+		check(c, d, n)
+
+		keys, values := rawScan(c, d)
+		c.Assert(keys, HasLen, n+1)
+		for i, v := range values {
+			c.Assert(bytes.Contains(v, []byte("value")), IsFalse)
+			if i < n {
+				c.Assert(bytes.Contains(keys[i], testKey(i)), Equals, mode == KeysPlain)
+			}
+		}
+		c.Assert(keys[n], DeepEquals, metaKey)
+
+		snap, err := d.GetSnapshot()
+		c.Assert(err, IsNil)
+		cnt := 0
+		it := snap.NewIterator(testKey(10), testKey(90))
+		for it.Next() {
+			c.Assert(it.Key(), DeepEquals, testKey(10+cnt))
+			cnt++
+		}
+		it.Release()
+		c.Assert(cnt, Equals, 80)
+
+		cnt = 0
+		it = snap.NewReverseIterator(nil)
+		for it.Next() {
+			c.Assert(it.Key(), DeepEquals, testKey(n-1-cnt))
+			cnt++
+		}
+		it.Release()
+		c.Assert(cnt, Equals, n)
+		snap.Release()
+
+		b := d.NewBatch()
+		b.Delete(testKey(0))
+		err = d.Commit(b)
+		c.Assert(err, IsNil)
+		v, err := d.Get(testKey(0))
+		c.Assert(err, IsNil)
+		c.Assert(v, IsNil)
+
+		err = d.Close()
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *testSuite) TestWrongKey(c *C) {
+	writeKeyFile(c, masterKey1)
+	d := open(c, KeysPlain)
+	fill(c, d, 10)
+	d.Close()
+
+	_, err := Driver{Engine: goleveldb.Driver{}}.Open(fmt.Sprintf("%s?keyfile=%s&keys=%s", testPath, testKeyFile, KeysOrder))
+	c.Assert(err, NotNil)
+
+	writeKeyFile(c, masterKey2)
+	_, err = Driver{Engine: goleveldb.Driver{}}.Open(fmt.Sprintf("%s?keyfile=%s", testPath, testKeyFile))
+	c.Assert(err, NotNil)
+
+	_, err = Driver{Engine: goleveldb.Driver{}}.Open(testPath)
+	c.Assert(err, NotNil)
+}
+
+func (s *testSuite) TestRotate(c *C) {
+	writeKeyFile(c, masterKey1)
+	d := open(c, KeysOrder)
+	n := 3*rotateBatchSize + 10
+	fill(c, d, n)
+	oldID := d.(*db).current.id
+	d.Close()
+
+	// The old master key is still needed to decrypt the data keys.
+	writeKeyFile(c, masterKey2, masterKey1)
+	d = open(c, KeysOrder)
+	c.Assert(d.(*db).current.id, Not(Equals), oldID)
+	check(c, d, n)
+	<-d.(*db).done
+	_, values := rawScan(c, d)
+	for _, v := range values[:n] {
+		id, err := cipherKeyID(v)
+		c.Assert(err, IsNil)
+		c.Assert(id, Equals, d.(*db).current.id)
+	}
+	c.Assert(d.(*db).meta.dataKeys, HasLen, 1)
+	d.Close()
+
+	writeKeyFile(c, masterKey2)
+	d = open(c, KeysOrder)
+	check(c, d, n)
+	d.Close()
+}
+
+func (s *testSuite) TestRotateStop(c *C) {
+	writeKeyFile(c, masterKey1)
+	d := open(c, KeysOrder)
+	n := 16 * rotateBatchSize
+	fill(c, d, n)
+	d.Close()
+
+	writeKeyFile(c, masterKey2, masterKey1)
+	d = open(c, KeysOrder)
+	// The rotation stops before the next batch.
+	e := d.(*db)
+	e.mu.Lock()
+	close(e.stop)
+	e.mu.Unlock()
+	<-e.done
+	c.Assert(e.meta.dataKeys, HasLen, 2)
+	// Rotate two batches as if it is stopped after them.
+	next, _, err := e.rotateBatch(nil)
+	c.Assert(err, IsNil)
+	_, _, err = e.rotateBatch(next)
+	c.Assert(err, IsNil)
+	// The values before the saved position are re-encrypted.
+	start, err := e.db.Get(rotateKey)
+	c.Assert(err, IsNil)
+	c.Assert(start, NotNil)
+	keys, values := rawScan(c, d)
+	for i, v := range values[:n] {
+		id, err1 := cipherKeyID(v)
+		c.Assert(err1, IsNil)
+		c.Assert(id == e.current.id, Equals, bytes.Compare(keys[i], start) < 0)
+	}
+	c.Assert(d.Close(), IsNil)
+
+	// The rotation continues when it is opened again.
+	d = open(c, KeysOrder)
+	<-d.(*db).done
+	check(c, d, n)
+	c.Assert(d.(*db).meta.dataKeys, HasLen, 1)
+	start, err = d.(*db).db.Get(rotateKey)
+	c.Assert(err, IsNil)
+	c.Assert(start, IsNil)
+	d.Close()
+}
+
+func (s *testSuite) TestStore(c *C) {
+	writeKeyFile(c, masterKey1)
+	d := localstore.Driver{Driver: Driver{Engine: goleveldb.Driver{}}}
+	store, err := d.Open(fmt.Sprintf("%s?keyfile=%s&keys=%s", testPath, testKeyFile, KeysOrder))
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+		for i := 0; i < 10; i++ {
+			if err1 := txn.Set(testKey(i), []byte("1")); err1 != nil {
+				return err1
+			}
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	it, err := txn.Seek(testKey(5), nil)
+	c.Assert(err, IsNil)
+	cnt := 0
+	for it.Valid() {
+		c.Assert([]byte(it.Key()), DeepEquals, testKey(5+cnt))
+		cnt++
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	it.Close()
+	c.Assert(cnt, Equals, 5)
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// meta is stored in the engine encrypted by the master key.
+type meta struct {
+	mode string
+	// orderKey is the key of the order-preserving cipher.
+	orderKey []byte
+	// dataKeys encrypt the values, the last one is the current key.
+	dataKeys [][]byte
+}
+
+func newMeta(mode string) (*meta, error) {
+	m := &meta{mode: mode}
+	key, err := newDataKey()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	m.dataKeys = [][]byte{key}
+	if mode == KeysOrder {
+		if m.orderKey, err = newDataKey(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return m, nil
+}
+
+func (m *meta) marshal() []byte {
+	b := codec.EncodeBytes(nil, []byte(m.mode))
+	b = codec.EncodeBytes(b, m.orderKey)
+	b = codec.EncodeUint(b, uint64(len(m.dataKeys)))
+	for _, key := range m.dataKeys {
+		b = codec.EncodeBytes(b, key)
+	}
+	return b
+}
+
+// unmarshalMeta decodes the meta, the keys are copied because the decoded
+// bytes may share the memory of b.
+func unmarshalMeta(b []byte) (*meta, error) {
+	b, mode, err := codec.DecodeBytes(b)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	m := &meta{mode: string(mode)}
+	b, key, err := codec.DecodeBytes(b)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(key) > 0 {
+		m.orderKey = append([]byte(nil), key...)
+	}
+	b, n, err := codec.DecodeUint(b)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if n == 0 {
+		return nil, errors.Errorf("encrypt: no data key in meta")
+	}
+	for i := uint64(0); i < n; i++ {
+		b, key, err = codec.DecodeBytes(b)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		m.dataKeys = append(m.dataKeys, append([]byte(nil), key...))
+	}
+	return m, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encrypt
+
+import (
+	"bytes"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+var (
+	_ engine.Snapshot = (*snapshot)(nil)
+	_ engine.Iterator = (*iterator)(nil)
+	_ engine.Batch    = (*batch)(nil)
+)
+
+type snapshot struct {
+	db   *db
+	snap engine.Snapshot
+}
+
+// Get implements engine.Snapshot Get interface.
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	v, err := s.snap.Get(s.db.encryptKey(key))
+	if err != nil || v == nil {
+		return nil, errors.Trace(err)
+	}
+	v, err = s.db.values.open(v, key)
+	return v, errors.Trace(err)
+}
+
+// NewIterator implements engine.Snapshot NewIterator interface.
+func (s *snapshot) NewIterator(startKey []byte, endKey []byte) engine.Iterator {
+	start, end := s.db.encryptKey(startKey), s.db.encryptEnd(endKey)
+	if bytes.Compare(start, end) >= 0 {
+		return &iterator{}
+	}
+	return &iterator{db: s.db, it: s.snap.NewIterator(start, end)}
+}
+
+// NewReverseIterator implements engine.Snapshot NewReverseIterator interface.
+func (s *snapshot) NewReverseIterator(endKey []byte) engine.Iterator {
+	return &iterator{db: s.db, it: s.snap.NewReverseIterator(s.db.encryptEnd(endKey))}
+}
+
+// Release implements engine.Snapshot Release interface.
+func (s *snapshot) Release() {
+	s.snap.Release()
+}
+
+// iterator decrypts the keys and values, it stops at the first
+// key or value which can't be decrypted.
+type iterator struct {
+	db    *db
+	it    engine.Iterator
+	key   []byte
+	value []byte
+}
+
+// Next implements engine.Iterator Next interface.
+func (it *iterator) Next() bool {
+	it.key, it.value = nil, nil
+	if it.it == nil || !it.it.Next() {
+		return false
+	}
+	key, err := it.db.decryptKey(it.it.Key())
+	if err != nil {
+		log.Errorf("encrypt: decrypt key err %v", err)
+		return false
+	}
+	value, err := it.db.values.open(it.it.Value(), key)
+	if err != nil {
+		log.Errorf("encrypt: decrypt value of %q err %v", key, err)
+		return false
+	}
+	it.key, it.value = key, value
+	return true
+}
+
+// Key implements engine.Iterator Key interface.
+func (it *iterator) Key() []byte {
+	return it.key
+}
+
+// Value implements engine.Iterator Value interface.
+func (it *iterator) Value() []byte {
+	return it.value
+}
+
+// Release implements engine.Iterator Release interface.
+func (it *iterator) Release() {
+	if it.it != nil {
+		it.it.Release()
+	}
+}
+
+// batch encrypts the keys and values when they are added,
+// the first error is returned by Commit.
+type batch struct {
+	db  *db
+	b   engine.Batch
+	err error
+}
+
+// Put implements engine.Batch Put interface.
+func (b *batch) Put(key []byte, value []byte) {
+	v, err := b.db.current.seal(value, key)
+	if err != nil {
+		if b.err == nil {
+			b.err = errors.Trace(err)
+		}
+		return
+	}
+	b.b.Put(b.db.encryptKey(key), v)
+}
+
+// Delete implements engine.Batch Delete interface.
+func (b *batch) Delete(key []byte) {
+	b.b.Delete(b.db.encryptKey(key))
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import "github.com/juju/errors"
+
+// deleteRangeBatchSize is the max number of the keys deleted in a batch by DeleteRangeInBatches.
+const deleteRangeBatchSize = 1024
+
+// DeleteRangeInBatches deletes the keys in [start, end) of db by the batches
+// of Delete, it is used by the engines which can't delete a range natively.
+func DeleteRangeInBatches(db DB, start, end []byte) error {
+	for {
+		snapshot, err := db.GetSnapshot()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		b := db.NewBatch()
+		it := snapshot.NewIterator(start, end)
+		n := 0
+		for n < deleteRangeBatchSize && it.Next() {
+			start = append([]byte(nil), it.Key()...)
+			b.Delete(start)
+			n++
+		}
+		it.Release()
+		snapshot.Release()
+
+		if n == 0 {
+			return nil
+		}
+		if err = db.Commit(b); err != nil {
+			return errors.Trace(err)
+		}
+		if n < deleteRangeBatchSize {
+			return nil
+		}
+		// Continue from the key after the last deleted one.
+		start = append(start, 0)
+	}
+}
@@ -31,6 +31,9 @@ type DB interface {
 	NewBatch() Batch
 	// Commit writes the changed data in Batch
 	Commit(b Batch) error
+	// DeleteRange deletes the keys in [start, end), a nil end means no upper bound.
+	// It may delete the keys in several writes, so it is not atomic.
+	DeleteRange(start, end []byte) error
 	// Close closes database
 	Close() error
 }
@@ -41,8 +44,12 @@ type Snapshot interface {
 	// return nil, nil if no value found
 	Get(key []byte) ([]byte, error)
 	// NewIterator creates an iterator, seeks the iterator to
-	// the first key >= startKey.
-	NewIterator(startKey []byte) Iterator
+	// the first key >= startKey, the iterator stops before endKey.
+	// A nil endKey means no upper bound.
+	NewIterator(startKey []byte, endKey []byte) Iterator
+	// NewReverseIterator creates an iterator which moves backward, seeks
+	// the iterator to the last key < endKey, or the last key if endKey is nil.
+	NewReverseIterator(endKey []byte) Iterator
 	// Release releases the snapshot
 	Release()
 }
@@ -50,6 +57,7 @@ type Snapshot interface {
 // Iterator is the interface for local storage
 type Iterator interface {
 	// Next moves the iterator to the next key/value pair,
+	// or the previous one for a reverse iterator,
 	// returns true/false if the iterator is exhausted
 	Next() bool
 	// Key returns the current key of the key/value pair or nil
@@ -0,0 +1,135 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Options is the options in the query of a path, like /path?sync=true&cache_size=64MB.
+// The getters remove the options they read, a Driver which wraps another one
+// passes the options it doesn't know with JoinPath, and the innermost Driver
+// rejects the unknown options with Check.
+type Options map[string]string
+
+// ParsePath splits path into the path without the query and the options in it.
+func ParsePath(path string) (string, Options, error) {
+	opts := Options{}
+	pos := strings.Index(path, "?")
+	if pos == -1 {
+		return path, opts, nil
+	}
+	values, err := url.ParseQuery(path[pos+1:])
+	if err != nil {
+		return "", nil, errors.Errorf("invalid options %q: %v", path[pos+1:], err)
+	}
+	for name, v := range values {
+		if len(v) > 1 {
+			return "", nil, errors.Errorf("option %s is set more than once", name)
+		}
+		opts[name] = v[0]
+	}
+	return path[:pos], opts, nil
+}
+
+// JoinPath appends the options to path as its query.
+func JoinPath(path string, opts Options) string {
+	if len(opts) == 0 {
+		return path
+	}
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, url.QueryEscape(name)+"="+url.QueryEscape(opts[name]))
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+// String returns the option name, or def if it is not set.
+func (o Options) String(name string, def string) string {
+	v, ok := o[name]
+	if !ok {
+		return def
+	}
+	delete(o, name)
+	return v
+}
+
+// Bool returns the option name parsed by strconv.ParseBool, or def if it is not set.
+func (o Options) Bool(name string, def bool) (bool, error) {
+	v, ok := o[name]
+	if !ok {
+		return def, nil
+	}
+	delete(o, name)
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.Errorf("invalid value %q of option %s, must be a bool", v, name)
+	}
+	return b, nil
+}
+
+// Size returns the option name in bytes, or def if it is not set.
+// The size is like 4096, 4KB, 64MB or 1GB, the units are powers of 1024
+// and the trailing B is optional.
+func (o Options) Size(name string, def int) (int, error) {
+	v, ok := o[name]
+	if !ok {
+		return def, nil
+	}
+	delete(o, name)
+	s := strings.TrimSuffix(strings.ToUpper(v), "B")
+	unit := 1
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid value %q of option %s, must be a size like 64MB", v, name)
+	}
+	return n * unit, nil
+}
+
+// Check returns an error if any option is not read, engine is the name of
+// the Driver in the error.
+func (o Options) Check(engine string) error {
+	if len(o) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return errors.Errorf("unknown options %s for %s", strings.Join(names, ", "), engine)
+}
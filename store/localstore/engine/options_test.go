@@ -0,0 +1,89 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testOptionsSuite{})
+
+type testOptionsSuite struct {
+}
+
+func (s *testOptionsSuite) TestParsePath(c *C) {
+	path, opts, err := ParsePath("/tmp/a")
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, "/tmp/a")
+	c.Assert(opts, HasLen, 0)
+	c.Assert(JoinPath(path, opts), Equals, "/tmp/a")
+
+	path, opts, err = ParsePath("/tmp/a?sync=true&cache_size=64MB&keyfile=%2Ftmp%2Fk")
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, "/tmp/a")
+	c.Assert(opts, HasLen, 3)
+	c.Assert(opts.String("keyfile", ""), Equals, "/tmp/k")
+	c.Assert(JoinPath(path, opts), Equals, "/tmp/a?cache_size=64MB&sync=true")
+
+	_, _, err = ParsePath("/tmp/a?sync=true&sync=false")
+	c.Assert(err, NotNil)
+	_, _, err = ParsePath("/tmp/a?sync=%zz")
+	c.Assert(err, NotNil)
+}
+
+func (s *testOptionsSuite) TestGetters(c *C) {
+	_, opts, err := ParsePath("/tmp/a?sync=1&read_only=x&a=4096&b=4kb&c=64M&d=1GB&e=-1&f=10TB&g=v")
+	c.Assert(err, IsNil)
+
+	b, err := opts.Bool("sync", false)
+	c.Assert(err, IsNil)
+	c.Assert(b, IsTrue)
+	b, err = opts.Bool("no_such", true)
+	c.Assert(err, IsNil)
+	c.Assert(b, IsTrue)
+	_, err = opts.Bool("read_only", false)
+	c.Assert(err, NotNil)
+
+	tbl := []struct {
+		name string
+		size int
+	}{
+		{"a", 4096},
+		{"b", 4 << 10},
+		{"c", 64 << 20},
+		{"d", 1 << 30},
+		{"no_such", 100},
+	}
+	for _, t := range tbl {
+		n, err1 := opts.Size(t.name, 100)
+		c.Assert(err1, IsNil)
+		c.Assert(n, Equals, t.size)
+	}
+	_, err = opts.Size("e", 0)
+	c.Assert(err, NotNil)
+	_, err = opts.Size("f", 0)
+	c.Assert(err, NotNil)
+
+	err = opts.Check("test")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Matches, ".*unknown options g for test")
+	c.Assert(opts.String("g", ""), Equals, "v")
+	c.Assert(opts.Check("test"), IsNil)
+}
@@ -15,10 +15,12 @@ package goleveldb
 
 import (
 	"sync"
+	"syscall"
 
 	"github.com/juju/errors"
 	"github.com/pingcap/tidb/store/localstore/engine"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/storage"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -40,6 +42,7 @@ var (
 
 type db struct {
 	*leveldb.DB
+	wo *opt.WriteOptions
 }
 
 func (d *db) Get(key []byte) ([]byte, error) {
@@ -69,12 +72,21 @@ func (d *db) Commit(b engine.Batch) error {
 	if !ok {
 		return errors.Errorf("invalid batch type %T", b)
 	}
-	err := d.DB.Write(batch, nil)
+	err := d.DB.Write(batch, d.wo)
 	batch.Reset()
 	p.Put(batch)
 	return err
 }
 
+// DeleteRange implements engine.DB DeleteRange interface, the range is
+// compacted after the keys are deleted to reclaim the space.
+func (d *db) DeleteRange(start, end []byte) error {
+	if err := engine.DeleteRangeInBatches(d, start, end); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(d.DB.CompactRange(util.Range{Start: start, Limit: end}))
+}
+
 func (d *db) Close() error {
 	return d.DB.Close()
 }
@@ -92,32 +104,103 @@ func (s *snapshot) Get(key []byte) ([]byte, error) {
 	return v, err
 }
 
-func (s *snapshot) NewIterator(startKey []byte) engine.Iterator {
-	it := s.Snapshot.NewIterator(&util.Range{Start: startKey}, nil)
+func (s *snapshot) NewIterator(startKey []byte, endKey []byte) engine.Iterator {
+	it := s.Snapshot.NewIterator(&util.Range{Start: startKey, Limit: endKey}, nil)
 	return it
 }
 
+func (s *snapshot) NewReverseIterator(endKey []byte) engine.Iterator {
+	it := s.Snapshot.NewIterator(&util.Range{Limit: endKey}, nil)
+	return &reverseIterator{Iterator: it}
+}
+
 func (s *snapshot) Release() {
 	s.Snapshot.Release()
 }
 
+// reverseIterator moves to the last key first, then moves backward.
+type reverseIterator struct {
+	iterator.Iterator
+	started bool
+}
+
+func (it *reverseIterator) Next() bool {
+	if !it.started {
+		it.started = true
+		return it.Iterator.Last()
+	}
+	return it.Iterator.Prev()
+}
+
+// parseOptions parses the options in path, which are
+//
+//	sync        sync every write to the disk, false by default.
+//	cache_size  the size of the block cache, like 64MB.
+//	block_size  the minimum uncompressed size of a block, like 4KB.
+//	read_only   open the database in read-only mode, false by default.
+//
+// A database in read-only mode is still locked exclusively and its LOG file is
+// still rotated, so it can't be opened while another process has it open, stop
+// the process or open a copy of the directory instead.
+func parseOptions(path string, cacheSize int) (string, *opt.Options, *opt.WriteOptions, error) {
+	path, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return "", nil, nil, errors.Trace(err)
+	}
+	o := &opt.Options{}
+	wo := &opt.WriteOptions{}
+	if wo.Sync, err = opts.Bool("sync", false); err != nil {
+		return "", nil, nil, errors.Trace(err)
+	}
+	if o.BlockCacheCapacity, err = opts.Size("cache_size", cacheSize); err != nil {
+		return "", nil, nil, errors.Trace(err)
+	}
+	if o.BlockSize, err = opts.Size("block_size", 0); err != nil {
+		return "", nil, nil, errors.Trace(err)
+	}
+	if o.ReadOnly, err = opts.Bool("read_only", false); err != nil {
+		return "", nil, nil, errors.Trace(err)
+	}
+	if err = opts.Check("goleveldb"); err != nil {
+		return "", nil, nil, errors.Trace(err)
+	}
+	return path, o, wo, nil
+}
+
 // Driver implements engine Driver.
 type Driver struct {
 }
 
-// Open opens or creates a local storage database for the given path.
+// Open opens or creates a local storage database for the given path,
+// the options of the database are in the query of the path, see parseOptions.
 func (driver Driver) Open(path string) (engine.DB, error) {
-	d, err := leveldb.OpenFile(path, &opt.Options{BlockCacheCapacity: 600 * 1024 * 1024})
-
-	return &db{d}, err
+	path, o, wo, err := parseOptions(path, 600*1024*1024)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	d, err := leveldb.OpenFile(path, o)
+	if err == syscall.EWOULDBLOCK {
+		return nil, errors.Errorf("database %s is locked by another process, stop it or open a copy of the directory", path)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &db{DB: d, wo: wo}, nil
 }
 
 // MemoryDriver implements engine Driver
 type MemoryDriver struct {
 }
 
-// Open opens a memory storage database.
+// Open opens a memory storage database, it accepts the same options as Driver.
 func (driver MemoryDriver) Open(path string) (engine.DB, error) {
-	d, err := leveldb.Open(storage.NewMemStorage(), nil)
-	return &db{d}, err
+	_, o, wo, err := parseOptions(path, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	d, err := leveldb.Open(storage.NewMemStorage(), o)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &db{DB: d, wo: wo}, nil
 }
@@ -14,6 +14,10 @@
 package goleveldb
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	. "github.com/pingcap/check"
@@ -82,7 +86,7 @@ func (s *testSuite) TestDB(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(v, IsNil)
 
-	iter := snap.NewIterator(nil)
+	iter := snap.NewIterator(nil, nil)
 	c.Assert(iter.Next(), Equals, true)
 	c.Assert(iter.Key(), DeepEquals, []byte("a"))
 	c.Assert(iter.Next(), Equals, true)
@@ -93,3 +97,146 @@ func (s *testSuite) TestDB(c *C) {
 
 	snap.Release()
 }
+
+func (s *testSuite) TestReverseIterator(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("r1"), []byte("1"))
+	b.Put([]byte("r2"), []byte("2"))
+	b.Put([]byte("r3"), []byte("3"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewReverseIterator([]byte("r3"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r2"))
+	c.Assert(iter.Value(), DeepEquals, []byte("2"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r1"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("r25"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r2"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("s"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r3"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator(nil)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r3"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("0"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("r1"))
+	b.Delete([]byte("r2"))
+	b.Delete([]byte("r3"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestRangeIterator(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("s1"), []byte("1"))
+	b.Put([]byte("s2"), []byte("2"))
+	b.Put([]byte("s3"), []byte("3"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewIterator([]byte("s1"), []byte("s3"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("s1"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("s2"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	iter = snap.NewIterator([]byte("s2"), []byte("s2"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("s1"))
+	b.Delete([]byte("s2"))
+	b.Delete([]byte("s3"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestOptions(c *C) {
+	var d MemoryDriver
+	e, err := d.Open("memory?sync=true&cache_size=16MB&block_size=8KB")
+	c.Assert(err, IsNil)
+	c.Assert(e.(*db).wo.Sync, IsTrue)
+	e.Close()
+
+	_, err = d.Open("memory?cache_size=big")
+	c.Assert(err, NotNil)
+	_, err = d.Open("memory?no_such=1")
+	c.Assert(err, NotNil)
+}
+
+func (s *testSuite) TestDeleteRange(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	for i := 0; i < 3000; i++ {
+		b.Put([]byte(fmt.Sprintf("d%04d", i)), []byte("v"))
+	}
+	b.Put([]byte("e"), []byte("v"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	err = db.DeleteRange([]byte("d0010"), []byte("e"))
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	iter := snap.NewIterator([]byte("d"), nil)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	c.Assert(keys, HasLen, 11)
+	c.Assert(keys[9], Equals, "d0009")
+	c.Assert(keys[10], Equals, "e")
+}
+
+func (s *testSuite) TestOpenLocked(c *C) {
+	dir, err := ioutil.TempDir("", "goleveldb-locked")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var d Driver
+	e, err := d.Open(dir)
+	c.Assert(err, IsNil)
+	// The read-only mode locks the directory too.
+	_, err = d.Open(dir + "?read_only=true")
+	c.Assert(err, NotNil)
+	c.Assert(strings.Contains(err.Error(), "locked by another process"), IsTrue)
+	c.Assert(e.Close(), IsNil)
+
+	e, err = d.Open(dir + "?read_only=true")
+	c.Assert(err, IsNil)
+	c.Assert(e.Close(), IsNil)
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+// maxGroupSize is the max number of the writes merged into a group.
+const maxGroupSize = 256
+
+// writeStep fills a batch of a write, the batches of the same step of the
+// writes in a group are merged into one engine batch.
+type writeStep struct {
+	// prepare checks the conflicts and puts the changes to b, the changes
+	// are dropped if it fails.
+	prepare func(b engine.Batch) error
+	// undo puts the changes to b to revert the write if prepare or writing
+	// the batch fails, it can be nil.
+	undo func(b engine.Batch)
+	// done is called with the result of writing the batch if prepare succeeds,
+	// it can be nil.
+	done func(err error)
+}
+
+// writeReq is a write waiting for its group to be committed.
+type writeReq struct {
+	steps []writeStep
+	err   error
+	// wake is signaled when the write is finished or it becomes the leader.
+	wake     chan struct{}
+	finished bool
+	// exclusive means the write is committed in a group alone.
+	exclusive bool
+}
+
+// groupCommitter queues the concurrent writes, the first one is the leader,
+// which commits the queued writes as a group and wakes up the next leader.
+type groupCommitter struct {
+	mu    sync.Mutex
+	queue []*writeReq
+}
+
+// recordBatch records the changes of a step, which are replayed to the
+// batch of the group if the step is prepared.
+type recordBatch struct {
+	writes []write
+}
+
+type write struct {
+	key      []byte
+	value    []byte
+	isDelete bool
+}
+
+// Put implements engine.Batch Put interface.
+func (b *recordBatch) Put(key []byte, value []byte) {
+	b.writes = append(b.writes, write{key: key, value: value})
+}
+
+// Delete implements engine.Batch Delete interface.
+func (b *recordBatch) Delete(key []byte) {
+	b.writes = append(b.writes, write{key: key, isDelete: true})
+}
+
+func (b *recordBatch) replay(to engine.Batch) {
+	for _, w := range b.writes {
+		if w.isDelete {
+			to.Delete(w.key)
+		} else {
+			to.Put(w.key, w.value)
+		}
+	}
+}
+
+// writeBatch runs the steps in order with s.mu held, and writes the batch of
+// every step to the engine before the next step runs. The steps of the
+// concurrent callers are prepared serially, and the batches of the same step
+// are merged into one engine write, so a synced engine syncs once for a group.
+// The keys written by the concurrent callers must not overlap, which is
+// guaranteed by the lock manager.
+func (s *dbStore) writeBatch(steps ...writeStep) error {
+	return s.write(&writeReq{steps: steps, wake: make(chan struct{}, 1)})
+}
+
+// writeExclusive is like writeBatch, but the steps are committed in a group alone,
+// so all the writes queued before it are written when its first step is prepared.
+// It is used by the writes which read the keys written by the others.
+func (s *dbStore) writeExclusive(steps ...writeStep) error {
+	return s.write(&writeReq{steps: steps, wake: make(chan struct{}, 1), exclusive: true})
+}
+
+func (s *dbStore) write(req *writeReq) error {
+	gc := &s.gc
+	gc.mu.Lock()
+	gc.queue = append(gc.queue, req)
+	leader := len(gc.queue) == 1
+	gc.mu.Unlock()
+
+	if !leader {
+		<-req.wake
+		if req.finished {
+			return req.err
+		}
+	}
+
+	gc.mu.Lock()
+	group := gc.queue
+	if len(group) > maxGroupSize {
+		group = group[:maxGroupSize]
+	}
+	for i, r := range group {
+		if !r.exclusive {
+			continue
+		}
+		if i == 0 {
+			i = 1
+		}
+		group = group[:i]
+		break
+	}
+	gc.mu.Unlock()
+
+	s.commitGroup(group)
+
+	gc.mu.Lock()
+	gc.queue = gc.queue[len(group):]
+	var next *writeReq
+	if len(gc.queue) > 0 {
+		next = gc.queue[0]
+	}
+	gc.mu.Unlock()
+
+	for _, r := range group[1:] {
+		r.finished = true
+		r.wake <- struct{}{}
+	}
+	if next != nil {
+		next.wake <- struct{}{}
+	}
+	return req.err
+}
+
+// commitGroup runs the steps of the writes in group with s.mu held.
+func (s *dbStore) commitGroup(group []*writeReq) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	steps := 0
+	for _, r := range group {
+		if len(r.steps) > steps {
+			steps = len(r.steps)
+		}
+	}
+
+	for i := 0; i < steps; i++ {
+		var (
+			b        engine.Batch
+			undo     engine.Batch
+			prepared []*writeReq
+		)
+		for _, r := range group {
+			if r.err != nil || i >= len(r.steps) {
+				continue
+			}
+			step := r.steps[i]
+			rb := &recordBatch{}
+			if err := step.prepare(rb); err != nil {
+				r.err = errors.Trace(err)
+				if step.undo != nil {
+					if undo == nil {
+						undo = s.db.NewBatch()
+					}
+					step.undo(undo)
+				}
+				continue
+			}
+			if b == nil {
+				b = s.db.NewBatch()
+			}
+			rb.replay(b)
+			prepared = append(prepared, r)
+		}
+
+		if b != nil {
+			err := s.db.Commit(b)
+			for _, r := range prepared {
+				step := r.steps[i]
+				if err != nil {
+					r.err = errors.Trace(err)
+					if step.undo != nil {
+						if undo == nil {
+							undo = s.db.NewBatch()
+						}
+						step.undo(undo)
+					}
+				}
+				if step.done != nil {
+					step.done(err)
+				}
+			}
+		}
+		if undo != nil {
+			if err := s.db.Commit(undo); err != nil {
+				log.Errorf("undo writes err %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+var _ = Suite(&testGroupCommitSuite{})
+
+type testGroupCommitSuite struct {
+}
+
+// slowDriver opens engines which take a while to commit a batch, like syncing to the disk.
+type slowDriver struct {
+	engine.Driver
+	commits *int64
+}
+
+func (d slowDriver) Open(path string) (engine.DB, error) {
+	db, err := d.Driver.Open(path)
+	return &slowDB{DB: db, commits: d.commits}, err
+}
+
+type slowDB struct {
+	engine.DB
+	commits *int64
+}
+
+func (db *slowDB) Commit(b engine.Batch) error {
+	atomic.AddInt64(db.commits, 1)
+	time.Sleep(time.Millisecond)
+	return db.DB.Commit(b)
+}
+
+func (t *testGroupCommitSuite) TestGroupCommit(c *C) {
+	var commits int64
+	s, err := Driver{slowDriver{Driver: goleveldb.MemoryDriver{}, commits: &commits}}.Open("memory:group")
+	c.Assert(err, IsNil)
+	defer s.Close()
+	sub := s.(kv.CommitNotifier).Subscribe()
+	defer sub.Close()
+
+	n := 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err1 := kv.RunInNewTxn(s, false, func(txn kv.Transaction) error {
+				if err2 := txn.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v")); err2 != nil {
+					return err2
+				}
+				return txn.Set([]byte(fmt.Sprintf("s%d", i)), []byte("v"))
+			})
+			c.Assert(err1, IsNil)
+		}(i)
+	}
+	wg.Wait()
+
+	// Every transaction writes the locks, the primary and the secondaries in 3 batches.
+	c.Assert(atomic.LoadInt64(&commits) < int64(3*n), IsTrue)
+
+	txn, err := s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	for i := 0; i < n; i++ {
+		v, err1 := txn.Get([]byte(fmt.Sprintf("s%d", i)))
+		c.Assert(err1, IsNil)
+		c.Assert(v, DeepEquals, []byte("v"))
+	}
+
+	// The events are emitted in the order of the commit versions.
+	var last kv.Version
+	for i := 0; i < n; i++ {
+		ev := <-sub.Events()
+		c.Assert(ev.CommitVersion.Cmp(last) > 0, IsTrue)
+		last = ev.CommitVersion
+	}
+}
+
+func (t *testGroupCommitSuite) TestConflict(c *C) {
+	s, err := Driver{goleveldb.MemoryDriver{}}.Open("memory:group-conflict")
+	c.Assert(err, IsNil)
+	defer s.Close()
+
+	// The transactions updating the same locked key are serialized by the lock manager,
+	// only the first one is committed, the others see the conflict.
+	n := 20
+	var (
+		wg        sync.WaitGroup
+		committed int64
+	)
+	txns := make([]kv.Transaction, n)
+	for i := 0; i < n; i++ {
+		txns[i], err = s.Begin()
+		c.Assert(err, IsNil)
+		c.Assert(txns[i].LockKeys([]byte("a")), IsNil)
+		c.Assert(txns[i].Set([]byte("a"), []byte(fmt.Sprint(i))), IsNil)
+	}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(txn kv.Transaction) {
+			defer wg.Done()
+			err1 := txn.Commit()
+			if err1 == nil {
+				atomic.AddInt64(&committed, 1)
+				return
+			}
+			c.Assert(errors2.ErrorEqual(err1, kv.ErrConditionNotMatch), IsTrue)
+		}(txns[i])
+	}
+	wg.Wait()
+	c.Assert(committed, Equals, int64(1))
+}
@@ -14,10 +14,8 @@
 package localstore
 
 import (
-	"bytes"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/juju/errors"
 	"github.com/ngaut/log"
@@ -27,17 +25,51 @@ import (
 )
 
 var (
-	_ kv.Storage = (*dbStore)(nil)
+	_ kv.Storage             = (*dbStore)(nil)
+	_ kv.CompressionReporter = (*dbStore)(nil)
+	_ kv.ReadOnlyChecker     = (*dbStore)(nil)
 )
 
 type dbStore struct {
 	mu sync.Mutex
 	db engine.DB
 
-	txns       map[int64]*dbTxn
-	keysLocked map[string]int64
-	uuid       string
-	path       string
+	// txns are the running transactions, their start versions are the safe point of the gc.
+	txns map[int64]*dbTxn
+	uuid string
+	path string
+	// oracle provides the start versions of snapshots and the commit versions.
+	oracle kv.VersionProvider
+	lm     *lockManager
+	// notifier emits the committed transactions to the subscriptions.
+	notifier *notifier
+	// compressor is nil if the compression is never enabled.
+	compressor *compressor
+	// readOnly is set by the read_only option, the transactions can't write.
+	readOnly bool
+	// gc merges the batches of the concurrent commits.
+	gc groupCommitter
+	// tombstones are the range tombstones not removed by the gc worker yet,
+	// it is replaced with s.mu held, see rangeTombstones.
+	tombstones rangeTombstones
+
+	// gcCh wakes up the gc worker of the dropped ranges, closeCh stops it.
+	gcCh    chan struct{}
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// parseReadOnly returns the read_only option of path, it is left in the path
+// so the engine opens its files in read-only mode too. An engine may still
+// lock its files, e.g. goleveldb, then the store can't be opened while it is
+// opened by another process.
+func parseReadOnly(path string) (bool, error) {
+	_, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	readOnly, err := opts.Bool("read_only", false)
+	return readOnly, errors.Trace(err)
 }
 
 type storeCache struct {
@@ -70,18 +102,81 @@ func (d Driver) Open(schema string) (kv.Storage, error) {
 		return store, nil
 	}
 
-	db, err := d.Driver.Open(schema)
+	path, compression, err := parseCompression(schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	readOnly, err := parseReadOnly(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	db, err := d.Driver.Open(path)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
+	// The versions start after the largest version in db, even if the wall clock
+	// is behind it, e.g. the clock goes backwards or the store is reopened at once.
+	var maxVer uint64
+	if readOnly {
+		// Nothing is written to a read-only store, the compression mode can't be changed,
+		// and the data of the transactions left committing is not visible.
+		compression = ""
+		log.Warnf("store %s is read-only, the locks left by crashed transactions are not resolved", schema)
+		_, _, maxVer, err = scanLocks(db)
+	} else {
+		// Resolve the locks left by the transactions which were committing when the store crashed.
+		var n int
+		n, maxVer, err = resolveLocks(db)
+		if n > 0 {
+			log.Warnf("resolve %d locks for store %s", n, schema)
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	tombstones, tombstoneVer, err := loadTombstones(db)
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	if tombstoneVer > maxVer {
+		maxVer = tombstoneVer
+	}
+
+	oracle := &LocalVersionProvider{lastTimestamp: maxVer}
+	ver, err := oracle.CurrentVersion()
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	c, err := loadCompressor(db, compression, ver)
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+
 	log.Info("New store", schema)
 	s := &dbStore{
 		txns:       make(map[int64]*dbTxn),
-		keysLocked: make(map[string]int64),
 		uuid:       uuid.NewV4().String(),
 		path:       schema,
 		db:         db,
+		oracle:     oracle,
+		lm:         newLockManager(),
+		notifier:   newNotifier(),
+		compressor: c,
+		readOnly:   readOnly,
+		tombstones: tombstones,
+		gcCh:       make(chan struct{}, 1),
+		closeCh:    make(chan struct{}),
+	}
+	if !readOnly {
+		// The ranges deleted before the store is closed are removed at start.
+		s.wg.Add(1)
+		go s.runGC()
+		s.kickGC()
 	}
 
 	mc.cache[schema] = s
@@ -98,86 +193,286 @@ func (s *dbStore) Begin() (kv.Transaction, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	snapshot, err := s.db.GetSnapshot()
+	ver, err := s.oracle.CurrentVersion()
 	if err != nil {
-		return nil, err
+		return nil, errors.Trace(err)
+	}
+
+	snapshot, err := s.newSnapshot(ver)
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
 
 	txn := &dbTxn{
-		startTs:      time.Now(),
-		tID:          atomic.AddInt64(&globalID, 1),
-		valid:        true,
-		store:        s,
-		snapshotVals: make(map[string][]byte),
-	}
-	log.Debugf("Begin txn:%d", txn.tID)
-	txn.UnionStore, err = kv.NewUnionStore(&dbSnapshot{snapshot})
+		version:    ver,
+		tID:        atomic.AddInt64(&globalID, 1),
+		valid:      true,
+		store:      s,
+		lockedKeys: make(map[string]struct{}),
+	}
+	log.Debugf("Begin txn:%d, version:%d", txn.tID, ver.Ver)
+	txn.UnionStore, err = kv.NewUnionStore(snapshot)
 	if err != nil {
 		return nil, err
 	}
+	s.txns[txn.tID] = txn
 	return txn, nil
 }
 
+func (s *dbStore) GetSnapshot(ver kv.Version) (kv.Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Use current version for snapshot if ver is MaxVersion.
+	if ver.Cmp(kv.MaxVersion) == 0 {
+		var err error
+		ver, err = s.oracle.CurrentVersion()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return s.newSnapshot(ver)
+}
+
+func (s *dbStore) CurrentVersion() (kv.Version, error) {
+	return s.oracle.CurrentVersion()
+}
+
+// newSnapshot must be called with s.mu held, so the engine snapshot
+// contains all the batches whose commit versions are less than ver.
+func (s *dbStore) newSnapshot(ver kv.Version) (*dbSnapshot, error) {
+	snapshot, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &dbSnapshot{
+		Snapshot:   snapshot,
+		version:    ver,
+		c:          s.compressor,
+		tombstones: s.tombstones.visibleTo(ver),
+	}, nil
+}
+
 func (s *dbStore) Close() error {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
 	delete(mc.cache, s.path)
+	select {
+	case <-s.closeCh:
+	default:
+		close(s.closeCh)
+	}
+	s.wg.Wait()
 	return s.db.Close()
 }
 
-func (s *dbStore) writeBatch(b engine.Batch) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	err := s.db.Commit(b)
-	if err != nil {
-		log.Error(err)
-		return err
+// prewrite checks the conflicts and writes the locks of keys in one batch.
+// keys must be sorted and the first one is the primary key.
+func (s *dbStore) prewrite(txn *dbTxn, keys [][]byte, locks map[string]*lockInfo) error {
+	// Acquire the keys in order, the keys locked by LockKeys in blocking mode are already held.
+	for _, key := range keys {
+		if err := s.lm.lock(txn.tID, string(key), txn.lockWaitTimeout); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
-	return nil
-}
-
-func (s *dbStore) newBatch() engine.Batch {
-	return s.db.NewBatch()
+	return s.writeBatch(writeStep{
+		prepare: func(b engine.Batch) error {
+			snapshot, err := s.db.GetSnapshot()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			defer snapshot.Release()
+
+			for _, key := range keys {
+				// err1 is used for passing `go tool vet --shadow` check.
+				_, ver, err1 := mvccSeek(snapshot, key, kv.MaxVersion)
+				if err1 != nil {
+					return errors.Trace(err1)
+				}
+				if isLockVersion(ver) {
+					return errors.Trace(kv.ErrLockConflict)
+				}
+
+				// Only the locked keys are checked for write conflicts.
+				if _, ok := txn.lockedKeys[string(key)]; ok && (ver.Cmp(txn.version) > 0 || s.tombstones.hides(key, txn.version)) {
+					log.Warnf("txn:%d, prewrite condition not match for key %q, currVer:%d, startVer:%d", txn.tID, key, ver.Ver, txn.version.Ver)
+					return errors.Trace(kv.ErrConditionNotMatch)
+				}
+
+				b.Put(mvccEncodeLockKey(key), locks[string(key)].marshal())
+			}
+			return nil
+		},
+	})
 }
 
-// Both lock and unlock are used for simulating scenario of percolator papers
+// lockKeys acquires keys for txn in blocking mode. It fails fast with kv.ErrConditionNotMatch
+// if a key has been changed after txn began, e.g, by the transaction it has waited for.
+func (s *dbStore) lockKeys(txn *dbTxn, keys [][]byte) error {
+	for _, key := range keys {
+		if err := s.lm.lock(txn.tID, string(key), txn.lockWaitTimeout); err != nil {
+			return errors.Trace(err)
+		}
+	}
 
-func (s *dbStore) tryConditionLockKey(tID int64, key string, snapshotVal []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.keysLocked[key]; ok {
-		return errors.Trace(kv.ErrLockConflict)
-	}
-
-	currValue, err := s.db.Get([]byte(key))
+	snapshot, err := s.db.GetSnapshot()
 	if err != nil {
 		return errors.Trace(err)
 	}
+	defer snapshot.Release()
 
-	if !bytes.Equal(currValue, snapshotVal) {
-		log.Warnf("txn:%d, tryLockKey condition not match for key %s, currValue:%q, snapshotVal:%q", tID, key, currValue, snapshotVal)
-		return errors.Trace(kv.ErrConditionNotMatch)
+	// Skip the locks, they are checked in prewrite.
+	lastCommitted := kv.NewVersion(kv.MaxVersion.Ver - 1)
+	for _, key := range keys {
+		_, ver, err1 := mvccSeek(snapshot, key, lastCommitted)
+		if err1 != nil {
+			return errors.Trace(err1)
+		}
+		if ver.Cmp(txn.version) > 0 || s.tombstones.hides(key, txn.version) {
+			return errors.Trace(kv.ErrConditionNotMatch)
+		}
 	}
-
-	s.keysLocked[key] = tID
-
 	return nil
 }
 
-func (s *dbStore) unLockKeys(keys ...string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// commit allocates a commit version, marks the primary lock as committed,
+// then writes the values and removes the locks of keys.
+// Allocating and writing are done with s.mu held, so no transaction can begin
+// with a greater version before the values are written.
+// The tombstones of the ranges deleted by txn are written with the primary.
+func (s *dbStore) commit(txn *dbTxn, keys [][]byte, locks map[string]*lockInfo) error {
+	var (
+		commitVer  kv.Version
+		ev         *kv.CommitEvent
+		tombstones rangeTombstones
+		deleted    []kv.Mutation
+	)
+	// The event is built only if there is a subscription when the commit starts,
+	// the keys in the deleted ranges are read for it with the other writes blocked.
+	active := s.notifier.active()
+	exclusive := active && len(txn.UnionStore.DeletedRanges) > 0
+	primary := writeStep{
+		prepare: func(b engine.Batch) error {
+			var err error
+			if commitVer, err = s.oracle.CurrentVersion(); err != nil {
+				return errors.Trace(err)
+			}
+			// The ranges are deleted with the primary lock marked as committed in one batch.
+			if tombstones, deleted, err = s.deleteRanges(b, txn, commitVer, exclusive); err != nil {
+				return errors.Trace(err)
+			}
+			if len(keys) == 0 {
+				return nil
+			}
+			l := locks[string(keys[0])]
+			l.commitVer = commitVer
+			b.Put(mvccEncodeLockKey(keys[0]), l.marshal())
+			return nil
+		},
+		undo: func(b engine.Batch) {
+			for _, key := range keys {
+				locks[string(key)].rollback(b, key)
+			}
+		},
+		done: func(err error) {
+			if err == nil && len(tombstones) > 0 {
+				s.tombstones = s.tombstones.add(tombstones)
+			}
+		},
+	}
+	secondaries := writeStep{
+		prepare: func(b engine.Batch) error {
+			err := runCommitFailpoint(commitPhasePrimary)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if active {
+				if ev, err = s.newCommitEvent(keys, locks, commitVer); err != nil {
+					log.Errorf("build commit event err %v", err)
+				} else {
+					ev.Mutations = append(deleted, ev.Mutations...)
+				}
+			}
+			for _, key := range keys {
+				locks[string(key)].commit(b, key, commitVer)
+			}
+			return nil
+		},
+		done: func(err error) {
+			if err != nil {
+				// The transaction is committed, the locks will be rolled forward when the store is opened again.
+				log.Errorf("commit secondaries err %v", err)
+			}
+			// The events are emitted with s.mu held in the order of the commit versions.
+			if ev != nil {
+				s.notifier.notify(ev)
+			}
+		},
+	}
+	if exclusive {
+		return s.writeExclusive(primary, secondaries)
+	}
+	return s.writeBatch(primary, secondaries)
+}
+
+// newCommitEvent builds the event of the transaction committed with commitVer,
+// it must be called with s.mu held before the values are written.
+func (s *dbStore) newCommitEvent(keys [][]byte, locks map[string]*lockInfo, commitVer kv.Version) (*kv.CommitEvent, error) {
+	snapshot, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer snapshot.Release()
 
+	ev := &kv.CommitEvent{CommitVersion: commitVer}
+	lastCommitted := kv.NewVersion(kv.MaxVersion.Ver - 1)
 	for _, key := range keys {
-		if _, ok := s.keysLocked[key]; !ok {
-			return kv.ErrNotExist
+		l := locks[string(key)]
+		if l.op == lockOpLock {
+			continue
 		}
-
-		delete(s.keysLocked, key)
+		old, ver, err1 := mvccSeek(snapshot, key, lastCommitted)
+		if err1 != nil {
+			return nil, errors.Trace(err1)
+		}
+		if s.tombstones.hides(key, ver) {
+			old = nil
+		}
+		if old, err1 = s.compressor.decode(old, ver); err1 != nil {
+			return nil, errors.Trace(err1)
+		}
+		m := kv.Mutation{Key: kv.DecodeKey(key)}
+		// An empty value is a tombstone.
+		if len(old) > 0 {
+			m.OldValue = old
+		}
+		if l.op == lockOpPut {
+			if m.NewValue, err1 = s.compressor.decode(l.value, commitVer); err1 != nil {
+				return nil, errors.Trace(err1)
+			}
+		}
+		ev.Mutations = append(ev.Mutations, m)
 	}
+	return ev, nil
+}
 
-	return nil
+// Subscribe implements kv.CommitNotifier Subscribe interface.
+func (s *dbStore) Subscribe() kv.Subscription {
+	return s.notifier.subscribe()
+}
+
+// CompressionStats implements kv.CompressionReporter CompressionStats interface.
+func (s *dbStore) CompressionStats() kv.CompressionStats {
+	return s.compressor.stats()
+}
+
+// IsReadOnly implements kv.ReadOnlyChecker IsReadOnly interface.
+func (s *dbStore) IsReadOnly() bool {
+	return s.readOnly
 }
@@ -14,15 +14,19 @@
 package localstore
 
 import (
+	"bytes"
 	"fmt"
+	"os"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/errors2"
 )
 
 const (
@@ -182,6 +186,29 @@ func (s *testKVSuite) TestSeek(c *C) {
 	mustDel(c, txn)
 }
 
+func (s *testKVSuite) TestSeekKeyCmp(c *C) {
+	txn, err := s.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+
+	c.Assert(txn.Set([]byte("ab"), []byte("1")), IsNil)
+	// The predicate gets the whole key.
+	var got []byte
+	it, err := txn.Seek([]byte("a"), func(k []byte) bool {
+		got = k
+		return !bytes.Equal(k, []byte("ab"))
+	})
+	c.Assert(err, IsNil)
+	c.Assert(string(got), Equals, "ab")
+	c.Assert(it.Valid(), IsTrue)
+	c.Assert(it.Key(), Equals, "ab")
+	it.Close()
+
+	it, err = txn.Seek([]byte("a"), func(k []byte) bool { return bytes.HasPrefix(k, []byte("ab")) })
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsFalse)
+}
+
 func (s *testKVSuite) TestInc(c *C) {
 	txn, err := s.s.Begin()
 	c.Assert(err, IsNil)
@@ -496,3 +523,43 @@ func (s *testKVSuite) TestConditionUpdate(c *C) {
 	err = txn.Commit()
 	c.Assert(err, IsNil)
 }
+
+func (s *testKVSuite) TestReadOnly(c *C) {
+	path := "/tmp/test-tidb-readonly"
+	defer os.RemoveAll(path)
+	d := Driver{goleveldb.Driver{}}
+
+	store, err := d.Open(path)
+	c.Assert(err, IsNil)
+	c.Assert(kv.IsReadOnly(store), IsFalse)
+	// The data is committed with a version ahead of the wall clock, as if the
+	// clock goes backwards after the store is closed.
+	future := uint64(time.Now().Add(time.Hour).UnixNano()/int64(time.Millisecond)) << timePrecisionOffset
+	store.(*dbStore).oracle = &LocalVersionProvider{lastTimestamp: future}
+	err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte("a"), []byte("1"))
+	})
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+
+	// The versions of the reopened store are later than the committed one.
+	store, err = d.Open(path + "?read_only=true")
+	c.Assert(err, IsNil)
+	defer store.Close()
+	c.Assert(kv.IsReadOnly(store), IsTrue)
+	ver, err := store.CurrentVersion()
+	c.Assert(err, IsNil)
+	c.Assert(ver.Ver > future, IsTrue)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	v, err := txn.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("1"))
+	c.Assert(errors2.ErrorEqual(txn.Set([]byte("b"), []byte("2")), kv.ErrReadOnly), IsTrue)
+	c.Assert(errors2.ErrorEqual(txn.Delete([]byte("a")), kv.ErrReadOnly), IsTrue)
+	_, err = txn.Inc([]byte("c"), 1)
+	c.Assert(errors2.ErrorEqual(err, kv.ErrReadOnly), IsTrue)
+	c.Assert(errors2.ErrorEqual(txn.LockKeys([]byte("a")), kv.ErrReadOnly), IsTrue)
+	c.Assert(txn.Commit(), IsNil)
+}
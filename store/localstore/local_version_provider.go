@@ -0,0 +1,48 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// LocalVersionProvider uses local timestamp for version.
+// A version is the wall clock in milliseconds shifted left by
+// timePrecisionOffset, the lower bits serve as a logical counter
+// for versions allocated within the same millisecond.
+type LocalVersionProvider struct {
+	mu sync.Mutex
+	// lastTimestamp is the last version allocated, it starts from the largest
+	// version of the data when the store is opened.
+	lastTimestamp uint64
+}
+
+const timePrecisionOffset = 18
+
+// CurrentVersion implements the VersionProvider's CurrentVersion interface.
+// The returned version is strictly increasing even if the wall clock goes backwards.
+func (l *LocalVersionProvider) CurrentVersion() (kv.Version, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ts := uint64(time.Now().UnixNano()/int64(time.Millisecond)) << timePrecisionOffset
+	if ts <= l.lastTimestamp {
+		ts = l.lastTimestamp + 1
+	}
+	l.lastTimestamp = ts
+	return kv.NewVersion(ts), nil
+}
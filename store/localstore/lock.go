@@ -0,0 +1,184 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// Transactions are committed in two phases like percolator:
+//
+//  1. Prewrite writes a lock for every key of the transaction in one batch,
+//     the first key in order is the primary key, others are secondary keys.
+//  2. Commit marks the primary lock as committed with the commit version in one batch,
+//     this is the commit point of the transaction. Then the values of all keys are
+//     written with the commit version and all locks are removed in another batch.
+//
+// A lock is stored as the MaxVersion of its key, so it is never visible to snapshots.
+// If the store crashes in the middle of a commit, the locks left are resolved when
+// the store is opened again: the transaction is rolled forward if its primary lock
+// is committed, otherwise rolled back.
+
+type lockOp byte
+
+const (
+	lockOpPut lockOp = iota + 1
+	lockOpDelete
+	// lockOpLock only locks the key for conflict checking, the value is not changed.
+	lockOpLock
+)
+
+// lockInfo is the value of a lock.
+type lockInfo struct {
+	primary  []byte
+	startVer kv.Version
+	// commitVer is only set in the primary lock when the transaction is committed.
+	commitVer kv.Version
+	op        lockOp
+	value     []byte
+}
+
+func mvccEncodeLockKey(key []byte) []byte {
+	return MvccEncodeVersionKey(key, kv.MaxVersion)
+}
+
+func isLockVersion(ver kv.Version) bool {
+	return ver.Cmp(kv.MaxVersion) == 0
+}
+
+func (l *lockInfo) isCommitted() bool {
+	return l.commitVer.Cmp(kv.MinVersion) != 0
+}
+
+func (l *lockInfo) marshal() []byte {
+	b := codec.EncodeBytes(nil, l.primary)
+	b = codec.EncodeUint(b, l.startVer.Ver)
+	b = codec.EncodeUint(b, l.commitVer.Ver)
+	b = append(b, byte(l.op))
+	return append(b, l.value...)
+}
+
+func unmarshalLock(data []byte) (*lockInfo, error) {
+	remain, primary, err := codec.DecodeBytes(data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	remain, startVer, err := codec.DecodeUint(remain)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	remain, commitVer, err := codec.DecodeUint(remain)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(remain) == 0 {
+		return nil, errors.Errorf("invalid lock %q", data)
+	}
+
+	return &lockInfo{
+		primary:   append([]byte(nil), primary...),
+		startVer:  kv.NewVersion(startVer),
+		commitVer: kv.NewVersion(commitVer),
+		op:        lockOp(remain[0]),
+		value:     append([]byte(nil), remain[1:]...),
+	}, nil
+}
+
+// commit writes the value of key with commitVer and removes the lock.
+func (l *lockInfo) commit(b engine.Batch, key []byte, commitVer kv.Version) {
+	switch l.op {
+	case lockOpPut:
+		b.Put(MvccEncodeVersionKey(key, commitVer), l.value)
+	case lockOpDelete:
+		// An empty value is a tombstone.
+		b.Put(MvccEncodeVersionKey(key, commitVer), nil)
+	}
+	b.Delete(mvccEncodeLockKey(key))
+}
+
+// rollback removes the lock.
+func (l *lockInfo) rollback(b engine.Batch, key []byte) {
+	b.Delete(mvccEncodeLockKey(key))
+}
+
+// scanLocks returns the locks left in db and the largest version of the data in db,
+// the versions of the store must start after it.
+func scanLocks(db engine.DB) ([][]byte, map[string]*lockInfo, uint64, error) {
+	snapshot, err := db.GetSnapshot()
+	if err != nil {
+		return nil, nil, 0, errors.Trace(err)
+	}
+	defer snapshot.Release()
+
+	var (
+		keys   [][]byte
+		maxVer uint64
+	)
+	locks := make(map[string]*lockInfo)
+	it := snapshot.NewIterator(nil, mvccEncodeEndKey(nil))
+	defer it.Release()
+	for it.Next() {
+		key, ver, err1 := MvccDecode(it.Key())
+		if err1 != nil {
+			return nil, nil, 0, errors.Trace(err1)
+		}
+		if !isLockVersion(ver) {
+			if ver.Ver > maxVer {
+				maxVer = ver.Ver
+			}
+			continue
+		}
+		l, err1 := unmarshalLock(it.Value())
+		if err1 != nil {
+			return nil, nil, 0, errors.Trace(err1)
+		}
+		if l.commitVer.Ver > maxVer {
+			maxVer = l.commitVer.Ver
+		}
+		if l.startVer.Ver > maxVer {
+			maxVer = l.startVer.Ver
+		}
+		keys = append(keys, key)
+		locks[string(key)] = l
+	}
+	return keys, locks, maxVer, nil
+}
+
+// resolveLocks rolls forward or rolls back all the locks left in db, and returns
+// the number of the locks and the largest version of the data in db.
+// It must be called before the store serves any transaction.
+func resolveLocks(db engine.DB) (int, uint64, error) {
+	keys, locks, maxVer, err := scanLocks(db)
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	if len(keys) == 0 {
+		return 0, maxVer, nil
+	}
+
+	b := db.NewBatch()
+	for _, key := range keys {
+		l := locks[string(key)]
+		primary, ok := locks[string(l.primary)]
+		if ok && primary.startVer.Cmp(l.startVer) == 0 && primary.isCommitted() {
+			l.commit(b, key, primary.commitVer)
+		} else {
+			l.rollback(b, key)
+		}
+	}
+	return len(keys), maxVer, errors.Trace(db.Commit(b))
+}
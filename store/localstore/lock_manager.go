@@ -0,0 +1,136 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+)
+
+// lockManager tracks which transaction holds a key in this process.
+// A transaction acquires its keys here before prewrite, and in blocking mode
+// acquires the keys of LockKeys immediately, all of them are released when
+// the transaction is committed or rolled back.
+//
+// A transaction can wait for only one holder at a time, so the wait-for graph
+// is kept as a map from the waiting transaction to the holder, and a deadlock
+// is found if the holder chain leads back to the waiting transaction.
+type lockManager struct {
+	mu      sync.Mutex
+	owners  map[string]int64
+	held    map[int64][]string
+	waitFor map[int64]int64
+	// released is closed and replaced whenever some keys are released to wake up the waiters.
+	released chan struct{}
+}
+
+func newLockManager() *lockManager {
+	return &lockManager{
+		owners:   make(map[string]int64),
+		held:     make(map[int64][]string),
+		waitFor:  make(map[int64]int64),
+		released: make(chan struct{}),
+	}
+}
+
+// lock acquires key for transaction tID. If the key is held by another transaction,
+// lock fails with kv.ErrLockConflict immediately when timeout is zero, otherwise it
+// waits until the key is released, and fails with kv.ErrLockWaitTimeout if it waits
+// longer than timeout, or kv.ErrDeadlock if waiting would cause a deadlock.
+func (lm *lockManager) lock(tID int64, key string, timeout time.Duration) error {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for {
+		owner, ok := lm.owners[key]
+		if !ok {
+			lm.owners[key] = tID
+			lm.held[tID] = append(lm.held[tID], key)
+			delete(lm.waitFor, tID)
+			return nil
+		}
+		if owner == tID {
+			delete(lm.waitFor, tID)
+			return nil
+		}
+
+		if timeout <= 0 {
+			return errors.Trace(kv.ErrLockConflict)
+		}
+		if lm.isWaitingFor(owner, tID) {
+			delete(lm.waitFor, tID)
+			log.Warnf("txn:%d, deadlock found when waiting for key %q held by txn:%d", tID, key, owner)
+			return errors.Trace(kv.ErrDeadlock)
+		}
+
+		lm.waitFor[tID] = owner
+		if timer == nil {
+			timer = time.NewTimer(timeout)
+		}
+		released := lm.released
+		lm.mu.Unlock()
+		select {
+		case <-released:
+			lm.mu.Lock()
+		case <-timer.C:
+			lm.mu.Lock()
+			delete(lm.waitFor, tID)
+			return errors.Trace(kv.ErrLockWaitTimeout)
+		}
+	}
+}
+
+// isWaitingFor checks whether transaction from waits for transaction to directly or indirectly.
+func (lm *lockManager) isWaitingFor(from int64, to int64) bool {
+	// The length of the chain can't exceed the number of waiting transactions.
+	for i := 0; i <= len(lm.waitFor); i++ {
+		if from == to {
+			return true
+		}
+		next, ok := lm.waitFor[from]
+		if !ok {
+			return false
+		}
+		from = next
+	}
+	return false
+}
+
+// unlockAll releases all the keys held by transaction tID.
+func (lm *lockManager) unlockAll(tID int64) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	keys, ok := lm.held[tID]
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		delete(lm.owners, key)
+	}
+	delete(lm.held, tID)
+
+	close(lm.released)
+	lm.released = make(chan struct{})
+}
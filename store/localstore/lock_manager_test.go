@@ -0,0 +1,139 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+var _ = Suite(&testLockWaitSuite{})
+
+type testLockWaitSuite struct {
+	s kv.Storage
+}
+
+func (t *testLockWaitSuite) SetUpTest(c *C) {
+	d := Driver{
+		goleveldb.MemoryDriver{},
+	}
+	var err error
+	t.s, err = d.Open("memory:lockwait")
+	c.Assert(err, IsNil)
+}
+
+func (t *testLockWaitSuite) TearDownTest(c *C) {
+	err := t.s.Close()
+	c.Assert(err, IsNil)
+}
+
+func (t *testLockWaitSuite) begin(c *C, timeout time.Duration) kv.Transaction {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	txn.SetOption(kv.LockWaitTimeout, timeout)
+	return txn
+}
+
+func (t *testLockWaitSuite) TestNoWait(c *C) {
+	txn1 := t.begin(c, time.Second)
+	err := txn1.LockKeys([]byte("a"))
+	c.Assert(err, IsNil)
+
+	txn2 := t.begin(c, 0)
+	err = txn2.Set([]byte("a"), []byte("2"))
+	c.Assert(err, IsNil)
+	err = txn2.Commit()
+	c.Assert(errors2.ErrorEqual(err, kv.ErrLockConflict), IsTrue)
+
+	err = txn1.Rollback()
+	c.Assert(err, IsNil)
+}
+
+func (t *testLockWaitSuite) TestWaitTimeout(c *C) {
+	txn1 := t.begin(c, time.Second)
+	err := txn1.LockKeys([]byte("a"))
+	c.Assert(err, IsNil)
+
+	txn2 := t.begin(c, 50*time.Millisecond)
+	err = txn2.LockKeys([]byte("a"))
+	c.Assert(errors2.ErrorEqual(err, kv.ErrLockWaitTimeout), IsTrue)
+	c.Assert(kv.IsRetryableError(err), IsFalse)
+
+	err = txn2.Rollback()
+	c.Assert(err, IsNil)
+	err = txn1.Rollback()
+	c.Assert(err, IsNil)
+}
+
+func (t *testLockWaitSuite) TestWaitForHolder(c *C) {
+	txn1 := t.begin(c, time.Second)
+	err := txn1.LockKeys([]byte("a"))
+	c.Assert(err, IsNil)
+
+	// txn2 gets the lock after txn1 rolls back.
+	txn2 := t.begin(c, time.Second)
+	ch := make(chan error, 1)
+	go func() {
+		ch <- txn2.LockKeys([]byte("a"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	err = txn1.Rollback()
+	c.Assert(err, IsNil)
+	c.Assert(<-ch, IsNil)
+
+	// txn3 fails fast after txn2 commits the key.
+	txn3 := t.begin(c, time.Second)
+	go func() {
+		ch <- txn3.LockKeys([]byte("a"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	err = txn2.Set([]byte("a"), []byte("2"))
+	c.Assert(err, IsNil)
+	err = txn2.Commit()
+	c.Assert(err, IsNil)
+	err = <-ch
+	c.Assert(errors2.ErrorEqual(err, kv.ErrConditionNotMatch), IsTrue)
+	err = txn3.Rollback()
+	c.Assert(err, IsNil)
+}
+
+func (t *testLockWaitSuite) TestDeadlock(c *C) {
+	txn1 := t.begin(c, time.Second)
+	err := txn1.LockKeys([]byte("a"))
+	c.Assert(err, IsNil)
+	txn2 := t.begin(c, time.Second)
+	err = txn2.LockKeys([]byte("b"))
+	c.Assert(err, IsNil)
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- txn1.LockKeys([]byte("b"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// txn2 -> txn1 -> txn2, txn2 is the victim.
+	err = txn2.LockKeys([]byte("a"))
+	c.Assert(errors2.ErrorEqual(err, kv.ErrDeadlock), IsTrue)
+	c.Assert(kv.IsRetryableError(err), IsTrue)
+	err = txn2.Rollback()
+	c.Assert(err, IsNil)
+
+	c.Assert(<-ch, IsNil)
+	err = txn1.Commit()
+	c.Assert(err, IsNil)
+}
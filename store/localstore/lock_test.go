@@ -0,0 +1,179 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"errors"
+	"os"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+)
+
+var _ = Suite(&testLockSuite{})
+
+const testLockPath = "/tmp/test-tidb-localstore-lock"
+
+var errCrash = errors.New("crash")
+
+type testLockSuite struct {
+	d Driver
+	s kv.Storage
+}
+
+func (t *testLockSuite) SetUpTest(c *C) {
+	os.RemoveAll(testLockPath)
+	t.d = Driver{
+		goleveldb.Driver{},
+	}
+	t.reopen(c)
+}
+
+func (t *testLockSuite) TearDownTest(c *C) {
+	commitFailpoint = nil
+	err := t.s.Close()
+	c.Assert(err, IsNil)
+	t.s = nil
+	os.RemoveAll(testLockPath)
+}
+
+func (t *testLockSuite) reopen(c *C) {
+	if t.s != nil {
+		err := t.s.Close()
+		c.Assert(err, IsNil)
+	}
+	var err error
+	t.s, err = t.d.Open(testLockPath)
+	c.Assert(err, IsNil)
+}
+
+func (t *testLockSuite) mustGet(c *C, k string, v string) {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	val, err := txn.Get([]byte(k))
+	if v == "" {
+		c.Assert(kv.IsErrNotFound(err), IsTrue)
+		return
+	}
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, v)
+}
+
+func (t *testLockSuite) countLocks(c *C) int {
+	snapshot, err := t.s.(*dbStore).db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snapshot.Release()
+
+	n := 0
+	it := snapshot.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		_, ver, err1 := MvccDecode(it.Key())
+		c.Assert(err1, IsNil)
+		if isLockVersion(ver) {
+			n++
+		}
+	}
+	return n
+}
+
+// crashCommit writes a, b and deletes c in one transaction,
+// the commit stops after phase as if the store crashed.
+func (t *testLockSuite) crashCommit(c *C, phase commitPhase) {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("c"), []byte("0"))
+	c.Assert(err, IsNil)
+	err = txn.Commit()
+	c.Assert(err, IsNil)
+
+	txn, err = t.s.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("a"), []byte("1"))
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("b"), []byte("2"))
+	c.Assert(err, IsNil)
+	err = txn.Delete([]byte("c"))
+	c.Assert(err, IsNil)
+
+	commitFailpoint = func(p commitPhase) error {
+		if p == phase {
+			return errCrash
+		}
+		return nil
+	}
+	err = txn.Commit()
+	c.Assert(err, NotNil)
+	commitFailpoint = nil
+
+	c.Assert(t.countLocks(c), Equals, 3)
+
+	// A new transaction meets the locks left.
+	txn, err = t.s.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("b"), []byte("3"))
+	c.Assert(err, IsNil)
+	err = txn.Commit()
+	c.Assert(kv.IsRetryableError(err), IsTrue)
+}
+
+func (t *testLockSuite) TestRollbackAfterCrash(c *C) {
+	t.crashCommit(c, commitPhasePrewrite)
+	t.mustGet(c, "a", "")
+	t.mustGet(c, "c", "0")
+
+	t.reopen(c)
+	c.Assert(t.countLocks(c), Equals, 0)
+	t.mustGet(c, "a", "")
+	t.mustGet(c, "b", "")
+	t.mustGet(c, "c", "0")
+}
+
+func (t *testLockSuite) TestRollForwardAfterCrash(c *C) {
+	t.crashCommit(c, commitPhasePrimary)
+
+	t.reopen(c)
+	c.Assert(t.countLocks(c), Equals, 0)
+	t.mustGet(c, "a", "1")
+	t.mustGet(c, "b", "2")
+	t.mustGet(c, "c", "")
+
+	// The keys can be written again.
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("b"), []byte("3"))
+	c.Assert(err, IsNil)
+	err = txn.Commit()
+	c.Assert(err, IsNil)
+	t.mustGet(c, "b", "3")
+}
+
+func (t *testLockSuite) TestLockCodec(c *C) {
+	l := &lockInfo{
+		primary:   []byte("p"),
+		startVer:  kv.NewVersion(10),
+		commitVer: kv.NewVersion(20),
+		op:        lockOpPut,
+		value:     []byte("v"),
+	}
+	l1, err := unmarshalLock(l.marshal())
+	c.Assert(err, IsNil)
+	c.Assert(l1, DeepEquals, l)
+	c.Assert(l1.isCommitted(), IsTrue)
+
+	_, err = unmarshalLock([]byte("p"))
+	c.Assert(err, NotNil)
+}
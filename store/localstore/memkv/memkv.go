@@ -0,0 +1,232 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memkv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+var (
+	_ engine.DB       = (*db)(nil)
+	_ engine.Snapshot = (*snapshot)(nil)
+	_ engine.Iterator = (*iterator)(nil)
+)
+
+// db is an in-memory engine on a persistent AVL tree, every snapshot keeps the
+// root of the tree at the time it is taken, and a commit copies only the nodes
+// on the paths to the keys it writes, so the snapshots are never copied.
+type db struct {
+	mu   sync.RWMutex
+	root *node
+	// ver is the version of the last commit.
+	ver uint64
+}
+
+func (d *db) Get(key []byte) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	v, _ := get(d.root, key)
+	return v, nil
+}
+
+func (d *db) GetSnapshot() (engine.Snapshot, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return &snapshot{root: d.root}, nil
+}
+
+func (d *db) NewBatch() engine.Batch {
+	return &batch{}
+}
+
+func (d *db) Commit(b engine.Batch) error {
+	bt, ok := b.(*batch)
+	if !ok {
+		return errors.Errorf("invalid batch type %T", b)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// The nodes created by this commit are not seen by any snapshot yet,
+	// so they are changed in place by the later writes of the batch.
+	d.ver++
+	w := writer{ver: d.ver}
+	root := d.root
+	for _, wr := range bt.writes {
+		if wr.isDelete {
+			root = w.delete(root, wr.key)
+			continue
+		}
+		root = w.put(root, wr.key, wr.value)
+	}
+	d.root = root
+	return nil
+}
+
+// DeleteRange implements engine.DB DeleteRange interface.
+func (d *db) DeleteRange(start, end []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var (
+		keys [][]byte
+		c    cursor
+	)
+	c.seek(d.root, start)
+	for n := c.next(); n != nil; n = c.next() {
+		if end != nil && bytes.Compare(n.key, end) >= 0 {
+			break
+		}
+		keys = append(keys, n.key)
+	}
+	d.ver++
+	w := writer{ver: d.ver}
+	for _, k := range keys {
+		d.root = w.delete(d.root, k)
+	}
+	return nil
+}
+
+func (d *db) Close() error {
+	return nil
+}
+
+// Dump writes all the key/value pairs in the db to w, it is used for debugging.
+func (d *db) Dump(w io.Writer) error {
+	s, err := d.GetSnapshot()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer s.Release()
+
+	it := s.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		_, err = fmt.Fprintf(w, "%q: %q\n", it.Key(), it.Value())
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+type snapshot struct {
+	root *node
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	v, _ := get(s.root, key)
+	return v, nil
+}
+
+func (s *snapshot) NewIterator(startKey []byte, endKey []byte) engine.Iterator {
+	it := &iterator{end: endKey}
+	it.c.seek(s.root, startKey)
+	return it
+}
+
+func (s *snapshot) NewReverseIterator(endKey []byte) engine.Iterator {
+	it := &iterator{}
+	it.c.seekReverse(s.root, endKey)
+	return it
+}
+
+func (s *snapshot) Release() {
+	s.root = nil
+}
+
+type iterator struct {
+	c cursor
+
+	key   []byte
+	value []byte
+	end   []byte
+}
+
+func (i *iterator) Next() bool {
+	n := i.c.next()
+	if n == nil || i.end != nil && bytes.Compare(n.key, i.end) >= 0 {
+		i.key, i.value = nil, nil
+		return false
+	}
+	i.key, i.value = n.key, n.value
+	return true
+}
+
+func (i *iterator) Key() []byte {
+	return i.key
+}
+
+func (i *iterator) Value() []byte {
+	return i.value
+}
+
+func (i *iterator) Release() {
+	i.c.stack = nil
+}
+
+type write struct {
+	key      []byte
+	value    []byte
+	isDelete bool
+}
+
+type batch struct {
+	writes []write
+}
+
+func (b *batch) Put(key []byte, value []byte) {
+	w := write{
+		key:   append([]byte(nil), key...),
+		value: append([]byte{}, value...),
+	}
+	b.writes = append(b.writes, w)
+}
+
+func (b *batch) Delete(key []byte) {
+	w := write{
+		key:      append([]byte(nil), key...),
+		isDelete: true,
+	}
+	b.writes = append(b.writes, w)
+}
+
+// Driver implements engine Driver.
+type Driver struct {
+}
+
+// Open creates an empty memory storage database, the path is ignored,
+// the only option in it is read_only, which is ignored too.
+func (driver Driver) Open(path string) (engine.DB, error) {
+	_, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err = opts.Bool("read_only", false); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = opts.Check("memkv"); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &db{}, nil
+}
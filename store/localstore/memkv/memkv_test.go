@@ -0,0 +1,338 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memkv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testSuite{})
+
+type testSuite struct {
+	db engine.DB
+}
+
+func (s *testSuite) SetUpSuite(c *C) {
+	var (
+		d   Driver
+		err error
+	)
+	s.db, err = d.Open("memory")
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TearDownSuite(c *C) {
+	s.db.Close()
+}
+
+func (s *testSuite) TestDB(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), []byte("2"))
+	b.Delete([]byte("c"))
+
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	v, err := db.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("1"))
+
+	v, err = db.Get([]byte("c"))
+	c.Assert(err, IsNil)
+	c.Assert(v, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+
+	b = db.NewBatch()
+	b.Put([]byte("a"), []byte("2"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+
+	v, err = snap.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("1"))
+
+	v, err = db.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, []byte("2"))
+
+	v, err = snap.Get([]byte("c"))
+	c.Assert(err, IsNil)
+	c.Assert(v, IsNil)
+
+	iter := snap.NewIterator(nil, nil)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("a"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("b"))
+	c.Assert(iter.Next(), Equals, false)
+
+	iter.Release()
+
+	snap.Release()
+}
+
+func (s *testSuite) TestReverseIterator(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("r1"), []byte("1"))
+	b.Put([]byte("r2"), []byte("2"))
+	b.Put([]byte("r3"), []byte("3"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewReverseIterator([]byte("r3"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r2"))
+	c.Assert(iter.Value(), DeepEquals, []byte("2"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r1"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("r25"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r2"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("s"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r3"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator(nil)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("r3"))
+	iter.Release()
+
+	iter = snap.NewReverseIterator([]byte("0"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("r1"))
+	b.Delete([]byte("r2"))
+	b.Delete([]byte("r3"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestRangeIterator(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	b.Put([]byte("s1"), []byte("1"))
+	b.Put([]byte("s2"), []byte("2"))
+	b.Put([]byte("s3"), []byte("3"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	iter := snap.NewIterator([]byte("s1"), []byte("s3"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("s1"))
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Key(), DeepEquals, []byte("s2"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	iter = snap.NewIterator([]byte("s2"), []byte("s2"))
+	c.Assert(iter.Next(), Equals, false)
+	iter.Release()
+
+	b = db.NewBatch()
+	b.Delete([]byte("s1"))
+	b.Delete([]byte("s2"))
+	b.Delete([]byte("s3"))
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestManyKeys(c *C) {
+	db := s.db
+
+	// Write enough keys to split the tree into many pages.
+	n := 1000
+	b := db.NewBatch()
+	for i := 0; i < n; i++ {
+		b.Put([]byte(fmt.Sprintf("m%04d", i)), []byte("v"))
+	}
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+
+	b = db.NewBatch()
+	for i := 0; i < n; i += 2 {
+		b.Delete([]byte(fmt.Sprintf("m%04d", i)))
+	}
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+
+	// The snapshot still sees all the keys.
+	iter := snap.NewIterator([]byte("m"), []byte("n"))
+	cnt := 0
+	for iter.Next() {
+		c.Assert(iter.Key(), DeepEquals, []byte(fmt.Sprintf("m%04d", cnt)))
+		cnt++
+	}
+	iter.Release()
+	c.Assert(cnt, Equals, n)
+
+	for i := 1; i < n; i++ {
+		iter = snap.NewReverseIterator([]byte(fmt.Sprintf("m%04d", i)))
+		c.Assert(iter.Next(), IsTrue)
+		c.Assert(iter.Key(), DeepEquals, []byte(fmt.Sprintf("m%04d", i-1)))
+		iter.Release()
+	}
+	snap.Release()
+
+	snap, err = db.GetSnapshot()
+	c.Assert(err, IsNil)
+	iter = snap.NewReverseIterator([]byte("m9"))
+	cnt = 0
+	for iter.Next() && bytes.HasPrefix(iter.Key(), []byte("m")) {
+		c.Assert(iter.Key(), DeepEquals, []byte(fmt.Sprintf("m%04d", n-1-cnt*2)))
+		cnt++
+	}
+	iter.Release()
+	snap.Release()
+	c.Assert(cnt, Equals, n/2)
+
+	var buf bytes.Buffer
+	err = s.db.(interface {
+		Dump(w io.Writer) error
+	}).Dump(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(buf.String(), `"m`), Equals, n/2)
+
+	b = db.NewBatch()
+	for i := 1; i < n; i += 2 {
+		b.Delete([]byte(fmt.Sprintf("m%04d", i)))
+	}
+	err = db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestDeleteRange(c *C) {
+	db := s.db
+
+	b := db.NewBatch()
+	for i := 0; i < 3000; i++ {
+		b.Put([]byte(fmt.Sprintf("d%04d", i)), []byte("v"))
+	}
+	b.Put([]byte("e"), []byte("v"))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+
+	err = db.DeleteRange([]byte("d0010"), []byte("e"))
+	c.Assert(err, IsNil)
+
+	snap, err := db.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	iter := snap.NewIterator([]byte("d"), nil)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	c.Assert(keys, HasLen, 11)
+	c.Assert(keys[9], Equals, "d0009")
+	c.Assert(keys[10], Equals, "e")
+}
+
+func (s *testSuite) TestSnapshotIsolation(c *C) {
+	d := &db{}
+	b := d.NewBatch()
+	for i := 0; i < 1000; i++ {
+		b.Put([]byte(fmt.Sprintf("s%04d", i)), []byte("1"))
+	}
+	c.Assert(d.Commit(b), IsNil)
+	snap, err := d.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	// The writes after the snapshot copy the nodes instead of changing them.
+	for i := 0; i < 1000; i += 3 {
+		b = d.NewBatch()
+		b.Put([]byte(fmt.Sprintf("s%04d", i)), []byte("2"))
+		b.Delete([]byte(fmt.Sprintf("s%04d", i+1)))
+		b.Put([]byte(fmt.Sprintf("t%04d", i)), []byte("2"))
+		c.Assert(d.Commit(b), IsNil)
+	}
+	c.Assert(d.DeleteRange([]byte("s0500"), []byte("s0600")), IsNil)
+
+	iter := snap.NewIterator(nil, nil)
+	cnt := 0
+	for iter.Next() {
+		c.Assert(string(iter.Key()), Equals, fmt.Sprintf("s%04d", cnt))
+		c.Assert(string(iter.Value()), Equals, "1")
+		cnt++
+	}
+	iter.Release()
+	c.Assert(cnt, Equals, 1000)
+
+	m := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		m[fmt.Sprintf("s%04d", i)] = "1"
+	}
+	for i := 0; i < 1000; i += 3 {
+		m[fmt.Sprintf("s%04d", i)] = "2"
+		delete(m, fmt.Sprintf("s%04d", i+1))
+		m[fmt.Sprintf("t%04d", i)] = "2"
+	}
+	for i := 500; i < 600; i++ {
+		delete(m, fmt.Sprintf("s%04d", i))
+	}
+	snap2, err := d.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap2.Release()
+	iter = snap2.NewReverseIterator(nil)
+	var last string
+	cnt = 0
+	for iter.Next() {
+		k := string(iter.Key())
+		c.Assert(last == "" || k < last, IsTrue)
+		c.Assert(string(iter.Value()), Equals, m[k])
+		last = k
+		cnt++
+	}
+	iter.Release()
+	c.Assert(cnt, Equals, len(m))
+	c.Assert(height(d.root) <= 2*11, IsTrue)
+}
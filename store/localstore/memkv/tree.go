@@ -0,0 +1,220 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memkv
+
+import "bytes"
+
+// node is a node of a persistent AVL tree. A node is never changed once a
+// snapshot may reach it, a write copies the nodes on the path to the key
+// instead, so a snapshot keeps the root of the tree at the time it is taken
+// and shares the other nodes with the db.
+type node struct {
+	key    []byte
+	value  []byte
+	left   *node
+	right  *node
+	height int
+	// ver is the version of the write which created the node, the write may
+	// change the node in place.
+	ver uint64
+}
+
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func (n *node) fix() {
+	n.height = height(n.left) + 1
+	if h := height(n.right) + 1; h > n.height {
+		n.height = h
+	}
+}
+
+func get(n *node, key []byte) ([]byte, bool) {
+	for n != nil {
+		c := bytes.Compare(key, n.key)
+		switch {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n.value, true
+		}
+	}
+	return nil, false
+}
+
+// writer changes a tree by copying the nodes created by the other versions.
+type writer struct {
+	ver uint64
+}
+
+// own returns n if it is created by w, or a copy of n created by w.
+func (w writer) own(n *node) *node {
+	if n.ver == w.ver {
+		return n
+	}
+	c := *n
+	c.ver = w.ver
+	return &c
+}
+
+func (w writer) rotateLeft(n *node) *node {
+	r := w.own(n.right)
+	n.right, r.left = r.left, n
+	n.fix()
+	r.fix()
+	return r
+}
+
+func (w writer) rotateRight(n *node) *node {
+	l := w.own(n.left)
+	n.left, l.right = l.right, n
+	n.fix()
+	l.fix()
+	return l
+}
+
+// balance rebalances n which is owned by w.
+func (w writer) balance(n *node) *node {
+	n.fix()
+	switch d := height(n.left) - height(n.right); {
+	case d > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = w.rotateLeft(w.own(n.left))
+		}
+		return w.rotateRight(n)
+	case d < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = w.rotateRight(w.own(n.right))
+		}
+		return w.rotateLeft(n)
+	}
+	return n
+}
+
+func (w writer) put(n *node, key, value []byte) *node {
+	if n == nil {
+		return &node{key: key, value: value, height: 1, ver: w.ver}
+	}
+	c := bytes.Compare(key, n.key)
+	n = w.own(n)
+	switch {
+	case c < 0:
+		n.left = w.put(n.left, key, value)
+	case c > 0:
+		n.right = w.put(n.right, key, value)
+	default:
+		n.value = value
+		return n
+	}
+	return w.balance(n)
+}
+
+// delete returns the root of the tree n without key, it is n if there is no key.
+func (w writer) delete(n *node, key []byte) *node {
+	if n == nil {
+		return nil
+	}
+	c := bytes.Compare(key, n.key)
+	switch {
+	case c < 0:
+		l := w.delete(n.left, key)
+		if l == n.left {
+			return n
+		}
+		n = w.own(n)
+		n.left = l
+	case c > 0:
+		r := w.delete(n.right, key)
+		if r == n.right {
+			return n
+		}
+		n = w.own(n)
+		n.right = r
+	default:
+		if n.left == nil {
+			return n.right
+		}
+		if n.right == nil {
+			return n.left
+		}
+		var min *node
+		r := w.deleteMin(n.right, &min)
+		n = w.own(n)
+		n.key, n.value, n.right = min.key, min.value, r
+	}
+	return w.balance(n)
+}
+
+func (w writer) deleteMin(n *node, min **node) *node {
+	if n.left == nil {
+		*min = n
+		return n.right
+	}
+	n = w.own(n)
+	n.left = w.deleteMin(n.left, min)
+	return w.balance(n)
+}
+
+// cursor walks the nodes of a tree in order, the stack has the nodes which
+// are not visited yet on the path to the next node.
+type cursor struct {
+	stack   []*node
+	reverse bool
+}
+
+// seek positions c before the first key >= key, or the first key if key is nil.
+func (c *cursor) seek(n *node, key []byte) {
+	for n != nil {
+		if key == nil || bytes.Compare(key, n.key) <= 0 {
+			c.stack = append(c.stack, n)
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+}
+
+// seekReverse positions c before the last key < key, or the last key if key is nil.
+func (c *cursor) seekReverse(n *node, key []byte) {
+	c.reverse = true
+	for n != nil {
+		if key == nil || bytes.Compare(n.key, key) < 0 {
+			c.stack = append(c.stack, n)
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+}
+
+// next returns the next node, nil if there are no more nodes.
+func (c *cursor) next() *node {
+	if len(c.stack) == 0 {
+		return nil
+	}
+	n := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	if c.reverse {
+		c.seekReverse(n.left, nil)
+	} else {
+		c.seek(n.right, nil)
+	}
+	return n
+}
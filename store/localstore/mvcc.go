@@ -0,0 +1,92 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"bytes"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// Every committed write is stored in the engine under a versioned key:
+//
+//  EncodeBytes(key) + EncodeUintDesc(commitVersion)
+//
+// EncodeBytes keeps the order of the origin keys and makes sure the versions
+// of one key are stored together, EncodeUintDesc sorts the versions of one key
+// from the newest to the oldest. An empty value is a tombstone which means the
+// key is deleted at that version.
+
+// MvccEncodeVersionKey returns the encoded key of key at version ver.
+func MvccEncodeVersionKey(key []byte, ver kv.Version) []byte {
+	b := codec.EncodeBytes(nil, key)
+	return codec.EncodeUintDesc(b, ver.Ver)
+}
+
+// MvccDecode parses the origin key and version of an encoded key.
+// The returned key doesn't share memory with encodedKey.
+func MvccDecode(encodedKey []byte) ([]byte, kv.Version, error) {
+	remain, key, err := codec.DecodeBytes(encodedKey)
+	if err != nil {
+		return nil, kv.MinVersion, errors.Trace(err)
+	}
+	remain, ver, err := codec.DecodeUintDesc(remain)
+	if err != nil {
+		return nil, kv.MinVersion, errors.Trace(err)
+	}
+	if len(remain) != 0 {
+		return nil, kv.MinVersion, errors.Errorf("invalid encoded mvcc key %q", encodedKey)
+	}
+	return append([]byte(nil), key...), kv.NewVersion(ver), nil
+}
+
+// storeMetaPrefix is the prefix of the keys which store the meta of the store.
+// EncodeBytes escapes a leading 0xFF, so no encoded key starts with it.
+var storeMetaPrefix = []byte{0xFF, 0xFF}
+
+// mvccEncodeEndKey returns the encoded upper bound of the keys < key,
+// all the versions of the keys < key are less than it.
+// A nil key means no upper bound, the meta of the store is out of the range.
+func mvccEncodeEndKey(key []byte) []byte {
+	if key == nil {
+		return storeMetaPrefix
+	}
+	return codec.EncodeBytes(nil, key)
+}
+
+func isTombstone(v []byte) bool {
+	return len(v) == 0
+}
+
+// mvccSeek returns the newest version of key which is <= ver and its value.
+// It returns a nil value if no such version exists.
+func mvccSeek(snap engine.Snapshot, key []byte, ver kv.Version) ([]byte, kv.Version, error) {
+	it := snap.NewIterator(MvccEncodeVersionKey(key, ver), mvccEncodeEndKey(nil))
+	defer it.Release()
+
+	if !it.Next() {
+		return nil, kv.MinVersion, nil
+	}
+	k, v, err := MvccDecode(it.Key())
+	if err != nil {
+		return nil, kv.MinVersion, errors.Trace(err)
+	}
+	if !bytes.Equal(k, key) {
+		return nil, kv.MinVersion, nil
+	}
+	return append([]byte(nil), it.Value()...), v, nil
+}
@@ -0,0 +1,352 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+)
+
+var _ = Suite(&testMvccSuite{})
+
+type testMvccSuite struct {
+	s kv.Storage
+}
+
+func (t *testMvccSuite) SetUpTest(c *C) {
+	d := Driver{
+		goleveldb.MemoryDriver{},
+	}
+	var err error
+	t.s, err = d.Open("memory:mvcc")
+	c.Assert(err, IsNil)
+}
+
+func (t *testMvccSuite) TearDownTest(c *C) {
+	err := t.s.Close()
+	c.Assert(err, IsNil)
+}
+
+func (t *testMvccSuite) TestMvccEncode(c *C) {
+	encodedKey1 := MvccEncodeVersionKey([]byte("A"), kv.NewVersion(1))
+	encodedKey2 := MvccEncodeVersionKey([]byte("A"), kv.NewVersion(2))
+	// A_2
+	// A_1
+	c.Assert(bytes.Compare(encodedKey1, encodedKey2), Greater, 0)
+
+	// decode test
+	key, ver, err := MvccDecode(encodedKey1)
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, "A")
+	c.Assert(ver.Ver, Equals, uint64(1))
+
+	// The versions of a key are always less than the next key.
+	encodedKey3 := MvccEncodeVersionKey([]byte("A\x00"), kv.NewVersion(3))
+	c.Assert(bytes.Compare(encodedKey1, encodedKey3), Less, 0)
+
+	_, _, err = MvccDecode([]byte("A"))
+	c.Assert(err, NotNil)
+}
+
+func (t *testMvccSuite) TestVersionProvider(c *C) {
+	p := &LocalVersionProvider{}
+	last := kv.MinVersion
+	for i := 0; i < 1000; i++ {
+		ver, err := p.CurrentVersion()
+		c.Assert(err, IsNil)
+		c.Assert(ver.Cmp(last), Greater, 0)
+		last = ver
+	}
+}
+
+func (t *testMvccSuite) mustSet(c *C, k, v string) {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte(k), []byte(v))
+	c.Assert(err, IsNil)
+	err = txn.Commit()
+	c.Assert(err, IsNil)
+}
+
+func (t *testMvccSuite) mustDelete(c *C, k string) {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	err = txn.Delete([]byte(k))
+	c.Assert(err, IsNil)
+	err = txn.Commit()
+	c.Assert(err, IsNil)
+}
+
+func (t *testMvccSuite) TestSnapshotIsolation(c *C) {
+	t.mustSet(c, "a", "1")
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+
+	t.mustSet(c, "a", "2")
+	t.mustSet(c, "b", "2")
+
+	v, err := txn.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "1")
+	_, err = txn.Get([]byte("b"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+
+	it, err := txn.Seek(nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsTrue)
+	c.Assert(it.Key(), Equals, "a")
+	c.Assert(string(it.Value()), Equals, "1")
+	it, err = it.Next(nil)
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsFalse)
+	it.Close()
+
+	err = txn.Rollback()
+	c.Assert(err, IsNil)
+}
+
+func (t *testMvccSuite) TestHistoricalRead(c *C) {
+	t.mustSet(c, "a", "1")
+	ver1, err := t.s.CurrentVersion()
+	c.Assert(err, IsNil)
+
+	t.mustSet(c, "a", "2")
+	ver2, err := t.s.CurrentVersion()
+	c.Assert(err, IsNil)
+
+	t.mustDelete(c, "a")
+
+	snap, err := t.s.GetSnapshot(ver1)
+	c.Assert(err, IsNil)
+	v, err := snap.Get(kv.EncodeKey([]byte("a")))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "1")
+	snap.Release()
+
+	snap, err = t.s.GetSnapshot(ver2)
+	c.Assert(err, IsNil)
+	v, err = snap.Get(kv.EncodeKey([]byte("a")))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "2")
+	snap.Release()
+
+	snap, err = t.s.GetSnapshot(kv.MaxVersion)
+	c.Assert(err, IsNil)
+	_, err = snap.Get(kv.EncodeKey([]byte("a")))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	it, err := snap.NewIterator([]byte(nil))
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsFalse)
+	it.Close()
+	snap.Release()
+}
+
+func (t *testMvccSuite) TestConflictByVersion(c *C) {
+	t.mustSet(c, "a", "1")
+
+	txn1, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn1.Inc([]byte("b"), 1)
+	c.Assert(err, IsNil)
+
+	// Write the same value again, the version still changes.
+	t.mustSet(c, "a", "1")
+
+	err = txn1.LockKeys([]byte("a"))
+	c.Assert(err, IsNil)
+	err = txn1.Commit()
+	c.Assert(kv.IsRetryableError(err), IsTrue)
+}
+
+func (t *testMvccSuite) TestSeekReverse(c *C) {
+	t.mustSet(c, "a", "1")
+	t.mustSet(c, "b", "1")
+	t.mustSet(c, "b", "2")
+	t.mustSet(c, "c", "1")
+	t.mustSet(c, "d", "1")
+	t.mustDelete(c, "c")
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+
+	// Dirty data overrides the committed data.
+	err = txn.Set([]byte("a0"), []byte("3"))
+	c.Assert(err, IsNil)
+	err = txn.Delete([]byte("d"))
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("e"), []byte("3"))
+	c.Assert(err, IsNil)
+
+	checkReverse := func(k []byte, expect []string) {
+		it, err1 := txn.SeekReverse(k)
+		c.Assert(err1, IsNil)
+		var got []string
+		for it.Valid() {
+			got = append(got, it.Key()+"="+string(it.Value()))
+			it, err1 = it.Next(nil)
+			c.Assert(err1, IsNil)
+		}
+		it.Close()
+		c.Assert(got, DeepEquals, expect)
+	}
+	checkReverse(nil, []string{"e=3", "b=2", "a0=3", "a=1"})
+	checkReverse([]byte("b"), []string{"a0=3", "a=1"})
+	checkReverse([]byte("c"), []string{"b=2", "a0=3", "a=1"})
+	checkReverse([]byte("a"), nil)
+}
+
+func (t *testMvccSuite) TestSnapshotReverseIterator(c *C) {
+	t.mustSet(c, "a", "1")
+	ver, err := t.s.CurrentVersion()
+	c.Assert(err, IsNil)
+	t.mustSet(c, "a", "2")
+	t.mustSet(c, "b", "2")
+
+	snap, err := t.s.GetSnapshot(ver)
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	it, err := snap.NewReverseIterator([]byte(nil))
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsTrue)
+	c.Assert(it.Key(), Equals, string(kv.EncodeKey([]byte("a"))))
+	c.Assert(string(it.Value()), Equals, "1")
+	it, err = it.Next(nil)
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsFalse)
+	it.Close()
+}
+
+func (t *testMvccSuite) TestIndexSeekLast(c *C) {
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+
+	idx := kv.NewKVIndex("i", "test", false)
+	other := kv.NewKVIndex("j", "test", false)
+	for i := int64(1); i <= 3; i++ {
+		err = idx.Create(txn, []interface{}{i * 10}, i)
+		c.Assert(err, IsNil)
+		err = other.Create(txn, []interface{}{i}, i)
+		c.Assert(err, IsNil)
+	}
+
+	it, err := idx.SeekLast(txn)
+	c.Assert(err, IsNil)
+	var handles []int64
+	for {
+		_, h, err1 := it.Next()
+		if err1 != nil {
+			c.Assert(err1, Equals, io.EOF)
+			break
+		}
+		handles = append(handles, h)
+	}
+	it.Close()
+	c.Assert(handles, DeepEquals, []int64{3, 2, 1})
+}
+
+func (t *testMvccSuite) TestScan(c *C) {
+	t.mustSet(c, "a", "1")
+	t.mustSet(c, "b", "1")
+	t.mustSet(c, "b", "2")
+	t.mustSet(c, "c", "1")
+	t.mustSet(c, "d", "1")
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+
+	err = txn.Set([]byte("a0"), []byte("3"))
+	c.Assert(err, IsNil)
+	err = txn.Delete([]byte("b"))
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("c0"), []byte("3"))
+	c.Assert(err, IsNil)
+
+	checkScan := func(start, end []byte, limit int, expect []string) {
+		it, err1 := txn.Scan(start, end, limit)
+		c.Assert(err1, IsNil)
+		var got []string
+		for it.Valid() {
+			got = append(got, it.Key()+"="+string(it.Value()))
+			it, err1 = it.Next(nil)
+			c.Assert(err1, IsNil)
+		}
+		it.Close()
+		c.Assert(got, DeepEquals, expect)
+	}
+	checkScan(nil, nil, 0, []string{"a=1", "a0=3", "c=1", "c0=3", "d=1"})
+	checkScan([]byte("a0"), []byte("c0"), 0, []string{"a0=3", "c=1"})
+	checkScan([]byte("b"), nil, 2, []string{"c=1", "c0=3"})
+	checkScan(nil, []byte("a"), 0, nil)
+
+	snap, err := t.s.GetSnapshot(kv.MaxVersion)
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	it, err := snap.Scan(kv.EncodeKey([]byte("b")), kv.EncodeKey([]byte("d")), 1)
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsTrue)
+	c.Assert(it.Key(), Equals, string(kv.EncodeKey([]byte("b"))))
+	c.Assert(string(it.Value()), Equals, "2")
+	it, err = it.Next(nil)
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsFalse)
+	it.Close()
+}
+
+func (t *testMvccSuite) TestBatchGet(c *C) {
+	t.mustSet(c, "a", "1")
+	t.mustSet(c, "b", "1")
+	t.mustSet(c, "c", "1")
+	t.mustDelete(c, "c")
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+
+	err = txn.Set([]byte("b"), []byte("2"))
+	c.Assert(err, IsNil)
+	err = txn.Delete([]byte("a"))
+	c.Assert(err, IsNil)
+	err = txn.Set([]byte("d"), []byte("2"))
+	c.Assert(err, IsNil)
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	m, err := txn.BatchGet(keys)
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 2)
+	c.Assert(string(m["b"]), Equals, "2")
+	c.Assert(string(m["d"]), Equals, "2")
+
+	ver, err := t.s.CurrentVersion()
+	c.Assert(err, IsNil)
+	t.mustSet(c, "a", "3")
+	snap, err := t.s.GetSnapshot(ver)
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	// The keys are not sorted and a is duplicated.
+	keys = [][]byte{kv.EncodeKey([]byte("c")), kv.EncodeKey([]byte("a")), kv.EncodeKey([]byte("e")), kv.EncodeKey([]byte("a")), kv.EncodeKey([]byte("b"))}
+	m, err = snap.BatchGet(keys)
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 2)
+	c.Assert(string(m[string(kv.EncodeKey([]byte("a")))]), Equals, "1")
+	c.Assert(string(m[string(kv.EncodeKey([]byte("b")))]), Equals, "1")
+}
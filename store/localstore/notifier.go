@@ -0,0 +1,167 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"sync"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	_ kv.CommitNotifier = (*dbStore)(nil)
+	_ kv.Subscription   = (*subscription)(nil)
+)
+
+// maxQueuedEvents is the max number of the events queued in a subscription.
+const maxQueuedEvents = 4096
+
+// notifier dispatches the CommitEvents to the subscriptions.
+type notifier struct {
+	mu   sync.RWMutex
+	subs map[*subscription]struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{subs: make(map[*subscription]struct{})}
+}
+
+func (n *notifier) subscribe() *subscription {
+	s := &subscription{
+		n:    n,
+		ch:   make(chan *kv.CommitEvent),
+		done: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	n.mu.Lock()
+	n.subs[s] = struct{}{}
+	n.mu.Unlock()
+
+	go s.run()
+	return s
+}
+
+func (n *notifier) remove(s *subscription) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.subs, s)
+}
+
+// active checks whether there is any subscription, so the events are not
+// built if no one receives them.
+func (n *notifier) active() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return len(n.subs) > 0
+}
+
+func (n *notifier) notify(ev *kv.CommitEvent) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for s := range n.subs {
+		s.push(ev)
+	}
+}
+
+// subscription queues the events until they are received from ch.
+type subscription struct {
+	n  *notifier
+	ch chan *kv.CommitEvent
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*kv.CommitEvent
+	closed bool
+	err    error
+	done   chan struct{}
+}
+
+func (s *subscription) push(ev *kv.CommitEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if len(s.queue) >= maxQueuedEvents {
+		// The subscription is removed from the notifier by run.
+		s.err = kv.ErrEventsOverflow
+		s.stop()
+		return
+	}
+	s.queue = append(s.queue, ev)
+	s.cond.Signal()
+}
+
+func (s *subscription) run() {
+	defer func() {
+		s.n.remove(s)
+		close(s.ch)
+	}()
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		ev := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *subscription) Events() <-chan *kv.CommitEvent {
+	return s.ch
+}
+
+func (s *subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *subscription) Close() {
+	s.n.remove(s)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+}
+
+// stop drops the queued events and stops run, it must be called with s.mu held.
+func (s *subscription) stop() {
+	if !s.closed {
+		s.closed = true
+		s.queue = nil
+		s.cond.Signal()
+		close(s.done)
+	}
+}
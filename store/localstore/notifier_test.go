@@ -0,0 +1,102 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localstore
+
+import (
+	"fmt"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+)
+
+var _ = Suite(&testNotifierSuite{})
+
+type testNotifierSuite struct {
+	s kv.Storage
+}
+
+func (t *testNotifierSuite) SetUpSuite(c *C) {
+	var err error
+	t.s, err = Driver{goleveldb.MemoryDriver{}}.Open("memory:notifier")
+	c.Assert(err, IsNil)
+}
+
+func (t *testNotifierSuite) TearDownSuite(c *C) {
+	err := t.s.Close()
+	c.Assert(err, IsNil)
+}
+
+func (t *testNotifierSuite) TestSubscribe(c *C) {
+	err := kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte("a"), []byte("0"))
+	})
+	c.Assert(err, IsNil)
+
+	sub := t.s.(kv.CommitNotifier).Subscribe()
+	n := 10
+	for i := 1; i <= n; i++ {
+		err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+			if err1 := txn.Set([]byte("a"), []byte(fmt.Sprint(i))); err1 != nil {
+				return err1
+			}
+			return txn.LockKeys([]byte("locked"))
+		})
+		c.Assert(err, IsNil)
+	}
+	err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return txn.Delete([]byte("a"))
+	})
+	c.Assert(err, IsNil)
+
+	var last kv.Version
+	for i := 1; i <= n; i++ {
+		ev := <-sub.Events()
+		c.Assert(ev.CommitVersion.Cmp(last), Greater, 0)
+		last = ev.CommitVersion
+
+		// The locked key isn't changed.
+		c.Assert(ev.Mutations, HasLen, 1)
+		m := ev.Mutations[0]
+		c.Assert(string(m.Key), Equals, "a")
+		c.Assert(string(m.OldValue), Equals, fmt.Sprint(i-1))
+		c.Assert(string(m.NewValue), Equals, fmt.Sprint(i))
+	}
+	ev := <-sub.Events()
+	c.Assert(ev.Mutations, HasLen, 1)
+	c.Assert(string(ev.Mutations[0].OldValue), Equals, fmt.Sprint(n))
+	c.Assert(ev.Mutations[0].NewValue, IsNil)
+
+	sub.Close()
+	_, ok := <-sub.Events()
+	c.Assert(ok, IsFalse)
+	err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte("a"), []byte("x"))
+	})
+	c.Assert(err, IsNil)
+}
+
+func (t *testNotifierSuite) TestOverflow(c *C) {
+	n := newNotifier()
+	sub := n.subscribe()
+	for i := 0; i <= maxQueuedEvents+1; i++ {
+		n.notify(&kv.CommitEvent{CommitVersion: kv.NewVersion(uint64(i + 1))})
+	}
+	// The events may be received before the subscription is stopped.
+	for range sub.Events() {
+	}
+	c.Assert(sub.Err(), Equals, kv.ErrEventsOverflow)
+	c.Assert(n.active(), IsFalse)
+	sub.Close()
+}
@@ -0,0 +1,250 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+var (
+	_ engine.Driver = Driver{}
+	_ engine.DB     = (*Cluster)(nil)
+	_ engine.Batch  = (*batch)(nil)
+)
+
+// Driver implements engine.Driver interface, it opens a Cluster
+// with Replicas engines opened by Engine.
+type Driver struct {
+	Engine   engine.Driver
+	Replicas int
+}
+
+// Open opens the engines at path/0, path/1 ... and starts a Cluster on them.
+// The options in the query of path are passed to the engines.
+func (d Driver) Open(path string) (engine.DB, error) {
+	replicas := d.Replicas
+	if replicas <= 0 {
+		replicas = 3
+	}
+
+	path, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var dbs []engine.DB
+	for i := 0; i < replicas; i++ {
+		db, err1 := d.Engine.Open(engine.JoinPath(filepath.Join(path, strconv.Itoa(i)), opts))
+		if err1 != nil {
+			for _, db := range dbs {
+				db.Close()
+			}
+			return nil, errors.Trace(err1)
+		}
+		dbs = append(dbs, db)
+	}
+	return NewCluster(dbs, DefaultConfig), nil
+}
+
+// Cluster is an engine.DB replicated to all its engines by raft, every engine
+// is a replica owned by a node. A batch is committed after it is applied by the
+// majority of the nodes, reads go to the engine of the leader.
+// The raft log is kept in memory, so a Cluster can't be reopened from its
+// engines with the committed data.
+type Cluster struct {
+	cfg   Config
+	nodes []*node
+}
+
+// NewCluster starts a Cluster with a node for every engine in dbs.
+func NewCluster(dbs []engine.DB, cfg Config) *Cluster {
+	c := &Cluster{cfg: cfg}
+	var peers []uint64
+	for i := range dbs {
+		peers = append(peers, uint64(i+1))
+	}
+
+	trans := newLoopback()
+	for i, db := range dbs {
+		n := newNode(peers[i], peers, db, trans, &c.cfg)
+		trans.add(n)
+		c.nodes = append(c.nodes, n)
+	}
+	for _, n := range c.nodes {
+		go n.run()
+	}
+	return c
+}
+
+// Leader returns the index of the node which is the ready leader, -1 if there is none.
+func (c *Cluster) Leader() int {
+	for i, n := range c.nodes {
+		if n.isReadyLeader() {
+			return i
+		}
+	}
+	return -1
+}
+
+// StopNode stops the ith node as if it crashes, it keeps its state and
+// stops handling messages until StartNode is called.
+func (c *Cluster) StopNode(i int) {
+	c.nodes[i].setStopped(true)
+}
+
+// StartNode restarts the ith node stopped by StopNode, it catches up with the leader.
+func (c *Cluster) StartNode(i int) {
+	c.nodes[i].setStopped(false)
+}
+
+// waitLeader waits for a ready leader until deadline.
+func (c *Cluster) waitLeader(deadline time.Time) (*node, error) {
+	for {
+		if i := c.Leader(); i >= 0 {
+			return c.nodes[i], nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Trace(ErrTimeout)
+		}
+		time.Sleep(c.cfg.TickInterval)
+	}
+}
+
+// Get implements engine.DB Get interface.
+func (c *Cluster) Get(key []byte) ([]byte, error) {
+	n, err := c.waitLeader(time.Now().Add(c.cfg.ProposeTimeout))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return n.db.Get(key)
+}
+
+// GetSnapshot implements engine.DB GetSnapshot interface.
+func (c *Cluster) GetSnapshot() (engine.Snapshot, error) {
+	n, err := c.waitLeader(time.Now().Add(c.cfg.ProposeTimeout))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return n.db.GetSnapshot()
+}
+
+// NewBatch implements engine.DB NewBatch interface.
+func (c *Cluster) NewBatch() engine.Batch {
+	return &batch{}
+}
+
+// Commit implements engine.DB Commit interface, it proposes the batch to the
+// leader and returns after the batch is applied. It returns ErrResultUnknown if
+// the batch may or may not be applied, so it is not proposed again.
+func (c *Cluster) Commit(b engine.Batch) error {
+	data := b.(*batch).data
+	if len(data) == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(c.cfg.ProposeTimeout)
+	for {
+		n, err := c.waitLeader(deadline)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		ch, err := n.propose(data)
+		if err == nil {
+			select {
+			case err = <-ch:
+			case <-time.After(deadline.Sub(time.Now())):
+				return errors.Trace(ErrTimeout)
+			}
+		}
+		// The batch is not applied if the leader has changed, so it can be proposed again.
+		if err != ErrNotLeader && err != ErrProposalDropped {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// DeleteRange implements engine.DB DeleteRange interface, the deletions are
+// proposed in batches like the other writes.
+func (c *Cluster) DeleteRange(start, end []byte) error {
+	return errors.Trace(engine.DeleteRangeInBatches(c, start, end))
+}
+
+// Close implements engine.DB Close interface, it stops the nodes and closes their engines.
+func (c *Cluster) Close() error {
+	var err error
+	for _, n := range c.nodes {
+		n.stop()
+		if err1 := n.db.Close(); err1 != nil {
+			err = err1
+		}
+	}
+	return errors.Trace(err)
+}
+
+const (
+	opPut byte = iota + 1
+	opDelete
+)
+
+// batch is encoded as the data of a raft entry, every operation is
+// an op byte followed by the encoded key, and the encoded value for opPut.
+type batch struct {
+	data []byte
+}
+
+func (b *batch) Put(key []byte, value []byte) {
+	b.data = append(b.data, opPut)
+	b.data = codec.EncodeBytes(b.data, key)
+	b.data = codec.EncodeBytes(b.data, value)
+}
+
+func (b *batch) Delete(key []byte) {
+	b.data = append(b.data, opDelete)
+	b.data = codec.EncodeBytes(b.data, key)
+}
+
+// applyBatch decodes the batch data and commits it to db.
+func applyBatch(db engine.DB, data []byte) error {
+	var (
+		key, value []byte
+		err        error
+	)
+	b := db.NewBatch()
+	for len(data) > 0 {
+		op := data[0]
+		data, key, err = codec.DecodeBytes(data[1:])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		switch op {
+		case opPut:
+			data, value, err = codec.DecodeBytes(data)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			b.Put(key, value)
+		case opDelete:
+			b.Delete(key)
+		default:
+			return errors.Errorf("invalid batch op %d", op)
+		}
+	}
+	return errors.Trace(db.Commit(b))
+}
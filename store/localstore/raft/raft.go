@@ -0,0 +1,666 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+var (
+	// ErrNotLeader is returned when proposing to a node which is not the leader.
+	ErrNotLeader = errors.New("raft: not leader")
+	// ErrProposalDropped is returned when a proposal is overwritten by another leader.
+	ErrProposalDropped = errors.New("raft: proposal dropped")
+	// ErrTimeout is returned when there is no leader or a proposal can't be committed in time.
+	ErrTimeout = errors.New("raft: timeout")
+	// ErrResultUnknown is returned when a proposal is covered by a snapshot from
+	// another leader, it can't be told whether the proposal is applied.
+	ErrResultUnknown = errors.New("raft: proposal result unknown")
+)
+
+// Config is the configuration of the raft nodes.
+type Config struct {
+	// TickInterval is the time of a tick, the timeouts below are in ticks.
+	TickInterval time.Duration
+	// ElectionTicks is the minimum election timeout, a follower becomes a candidate
+	// if it doesn't hear from the leader in [ElectionTicks, 2*ElectionTicks) ticks.
+	ElectionTicks int
+	// HeartbeatTicks is the interval of the heartbeats sent by the leader.
+	HeartbeatTicks int
+	// CompactThreshold is the number of the applied entries kept in the log,
+	// the log is compacted when it has more, and the followers which need the
+	// compacted entries catch up with an engine snapshot.
+	CompactThreshold int
+	// MaxEntriesPerMsg is the max number of the entries sent in a message.
+	MaxEntriesPerMsg int
+	// ProposeTimeout is the max time to wait for a leader and a proposal to be applied.
+	ProposeTimeout time.Duration
+}
+
+// DefaultConfig is the default configuration.
+var DefaultConfig = Config{
+	TickInterval:     10 * time.Millisecond,
+	ElectionTicks:    10,
+	HeartbeatTicks:   2,
+	CompactThreshold: 1024,
+	MaxEntriesPerMsg: 64,
+	ProposeTimeout:   5 * time.Second,
+}
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+type msgType int
+
+const (
+	msgVote msgType = iota + 1
+	msgVoteResp
+	msgApp
+	msgAppResp
+	msgSnap
+)
+
+// entry is a raft log entry, its data is an encoded batch, nil for a no-op entry.
+type entry struct {
+	Term  uint64
+	Index uint64
+	Data  []byte
+}
+
+type pair struct {
+	Key   []byte
+	Value []byte
+}
+
+// snapshot is the whole engine data of a node after applying the entry Index.
+type snapshot struct {
+	Index uint64
+	Term  uint64
+	Pairs []pair
+}
+
+type message struct {
+	Type msgType
+	From uint64
+	To   uint64
+	Term uint64
+
+	// For msgVote, the last log entry of the candidate.
+	LastIndex uint64
+	LastTerm  uint64
+	// For msgVoteResp.
+	Granted bool
+
+	// For msgApp.
+	PrevIndex uint64
+	PrevTerm  uint64
+	Entries   []entry
+	Commit    uint64
+	// For msgAppResp, Match is the last matched index if Success,
+	// otherwise the index to retry from.
+	Success bool
+	Match   uint64
+
+	// For msgSnap.
+	Snapshot *snapshot
+}
+
+type proposal struct {
+	term uint64
+	ch   chan error
+}
+
+// node is a raft replica, it applies the committed entries to its engine.
+// The raft state and the log are only kept in memory.
+type node struct {
+	id    uint64
+	peers []uint64
+	db    engine.DB
+	trans transport
+	cfg   *Config
+
+	mu       sync.Mutex
+	role     role
+	term     uint64
+	votedFor uint64
+	leader   uint64
+	votes    map[uint64]bool
+	// log[0] is a dummy entry at the last compacted index.
+	log     []entry
+	commit  uint64
+	applied uint64
+	next    map[uint64]uint64
+	match   map[uint64]uint64
+
+	electionElapsed  int
+	electionTimeout  int
+	heartbeatElapsed int
+
+	proposals map[uint64]*proposal
+	stopped   bool
+	inbox     chan message
+	quit      chan struct{}
+}
+
+func newNode(id uint64, peers []uint64, db engine.DB, trans transport, cfg *Config) *node {
+	n := &node{
+		id:        id,
+		peers:     peers,
+		db:        db,
+		trans:     trans,
+		cfg:       cfg,
+		log:       []entry{{}},
+		proposals: make(map[uint64]*proposal),
+		inbox:     make(chan message, 1024),
+		quit:      make(chan struct{}),
+	}
+	n.resetElectionTimeout()
+	return n
+}
+
+func (n *node) run() {
+	ticker := time.NewTicker(n.cfg.TickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case m := <-n.inbox:
+			n.step(m)
+		case <-ticker.C:
+			n.tick()
+		case <-n.quit:
+			return
+		}
+	}
+}
+
+func (n *node) stop() {
+	close(n.quit)
+}
+
+// setStopped stops or restarts the node as if it crashed, messages to a stopped node are dropped.
+func (n *node) setStopped(stopped bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.stopped = stopped
+	if stopped {
+		n.becomeFollower(n.term, 0)
+	}
+}
+
+func (n *node) isStopped() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.stopped
+}
+
+func (n *node) firstIndex() uint64 {
+	return n.log[0].Index
+}
+
+func (n *node) lastIndex() uint64 {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+// termOf returns the term of the entry at index, the index must be in the log.
+func (n *node) termOf(index uint64) uint64 {
+	return n.log[index-n.firstIndex()].Term
+}
+
+func (n *node) quorum() int {
+	return len(n.peers)/2 + 1
+}
+
+func (n *node) resetElectionTimeout() {
+	n.electionElapsed = 0
+	n.electionTimeout = n.cfg.ElectionTicks + rand.Intn(n.cfg.ElectionTicks)
+}
+
+func (n *node) send(m message) {
+	m.From = n.id
+	m.Term = n.term
+	n.trans.Send(m)
+}
+
+func (n *node) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped {
+		return
+	}
+	if n.role == leader {
+		n.heartbeatElapsed++
+		if n.heartbeatElapsed >= n.cfg.HeartbeatTicks {
+			n.heartbeatElapsed = 0
+			n.broadcastAppend()
+		}
+		return
+	}
+
+	n.electionElapsed++
+	if n.electionElapsed >= n.electionTimeout {
+		n.campaign()
+	}
+}
+
+func (n *node) campaign() {
+	n.role = candidate
+	n.term++
+	n.votedFor = n.id
+	n.leader = 0
+	n.votes = map[uint64]bool{n.id: true}
+	n.resetElectionTimeout()
+	log.Infof("raft node %d starts election at term %d", n.id, n.term)
+
+	if n.quorum() == 1 {
+		n.becomeLeader()
+		return
+	}
+	for _, p := range n.peers {
+		if p == n.id {
+			continue
+		}
+		n.send(message{Type: msgVote, To: p, LastIndex: n.lastIndex(), LastTerm: n.lastTerm()})
+	}
+}
+
+func (n *node) becomeFollower(term uint64, lead uint64) {
+	if term != n.term {
+		n.votedFor = 0
+	}
+	n.role = follower
+	n.term = term
+	n.leader = lead
+	n.resetElectionTimeout()
+}
+
+func (n *node) becomeLeader() {
+	log.Infof("raft node %d becomes leader at term %d", n.id, n.term)
+	n.role = leader
+	n.leader = n.id
+	n.heartbeatElapsed = 0
+	n.next = make(map[uint64]uint64)
+	n.match = make(map[uint64]uint64)
+	for _, p := range n.peers {
+		n.next[p] = n.lastIndex() + 1
+		n.match[p] = 0
+	}
+	// The entries of the previous terms are committed with a no-op entry of this term.
+	n.appendEntry(nil)
+}
+
+func (n *node) appendEntry(data []byte) uint64 {
+	e := entry{Term: n.term, Index: n.lastIndex() + 1, Data: data}
+	n.log = append(n.log, e)
+	n.match[n.id] = e.Index
+	n.next[n.id] = e.Index + 1
+	n.broadcastAppend()
+	n.maybeCommit()
+	return e.Index
+}
+
+// propose appends data to the log if the node is the leader, the returned channel
+// gets the result after the entry is applied.
+func (n *node) propose(data []byte) (<-chan error, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped || n.role != leader {
+		return nil, ErrNotLeader
+	}
+	ch := make(chan error, 1)
+	index := n.appendEntry(data)
+	if index <= n.applied {
+		ch <- nil
+		return ch, nil
+	}
+	n.proposals[index] = &proposal{term: n.term, ch: ch}
+	return ch, nil
+}
+
+// isReadyLeader checks whether the node is the leader and has applied all the committed
+// entries, which is true after the first entry of its term is committed.
+func (n *node) isReadyLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return !n.stopped && n.role == leader && n.termOf(n.commit) == n.term
+}
+
+func (n *node) broadcastAppend() {
+	for _, p := range n.peers {
+		if p != n.id {
+			n.sendAppend(p)
+		}
+	}
+}
+
+func (n *node) sendAppend(to uint64) {
+	prev := n.next[to] - 1
+	if prev < n.firstIndex() {
+		n.sendSnapshot(to)
+		return
+	}
+
+	start, end := prev+1-n.firstIndex(), uint64(len(n.log))
+	if end-start > uint64(n.cfg.MaxEntriesPerMsg) {
+		end = start + uint64(n.cfg.MaxEntriesPerMsg)
+	}
+	n.send(message{
+		Type:      msgApp,
+		To:        to,
+		PrevIndex: prev,
+		PrevTerm:  n.termOf(prev),
+		Entries:   append([]entry(nil), n.log[start:end]...),
+		Commit:    n.commit,
+	})
+}
+
+// sendSnapshot sends the engine data to a follower which needs the compacted entries.
+// The engine data is at the applied index.
+func (n *node) sendSnapshot(to uint64) {
+	snap, err := n.db.GetSnapshot()
+	if err != nil {
+		log.Errorf("raft node %d get snapshot err %v", n.id, err)
+		return
+	}
+	defer snap.Release()
+
+	s := &snapshot{Index: n.applied, Term: n.termOf(n.applied)}
+	it := snap.NewIterator(nil, nil)
+	for it.Next() {
+		s.Pairs = append(s.Pairs, pair{
+			Key:   append([]byte(nil), it.Key()...),
+			Value: append([]byte(nil), it.Value()...),
+		})
+	}
+	it.Release()
+
+	log.Infof("raft node %d sends snapshot at %d to %d", n.id, s.Index, to)
+	n.next[to] = s.Index + 1
+	n.send(message{Type: msgSnap, To: to, Snapshot: s})
+}
+
+func (n *node) step(m message) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.stopped {
+		return
+	}
+
+	if m.Term > n.term {
+		lead := uint64(0)
+		if m.Type == msgApp || m.Type == msgSnap {
+			lead = m.From
+		}
+		n.becomeFollower(m.Term, lead)
+	}
+	if m.Term < n.term {
+		// Tell the stale leader or candidate the new term.
+		switch m.Type {
+		case msgApp, msgSnap:
+			n.send(message{Type: msgAppResp, To: m.From})
+		case msgVote:
+			n.send(message{Type: msgVoteResp, To: m.From})
+		}
+		return
+	}
+
+	switch m.Type {
+	case msgVote:
+		n.handleVote(m)
+	case msgVoteResp:
+		n.handleVoteResp(m)
+	case msgApp:
+		n.role, n.leader = follower, m.From
+		n.resetElectionTimeout()
+		n.handleAppend(m)
+	case msgAppResp:
+		n.handleAppendResp(m)
+	case msgSnap:
+		n.role, n.leader = follower, m.From
+		n.resetElectionTimeout()
+		n.handleSnapshot(m)
+	}
+}
+
+func (n *node) handleVote(m message) {
+	upToDate := m.LastTerm > n.lastTerm() || (m.LastTerm == n.lastTerm() && m.LastIndex >= n.lastIndex())
+	granted := (n.votedFor == 0 || n.votedFor == m.From) && upToDate
+	if granted {
+		n.votedFor = m.From
+		n.resetElectionTimeout()
+	}
+	n.send(message{Type: msgVoteResp, To: m.From, Granted: granted})
+}
+
+func (n *node) handleVoteResp(m message) {
+	if n.role != candidate {
+		return
+	}
+	n.votes[m.From] = m.Granted
+
+	granted := 0
+	for _, v := range n.votes {
+		if v {
+			granted++
+		}
+	}
+	if granted >= n.quorum() {
+		n.becomeLeader()
+	}
+}
+
+func (n *node) handleAppend(m message) {
+	if m.PrevIndex > n.lastIndex() {
+		n.send(message{Type: msgAppResp, To: m.From, Match: n.lastIndex() + 1})
+		return
+	}
+	// The entries before firstIndex are applied, so they must match.
+	if m.PrevIndex >= n.firstIndex() && n.termOf(m.PrevIndex) != m.PrevTerm {
+		n.send(message{Type: msgAppResp, To: m.From, Match: m.PrevIndex})
+		return
+	}
+
+	for _, e := range m.Entries {
+		if e.Index <= n.firstIndex() {
+			continue
+		}
+		if e.Index <= n.lastIndex() {
+			if n.termOf(e.Index) == e.Term {
+				continue
+			}
+			// Remove the conflicting entry and all that follow it.
+			n.log = n.log[:e.Index-n.firstIndex()]
+		}
+		n.log = append(n.log, e)
+	}
+
+	lastNew := m.PrevIndex + uint64(len(m.Entries))
+	if commit := minUint64(m.Commit, lastNew); commit > n.commit {
+		n.commit = commit
+		n.apply()
+	}
+	n.send(message{Type: msgAppResp, To: m.From, Success: true, Match: lastNew})
+}
+
+func (n *node) handleAppendResp(m message) {
+	if n.role != leader {
+		return
+	}
+	if m.Success {
+		if m.Match > n.match[m.From] {
+			n.match[m.From] = m.Match
+			n.maybeCommit()
+		}
+		if m.Match+1 > n.next[m.From] {
+			n.next[m.From] = m.Match + 1
+		}
+		if n.next[m.From] <= n.lastIndex() {
+			n.sendAppend(m.From)
+		}
+		return
+	}
+
+	// Retry from the index the follower asks for.
+	next := m.Match
+	if next == 0 {
+		next = 1
+	}
+	if next > n.next[m.From] {
+		return
+	}
+	n.next[m.From] = next
+	n.sendAppend(m.From)
+}
+
+func (n *node) handleSnapshot(m message) {
+	s := m.Snapshot
+	if s.Index <= n.commit {
+		n.send(message{Type: msgAppResp, To: m.From, Success: true, Match: n.commit})
+		return
+	}
+
+	log.Infof("raft node %d restores snapshot at %d from %d", n.id, s.Index, m.From)
+	if err := n.restore(s); err != nil {
+		log.Errorf("raft node %d restore snapshot err %v", n.id, err)
+		return
+	}
+	n.log = []entry{{Term: s.Term, Index: s.Index}}
+	n.commit, n.applied = s.Index, s.Index
+	for index, p := range n.proposals {
+		if index <= s.Index {
+			p.ch <- snapshotResult(p, s)
+			delete(n.proposals, index)
+		}
+	}
+	n.send(message{Type: msgAppResp, To: m.From, Success: true, Match: s.Index})
+}
+
+// snapshotResult returns the result of the proposal p covered by the snapshot s.
+// The entry at s.Index is created by the leader of s.Term, and only the leader
+// of a term creates the entries of the term. So p is applied if it is proposed in
+// s.Term, and it is dropped if it is proposed after s.Term, no entry in s has
+// a term greater than s.Term. Otherwise the term of its entry is unknown.
+func snapshotResult(p *proposal, s *snapshot) error {
+	switch {
+	case p.term == s.Term:
+		return nil
+	case p.term > s.Term:
+		return ErrProposalDropped
+	default:
+		return ErrResultUnknown
+	}
+}
+
+// restore replaces all the data in the engine with the snapshot.
+func (n *node) restore(s *snapshot) error {
+	snap, err := n.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	b := n.db.NewBatch()
+	it := snap.NewIterator(nil, nil)
+	for it.Next() {
+		b.Delete(it.Key())
+	}
+	it.Release()
+	snap.Release()
+
+	for _, p := range s.Pairs {
+		b.Put(p.Key, p.Value)
+	}
+	return n.db.Commit(b)
+}
+
+func (n *node) maybeCommit() {
+	for index := n.lastIndex(); index > n.commit; index-- {
+		if n.termOf(index) != n.term {
+			// Only the entries of the current term are committed by counting replicas.
+			break
+		}
+		cnt := 0
+		for _, p := range n.peers {
+			if n.match[p] >= index {
+				cnt++
+			}
+		}
+		if cnt >= n.quorum() {
+			n.commit = index
+			n.apply()
+			n.broadcastAppend()
+			return
+		}
+	}
+}
+
+// apply applies the committed entries to the engine.
+func (n *node) apply() {
+	for n.applied < n.commit {
+		index := n.applied + 1
+		e := n.log[index-n.firstIndex()]
+		var err error
+		if e.Data != nil {
+			err = applyBatch(n.db, e.Data)
+			if err != nil {
+				log.Errorf("raft node %d apply entry %d err %v", n.id, index, err)
+			}
+		}
+		n.applied = index
+
+		if p, ok := n.proposals[index]; ok {
+			if p.term != e.Term {
+				err = ErrProposalDropped
+			}
+			p.ch <- err
+			delete(n.proposals, index)
+		}
+	}
+	n.maybeCompact()
+}
+
+// maybeCompact removes the applied entries from the log if there are too many,
+// the engine data is the snapshot of them.
+func (n *node) maybeCompact() {
+	if n.applied-n.firstIndex() <= uint64(n.cfg.CompactThreshold) {
+		return
+	}
+	compacted := n.log[n.applied-n.firstIndex():]
+	n.log = append([]entry{{Term: compacted[0].Term, Index: compacted[0].Index}}, compacted[1:]...)
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,219 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/store/localstore/memkv"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testSuite{})
+
+type testSuite struct {
+	cfg Config
+}
+
+func (s *testSuite) SetUpSuite(c *C) {
+	s.cfg = Config{
+		TickInterval:     5 * time.Millisecond,
+		ElectionTicks:    10,
+		HeartbeatTicks:   2,
+		CompactThreshold: 8,
+		MaxEntriesPerMsg: 4,
+		ProposeTimeout:   5 * time.Second,
+	}
+}
+
+func (s *testSuite) newCluster(c *C) *Cluster {
+	var dbs []engine.DB
+	for i := 0; i < 3; i++ {
+		db, err := memkv.Driver{}.Open("memory")
+		c.Assert(err, IsNil)
+		dbs = append(dbs, db)
+	}
+	return NewCluster(dbs, s.cfg)
+}
+
+func put(c *C, db engine.DB, key string, value string) {
+	b := db.NewBatch()
+	b.Put([]byte(key), []byte(value))
+	err := db.Commit(b)
+	c.Assert(err, IsNil)
+}
+
+// waitValue waits for the value of key in the engine of the ith node.
+func waitValue(c *C, cluster *Cluster, i int, key string, value string) {
+	db := cluster.nodes[i].db
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		v, err := db.Get([]byte(key))
+		c.Assert(err, IsNil)
+		if string(v) == value {
+			return
+		}
+	}
+	c.Fatalf("node %d doesn't have %s=%s", i, key, value)
+}
+
+func (s *testSuite) TestReplicate(c *C) {
+	cluster := s.newCluster(c)
+	defer cluster.Close()
+
+	put(c, cluster, "a", "1")
+	b := cluster.NewBatch()
+	b.Put([]byte("b"), []byte("2"))
+	b.Delete([]byte("a"))
+	err := cluster.Commit(b)
+	c.Assert(err, IsNil)
+
+	v, err := cluster.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(v, IsNil)
+	snap, err := cluster.GetSnapshot()
+	c.Assert(err, IsNil)
+	v, err = snap.Get([]byte("b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "2")
+	snap.Release()
+
+	for i := range cluster.nodes {
+		waitValue(c, cluster, i, "b", "2")
+		v, err = cluster.nodes[i].db.Get([]byte("a"))
+		c.Assert(err, IsNil)
+		c.Assert(v, IsNil)
+	}
+}
+
+func (s *testSuite) TestLeaderFailure(c *C) {
+	cluster := s.newCluster(c)
+	defer cluster.Close()
+
+	put(c, cluster, "a", "1")
+	old := cluster.Leader()
+	c.Assert(old, GreaterEqual, 0)
+
+	cluster.StopNode(old)
+	put(c, cluster, "a", "2")
+	leader := cluster.Leader()
+	c.Assert(leader, Not(Equals), old)
+	v, err := cluster.Get([]byte("a"))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "2")
+
+	// The old leader catches up after it restarts.
+	cluster.StartNode(old)
+	waitValue(c, cluster, old, "a", "2")
+
+	// No majority, the commit times out.
+	cluster.cfg.ProposeTimeout = 200 * time.Millisecond
+	for i := range cluster.nodes {
+		if i != old {
+			cluster.StopNode(i)
+		}
+	}
+	b := cluster.NewBatch()
+	b.Put([]byte("a"), []byte("3"))
+	err = cluster.Commit(b)
+	c.Assert(errors2.ErrorEqual(err, ErrTimeout), IsTrue)
+}
+
+func (s *testSuite) TestSnapshotCatchUp(c *C) {
+	cluster := s.newCluster(c)
+	defer cluster.Close()
+
+	put(c, cluster, "k", "0")
+	follower := (cluster.Leader() + 1) % len(cluster.nodes)
+	cluster.StopNode(follower)
+
+	n := s.cfg.CompactThreshold * 4
+	for i := 0; i < n; i++ {
+		put(c, cluster, fmt.Sprintf("k%03d", i), fmt.Sprint(i))
+	}
+	put(c, cluster, "k", "1")
+
+	leader := cluster.nodes[cluster.Leader()]
+	leader.mu.Lock()
+	first := leader.firstIndex()
+	leader.mu.Unlock()
+	c.Assert(first, Greater, uint64(0))
+
+	// The log the follower needs is compacted, it catches up with a snapshot.
+	cluster.StartNode(follower)
+	waitValue(c, cluster, follower, "k", "1")
+	for i := 0; i < n; i++ {
+		waitValue(c, cluster, follower, fmt.Sprintf("k%03d", i), fmt.Sprint(i))
+	}
+}
+
+func (s *testSuite) TestSnapshotProposals(c *C) {
+	db, err := memkv.Driver{}.Open("memory")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	n := newNode(1, []uint64{1, 2, 3}, db, newLoopback(), &s.cfg)
+	var chs []chan error
+	for i, term := range []uint64{2, 3, 4, 3} {
+		ch := make(chan error, 1)
+		n.proposals[uint64(i+1)] = &proposal{term: term, ch: ch}
+		chs = append(chs, ch)
+	}
+
+	// The proposals in the snapshot are applied if they are proposed in the term of the snapshot.
+	n.handleSnapshot(message{From: 2, Snapshot: &snapshot{Index: 3, Term: 3}})
+	c.Assert(<-chs[0], Equals, ErrResultUnknown)
+	c.Assert(<-chs[1], IsNil)
+	c.Assert(<-chs[2], Equals, ErrProposalDropped)
+	c.Assert(n.proposals, HasLen, 1)
+	c.Assert(chs[3], HasLen, 0)
+}
+
+func (s *testSuite) TestStore(c *C) {
+	d := localstore.Driver{
+		Driver: Driver{Engine: memkv.Driver{}},
+	}
+	store, err := d.Open("raft")
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+		for i := 0; i < 10; i++ {
+			if err1 := txn.Set([]byte(fmt.Sprint(i)), []byte("v")); err1 != nil {
+				return err1
+			}
+		}
+		_, err1 := txn.Inc([]byte("n"), 1)
+		return err1
+	})
+	c.Assert(err, IsNil)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	v, err := txn.Get([]byte("5"))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "v")
+	m, err := txn.BatchGet([][]byte{[]byte("0"), []byte("9"), []byte("n")})
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 3)
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raft
+
+import "sync"
+
+// transport sends the messages between the nodes, a message may be lost.
+type transport interface {
+	Send(m message)
+}
+
+// loopback is a transport for the nodes in the same process.
+type loopback struct {
+	mu    sync.RWMutex
+	nodes map[uint64]*node
+}
+
+func newLoopback() *loopback {
+	return &loopback{nodes: make(map[uint64]*node)}
+}
+
+func (t *loopback) add(n *node) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nodes[n.id] = n
+}
+
+// Send puts the message in the inbox of the target node, the message
+// is dropped if the node is stopped or its inbox is full.
+func (t *loopback) Send(m message) {
+	t.mu.RLock()
+	n, ok := t.nodes[m.To]
+	t.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case n.inbox <- m:
+	default:
+	}
+}
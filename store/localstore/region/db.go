@@ -0,0 +1,519 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package region
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+var (
+	_ engine.Driver = Driver{}
+	_ engine.DB     = (*db)(nil)
+	_ engine.Batch  = (*batch)(nil)
+)
+
+const (
+	// The meta engine keeps the next region ID and the range of every region.
+	nextIDMetaKey    = "n"
+	regionMetaPrefix = "r"
+	// pendingMetaKey keeps a batch which is being committed to more than one region.
+	pendingMetaKey = "w"
+	metaDir        = "meta"
+	// splitBatchSize is the max number of keys moved in a batch when splitting.
+	splitBatchSize = 1024
+)
+
+// Config is the split configuration of the regions.
+type Config struct {
+	// A region is split when it has more than MaxKeys keys or MaxSize bytes.
+	MaxKeys int
+	MaxSize int
+}
+
+// DefaultConfig is the default configuration.
+var DefaultConfig = Config{
+	MaxKeys: 1024 * 1024,
+	MaxSize: 64 * 1024 * 1024,
+}
+
+// Driver implements engine.Driver interface, it splits the keyspace into regions,
+// every region is stored in an engine opened by Engine at path/<region id>.
+type Driver struct {
+	Engine engine.Driver
+	// Config is DefaultConfig if it is zero.
+	Config Config
+}
+
+// Open opens the regions at path, or creates a region for the whole keyspace.
+// The options in the query of path are passed to the engines.
+func (d Driver) Open(path string) (engine.DB, error) {
+	cfg := d.Config
+	if cfg.MaxKeys == 0 && cfg.MaxSize == 0 {
+		cfg = DefaultConfig
+	}
+
+	path, opts, err := engine.ParsePath(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	meta, err := d.Engine.Open(engine.JoinPath(filepath.Join(path, metaDir), opts))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &db{
+		path:   path,
+		opts:   opts,
+		driver: d.Engine,
+		cfg:    cfg,
+		meta:   meta,
+	}
+	if err = s.load(); err != nil {
+		s.Close()
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+// db is an engine.DB which routes the keys to the regions.
+// A batch is committed to every region it touches with mu held, so readers see
+// it all or nothing. A batch which touches more than one region is saved in the
+// meta engine first and removed when all the regions commit it. If a crash or
+// an error leaves it partly written, it is written again before the next commit,
+// or when the store is opened again, so it is never partly applied for good.
+type db struct {
+	path   string
+	opts   engine.Options
+	driver engine.Driver
+	cfg    Config
+
+	mu   sync.RWMutex
+	meta engine.DB
+	// regions are sorted by start key, they cover the whole keyspace.
+	regions []*region
+	nextID  uint64
+	// pending is true if a batch saved in the meta engine may be partly written.
+	pending bool
+}
+
+// load reads the regions from the meta engine and opens their engines.
+func (s *db) load() error {
+	s.nextID = 1
+	v, err := s.meta.Get([]byte(nextIDMetaKey))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if v != nil {
+		if _, s.nextID, err = codec.DecodeUint(v); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	snap, err := s.meta.GetSnapshot()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer snap.Release()
+
+	it := snap.NewIterator([]byte(regionMetaPrefix), []byte{regionMetaPrefix[0] + 1})
+	defer it.Release()
+	for it.Next() {
+		_, id, err1 := codec.DecodeUint(it.Key()[len(regionMetaPrefix):])
+		if err1 != nil {
+			return errors.Trace(err1)
+		}
+		r := &region{id: id}
+		if err1 = r.unmarshal(it.Value()); err1 != nil {
+			return errors.Trace(err1)
+		}
+		if r.db, err1 = s.driver.Open(s.regionPath(id)); err1 != nil {
+			return errors.Trace(err1)
+		}
+		// Add the region before counting it, so Close closes its engine if counting fails.
+		s.regions = append(s.regions, r)
+		if _, err1 = r.count(); err1 != nil {
+			return errors.Trace(err1)
+		}
+	}
+	if len(s.regions) > 0 {
+		sort.Sort(regionSlice(s.regions))
+		log.Infof("load %d regions from %s", len(s.regions), s.path)
+		s.pending = true
+		return errors.Trace(s.replayPending())
+	}
+
+	// A new store, create the first region for the whole keyspace.
+	r, err := s.newRegion(nil, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	b := s.meta.NewBatch()
+	b.Put(regionMetaKey(r.id), r.marshal())
+	if err = s.meta.Commit(b); err != nil {
+		r.db.Close()
+		return errors.Trace(err)
+	}
+	s.regions = []*region{r}
+	return nil
+}
+
+func (s *db) regionPath(id uint64) string {
+	return engine.JoinPath(filepath.Join(s.path, strconv.FormatUint(id, 10)), s.opts)
+}
+
+// newRegion allocates an ID and opens the engine for the range [start, end).
+func (s *db) newRegion(start, end []byte) (*region, error) {
+	id := s.nextID
+	s.nextID++
+	// Save the next ID first, so the engine path of a region which fails to be
+	// created is never used again.
+	b := s.meta.NewBatch()
+	b.Put([]byte(nextIDMetaKey), codec.EncodeUint(nil, s.nextID))
+	if err := s.meta.Commit(b); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	d, err := s.driver.Open(s.regionPath(id))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &region{id: id, start: start, end: end, db: d}, nil
+}
+
+func (s *db) locate(key []byte) int {
+	return locate(len(s.regions), func(i int) []byte { return s.regions[i].start }, key)
+}
+
+// Get implements engine.DB Get interface.
+func (s *db) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.regions[s.locate(key)].db.Get(key)
+}
+
+// GetSnapshot implements engine.DB GetSnapshot interface.
+func (s *db) GetSnapshot() (engine.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := &snapshot{}
+	for _, r := range s.regions {
+		rs, err := r.db.GetSnapshot()
+		if err != nil {
+			snap.Release()
+			return nil, errors.Trace(err)
+		}
+		snap.regions = append(snap.regions, &regionSnapshot{start: r.start, end: r.end, snap: rs})
+	}
+	return snap, nil
+}
+
+// NewBatch implements engine.DB NewBatch interface.
+func (s *db) NewBatch() engine.Batch {
+	return &batch{}
+}
+
+// Commit implements engine.DB Commit interface, it commits the batch to the
+// regions and splits the regions which become too large.
+func (s *db) Commit(b engine.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.replayPending(); err != nil {
+		return errors.Trace(err)
+	}
+	writes := b.(*batch).writes
+	batches := s.route(writes)
+	if len(batches) > 1 {
+		mb := s.meta.NewBatch()
+		mb.Put([]byte(pendingMetaKey), encodeWrites(writes))
+		if err := s.meta.Commit(mb); err != nil {
+			return errors.Trace(err)
+		}
+		s.pending = true
+	}
+	if err := s.commitRegions(batches); err != nil {
+		return errors.Trace(err)
+	}
+	if err := s.clearPending(); err != nil {
+		return errors.Trace(err)
+	}
+
+	for i := 0; i < len(s.regions); {
+		split, err := s.maybeSplit(i)
+		if err != nil {
+			// The batch is committed, the region is split again after the next commit.
+			log.Errorf("split region %d err %v", s.regions[i].id, err)
+			break
+		}
+		if !split {
+			i++
+		}
+	}
+	return nil
+}
+
+// route splits the writes into the batches of the regions by region index.
+func (s *db) route(writes []write) map[int]engine.Batch {
+	batches := make(map[int]engine.Batch)
+	for _, w := range writes {
+		i := s.locate(w.key)
+		rb, ok := batches[i]
+		if !ok {
+			rb = s.regions[i].db.NewBatch()
+			batches[i] = rb
+		}
+		if w.isDelete {
+			rb.Delete(w.key)
+			s.regions[i].delete(w.key)
+		} else {
+			rb.Put(w.key, w.value)
+			s.regions[i].put(w.key, w.value)
+		}
+	}
+	return batches
+}
+
+func (s *db) commitRegions(batches map[int]engine.Batch) error {
+	for i := range s.regions {
+		if rb, ok := batches[i]; ok {
+			if err := s.regions[i].db.Commit(rb); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// replayPending writes the batch saved in the meta engine to the regions again,
+// the writes are idempotent, so the regions which have committed it are fine.
+func (s *db) replayPending() error {
+	if !s.pending {
+		return nil
+	}
+	v, err := s.meta.Get([]byte(pendingMetaKey))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if v != nil {
+		writes, err1 := decodeWrites(v)
+		if err1 != nil {
+			return errors.Trace(err1)
+		}
+		log.Warnf("replay a partly committed batch of %d writes", len(writes))
+		if err1 = s.commitRegions(s.route(writes)); err1 != nil {
+			return errors.Trace(err1)
+		}
+	}
+	return errors.Trace(s.clearPending())
+}
+
+func (s *db) clearPending() error {
+	if !s.pending {
+		return nil
+	}
+	mb := s.meta.NewBatch()
+	mb.Delete([]byte(pendingMetaKey))
+	if err := s.meta.Commit(mb); err != nil {
+		return errors.Trace(err)
+	}
+	s.pending = false
+	return nil
+}
+
+// DeleteRange implements engine.DB DeleteRange interface, the deletions are
+// committed in batches, so the statistics of the regions are kept.
+func (s *db) DeleteRange(start, end []byte) error {
+	return errors.Trace(engine.DeleteRangeInBatches(s, start, end))
+}
+
+func (s *db) tooLarge(r *region) bool {
+	return (s.cfg.MaxKeys > 0 && r.keys > s.cfg.MaxKeys) || (s.cfg.MaxSize > 0 && r.size > s.cfg.MaxSize)
+}
+
+// maybeSplit splits the ith region at its middle key if it is too large.
+// The keys from the middle key are copied to a new region before the meta is
+// updated, then they are removed from the ith region. The regions only read
+// the keys in their ranges, so a split interrupted by a crash leaves no effect
+// except some garbage.
+func (s *db) maybeSplit(i int) (bool, error) {
+	r := s.regions[i]
+	if !s.tooLarge(r) {
+		return false, nil
+	}
+	mid, err := r.count()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if mid == nil || !s.tooLarge(r) {
+		return false, nil
+	}
+
+	nr, err := s.newRegion(mid, r.end)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if err = moveKeys(r.db, nr.db, mid, r.end, false); err != nil {
+		nr.db.Close()
+		return false, errors.Trace(err)
+	}
+
+	b := s.meta.NewBatch()
+	b.Put(regionMetaKey(r.id), (&region{start: r.start, end: mid}).marshal())
+	b.Put(regionMetaKey(nr.id), nr.marshal())
+	if err = s.meta.Commit(b); err != nil {
+		nr.db.Close()
+		return false, errors.Trace(err)
+	}
+
+	r.end = mid
+	s.regions = append(s.regions, nil)
+	copy(s.regions[i+2:], s.regions[i+1:])
+	s.regions[i+1] = nr
+	log.Infof("split region %d at %q, new region %d", r.id, mid, nr.id)
+
+	if err = moveKeys(r.db, nil, mid, nr.end, true); err != nil {
+		log.Errorf("remove keys of region %d err %v", r.id, err)
+	}
+	if _, err = r.count(); err != nil {
+		return true, errors.Trace(err)
+	}
+	_, err = nr.count()
+	return true, errors.Trace(err)
+}
+
+// moveKeys copies the keys in [start, end) of from to to,
+// or removes them from from if remove is true.
+func moveKeys(from engine.DB, to engine.DB, start, end []byte, remove bool) error {
+	snap, err := from.GetSnapshot()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer snap.Release()
+
+	target := to
+	if remove {
+		target = from
+	}
+	b, n := target.NewBatch(), 0
+	it := snap.NewIterator(start, end)
+	defer it.Release()
+	for it.Next() {
+		if remove {
+			b.Delete(it.Key())
+		} else {
+			b.Put(it.Key(), it.Value())
+		}
+		if n++; n >= splitBatchSize {
+			if err = target.Commit(b); err != nil {
+				return errors.Trace(err)
+			}
+			b, n = target.NewBatch(), 0
+		}
+	}
+	return errors.Trace(target.Commit(b))
+}
+
+// Close implements engine.DB Close interface.
+func (s *db) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, r := range s.regions {
+		if err1 := r.db.Close(); err1 != nil {
+			err = err1
+		}
+	}
+	s.regions = nil
+	if err1 := s.meta.Close(); err1 != nil {
+		err = err1
+	}
+	return errors.Trace(err)
+}
+
+type write struct {
+	key      []byte
+	value    []byte
+	isDelete bool
+}
+
+// batch keeps the writes until they are routed to the regions.
+type batch struct {
+	writes []write
+}
+
+func (b *batch) Put(key []byte, value []byte) {
+	b.writes = append(b.writes, write{
+		key:   append([]byte(nil), key...),
+		value: append([]byte(nil), value...),
+	})
+}
+
+func (b *batch) Delete(key []byte) {
+	b.writes = append(b.writes, write{key: append([]byte(nil), key...), isDelete: true})
+}
+
+// encodeWrites encodes the writes as a flag, the key and the value of a put
+// for every write.
+func encodeWrites(writes []write) []byte {
+	var b []byte
+	for _, w := range writes {
+		if w.isDelete {
+			b = append(b, 1)
+			b = codec.EncodeBytes(b, w.key)
+			continue
+		}
+		b = append(b, 0)
+		b = codec.EncodeBytes(b, w.key)
+		b = codec.EncodeBytes(b, w.value)
+	}
+	return b
+}
+
+func decodeWrites(b []byte) ([]write, error) {
+	var writes []write
+	for len(b) > 0 {
+		var (
+			w   write
+			err error
+		)
+		w.isDelete = b[0] == 1
+		if b, w.key, err = codec.DecodeBytes(b[1:]); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !w.isDelete {
+			if b, w.value, err = codec.DecodeBytes(b); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		writes = append(writes, w)
+	}
+	return writes, nil
+}
+
+type regionSlice []*region
+
+func (s regionSlice) Len() int           { return len(s) }
+func (s regionSlice) Less(i, j int) bool { return bytes.Compare(s[i].start, s[j].start) < 0 }
+func (s regionSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,134 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package region
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+// region is the range [start, end) of the keyspace stored in its own engine.
+// A nil end means the region is the last one.
+type region struct {
+	id    uint64
+	start []byte
+	end   []byte
+	db    engine.DB
+
+	// keys and size are estimated from the written batches, they are
+	// counted again when the region seems to be too large.
+	keys int
+	size int
+}
+
+func (r *region) contains(key []byte) bool {
+	return bytes.Compare(key, r.start) >= 0 && (r.end == nil || bytes.Compare(key, r.end) < 0)
+}
+
+func (r *region) put(key []byte, value []byte) {
+	r.keys++
+	r.size += len(key) + len(value)
+}
+
+func (r *region) delete(key []byte) {
+	if r.keys > 0 {
+		r.keys--
+	}
+	if r.size -= len(key); r.size < 0 {
+		r.size = 0
+	}
+}
+
+// count counts the keys and the size of the region, it returns the key in the middle.
+// The keys are counted in one pass and the middle key is found in another, so
+// the keys are never held in memory.
+func (r *region) count() ([]byte, error) {
+	snap, err := r.db.GetSnapshot()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer snap.Release()
+
+	r.keys, r.size = 0, 0
+	it := snap.NewIterator(r.start, r.end)
+	for it.Next() {
+		r.put(it.Key(), it.Value())
+	}
+	it.Release()
+
+	if r.keys < 2 {
+		return nil, nil
+	}
+	var mid []byte
+	it = snap.NewIterator(r.start, r.end)
+	for n := 0; it.Next(); n++ {
+		if n == r.keys/2 {
+			mid = append([]byte(nil), it.Key()...)
+			break
+		}
+	}
+	it.Release()
+	return mid, nil
+}
+
+// locate returns the index of the region which contains key in regions sorted by start key.
+func locate(n int, start func(i int) []byte, key []byte) int {
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(start(i), key) > 0
+	})
+	if i == 0 {
+		return 0
+	}
+	return i - 1
+}
+
+func regionMetaKey(id uint64) []byte {
+	return codec.EncodeUint([]byte(regionMetaPrefix), id)
+}
+
+// marshal encodes the range of the region, the end is prefixed with a flag for nil.
+func (r *region) marshal() []byte {
+	b := codec.EncodeBytes(nil, r.start)
+	if r.end == nil {
+		return append(b, 0)
+	}
+	b = append(b, 1)
+	return codec.EncodeBytes(b, r.end)
+}
+
+// unmarshal decodes the range of the region, the keys are copied
+// because the decoded bytes may share the memory of b.
+func (r *region) unmarshal(b []byte) error {
+	b, start, err := codec.DecodeBytes(b)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(b) == 0 {
+		return errors.Errorf("invalid region meta %q", b)
+	}
+	r.start, r.end = append([]byte(nil), start...), nil
+	if b[0] == 0 {
+		return nil
+	}
+	_, end, err := codec.DecodeBytes(b[1:])
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.end = append([]byte(nil), end...)
+	return nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package region
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/juju/errors"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/engine"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/store/localstore/memkv"
+)
+
+const testPath = "/tmp/test-tidb-region"
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testSuite{})
+
+type testSuite struct {
+}
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("k%04d", i))
+}
+
+// fill writes n keys in batches of 10 keys.
+func fill(c *C, d engine.DB, n int) {
+	for i := 0; i < n; i += 10 {
+		b := d.NewBatch()
+		for j := i; j < i+10 && j < n; j++ {
+			b.Put(testKey(j), []byte(fmt.Sprint(j)))
+		}
+		err := d.Commit(b)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *testSuite) TestSplit(c *C) {
+	d, err := Driver{Engine: memkv.Driver{}, Config: Config{MaxKeys: 100}}.Open("memory")
+	c.Assert(err, IsNil)
+	defer d.Close()
+
+	snap, err := d.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+
+	n := 1000
+	fill(c, d, n)
+	regions := d.(*db).regions
+	c.Assert(len(regions), Greater, 5)
+	c.Assert(regions[0].start, HasLen, 0)
+	c.Assert(regions[len(regions)-1].end, IsNil)
+	for i, r := range regions {
+		c.Assert(r.keys, LessEqual, 100)
+		if i > 0 {
+			c.Assert(r.start, DeepEquals, regions[i-1].end)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		v, err1 := d.Get(testKey(i))
+		c.Assert(err1, IsNil)
+		c.Assert(string(v), Equals, fmt.Sprint(i))
+	}
+
+	// The snapshot taken before the splits doesn't see the keys.
+	it := snap.NewIterator(nil, nil)
+	c.Assert(it.Next(), IsFalse)
+	it.Release()
+
+	snap2, err := d.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap2.Release()
+
+	cnt := 0
+	it = snap2.NewIterator(nil, nil)
+	for it.Next() {
+		c.Assert(it.Key(), DeepEquals, testKey(cnt))
+		cnt++
+	}
+	it.Release()
+	c.Assert(cnt, Equals, n)
+
+	// The range crosses several regions.
+	cnt = 0
+	it = snap2.NewIterator(testKey(150), testKey(850))
+	for it.Next() {
+		c.Assert(it.Key(), DeepEquals, testKey(150+cnt))
+		cnt++
+	}
+	it.Release()
+	c.Assert(cnt, Equals, 700)
+
+	cnt = 0
+	it = snap2.NewReverseIterator(testKey(850))
+	for it.Next() {
+		c.Assert(it.Key(), DeepEquals, testKey(849-cnt))
+		cnt++
+	}
+	it.Release()
+	c.Assert(cnt, Equals, 850)
+
+	b := d.NewBatch()
+	for i := 0; i < n; i += 2 {
+		b.Delete(testKey(i))
+	}
+	err = d.Commit(b)
+	c.Assert(err, IsNil)
+	v, err := d.Get(testKey(500))
+	c.Assert(err, IsNil)
+	c.Assert(v, IsNil)
+	v, err = d.Get(testKey(501))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "501")
+}
+
+func (s *testSuite) TestReopen(c *C) {
+	os.RemoveAll(testPath)
+	defer os.RemoveAll(testPath)
+
+	driver := Driver{Engine: goleveldb.Driver{}, Config: Config{MaxSize: 1024}}
+	d, err := driver.Open(testPath)
+	c.Assert(err, IsNil)
+	fill(c, d, 200)
+	cnt := len(d.(*db).regions)
+	c.Assert(cnt, Greater, 1)
+	err = d.Close()
+	c.Assert(err, IsNil)
+
+	d, err = driver.Open(testPath)
+	c.Assert(err, IsNil)
+	defer d.Close()
+	c.Assert(d.(*db).regions, HasLen, cnt)
+
+	snap, err := d.GetSnapshot()
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	n := 0
+	it := snap.NewIterator(nil, nil)
+	for it.Next() {
+		c.Assert(it.Key(), DeepEquals, testKey(n))
+		n++
+	}
+	it.Release()
+	c.Assert(n, Equals, 200)
+}
+
+// failDriver opens the engines whose Commit fails when the shared countdown
+// of the commits reaches 0.
+type failDriver struct {
+	engine.Driver
+	commits *int
+}
+
+func (d failDriver) Open(path string) (engine.DB, error) {
+	db, err := d.Driver.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &failDB{DB: db, commits: d.commits}, nil
+}
+
+type failDB struct {
+	engine.DB
+	commits *int
+}
+
+func (d *failDB) Commit(b engine.Batch) error {
+	if *d.commits--; *d.commits == 0 {
+		return errors.New("injected commit error")
+	}
+	return d.DB.Commit(b)
+}
+
+func (s *testSuite) TestPartlyCommitted(c *C) {
+	os.RemoveAll(testPath)
+	defer os.RemoveAll(testPath)
+
+	commits := -1
+	driver := Driver{Engine: failDriver{Driver: goleveldb.Driver{}, commits: &commits}, Config: Config{MaxKeys: 50}}
+	d, err := driver.Open(testPath)
+	c.Assert(err, IsNil)
+	fill(c, d, 200)
+	c.Assert(len(d.(*db).regions), Greater, 1)
+
+	// The batch is saved in the meta engine, then the first region commits it
+	// and the last one fails.
+	commits = 3
+	b := d.NewBatch()
+	b.Put(testKey(0), []byte("x"))
+	b.Put(testKey(199), []byte("y"))
+	c.Assert(d.Commit(b), NotNil)
+	v, err := d.Get(testKey(199))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "199")
+	c.Assert(d.Close(), IsNil)
+
+	// The batch is written again when the store is opened.
+	commits = -1
+	d, err = driver.Open(testPath)
+	c.Assert(err, IsNil)
+	defer d.Close()
+	v, err = d.Get(testKey(0))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "x")
+	v, err = d.Get(testKey(199))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "y")
+
+	// Or before the next commit if the store is not closed.
+	commits = 3
+	b = d.NewBatch()
+	b.Put(testKey(0), []byte("x2"))
+	b.Put(testKey(199), []byte("y2"))
+	c.Assert(d.Commit(b), NotNil)
+	commits = -1
+	b = d.NewBatch()
+	b.Put(testKey(100), []byte("z"))
+	c.Assert(d.Commit(b), IsNil)
+	v, err = d.Get(testKey(199))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "y2")
+}
+
+func (s *testSuite) TestStore(c *C) {
+	d := localstore.Driver{
+		Driver: Driver{Engine: memkv.Driver{}, Config: Config{MaxKeys: 50}},
+	}
+	store, err := d.Open("region")
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	// The transaction writes to many regions.
+	n := 300
+	err = kv.RunInNewTxn(store, false, func(txn kv.Transaction) error {
+		for i := 0; i < n; i++ {
+			if err1 := txn.Set(testKey(i), []byte("1")); err1 != nil {
+				return err1
+			}
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	txn1, err := store.Begin()
+	c.Assert(err, IsNil)
+	txn2, err := store.Begin()
+	c.Assert(err, IsNil)
+	_, err = txn1.Inc(testKey(0), 1)
+	c.Assert(err, IsNil)
+	err = txn1.Set(testKey(n-1), []byte("2"))
+	c.Assert(err, IsNil)
+	_, err = txn2.Inc(testKey(0), 1)
+	c.Assert(err, IsNil)
+	c.Assert(txn1.Commit(), IsNil)
+	c.Assert(kv.IsRetryableError(txn2.Commit()), IsTrue)
+
+	txn, err := store.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+	it, err := txn.Scan(testKey(0), nil, 0)
+	c.Assert(err, IsNil)
+	cnt := 0
+	for it.Valid() {
+		c.Assert(it.Key(), Equals, string(testKey(cnt)))
+		cnt++
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	it.Close()
+	c.Assert(cnt, Equals, n)
+	v, err := txn.Get(testKey(n - 1))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "2")
+}
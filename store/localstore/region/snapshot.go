@@ -0,0 +1,154 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package region
+
+import (
+	"bytes"
+
+	"github.com/pingcap/tidb/store/localstore/engine"
+)
+
+var (
+	_ engine.Snapshot = (*snapshot)(nil)
+	_ engine.Iterator = (*iterator)(nil)
+)
+
+// regionSnapshot is the snapshot of a region, the range is the one when the snapshot is taken.
+type regionSnapshot struct {
+	start []byte
+	end   []byte
+	snap  engine.Snapshot
+}
+
+// snapshot is made up of the snapshots of all the regions taken at the same time.
+type snapshot struct {
+	regions []*regionSnapshot
+}
+
+func (s *snapshot) locate(key []byte) int {
+	return locate(len(s.regions), func(i int) []byte { return s.regions[i].start }, key)
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	return s.regions[s.locate(key)].snap.Get(key)
+}
+
+func (s *snapshot) NewIterator(startKey []byte, endKey []byte) engine.Iterator {
+	return &iterator{
+		regions: s.regions,
+		idx:     s.locate(startKey),
+		start:   startKey,
+		end:     endKey,
+	}
+}
+
+func (s *snapshot) NewReverseIterator(endKey []byte) engine.Iterator {
+	idx := len(s.regions) - 1
+	if endKey != nil {
+		idx = s.locate(endKey)
+	}
+	return &iterator{
+		regions: s.regions,
+		idx:     idx,
+		end:     endKey,
+		reverse: true,
+	}
+}
+
+func (s *snapshot) Release() {
+	for _, r := range s.regions {
+		r.snap.Release()
+	}
+	s.regions = nil
+}
+
+// iterator iterates the regions one by one, it only reads the keys in the
+// range of every region.
+type iterator struct {
+	regions []*regionSnapshot
+	// idx is the index of the region iterated by it.
+	idx     int
+	it      engine.Iterator
+	start   []byte
+	end     []byte
+	reverse bool
+}
+
+// open creates the iterator of the current region, it returns false if there is no more region.
+func (it *iterator) open() bool {
+	if it.idx < 0 || it.idx >= len(it.regions) {
+		return false
+	}
+	r := it.regions[it.idx]
+	if !it.reverse && it.end != nil && bytes.Compare(r.start, it.end) >= 0 {
+		return false
+	}
+
+	end := it.end
+	if r.end != nil && (end == nil || bytes.Compare(r.end, end) < 0) {
+		end = r.end
+	}
+	if it.reverse {
+		it.it = r.snap.NewReverseIterator(end)
+		return true
+	}
+	start := it.start
+	if bytes.Compare(r.start, start) > 0 {
+		start = r.start
+	}
+	it.it = r.snap.NewIterator(start, end)
+	return true
+}
+
+func (it *iterator) Next() bool {
+	for {
+		if it.it == nil && !it.open() {
+			return false
+		}
+		if it.it.Next() {
+			if !it.reverse || bytes.Compare(it.it.Key(), it.regions[it.idx].start) >= 0 {
+				return true
+			}
+		}
+
+		it.it.Release()
+		it.it = nil
+		if it.reverse {
+			it.idx--
+		} else {
+			it.idx++
+		}
+	}
+}
+
+func (it *iterator) Key() []byte {
+	if it.it == nil {
+		return nil
+	}
+	return it.it.Key()
+}
+
+func (it *iterator) Value() []byte {
+	if it.it == nil {
+		return nil
+	}
+	return it.it.Value()
+}
+
+func (it *iterator) Release() {
+	if it.it != nil {
+		it.it.Release()
+		it.it = nil
+	}
+}
@@ -14,7 +14,10 @@
 package localstore
 
 import (
-	"github.com/ngaut/log"
+	"bytes"
+	"sort"
+
+	"github.com/juju/errors"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/localstore/engine"
 )
@@ -22,35 +25,112 @@ import (
 var (
 	_ kv.Snapshot = (*dbSnapshot)(nil)
 	_ kv.Iterator = (*dbIter)(nil)
+	_ kv.Iterator = (*dbReverseIter)(nil)
 )
 
+// dbSnapshot reads the newest versions which are not greater than version.
 type dbSnapshot struct {
 	engine.Snapshot
+	version kv.Version
+	c       *compressor
+	// tombstones hide the versions of the keys deleted by the range deletions.
+	tombstones rangeTombstones
 }
 
 func (s *dbSnapshot) Get(k []byte) ([]byte, error) {
-	// engine Snapshot return nil, nil for value not found,
+	// mvccSeek returns nil for both a missing key and a tombstone,
 	// so here we will check nil and return kv.ErrNotExist.
-	v, err := s.Snapshot.Get(k)
+	v, ver, err := mvccSeek(s.Snapshot, k, s.version)
 	if err != nil {
-		return nil, err
+		return nil, errors.Trace(err)
 	}
 
-	if v == nil {
+	if v == nil || s.tombstones.hides(k, ver) {
 		return nil, kv.ErrNotExist
 	}
 
-	return v, nil
+	v, err = s.c.decode(v, ver)
+	return v, errors.Trace(err)
 }
 
-func (s *dbSnapshot) NewIterator(param interface{}) kv.Iterator {
+// BatchGet sorts the keys and reads them with one iterator, which walks the
+// entries from the first key to the last one.
+func (s *dbSnapshot) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	m := make(map[string][]byte, len(keys))
+	if len(keys) == 0 {
+		return m, nil
+	}
+	sorted := append(bytesSlice(nil), keys...)
+	sort.Sort(sorted)
+	end := append(append([]byte(nil), sorted[len(sorted)-1]...), 0)
+	it := s.Snapshot.NewIterator(MvccEncodeVersionKey(sorted[0], s.version), mvccEncodeEndKey(end))
+	defer it.Release()
+
+	i := 0
+	for i < len(sorted) && it.Next() {
+		key, ver, err := MvccDecode(it.Key())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i < len(sorted) && bytes.Compare(sorted[i], key) < 0 {
+			i++
+		}
+		if i == len(sorted) {
+			break
+		}
+		if !bytes.Equal(sorted[i], key) || ver.Cmp(s.version) > 0 {
+			continue
+		}
+		// The first visible version is the newest, the older ones are skipped
+		// with the duplicated keys.
+		for i < len(sorted) && bytes.Equal(sorted[i], key) {
+			i++
+		}
+		v := it.Value()
+		if isTombstone(v) || s.tombstones.hides(key, ver) {
+			continue
+		}
+		if v, err = s.c.decode(append([]byte(nil), v...), ver); err != nil {
+			return nil, errors.Trace(err)
+		}
+		m[string(key)] = v
+	}
+	return m, nil
+}
+
+func (s *dbSnapshot) NewIterator(param interface{}) (kv.Iterator, error) {
 	startKey, ok := param.([]byte)
 	if !ok {
-		log.Errorf("leveldb iterator parameter error, %+v", param)
-		return nil
+		return nil, errors.Errorf("leveldb iterator parameter error, %+v", param)
+	}
+	it := s.Snapshot.NewIterator(MvccEncodeVersionKey(startKey, s.version), mvccEncodeEndKey(nil))
+	return checkIter(newDBIter(it, s.version, s.c, s.tombstones, 0))
+}
+
+func (s *dbSnapshot) Scan(start, end []byte, limit int) (kv.Iterator, error) {
+	it := s.Snapshot.NewIterator(MvccEncodeVersionKey(start, s.version), mvccEncodeEndKey(end))
+	return checkIter(newDBIter(it, s.version, s.c, s.tombstones, limit))
+}
+
+func (s *dbSnapshot) NewReverseIterator(param interface{}) (kv.Iterator, error) {
+	endKey, ok := param.([]byte)
+	if !ok {
+		return nil, errors.Errorf("leveldb reverse iterator parameter error, %+v", param)
 	}
-	it := s.Snapshot.NewIterator(startKey)
-	return newDBIter(it)
+	it := s.Snapshot.NewReverseIterator(mvccEncodeEndKey(endKey))
+	return checkIter(newDBReverseIter(it, s.version, s.c, s.tombstones))
+}
+
+// checkIter closes it and returns the error if it fails to move to its first entry.
+func checkIter(it interface {
+	kv.Iterator
+	Err() error
+}) (kv.Iterator, error) {
+	if err := it.Err(); err != nil {
+		it.Close()
+		return nil, errors.Trace(err)
+	}
+	return it, nil
 }
 
 func (s *dbSnapshot) Release() {
@@ -60,21 +140,82 @@ func (s *dbSnapshot) Release() {
 	}
 }
 
+// dbIter iterates the newest visible version of every key,
+// skipping the newer versions, the older versions and the tombstones.
+// If limit > 0, it stops after limit keys.
 type dbIter struct {
 	engine.Iterator
-	valid bool
+	version    kv.Version
+	c          *compressor
+	tombstones rangeTombstones
+	key        []byte
+	value      []byte
+	valid      bool
+	limit      int
+	count      int
+	// err is the error of decoding an entry, the iterator stops at it.
+	err error
 }
 
-func newDBIter(it engine.Iterator) *dbIter {
-	return &dbIter{
-		Iterator: it,
-		valid:    it.Next(),
+func newDBIter(it engine.Iterator, ver kv.Version, c *compressor, ts rangeTombstones, limit int) *dbIter {
+	iter := &dbIter{
+		Iterator:   it,
+		version:    ver,
+		c:          c,
+		tombstones: ts,
+		limit:      limit,
 	}
+	iter.next()
+	return iter
+}
+
+func (it *dbIter) next() {
+	if it.limit > 0 && it.count >= it.limit {
+		it.valid = false
+		return
+	}
+	skipKey, skip := it.key, it.valid
+	for it.Iterator.Next() {
+		key, ver, err := MvccDecode(it.Iterator.Key())
+		if err != nil {
+			it.err = errors.Annotatef(err, "decode mvcc key %q", it.Iterator.Key())
+			break
+		}
+		if ver.Cmp(it.version) > 0 {
+			continue
+		}
+		// The first visible version is the newest, skip the older ones.
+		if skip && bytes.Equal(key, skipKey) {
+			continue
+		}
+		skipKey, skip = key, true
+		if isTombstone(it.Iterator.Value()) || it.tombstones.hides(key, ver) {
+			continue
+		}
+		value, err := it.c.decode(it.Iterator.Value(), ver)
+		if err != nil {
+			it.err = errors.Annotatef(err, "decode value of %q", key)
+			break
+		}
+		it.key = key
+		it.value = value
+		it.valid = true
+		it.count++
+		return
+	}
+	it.valid = false
 }
 
 func (it *dbIter) Next(fn kv.FnKeyCmp) (kv.Iterator, error) {
-	it.valid = it.Iterator.Next()
-	return it, nil
+	if it.err == nil {
+		it.next()
+	}
+	return it, errors.Trace(it.err)
+}
+
+// Err returns the error which stops the iterator.
+func (it *dbIter) Err() error {
+	return it.err
 }
 
 func (it *dbIter) Valid() bool {
@@ -82,11 +223,11 @@ func (it *dbIter) Valid() bool {
 }
 
 func (it *dbIter) Key() string {
-	return string(it.Iterator.Key())
+	return string(it.key)
 }
 
 func (it *dbIter) Value() []byte {
-	return it.Iterator.Value()
+	return it.value
 }
 
 func (it *dbIter) Close() {
@@ -95,3 +236,119 @@ func (it *dbIter) Close() {
 		it.Iterator = nil
 	}
 }
+
+// dbReverseIter iterates the newest visible version of every key backward.
+// The versions of a key are met from the oldest to the newest, so it has to
+// read past all of them to find the newest visible one.
+type dbReverseIter struct {
+	engine.Iterator
+	version    kv.Version
+	c          *compressor
+	tombstones rangeTombstones
+	key        []byte
+	value      []byte
+	valid      bool
+	// pending means the engine iterator points to an entry not consumed yet.
+	pending bool
+	// err is the error of decoding an entry, the iterator stops at it.
+	err error
+}
+
+func newDBReverseIter(it engine.Iterator, ver kv.Version, c *compressor, ts rangeTombstones) *dbReverseIter {
+	iter := &dbReverseIter{
+		Iterator:   it,
+		version:    ver,
+		c:          c,
+		tombstones: ts,
+	}
+	iter.next()
+	return iter
+}
+
+func (it *dbReverseIter) next() {
+	for {
+		if !it.pending && !it.Iterator.Next() {
+			it.valid = false
+			return
+		}
+		it.pending = false
+
+		curKey, _, err := MvccDecode(it.Iterator.Key())
+		if err != nil {
+			it.err = errors.Annotatef(err, "decode mvcc key %q", it.Iterator.Key())
+			it.valid = false
+			return
+		}
+
+		var value []byte
+		var valueVer kv.Version
+		found := false
+		for {
+			key, ver, err1 := MvccDecode(it.Iterator.Key())
+			if err1 != nil {
+				it.err = errors.Annotatef(err1, "decode mvcc key %q", it.Iterator.Key())
+				it.valid = false
+				return
+			}
+			if !bytes.Equal(key, curKey) {
+				it.pending = true
+				break
+			}
+			if ver.Cmp(it.version) <= 0 {
+				value = append(value[:0], it.Iterator.Value()...)
+				valueVer = ver
+				found = true
+			}
+			if !it.Iterator.Next() {
+				break
+			}
+		}
+
+		if found && !isTombstone(value) && !it.tombstones.hides(curKey, valueVer) {
+			if value, err = it.c.decode(value, valueVer); err != nil {
+				it.err = errors.Annotatef(err, "decode value of %q", curKey)
+				it.valid = false
+				return
+			}
+			it.key = curKey
+			it.value = value
+			it.valid = true
+			return
+		}
+		if !it.pending {
+			it.valid = false
+			return
+		}
+	}
+}
+
+func (it *dbReverseIter) Next(fn kv.FnKeyCmp) (kv.Iterator, error) {
+	if it.err == nil {
+		it.next()
+	}
+	return it, errors.Trace(it.err)
+}
+
+// Err returns the error which stops the iterator.
+func (it *dbReverseIter) Err() error {
+	return it.err
+}
+
+func (it *dbReverseIter) Valid() bool {
+	return it.valid
+}
+
+func (it *dbReverseIter) Key() string {
+	return string(it.key)
+}
+
+func (it *dbReverseIter) Value() []byte {
+	return it.value
+}
+
+func (it *dbReverseIter) Close() {
+	if it.Iterator != nil {
+		it.Iterator.Release()
+		it.Iterator = nil
+	}
+}
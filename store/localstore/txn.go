@@ -14,8 +14,10 @@
 package localstore
 
 import (
+	"bytes"
 	"fmt"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"time"
 
@@ -37,28 +39,20 @@ var (
 // dbTxn is not thread safe
 type dbTxn struct {
 	kv.UnionStore
-	store        *dbStore // for commit
-	startTs      time.Time
-	tID          int64
-	valid        bool
-	snapshotVals map[string][]byte // origin version in snapshot
+	store      *dbStore // for commit
+	version    kv.Version
+	tID        int64
+	valid      bool
+	lockedKeys map[string]struct{} // keys checked for conflicts on commit
+	// droppedRanges are the ranges in UnionStore.DeletedRanges deleted by DropRange.
+	droppedRanges []kv.KeyRange
+	// lockWaitTimeout is the duration to wait for the keys locked by other transactions,
+	// a positive value enables the blocking mode.
+	lockWaitTimeout time.Duration
 }
 
 func (txn *dbTxn) markOrigin(k []byte) error {
-	keystr := string(k)
-
-	// Already exist, no nothing
-	if _, ok := txn.snapshotVals[keystr]; ok {
-		return nil
-	}
-
-	val, err := txn.Snapshot.Get(k)
-	if err != nil && !kv.IsErrNotFound(err) {
-		return err
-	}
-
-	//log.Debugf("markOrigin, key:%q, value:%q", keystr, val)
-	txn.snapshotVals[keystr] = val
+	txn.lockedKeys[string(k)] = struct{}{}
 	return nil
 }
 
@@ -66,6 +60,9 @@ func (txn *dbTxn) markOrigin(k []byte) error {
 
 func (txn *dbTxn) Inc(k []byte, step int64) (int64, error) {
 	log.Debugf("Inc %q, step %d txn:%d", k, step, txn.tID)
+	if txn.store.readOnly {
+		return 0, errors.Trace(kv.ErrReadOnly)
+	}
 	k = kv.EncodeKey(k)
 
 	if err := txn.markOrigin(k); err != nil {
@@ -121,6 +118,24 @@ func (txn *dbTxn) Get(k []byte) ([]byte, error) {
 	return val, nil
 }
 
+func (txn *dbTxn) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	log.Debugf("batch get %d keys, txn:%d", len(keys), txn.tID)
+	encodedKeys := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		encodedKeys = append(encodedKeys, kv.EncodeKey(k))
+	}
+	values, err := txn.UnionStore.BatchGet(encodedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][]byte, len(values))
+	for k, v := range values {
+		m[string(kv.DecodeKey([]byte(k)))] = v
+	}
+	return m, nil
+}
+
 func (txn *dbTxn) Set(k []byte, data []byte) error {
 	if len(data) == 0 {
 		// Incase someone use it in the wrong way, we can figure it out immediately
@@ -129,6 +144,9 @@ func (txn *dbTxn) Set(k []byte, data []byte) error {
 	}
 
 	log.Debugf("set key:%q, txn:%d", k, txn.tID)
+	if txn.store.readOnly {
+		return errors.Trace(kv.ErrReadOnly)
+	}
 	k = kv.EncodeKey(k)
 	return txn.UnionStore.Set(k, data)
 }
@@ -147,7 +165,7 @@ func (txn *dbTxn) Seek(k []byte, fnKeyCmp func([]byte) bool) (kv.Iterator, error
 	}
 
 	if fnKeyCmp != nil {
-		if fnKeyCmp([]byte(iter.Key())[:1]) {
+		if fnKeyCmp([]byte(iter.Key())) {
 			return &kv.UnionIter{}, nil
 		}
 	}
@@ -155,12 +173,63 @@ func (txn *dbTxn) Seek(k []byte, fnKeyCmp func([]byte) bool) (kv.Iterator, error
 	return iter, nil
 }
 
+func (txn *dbTxn) Scan(start, end []byte, limit int) (kv.Iterator, error) {
+	log.Debugf("scan [%q, %q) limit %d txn:%d", start, end, limit, txn.tID)
+	start = kv.EncodeKey(start)
+	end = kv.EncodeEndKey(end)
+	return txn.UnionStore.Scan(start, end, limit)
+}
+
+func (txn *dbTxn) SeekReverse(k []byte) (kv.Iterator, error) {
+	log.Debugf("seek reverse %q txn:%d", k, txn.tID)
+	k = kv.EncodeEndKey(k)
+	return txn.UnionStore.SeekReverse(k, txn)
+}
+
 func (txn *dbTxn) Delete(k []byte) error {
 	log.Debugf("delete %q txn:%d", k, txn.tID)
+	if txn.store.readOnly {
+		return errors.Trace(kv.ErrReadOnly)
+	}
 	k = kv.EncodeKey(k)
 	return txn.UnionStore.Delete(k)
 }
 
+// DeleteRange implements kv.RangeDeleter DeleteRange interface.
+func (txn *dbTxn) DeleteRange(start, end []byte) error {
+	return txn.deleteRange(start, end, false)
+}
+
+// DropRange implements kv.RangeDeleter DropRange interface.
+func (txn *dbTxn) DropRange(start, end []byte) error {
+	return txn.deleteRange(start, end, true)
+}
+
+func (txn *dbTxn) deleteRange(start, end []byte, drop bool) error {
+	log.Debugf("delete range [%q, %q) drop %v txn:%d", start, end, drop, txn.tID)
+	if txn.store.readOnly {
+		return errors.Trace(kv.ErrReadOnly)
+	}
+	r := kv.KeyRange{StartKey: kv.EncodeKey(start), EndKey: kv.EncodeEndKey(end)}
+	if err := txn.UnionStore.DeleteRange(r.StartKey, r.EndKey); err != nil {
+		return errors.Trace(err)
+	}
+	if drop {
+		txn.droppedRanges = append(txn.droppedRanges, r)
+	}
+	return nil
+}
+
+// isDropped returns true if r is deleted by DropRange.
+func (txn *dbTxn) isDropped(r kv.KeyRange) bool {
+	for _, d := range txn.droppedRanges {
+		if bytes.Equal(d.StartKey, r.StartKey) && bytes.Equal(d.EndKey, r.EndKey) {
+			return true
+		}
+	}
+	return false
+}
+
 func (txn *dbTxn) each(f func(iterator.Iterator) error) error {
 	iter := txn.UnionStore.Dirty.NewIterator(nil)
 	defer iter.Release()
@@ -172,37 +241,83 @@ func (txn *dbTxn) each(f func(iterator.Iterator) error) error {
 	return nil
 }
 
-func (txn *dbTxn) doCommit() error {
-	b := txn.store.newBatch()
-	keysLocked := make([]string, 0, len(txn.snapshotVals))
-	defer func() {
-		for _, key := range keysLocked {
-			txn.store.unLockKeys(key)
-		}
-	}()
-	// Check locked keys
-	for k, v := range txn.snapshotVals {
-		err := txn.store.tryConditionLockKey(txn.tID, k, v)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		keysLocked = append(keysLocked, k)
+type commitPhase int
+
+const (
+	commitPhasePrewrite commitPhase = iota + 1
+	commitPhasePrimary
+)
+
+// commitFailpoint is only used in tests to simulate a crash in the middle of a commit.
+// If it returns an error, the commit stops immediately and leaves the locks in store.
+var commitFailpoint func(phase commitPhase) error
+
+func runCommitFailpoint(phase commitPhase) error {
+	if commitFailpoint == nil {
+		return nil
 	}
+	return commitFailpoint(phase)
+}
 
-	// Check dirty store
+// buildLocks returns the sorted keys to be committed and their locks.
+func (txn *dbTxn) buildLocks() ([][]byte, map[string]*lockInfo, error) {
+	var keys [][]byte
+	locks := make(map[string]*lockInfo)
 	err := txn.each(func(iter iterator.Iterator) error {
+		key := append([]byte(nil), iter.Key()...)
+		l := &lockInfo{startVer: txn.version, op: lockOpPut}
 		if len(iter.Value()) == 0 { // Deleted marker
-			b.Delete(iter.Key())
+			l.op = lockOpDelete
 		} else {
-			b.Put(iter.Key(), iter.Value())
+			l.value = txn.store.compressor.encode(append([]byte(nil), iter.Value()...))
 		}
+		keys = append(keys, key)
+		locks[string(key)] = l
 		return nil
 	})
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	for k := range txn.lockedKeys {
+		if _, ok := locks[k]; ok {
+			continue
+		}
+		keys = append(keys, []byte(k))
+		locks[k] = &lockInfo{startVer: txn.version, op: lockOpLock}
+	}
+
+	sort.Sort(bytesSlice(keys))
+	for _, l := range locks {
+		l.primary = keys[0]
+	}
+	return keys, locks, nil
+}
+
+func (txn *dbTxn) doCommit() error {
+	keys, locks, err := txn.buildLocks()
 	if err != nil {
 		return errors.Trace(err)
 	}
-	return txn.store.writeBatch(b)
+	if len(keys) == 0 && len(txn.UnionStore.DeletedRanges) == 0 {
+		return nil
+	}
+	if txn.store.readOnly {
+		return errors.Trace(kv.ErrReadOnly)
+	}
+
+	// The transaction which only deletes ranges has no lock to be written.
+	if len(keys) > 0 {
+		if err = txn.store.prewrite(txn, keys, locks); err != nil {
+			return errors.Trace(err)
+		}
+	}
 
+	if err = runCommitFailpoint(commitPhasePrewrite); err != nil {
+		return errors.Trace(err)
+	}
+
+	return txn.store.commit(txn, keys, locks)
 }
 
 func (txn *dbTxn) Commit() error {
@@ -219,7 +334,14 @@ func (txn *dbTxn) Commit() error {
 
 func (txn *dbTxn) close() error {
 	txn.UnionStore.Close()
-	txn.snapshotVals = nil
+	txn.store.lm.unlockAll(txn.tID)
+	txn.store.mu.Lock()
+	delete(txn.store.txns, txn.tID)
+	txn.store.mu.Unlock()
+	if len(txn.UnionStore.DeletedRanges) > 0 {
+		txn.store.kickGC()
+	}
+	txn.lockedKeys = nil
 	txn.valid = false
 	return nil
 }
@@ -233,11 +355,41 @@ func (txn *dbTxn) Rollback() error {
 }
 
 func (txn *dbTxn) LockKeys(keys ...[]byte) error {
+	if txn.store.readOnly {
+		return errors.Trace(kv.ErrReadOnly)
+	}
+	encodedKeys := make([][]byte, 0, len(keys))
 	for _, key := range keys {
 		key = kv.EncodeKey(key)
 		if err := txn.markOrigin(key); err != nil {
 			return err
 		}
+		encodedKeys = append(encodedKeys, key)
+	}
+
+	// In blocking mode, the keys are locked now instead of in prewrite.
+	if txn.lockWaitTimeout > 0 {
+		return errors.Trace(txn.store.lockKeys(txn, encodedKeys))
 	}
 	return nil
 }
+
+func (txn *dbTxn) SetOption(opt kv.Option, val interface{}) {
+	switch opt {
+	case kv.LockWaitTimeout:
+		txn.lockWaitTimeout = 0
+		if d, ok := val.(time.Duration); ok {
+			txn.lockWaitTimeout = d
+		}
+	case kv.TxnEntryLimit:
+		txn.UnionStore.EntryLimit, _ = val.(int)
+	case kv.TxnSizeLimit:
+		txn.UnionStore.SizeLimit, _ = val.(int)
+	}
+}
+
+type bytesSlice [][]byte
+
+func (s bytesSlice) Len() int           { return len(s) }
+func (s bytesSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bytesSlice) Less(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
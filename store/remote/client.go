@@ -0,0 +1,335 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/rpc"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	_ kv.Driver      = Driver{}
+	_ kv.Storage     = (*store)(nil)
+	_ kv.Transaction = (*txn)(nil)
+	_ kv.Snapshot    = (*snapshot)(nil)
+	_ kv.Iterator    = (*iterator)(nil)
+)
+
+// Driver implements kv.Driver interface for the remote kv server.
+type Driver struct {
+}
+
+// Open connects to the kv server, the schema is the address of the server like host:port.
+func (d Driver) Open(schema string) (kv.Storage, error) {
+	client, err := rpc.Dial("tcp", schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	s := &store{addr: schema, client: client}
+	var resp Response
+	if err = s.call("UUID", &Request{}, &resp); err != nil {
+		client.Close()
+		return nil, errors.Trace(err)
+	}
+	s.uuid = resp.Name
+	log.Infof("connected to kv server %s, uuid %s", schema, s.uuid)
+	return s, nil
+}
+
+type store struct {
+	addr   string
+	uuid   string
+	client *rpc.Client
+}
+
+func (s *store) call(method string, req *Request, resp *Response) error {
+	err := s.client.Call(serviceName+"."+method, req, resp)
+	if err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
+
+func (s *store) Begin() (kv.Transaction, error) {
+	var resp Response
+	if err := s.call("Begin", &Request{}, &resp); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &txn{store: s, id: resp.ID, name: resp.Name, valid: true}, nil
+}
+
+func (s *store) GetSnapshot(ver kv.Version) (kv.Snapshot, error) {
+	var resp Response
+	if err := s.call("GetSnapshot", &Request{Version: ver.Ver}, &resp); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &snapshot{store: s, id: resp.ID}, nil
+}
+
+func (s *store) CurrentVersion() (kv.Version, error) {
+	var resp Response
+	if err := s.call("CurrentVersion", &Request{}, &resp); err != nil {
+		return kv.MinVersion, errors.Trace(err)
+	}
+	return kv.NewVersion(resp.Version), nil
+}
+
+func (s *store) Close() error {
+	return s.client.Close()
+}
+
+func (s *store) UUID() string {
+	return s.uuid
+}
+
+// txn is a transaction in the kv server.
+type txn struct {
+	store *store
+	id    uint64
+	name  string
+	valid bool
+}
+
+func (t *txn) call(method string, req *Request, resp *Response) error {
+	if !t.valid {
+		return errors.Trace(kv.ErrClosed)
+	}
+	req.ID = t.id
+	return t.store.call(method, req, resp)
+}
+
+func (t *txn) Get(k []byte) ([]byte, error) {
+	var resp Response
+	if err := t.call("Get", &Request{Key: k}, &resp); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return resp.Value, nil
+}
+
+func (t *txn) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	var resp Response
+	if err := t.call("BatchGet", &Request{Keys: keys}, &resp); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.Values == nil {
+		resp.Values = make(map[string][]byte)
+	}
+	return resp.Values, nil
+}
+
+func (t *txn) Set(k []byte, v []byte) error {
+	return errors.Trace(t.call("Set", &Request{Key: k, Value: v}, &Response{}))
+}
+
+func (t *txn) Seek(k []byte, fnKeyCmp func(key []byte) bool) (kv.Iterator, error) {
+	return t.Scan(k, nil, 0)
+}
+
+func (t *txn) Scan(start, end []byte, limit int) (kv.Iterator, error) {
+	it := &iterator{call: t.call, method: "Scan", start: start, end: end, limit: limit}
+	return it, errors.Trace(it.fetch())
+}
+
+func (t *txn) SeekReverse(k []byte) (kv.Iterator, error) {
+	it := &iterator{call: t.call, method: "Scan", end: k, reverse: true}
+	return it, errors.Trace(it.fetch())
+}
+
+func (t *txn) Inc(k []byte, step int64) (int64, error) {
+	var resp Response
+	if err := t.call("Inc", &Request{Key: k, Step: step}, &resp); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return resp.Int, nil
+}
+
+func (t *txn) Delete(k []byte) error {
+	return errors.Trace(t.call("Delete", &Request{Key: k}, &Response{}))
+}
+
+func (t *txn) Commit() error {
+	err := t.call("Commit", &Request{}, &Response{})
+	t.valid = false
+	return errors.Trace(err)
+}
+
+func (t *txn) Rollback() error {
+	err := t.call("Rollback", &Request{}, &Response{})
+	t.valid = false
+	return errors.Trace(err)
+}
+
+func (t *txn) String() string {
+	return t.name
+}
+
+func (t *txn) LockKeys(keys ...[]byte) error {
+	return errors.Trace(t.call("LockKeys", &Request{Keys: keys}, &Response{}))
+}
+
+func (t *txn) SetOption(opt kv.Option, val interface{}) {
+	req := &Request{Option: opt}
+	switch opt {
+	case kv.LockWaitTimeout:
+		req.Timeout, _ = val.(time.Duration)
+	case kv.TxnEntryLimit, kv.TxnSizeLimit:
+		req.Limit, _ = val.(int)
+	default:
+		return
+	}
+	if err := t.call("SetOption", req, &Response{}); err != nil {
+		log.Errorf("txn %s set option %d err %v", t.name, opt, err)
+	}
+}
+
+// snapshot is a snapshot in the kv server.
+type snapshot struct {
+	store *store
+	id    uint64
+}
+
+func (s *snapshot) call(method string, req *Request, resp *Response) error {
+	req.ID = s.id
+	return s.store.call(method, req, resp)
+}
+
+func (s *snapshot) Get(k []byte) ([]byte, error) {
+	var resp Response
+	if err := s.call("SnapshotGet", &Request{Key: k}, &resp); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return resp.Value, nil
+}
+
+func (s *snapshot) BatchGet(keys [][]byte) (map[string][]byte, error) {
+	var resp Response
+	if err := s.call("SnapshotBatchGet", &Request{Keys: keys}, &resp); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.Values == nil {
+		resp.Values = make(map[string][]byte)
+	}
+	return resp.Values, nil
+}
+
+func (s *snapshot) NewIterator(param interface{}) (kv.Iterator, error) {
+	startKey, ok := param.([]byte)
+	if !ok {
+		return nil, errors.Errorf("remote iterator parameter error, %+v", param)
+	}
+	it := &iterator{call: s.call, method: "SnapshotScan", start: startKey}
+	return it, errors.Trace(it.fetch())
+}
+
+func (s *snapshot) NewReverseIterator(param interface{}) (kv.Iterator, error) {
+	endKey, ok := param.([]byte)
+	if !ok {
+		return nil, errors.Errorf("remote reverse iterator parameter error, %+v", param)
+	}
+	it := &iterator{call: s.call, method: "SnapshotScan", end: endKey, reverse: true}
+	return it, errors.Trace(it.fetch())
+}
+
+func (s *snapshot) Scan(start, end []byte, limit int) (kv.Iterator, error) {
+	it := &iterator{call: s.call, method: "SnapshotScan", start: start, end: end, limit: limit}
+	return it, errors.Trace(it.fetch())
+}
+
+func (s *snapshot) Release() {
+	if err := s.call("ReleaseSnapshot", &Request{}, &Response{}); err != nil {
+		log.Errorf("release remote snapshot %d err %v", s.id, err)
+	}
+}
+
+// iterator fetches the entries from the kv server in batches.
+type iterator struct {
+	call    func(method string, req *Request, resp *Response) error
+	method  string
+	start   []byte
+	end     []byte
+	reverse bool
+	// If limit > 0, the iterator stops after limit entries.
+	limit int
+	count int
+
+	pairs []Pair
+	// last means no more entries after pairs in the server.
+	last bool
+}
+
+// fetch gets the next batch of entries.
+func (it *iterator) fetch() error {
+	batch := scanBatchSize
+	if it.limit > 0 && it.limit-it.count < batch {
+		batch = it.limit - it.count
+	}
+	req := &Request{Key: it.start, End: it.end, Limit: batch, Reverse: it.reverse}
+	var resp Response
+	if err := it.call(it.method, req, &resp); err != nil {
+		it.pairs, it.last = nil, true
+		return errors.Trace(err)
+	}
+
+	it.pairs = resp.Pairs
+	it.last = len(it.pairs) < batch
+	if len(it.pairs) > 0 {
+		lastKey := it.pairs[len(it.pairs)-1].Key
+		if it.reverse {
+			it.end = lastKey
+		} else {
+			// The next batch starts from the key right after the last key.
+			it.start = append(append([]byte(nil), lastKey...), 0)
+		}
+	}
+	return nil
+}
+
+func (it *iterator) Next(fn kv.FnKeyCmp) (kv.Iterator, error) {
+	if len(it.pairs) == 0 {
+		return it, nil
+	}
+	it.pairs = it.pairs[1:]
+	it.count++
+	if it.limit > 0 && it.count >= it.limit {
+		it.pairs, it.last = nil, true
+		return it, nil
+	}
+	if len(it.pairs) == 0 && !it.last {
+		if err := it.fetch(); err != nil {
+			return it, errors.Trace(err)
+		}
+	}
+	return it, nil
+}
+
+func (it *iterator) Valid() bool {
+	return len(it.pairs) > 0
+}
+
+func (it *iterator) Key() string {
+	return string(it.pairs[0].Key)
+}
+
+func (it *iterator) Value() []byte {
+	return it.pairs[0].Value
+}
+
+func (it *iterator) Close() {
+	it.pairs = nil
+}
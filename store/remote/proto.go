@@ -0,0 +1,108 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/rpc"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/kv"
+)
+
+// The remote store talks with the kv server with net/rpc over TCP, every
+// kv.Storage, kv.Transaction and kv.Snapshot operation is a call to the
+// service named serviceName. Transactions and snapshots live in the server,
+// the client refers to them by ID. A transaction is committed by the server
+// with its own two-phase commit, so it is a single call for the client.
+const serviceName = "KV"
+
+// scanBatchSize is the max number of entries fetched by a Scan call.
+const scanBatchSize = 256
+
+// Request is the arguments of a call, only the fields used by the call are set.
+type Request struct {
+	// ID is the ID of the transaction or the snapshot.
+	ID      uint64
+	Key     []byte
+	Value   []byte
+	Keys    [][]byte
+	End     []byte
+	Limit   int
+	Reverse bool
+	Step    int64
+	Version uint64
+	Option  kv.Option
+	Timeout time.Duration
+}
+
+// Pair is a key/value pair returned by Scan.
+type Pair struct {
+	Key   []byte
+	Value []byte
+}
+
+// Response is the result of a call, only the fields used by the call are set.
+type Response struct {
+	ID      uint64
+	Name    string
+	Value   []byte
+	Int     int64
+	Values  map[string][]byte
+	Pairs   []Pair
+	Version uint64
+}
+
+// knownErrors are the errors which callers check with errors2.ErrorEqual,
+// they are sent by message and turned back to the same error by the client.
+var knownErrors = []error{
+	kv.ErrClosed,
+	kv.ErrNotExist,
+	kv.ErrKeyExists,
+	kv.ErrConditionNotMatch,
+	kv.ErrLockConflict,
+	kv.ErrLockWaitTimeout,
+	kv.ErrDeadlock,
+	kv.ErrTxnTooLarge,
+	kv.ErrReadOnly,
+}
+
+// encodeError returns the original error of err if it is a known error,
+// so the client gets its message exactly.
+func encodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	cause := errors.Cause(err)
+	for _, e := range knownErrors {
+		if cause == e {
+			return e
+		}
+	}
+	return err
+}
+
+// decodeError turns the error returned by a call back to the known error.
+func decodeError(err error) error {
+	serverErr, ok := err.(rpc.ServerError)
+	if !ok {
+		return errors.Trace(err)
+	}
+	for _, e := range knownErrors {
+		if string(serverErr) == e.Error() {
+			return errors.Trace(e)
+		}
+	}
+	return errors.New(string(serverErr))
+}
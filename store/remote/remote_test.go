@@ -0,0 +1,220 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/util/errors2"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testRemoteSuite{})
+
+type testRemoteSuite struct {
+	local  kv.Storage
+	server *Server
+	s      kv.Storage
+}
+
+func (t *testRemoteSuite) SetUpSuite(c *C) {
+	d := localstore.Driver{
+		Driver: goleveldb.MemoryDriver{},
+	}
+	var err error
+	t.local, err = d.Open("memory:remote")
+	c.Assert(err, IsNil)
+
+	t.server, err = NewServer(t.local, "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	go t.server.Run()
+
+	t.s, err = Driver{}.Open(t.server.Addr())
+	c.Assert(err, IsNil)
+	c.Assert(t.s.UUID(), Equals, t.local.UUID())
+}
+
+func (t *testRemoteSuite) TearDownSuite(c *C) {
+	err := t.s.Close()
+	c.Assert(err, IsNil)
+	t.server.Close()
+	err = t.local.Close()
+	c.Assert(err, IsNil)
+}
+
+func (t *testRemoteSuite) TestGetSet(c *C) {
+	err := kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		err1 := txn.Set([]byte("a"), []byte("1"))
+		c.Assert(err1, IsNil)
+		err1 = txn.Set([]byte("b"), []byte("2"))
+		c.Assert(err1, IsNil)
+		v, err1 := txn.Get([]byte("a"))
+		c.Assert(err1, IsNil)
+		c.Assert(string(v), Equals, "1")
+		n, err1 := txn.Inc([]byte("n"), 2)
+		c.Assert(err1, IsNil)
+		c.Assert(n, Equals, int64(2))
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	c.Assert(txn.String(), Not(Equals), "")
+	_, err = txn.Get([]byte("c"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	m, err := txn.BatchGet([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 2)
+	c.Assert(string(m["b"]), Equals, "2")
+	err = txn.Delete([]byte("b"))
+	c.Assert(err, IsNil)
+	_, err = txn.Get([]byte("b"))
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	err = txn.Rollback()
+	c.Assert(err, IsNil)
+
+	// The transaction can't be used after rollback.
+	err = txn.Set([]byte("a"), []byte("2"))
+	c.Assert(errors2.ErrorEqual(err, kv.ErrClosed), IsTrue)
+}
+
+func (t *testRemoteSuite) TestScan(c *C) {
+	n := scanBatchSize*2 + 10
+	err := kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		for i := 0; i < n; i++ {
+			err1 := txn.Set([]byte(fmt.Sprintf("s%04d", i)), []byte("v"))
+			c.Assert(err1, IsNil)
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	txn, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	defer txn.Rollback()
+
+	it, err := txn.Scan([]byte("s"), []byte("t"), 0)
+	c.Assert(err, IsNil)
+	cnt := 0
+	for it.Valid() {
+		c.Assert(it.Key(), Equals, fmt.Sprintf("s%04d", cnt))
+		cnt++
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	it.Close()
+	c.Assert(cnt, Equals, n)
+
+	it, err = txn.Scan([]byte("s0001"), nil, scanBatchSize+1)
+	c.Assert(err, IsNil)
+	cnt = 0
+	for it.Valid() {
+		cnt++
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	it.Close()
+	c.Assert(cnt, Equals, scanBatchSize+1)
+
+	it, err = txn.SeekReverse([]byte("t"))
+	c.Assert(err, IsNil)
+	cnt = 0
+	for it.Valid() && it.Key() >= "s" {
+		c.Assert(it.Key(), Equals, fmt.Sprintf("s%04d", n-1-cnt))
+		cnt++
+		it, err = it.Next(nil)
+		c.Assert(err, IsNil)
+	}
+	it.Close()
+	c.Assert(cnt, Equals, n)
+}
+
+func (t *testRemoteSuite) TestSnapshot(c *C) {
+	err := kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte("x"), []byte("1"))
+	})
+	c.Assert(err, IsNil)
+	ver, err := t.s.CurrentVersion()
+	c.Assert(err, IsNil)
+	err = kv.RunInNewTxn(t.s, false, func(txn kv.Transaction) error {
+		return txn.Set([]byte("x"), []byte("2"))
+	})
+	c.Assert(err, IsNil)
+
+	snap, err := t.s.GetSnapshot(ver)
+	c.Assert(err, IsNil)
+	defer snap.Release()
+	k := kv.EncodeKey([]byte("x"))
+	v, err := snap.Get(k)
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "1")
+	m, err := snap.BatchGet([][]byte{k})
+	c.Assert(err, IsNil)
+	c.Assert(string(m[string(k)]), Equals, "1")
+
+	it, err := snap.NewIterator(k)
+	c.Assert(err, IsNil)
+	c.Assert(it.Valid(), IsTrue)
+	c.Assert(it.Key(), Equals, string(k))
+	it.Close()
+}
+
+func (t *testRemoteSuite) TestConflict(c *C) {
+	txn1, err := t.s.Begin()
+	c.Assert(err, IsNil)
+	txn2, err := t.s.Begin()
+	c.Assert(err, IsNil)
+
+	_, err = txn1.Inc([]byte("conflict"), 1)
+	c.Assert(err, IsNil)
+	_, err = txn2.Inc([]byte("conflict"), 1)
+	c.Assert(err, IsNil)
+
+	err = txn1.Commit()
+	c.Assert(err, IsNil)
+	err = txn2.Commit()
+	c.Assert(kv.IsRetryableError(err), IsTrue)
+}
+
+func (t *testRemoteSuite) TestDisconnect(c *C) {
+	s, err := Driver{}.Open(t.server.Addr())
+	c.Assert(err, IsNil)
+	txn, err := s.Begin()
+	c.Assert(err, IsNil)
+	txn.SetOption(kv.LockWaitTimeout, time.Second)
+	err = txn.LockKeys([]byte("disconnect"))
+	c.Assert(err, IsNil)
+	err = s.Close()
+	c.Assert(err, IsNil)
+
+	// The transaction left by the closed client doesn't block others.
+	err = kv.RunInNewTxn(t.s, true, func(txn kv.Transaction) error {
+		txn.SetOption(kv.LockWaitTimeout, time.Second)
+		if err1 := txn.LockKeys([]byte("disconnect")); err1 != nil {
+			return err1
+		}
+		return txn.Set([]byte("disconnect"), []byte("1"))
+	})
+	c.Assert(err, IsNil)
+}
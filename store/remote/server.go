@@ -0,0 +1,380 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net"
+	"net/rpc"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb/kv"
+)
+
+// Server serves a kv.Storage to the remote clients.
+type Server struct {
+	store kv.Storage
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewServer creates a Server which listens at addr.
+func NewServer(store kv.Storage, addr string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	log.Infof("KV server listen at [%s]", l.Addr())
+	return &Server{store: store, listener: l}, nil
+}
+
+// Addr returns the address the server listens at.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Run runs the server until it is closed.
+func (s *Server) Run() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		go s.onConn(conn)
+	}
+}
+
+// Close closes the server, the store is not closed.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+func (s *Server) onConn(conn net.Conn) {
+	log.Info("new kv client", conn.RemoteAddr())
+	svc := &service{
+		store:     s.store,
+		txns:      make(map[uint64]kv.Transaction),
+		snapshots: make(map[uint64]kv.Snapshot),
+	}
+	rs := rpc.NewServer()
+	if err := rs.RegisterName(serviceName, svc); err != nil {
+		log.Error(err)
+		conn.Close()
+		return
+	}
+	rs.ServeConn(conn)
+
+	// The client is gone, clean up what it left.
+	svc.close()
+	log.Info("kv client closed", conn.RemoteAddr())
+}
+
+// service handles the calls from one client connection.
+type service struct {
+	store kv.Storage
+
+	mu        sync.Mutex
+	nextID    uint64
+	txns      map[uint64]kv.Transaction
+	snapshots map[uint64]kv.Snapshot
+}
+
+func (svc *service) txn(id uint64) (kv.Transaction, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	txn, ok := svc.txns[id]
+	if !ok {
+		return nil, errors.Trace(kv.ErrClosed)
+	}
+	return txn, nil
+}
+
+func (svc *service) removeTxn(id uint64) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	delete(svc.txns, id)
+}
+
+func (svc *service) snapshot(id uint64) (kv.Snapshot, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	snap, ok := svc.snapshots[id]
+	if !ok {
+		return nil, errors.Errorf("snapshot %d not found", id)
+	}
+	return snap, nil
+}
+
+func (svc *service) close() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	for id, txn := range svc.txns {
+		txn.Rollback()
+		delete(svc.txns, id)
+	}
+	for id, snap := range svc.snapshots {
+		snap.Release()
+		delete(svc.snapshots, id)
+	}
+}
+
+// UUID returns the UUID of the store.
+func (svc *service) UUID(req *Request, resp *Response) error {
+	resp.Name = svc.store.UUID()
+	return nil
+}
+
+// CurrentVersion returns the current version of the store.
+func (svc *service) CurrentVersion(req *Request, resp *Response) error {
+	ver, err := svc.store.CurrentVersion()
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Version = ver.Ver
+	return nil
+}
+
+// Begin starts a transaction.
+func (svc *service) Begin(req *Request, resp *Response) error {
+	txn, err := svc.store.Begin()
+	if err != nil {
+		return encodeError(err)
+	}
+
+	svc.mu.Lock()
+	svc.nextID++
+	resp.ID = svc.nextID
+	svc.txns[resp.ID] = txn
+	svc.mu.Unlock()
+
+	resp.Name = txn.String()
+	return nil
+}
+
+// Get gets the value of req.Key in the transaction.
+func (svc *service) Get(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Value, err = txn.Get(req.Key)
+	return encodeError(err)
+}
+
+// BatchGet gets the values of req.Keys in the transaction.
+func (svc *service) BatchGet(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Values, err = txn.BatchGet(req.Keys)
+	return encodeError(err)
+}
+
+// Set sets req.Key to req.Value in the transaction.
+func (svc *service) Set(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	return encodeError(txn.Set(req.Key, req.Value))
+}
+
+// Delete deletes req.Key in the transaction.
+func (svc *service) Delete(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	return encodeError(txn.Delete(req.Key))
+}
+
+// Inc increases the value of req.Key by req.Step in the transaction.
+func (svc *service) Inc(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Int, err = txn.Inc(req.Key, req.Step)
+	return encodeError(err)
+}
+
+// LockKeys locks req.Keys in the transaction.
+func (svc *service) LockKeys(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	return encodeError(txn.LockKeys(req.Keys...))
+}
+
+// SetOption sets req.Option of the transaction.
+func (svc *service) SetOption(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	switch req.Option {
+	case kv.LockWaitTimeout:
+		txn.SetOption(req.Option, req.Timeout)
+	case kv.TxnEntryLimit, kv.TxnSizeLimit:
+		txn.SetOption(req.Option, req.Limit)
+	}
+	return nil
+}
+
+// Scan returns at most req.Limit entries from req.Key to req.End in the transaction,
+// or the entries before req.End backward if req.Reverse is set.
+func (svc *service) Scan(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+
+	var it kv.Iterator
+	if req.Reverse {
+		it, err = txn.SeekReverse(req.End)
+	} else {
+		it, err = txn.Scan(req.Key, req.End, req.Limit)
+	}
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Pairs, err = readPairs(it, req.Limit)
+	return encodeError(err)
+}
+
+// Commit commits the transaction.
+func (svc *service) Commit(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	svc.removeTxn(req.ID)
+	return encodeError(txn.Commit())
+}
+
+// Rollback rolls back the transaction.
+func (svc *service) Rollback(req *Request, resp *Response) error {
+	txn, err := svc.txn(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	svc.removeTxn(req.ID)
+	return encodeError(txn.Rollback())
+}
+
+// GetSnapshot gets a snapshot of req.Version.
+func (svc *service) GetSnapshot(req *Request, resp *Response) error {
+	snap, err := svc.store.GetSnapshot(kv.NewVersion(req.Version))
+	if err != nil {
+		return encodeError(err)
+	}
+
+	svc.mu.Lock()
+	svc.nextID++
+	resp.ID = svc.nextID
+	svc.snapshots[resp.ID] = snap
+	svc.mu.Unlock()
+	return nil
+}
+
+// SnapshotGet gets the value of req.Key in the snapshot.
+func (svc *service) SnapshotGet(req *Request, resp *Response) error {
+	snap, err := svc.snapshot(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Value, err = snap.Get(req.Key)
+	return encodeError(err)
+}
+
+// SnapshotBatchGet gets the values of req.Keys in the snapshot.
+func (svc *service) SnapshotBatchGet(req *Request, resp *Response) error {
+	snap, err := svc.snapshot(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Values, err = snap.BatchGet(req.Keys)
+	return encodeError(err)
+}
+
+// SnapshotScan is like Scan, but in the snapshot.
+func (svc *service) SnapshotScan(req *Request, resp *Response) error {
+	snap, err := svc.snapshot(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+
+	var it kv.Iterator
+	if req.Reverse {
+		it, err = snap.NewReverseIterator(req.End)
+	} else {
+		it, err = snap.Scan(req.Key, req.End, req.Limit)
+	}
+	if err != nil {
+		return encodeError(err)
+	}
+	resp.Pairs, err = readPairs(it, req.Limit)
+	return encodeError(err)
+}
+
+// ReleaseSnapshot releases the snapshot.
+func (svc *service) ReleaseSnapshot(req *Request, resp *Response) error {
+	snap, err := svc.snapshot(req.ID)
+	if err != nil {
+		return encodeError(err)
+	}
+
+	svc.mu.Lock()
+	delete(svc.snapshots, req.ID)
+	svc.mu.Unlock()
+
+	snap.Release()
+	return nil
+}
+
+// readPairs reads at most limit entries from it and closes it.
+func readPairs(it kv.Iterator, limit int) ([]Pair, error) {
+	defer func() {
+		it.Close()
+	}()
+
+	var pairs []Pair
+	var err error
+	for it.Valid() && len(pairs) < limit {
+		pairs = append(pairs, Pair{
+			Key:   []byte(it.Key()),
+			Value: append([]byte(nil), it.Value()...),
+		})
+		it, err = it.Next(nil)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return pairs, nil
+}
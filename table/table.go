@@ -22,6 +22,8 @@ import (
 
 	"github.com/pingcap/tidb/column"
 	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta/autoid"
 	"github.com/pingcap/tidb/model"
 	"github.com/pingcap/tidb/sessionctx/db"
@@ -41,6 +43,9 @@ type Table interface {
 	// Row returns a row for all columns.
 	Row(ctx context.Context, h int64) ([]interface{}, error)
 
+	// Rows returns the rows of handles for all columns, they are read in one batch.
+	Rows(ctx context.Context, handles []int64) ([][]interface{}, error)
+
 	// RemoveRow removes the row of handle h.
 	RemoveRow(ctx context.Context, h int64) error
 
@@ -104,14 +109,33 @@ type Table interface {
 	// Meta returns TableInfo.
 	Meta() *model.TableInfo
 
+	// PKHandleCol returns the primary key column whose values are the row handles, nil if there is none.
+	PKHandleCol() *column.Col
+
+	// Partitions returns the partitions of a partitioned table, nil if the table is not partitioned.
+	// Every partition is a Table which stores its rows and indices under its own ID.
+	Partitions() []Table
+
+	// LocatePartition returns the partition the row r belongs to, or the table itself if it is not partitioned.
+	LocatePartition(ctx context.Context, r []interface{}) (Table, error)
+
+	// GetTxn returns the transaction to access the rows and indices of the table in,
+	// a temporary table is stored apart from the store of ctx.
+	GetTxn(ctx context.Context) (kv.Transaction, error)
+
 	// LockRow locks a row.
 	// If update is true, set row lock key to current txn.
 	LockRow(ctx context.Context, h int64, update bool) error
 }
 
-// TableFromMeta builds a table.Table from *model.TableInfo.
+// ExprParser parses an expression kept as its source in *model.TableInfo,
+// e.g. the partitioning expression or the expression of a generated column.
+type ExprParser func(src string) (expression.Expression, error)
+
+// TableFromMeta builds a table.Table from *model.TableInfo, the expressions of
+// tblInfo are parsed by parse.
 // Currently, it is assigned to tables.TableFromMeta in tidb package's init function.
-var TableFromMeta func(schema string, alloc autoid.Allocator, tblInfo *model.TableInfo) Table
+var TableFromMeta func(schema string, alloc autoid.Allocator, tblInfo *model.TableInfo, parse ExprParser) Table
 
 // Ident is the table identifier composed of schema name and table name.
 // TODO: Move out
@@ -0,0 +1,151 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tables_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/meta/autoid"
+	"github.com/pingcap/tidb/model"
+	mysql "github.com/pingcap/tidb/mysqldef"
+	"github.com/pingcap/tidb/store/localstore"
+	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/table/tables"
+	"github.com/pingcap/tidb/util/types"
+)
+
+const (
+	benchCols      = 8
+	benchRows      = 1000
+	benchBatchSize = 100
+)
+
+var benchStoreID int64
+
+// newBenchTable creates a table of benchCols columns in the row format in a new memory store.
+func newBenchTable(b *testing.B, format int) (kv.Storage, context.Context, table.Table) {
+	log.SetLevelByString("error")
+	driver := localstore.Driver{Driver: goleveldb.MemoryDriver{}}
+	store, err := driver.Open(fmt.Sprintf("memory-bench-%d", atomic.AddInt64(&benchStoreID, 1)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	se, err := tidb.CreateSession(store)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	tbInfo := &model.TableInfo{ID: 1, Name: model.NewCIStr("t"), RowFormat: format}
+	for i := 0; i < benchCols; i++ {
+		tp := mysql.TypeLonglong
+		if i%2 == 1 {
+			tp = mysql.TypeVarchar
+		}
+		tbInfo.Columns = append(tbInfo.Columns, &model.ColumnInfo{
+			ID:        int64(i + 1),
+			Name:      model.NewCIStr(fmt.Sprintf("c%d", i)),
+			Offset:    i,
+			FieldType: *types.NewFieldType(tp),
+		})
+	}
+	return store, se.(context.Context), tables.TableFromMeta("test", autoid.NewAllocator(store), tbInfo, nil)
+}
+
+func benchRow(i int) []interface{} {
+	r := make([]interface{}, benchCols)
+	for j := range r {
+		if j%2 == 0 {
+			r[j] = int64(i)
+		} else {
+			r[j] = fmt.Sprintf("value %d of column %d", i, j)
+		}
+	}
+	return r
+}
+
+func addBenchRecords(b *testing.B, ctx context.Context, t table.Table, n int) []int64 {
+	var handles []int64
+	for i := 0; i < n; i++ {
+		h, err := t.AddRecord(ctx, benchRow(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		handles = append(handles, h)
+		if (i+1)%benchBatchSize == 0 || i == n-1 {
+			if err = ctx.FinishTxn(false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return handles
+}
+
+func benchmarkAddRecord(b *testing.B, format int) {
+	store, ctx, t := newBenchTable(b, format)
+	defer store.Close()
+
+	b.ResetTimer()
+	addBenchRecords(b, ctx, t, b.N)
+}
+
+func benchmarkRow(b *testing.B, format int) {
+	store, ctx, t := newBenchTable(b, format)
+	defer store.Close()
+	handles := addBenchRecords(b, ctx, t, benchRows)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := t.Row(ctx, handles[i%len(handles)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	ctx.FinishTxn(true)
+}
+
+func benchmarkIterRecords(b *testing.B, format int) {
+	store, ctx, t := newBenchTable(b, format)
+	defer store.Close()
+	addBenchRecords(b, ctx, t, benchRows)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := t.IterRecords(ctx, t.FirstKey(), t.Cols(), func(h int64, data []interface{}, cols []*column.Col) (bool, error) {
+			return true, nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	ctx.FinishTxn(true)
+}
+
+func BenchmarkAddRecordColumns(b *testing.B) { benchmarkAddRecord(b, model.RowFormatColumns) }
+func BenchmarkAddRecordCompact(b *testing.B) { benchmarkAddRecord(b, model.RowFormatCompact) }
+
+func BenchmarkRowColumns(b *testing.B) { benchmarkRow(b, model.RowFormatColumns) }
+func BenchmarkRowCompact(b *testing.B) { benchmarkRow(b, model.RowFormatCompact) }
+
+// BenchmarkIterRecords* scan benchRows rows in every iteration.
+func BenchmarkIterRecordsColumns(b *testing.B) { benchmarkIterRecords(b, model.RowFormatColumns) }
+func BenchmarkIterRecordsCompact(b *testing.B) { benchmarkIterRecords(b, model.RowFormatCompact) }
@@ -0,0 +1,120 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tables
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// The values of a STORED generated column are computed when the row is written
+// and stored like the values of the other columns. The values of a VIRTUAL
+// generated column are never stored, they are computed when the row is read.
+// The generated columns are computed in column order, so a generated column
+// may use the generated columns before it.
+
+// initGenerated parses the expressions of the generated columns of t by parse.
+func (t *Table) initGenerated(parse table.ExprParser) {
+	for _, c := range t.Columns {
+		if !c.IsGenerated() {
+			continue
+		}
+		if t.generatedExprs == nil {
+			t.generatedExprs = make([]expression.Expression, len(t.Columns))
+		}
+		if parse == nil {
+			t.generatedErr = errors.New("no parser for the generated column expression")
+			return
+		}
+		expr, err := parse(c.GeneratedExprString)
+		if err != nil {
+			t.generatedErr = errors.Annotatef(err, "generated column %s", c.Name)
+			return
+		}
+		t.generatedExprs[c.Offset] = expr
+	}
+}
+
+// isVirtual returns true if the values of c are not stored.
+func isVirtual(c *column.Col) bool {
+	return c.IsGenerated() && !c.GeneratedStored
+}
+
+// storedCols returns the columns of t whose values are stored.
+func (t *Table) storedCols() []*column.Col {
+	if t.generatedExprs == nil {
+		return t.Columns
+	}
+	cols := make([]*column.Col, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		if !isVirtual(c) {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// hasVirtual returns true if any of cols is a VIRTUAL generated column.
+func hasVirtual(cols []*column.Col) bool {
+	for _, c := range cols {
+		if isVirtual(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalGenerated computes the generated columns of the row r in column order,
+// only the VIRTUAL ones if virtualOnly is true. The computed columns are set
+// touched if touched is not nil.
+func (t *Table) evalGenerated(ctx context.Context, r []interface{}, touched []bool, virtualOnly bool) error {
+	if t.generatedExprs == nil {
+		return nil
+	}
+	if t.generatedErr != nil {
+		return errors.Trace(t.generatedErr)
+	}
+	m := make(map[interface{}]interface{}, len(t.Columns))
+	for _, c := range t.Columns {
+		m[c.Name.L] = r[c.Offset]
+	}
+	for _, c := range t.Columns {
+		expr := t.generatedExprs[c.Offset]
+		if expr == nil || (virtualOnly && !isVirtual(c)) {
+			continue
+		}
+		v, err := expr.Eval(ctx, m)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if v, err = types.Convert(v, &c.FieldType); err != nil {
+			return errors.Trace(err)
+		}
+		if !virtualOnly {
+			if err = c.CheckNotNull(v); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		r[c.Offset] = v
+		m[c.Name.L] = v
+		if touched != nil {
+			touched[c.Offset] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tables
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/model"
+	"github.com/pingcap/tidb/table"
+	"github.com/pingcap/tidb/util/types"
+)
+
+// A partitioned table stores no rows itself. Every partition is a Table with
+// the ID of its model.PartitionDefinition, it stores the rows which belong to
+// it and their local indices under its own key prefixes. The handles of the rows
+// are allocated by the partitioned table, so they are unique in all partitions.
+
+// initPartitions creates the partitions of t described by pi, the partitioning
+// expression is parsed by parse.
+func (t *Table) initPartitions(pi *model.PartitionInfo, parse table.ExprParser) {
+	t.partitionInfo = pi
+	if parse == nil {
+		t.partitionErr = errors.New("no parser for the partitioning expression")
+	} else {
+		t.partitionExpr, t.partitionErr = parse(pi.Expr)
+	}
+	for _, def := range pi.Definitions {
+		p := NewTable(def.ID, t.Name.O, "", t.Columns, t.alloc)
+		p.rowFormat = t.rowFormat
+		p.pkHandle = t.pkHandle
+		p.generatedExprs = t.generatedExprs
+		p.generatedErr = t.generatedErr
+		p.parent = t
+		for _, idx := range t.indices {
+			p.AddIndex(&column.IndexedCol{
+				IndexInfo: idx.IndexInfo,
+				X:         kv.NewKVIndex(p.indexPrefix, idx.Name.L, idx.Unique),
+			})
+		}
+		t.partitions = append(t.partitions, p)
+	}
+}
+
+// Partitions implements table.Table Partitions interface.
+func (t *Table) Partitions() []table.Table {
+	if t.partitions == nil {
+		return nil
+	}
+	ps := make([]table.Table, 0, len(t.partitions))
+	for _, p := range t.partitions {
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// LocatePartition implements table.Table LocatePartition interface.
+func (t *Table) LocatePartition(ctx context.Context, r []interface{}) (table.Table, error) {
+	p, err := t.partitionOf(ctx, r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return p, nil
+}
+
+// partitionOf returns the partition the row r belongs to, a partition
+// locates the row in its partitioned table.
+func (t *Table) partitionOf(ctx context.Context, r []interface{}) (*Table, error) {
+	if t.parent != nil {
+		return t.parent.partitionOf(ctx, r)
+	}
+	if t.partitions == nil {
+		return t, nil
+	}
+	if t.partitionErr != nil {
+		return nil, errors.Trace(t.partitionErr)
+	}
+	m := make(map[interface{}]interface{}, len(t.Columns))
+	for _, col := range t.Columns {
+		m[col.Name.L] = r[col.Offset]
+	}
+	v, err := t.partitionExpr.Eval(ctx, m)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if v == nil {
+		// NULL is less than any value for RANGE partitioning, and it is 0 for HASH partitioning.
+		return t.partitions[0], nil
+	}
+	n, err := types.ToInt64(v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	i := t.partitionInfo.Locate(n)
+	if i < 0 {
+		return nil, errors.Errorf("Table has no partition for value %d", n)
+	}
+	return t.partitions[i], nil
+}
+
+// findPartition returns the partition which has the row of handle h.
+func (t *Table) findPartition(ctx context.Context, h int64) (*Table, error) {
+	txn, err := t.GetTxn(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, p := range t.partitions {
+		_, err = txn.Get(p.RecordKey(h, nil))
+		if err == nil {
+			return p, nil
+		}
+		if !kv.IsErrNotFound(err) {
+			return nil, errors.Trace(err)
+		}
+	}
+	return nil, errors.Trace(kv.ErrNotExist)
+}
+
+// partitionRowsWithCols returns the rows of handles that contain the given cols
+// from the partitions of t. The partitions of the handles are found in one batch,
+// then the rows of every partition are read in one batch.
+func (t *Table) partitionRowsWithCols(ctx context.Context, handles []int64, cols []*column.Col) ([][]interface{}, error) {
+	txn, err := t.GetTxn(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	keys := make([][]byte, 0, len(handles)*len(t.partitions))
+	for _, h := range handles {
+		for _, p := range t.partitions {
+			keys = append(keys, p.RecordKey(h, nil))
+		}
+	}
+	values, err := txn.BatchGet(keys)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// offsets are the offsets in handles of the handles of every partition.
+	offsets := make([][]int, len(t.partitions))
+	for i, h := range handles {
+		found := false
+		for j, p := range t.partitions {
+			if _, ok := values[string(p.RecordKey(h, nil))]; ok {
+				offsets[j] = append(offsets[j], i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Trace(kv.ErrNotExist)
+		}
+	}
+	rows := make([][]interface{}, len(handles))
+	for j, p := range t.partitions {
+		if len(offsets[j]) == 0 {
+			continue
+		}
+		hs := make([]int64, 0, len(offsets[j]))
+		for _, i := range offsets[j] {
+			hs = append(hs, handles[i])
+		}
+		prows, err := p.rowsWithCols(ctx, hs, cols)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for k, i := range offsets[j] {
+			rows[i] = prows[k]
+		}
+	}
+	return rows, nil
+}
+
+// partitionIndex returns the local index of the partition t for the index idx
+// of its partitioned table.
+func (t *Table) partitionIndex(idx *column.IndexedCol) *column.IndexedCol {
+	for _, v := range t.indices {
+		if v.Name.L == idx.Name.L {
+			return v
+		}
+	}
+	return nil
+}
+
+// updatePartitionRecord updates the row of handle h in its partition, the row is
+// moved to another partition if the value of the partitioning expression changes.
+func (t *Table) updatePartitionRecord(ctx context.Context, h int64, currData []interface{}, newData []interface{}, touched []bool) error {
+	src, err := t.partitionOf(ctx, currData)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	dst, err := t.partitionOf(ctx, newData)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if src == dst {
+		return src.updateRecord(ctx, h, currData, newData, touched)
+	}
+	newH := h
+	if t.pkHandle != nil {
+		if newH, err = types.ToInt64(newData[t.pkHandle.Offset]); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	txn, err := t.GetTxn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = dst.checkHandleNotExists(txn, newH); err != nil {
+		return errors.Trace(err)
+	}
+	if err = src.RemoveRowAllIndex(ctx, h, currData); err != nil {
+		return errors.Trace(err)
+	}
+	if err = src.RemoveRow(ctx, h); err != nil {
+		return errors.Trace(err)
+	}
+	_, err = dst.addRecord(txn, newH, newData)
+	return errors.Trace(err)
+}
+
+// iterPartitionRecords iterates the records of the partitions, from the
+// partition which startKey is in.
+func (t *Table) iterPartitionRecords(ctx context.Context, startKey string, cols []*column.Col, fn table.RecordIterFunc) error {
+	more := true
+	f := func(h int64, rec []interface{}, cols []*column.Col) (bool, error) {
+		var err error
+		more, err = fn(h, rec, cols)
+		return more, err
+	}
+	started := startKey == t.FirstKey()
+	for _, p := range t.partitions {
+		start := p.FirstKey()
+		if !started {
+			if !strings.HasPrefix(startKey, p.KeyPrefix()) {
+				continue
+			}
+			started = true
+			start = startKey
+		}
+		if err := p.IterRecords(ctx, start, cols, f); err != nil {
+			return errors.Trace(err)
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2013 The ql Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSES/QL-LICENSE file.
+
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tables
+
+import (
+	"github.com/juju/errors"
+	"github.com/pingcap/tidb/column"
+	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/sessionctx/variable"
+)
+
+// A row in model.RowFormatColumns is stored as:
+//
+//	RecordKey(h, nil) -> the string of the transaction which writes it last
+//	RecordKey(h, col) -> EncodeValue(value)
+//
+// A row in model.RowFormatCompact is stored in one key:
+//
+//	RecordKey(h, nil) -> rowHeader, rowVersion, kv.EncodeValue(col1.ID, value1, col2.ID, value2...)
+//
+// The format of a row is told by the value of its row key, so the rows of both
+// formats can be read from any table.
+const (
+	// rowHeader never starts the transaction string of a row in the columns format.
+	rowHeader byte = 0xFE
+	// rowVersion is the version of the compact row payload.
+	rowVersion byte = 1
+)
+
+// IsCompactRow returns true if data is the value of a row key in the compact format.
+func IsCompactRow(data []byte) bool {
+	return len(data) >= 2 && data[0] == rowHeader
+}
+
+// encodeRow encodes the values of the columns of t to a compact row.
+func (t *Table) encodeRow(r []interface{}) ([]byte, error) {
+	vals := make([]interface{}, 0, 2*len(t.Columns))
+	for _, c := range t.storedCols() {
+		v, err := t.flatten(r[c.Offset])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		vals = append(vals, c.ID, v)
+	}
+	data, err := kv.EncodeValue(vals...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return append([]byte{rowHeader, rowVersion}, data...), nil
+}
+
+// DecodeRow decodes the values of cols from a compact row, the values are aligned
+// with t.Cols(). The columns added after the row is written are nil.
+func (t *Table) DecodeRow(data []byte, cols []*column.Col) ([]interface{}, error) {
+	if !IsCompactRow(data) {
+		return nil, errors.New("invalid compact row")
+	}
+	if data[1] != rowVersion {
+		return nil, errors.Errorf("unsupported compact row version %d", data[1])
+	}
+	vals, err := kv.DecodeValue(data[2:])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(vals)%2 != 0 {
+		return nil, errors.New("invalid compact row")
+	}
+	m := make(map[int64]interface{}, len(vals)/2)
+	for i := 0; i < len(vals); i += 2 {
+		id, ok := vals[i].(int64)
+		if !ok {
+			return nil, errors.Errorf("invalid column id %v in compact row", vals[i])
+		}
+		m[id] = vals[i+1]
+	}
+
+	v := make([]interface{}, len(t.Cols()))
+	for _, c := range cols {
+		if v[c.Offset], err = t.unflatten(m[c.ID], c); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return v, nil
+}
+
+// columnKeys returns the keys of cols of the row in the columns format.
+func (t *Table) columnKeys(h int64, cols []*column.Col) [][]byte {
+	keys := make([][]byte, 0, len(cols))
+	for _, c := range cols {
+		keys = append(keys, t.RecordKey(h, c))
+	}
+	return keys
+}
+
+// removeColumns removes the column keys of the row in the columns format.
+func (t *Table) removeColumns(txn kv.Transaction, h int64) error {
+	for _, k := range t.columnKeys(h, t.storedCols()) {
+		if err := txn.Delete(k); err != nil && !kv.IsErrNotFound(err) {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// RowFormat returns the format the rows of t are written in.
+func (t *Table) RowFormat() int {
+	return t.rowFormat
+}
+
+// defaultRewriteBatch is the number of the rows rewritten in a transaction by
+// RewriteRows if the entries of a transaction are not limited.
+const defaultRewriteBatch = 1024
+
+// RewriteRows rewrites the rows of t in the format of t. The rows are rewritten
+// in batches, the transaction of ctx is committed before every batch, so the
+// entries of a transaction don't exceed tidb_txn_entry_limit. The rows of both
+// formats can be read, so the rows left unchanged by an error are still valid.
+func (t *Table) RewriteRows(ctx context.Context) error {
+	if t.partitions != nil {
+		for _, p := range t.partitions {
+			if err := p.RewriteRows(ctx); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	}
+	batch := defaultRewriteBatch
+	if entries, _ := variable.GetTxnLimits(ctx); entries > 0 {
+		// A row in the columns format is rewritten by deleting its column keys
+		// and setting its row key, or the other way round.
+		batch = entries / (len(t.storedCols()) + 2)
+		if batch == 0 {
+			batch = 1
+		}
+	}
+	startKey := t.FirstKey()
+	for startKey != "" {
+		if _, err := ctx.GetTxn(true); err != nil {
+			return errors.Trace(err)
+		}
+		n := 0
+		next := ""
+		err := t.IterRecords(ctx, startKey, t.Cols(), func(h int64, data []interface{}, cols []*column.Col) (bool, error) {
+			if n == batch {
+				next = string(t.RecordKey(h, nil))
+				return false, nil
+			}
+			n++
+			return true, errors.Trace(t.setNewData(ctx, h, data))
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		startKey = next
+	}
+	return nil
+}
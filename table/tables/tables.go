@@ -19,6 +19,7 @@ package tables
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 	"time"
@@ -27,15 +28,18 @@ import (
 	"github.com/ngaut/log"
 	"github.com/pingcap/tidb/column"
 	"github.com/pingcap/tidb/context"
+	"github.com/pingcap/tidb/expression"
 	"github.com/pingcap/tidb/expression/expressions"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/meta/autoid"
 	"github.com/pingcap/tidb/model"
 	mysql "github.com/pingcap/tidb/mysqldef"
+	"github.com/pingcap/tidb/sessionctx/temptable"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/table"
 	"github.com/pingcap/tidb/util"
 	"github.com/pingcap/tidb/util/errors2"
+	"github.com/pingcap/tidb/util/types"
 )
 
 // Table implements table.Table interface.
@@ -48,16 +52,43 @@ type Table struct {
 	recordPrefix string
 	indexPrefix  string
 	alloc        autoid.Allocator
-}
-
-// TableFromMeta creates a Table instance from model.TableInfo.
-func TableFromMeta(dbname string, alloc autoid.Allocator, tblInfo *model.TableInfo) table.Table {
+	rowFormat    int
+	// pkHandle is the primary key column whose values are the row handles.
+	pkHandle *column.Col
+
+	// partitions store the rows of a partitioned table.
+	partitions    []*Table
+	partitionInfo *model.PartitionInfo
+	partitionExpr expression.Expression
+	// partitionErr is the error parsing partitionExpr.
+	partitionErr error
+	// parent is the partitioned table of a partition.
+	parent *Table
+	// temporary is true if the table is stored in the temporary store of the session.
+	temporary bool
+
+	// generatedExprs are the expressions of the generated columns by offset,
+	// nil if the table has no generated column.
+	generatedExprs []expression.Expression
+	// generatedErr is the error parsing generatedExprs.
+	generatedErr error
+}
+
+// TableFromMeta creates a Table instance from model.TableInfo, the partitioning
+// expression and the expressions of the generated columns are parsed by parse.
+func TableFromMeta(dbname string, alloc autoid.Allocator, tblInfo *model.TableInfo, parse table.ExprParser) table.Table {
 	t := NewTable(tblInfo.ID, tblInfo.Name.O, dbname, nil, alloc)
+	t.rowFormat = tblInfo.RowFormat
+	t.temporary = tblInfo.Temporary
 
 	for _, colInfo := range tblInfo.Columns {
 		c := column.Col{ColumnInfo: *colInfo}
 		t.Columns = append(t.Columns, &c)
+		if tblInfo.PKIsHandle && mysql.HasPriKeyFlag(c.Flag) {
+			t.pkHandle = &c
+		}
 	}
+	t.initGenerated(parse)
 
 	for _, idxInfo := range tblInfo.Indices {
 		idx := &column.IndexedCol{
@@ -67,6 +98,9 @@ func TableFromMeta(dbname string, alloc autoid.Allocator, tblInfo *model.TableIn
 		t.AddIndex(idx)
 	}
 
+	if tblInfo.Partition != nil {
+		t.initPartitions(tblInfo.Partition, parse)
+	}
 	return t
 }
 
@@ -107,8 +141,12 @@ func (t *Table) TableName() model.CIStr {
 // Meta implements table.Table Meta interface.
 func (t *Table) Meta() *model.TableInfo {
 	ti := &model.TableInfo{
-		Name: t.Name,
-		ID:   t.ID,
+		Name:       t.Name,
+		ID:         t.ID,
+		RowFormat:  t.rowFormat,
+		PKIsHandle: t.pkHandle != nil,
+		Partition:  t.partitionInfo,
+		Temporary:  t.temporary,
 	}
 	// load table meta
 	for _, col := range t.Columns {
@@ -123,6 +161,19 @@ func (t *Table) Meta() *model.TableInfo {
 	return ti
 }
 
+// GetTxn implements table.Table GetTxn interface.
+func (t *Table) GetTxn(ctx context.Context) (kv.Transaction, error) {
+	if t.temporary {
+		return temptable.GetTxn(ctx)
+	}
+	return ctx.GetTxn(false)
+}
+
+// PKHandleCol implements table.Table PKHandleCol interface.
+func (t *Table) PKHandleCol() *column.Col {
+	return t.pkHandle
+}
+
 // Cols implements table.Table Cols interface.
 func (t *Table) Cols() []*column.Col {
 	return t.Columns
@@ -192,7 +243,8 @@ func (t *Table) RecordKey(h int64, col *column.Col) []byte {
 
 // FirstKey implements table.Table FirstKey interface.
 func (t *Table) FirstKey() string {
-	return string(t.RecordKey(0, nil))
+	// The handles of the primary keys may be negative.
+	return string(t.RecordKey(math.MinInt64, nil))
 }
 
 // FindIndexByColName implements table.Table FindIndexByColName interface.
@@ -208,11 +260,21 @@ func (t *Table) FindIndexByColName(name string) *column.IndexedCol {
 
 // Truncate implements table.Table Truncate interface.
 func (t *Table) Truncate(ctx context.Context) (err error) {
-	err = util.DelKeyWithPrefix(ctx, t.KeyPrefix())
+	for _, p := range t.partitions {
+		if err = p.Truncate(ctx); err != nil {
+			return
+		}
+	}
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
-		return
+		return errors.Trace(err)
+	}
+	for _, prefix := range []string{t.KeyPrefix(), t.IndexPrefix()} {
+		if err = kv.DeleteRange(txn, []byte(prefix), kv.PrefixNext([]byte(prefix))); err != nil {
+			return errors.Trace(err)
+		}
 	}
-	return util.DelKeyWithPrefix(ctx, t.IndexPrefix())
+	return nil
 }
 
 // UpdateRecord implements table.Table UpdateRecord interface.
@@ -223,6 +285,26 @@ func (t *Table) UpdateRecord(ctx context.Context, h int64, currData []interface{
 	if err != nil {
 		return err
 	}
+	if err = t.evalGenerated(ctx, newData, touched, false); err != nil {
+		return errors.Trace(err)
+	}
+	if t.partitions != nil || t.parent != nil {
+		return t.updatePartitionRecord(ctx, h, currData, newData, touched)
+	}
+	return t.updateRecord(ctx, h, currData, newData, touched)
+}
+
+// updateRecord updates the row of handle h in the table which stores it.
+func (t *Table) updateRecord(ctx context.Context, h int64, currData []interface{}, newData []interface{}, touched []bool) error {
+	if t.pkHandle != nil && touched[t.pkHandle.Offset] {
+		newH, err := types.ToInt64(newData[t.pkHandle.Offset])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if newH != h {
+			return t.moveRecord(ctx, h, newH, currData, newData)
+		}
+	}
 
 	// set new value
 	if err := t.setNewData(ctx, h, newData); err != nil {
@@ -252,11 +334,35 @@ func (t *Table) setOnUpdateData(ctx context.Context, touched []bool, data []inte
 }
 
 func (t *Table) setNewData(ctx context.Context, h int64, data []interface{}) error {
-	txn, err := ctx.GetTxn(false)
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return err
 	}
-	for _, col := range t.Cols() {
+	// The row is rewritten in the format of the table.
+	rk := t.RecordKey(h, nil)
+	old, err := txn.Get(rk)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if t.rowFormat == model.RowFormatCompact {
+		row, err := t.encodeRow(data)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = txn.Set(rk, row); err != nil {
+			return errors.Trace(err)
+		}
+		if IsCompactRow(old) {
+			return nil
+		}
+		return errors.Trace(t.removeColumns(txn, h))
+	}
+	if IsCompactRow(old) {
+		if err = txn.Set(rk, []byte(txn.String())); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, col := range t.storedCols() {
 		// set new value
 		// If column untouched, we do not need to do this
 		k := t.RecordKey(h, col)
@@ -304,11 +410,57 @@ func (t *Table) rebuildIndices(ctx context.Context, h int64, touched []bool, old
 	return nil
 }
 
+// moveRecord moves the row of handle h to newH when its primary key, which is
+// the handle, is updated.
+func (t *Table) moveRecord(ctx context.Context, h, newH int64, oldData, newData []interface{}) error {
+	txn, err := t.GetTxn(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = t.checkHandleNotExists(txn, newH); err != nil {
+		return errors.Trace(err)
+	}
+	if err = t.RemoveRowAllIndex(ctx, h, oldData); err != nil {
+		return errors.Trace(err)
+	}
+	if err = t.RemoveRow(ctx, h); err != nil {
+		return errors.Trace(err)
+	}
+	_, err = t.addRecord(txn, newH, newData)
+	return errors.Trace(err)
+}
+
+// checkHandleNotExists returns kv.ErrKeyExists if there is a row of handle h,
+// the row key works as the unique index of the primary key which is the handle.
+func (t *Table) checkHandleNotExists(txn kv.Transaction, h int64) error {
+	_, err := txn.Get(t.RecordKey(h, nil))
+	if err == nil {
+		return errors.Trace(kv.ErrKeyExists)
+	}
+	if kv.IsErrNotFound(err) {
+		return nil
+	}
+	return errors.Trace(err)
+}
+
 // AddRecord implements table.Table AddRecord interface.
 func (t *Table) AddRecord(ctx context.Context, r []interface{}) (recordID int64, err error) {
+	if t.parent != nil {
+		// The handles are allocated by the partitioned table.
+		return t.parent.AddRecord(ctx, r)
+	}
+	if err = t.evalGenerated(ctx, r, nil, false); err != nil {
+		return 0, errors.Trace(err)
+	}
 	id := variable.GetSessionVars(ctx).LastInsertID
-	// Already have auto increment ID
-	if id != 0 {
+	if t.pkHandle != nil {
+		// The primary key is the handle.
+		recordID, err = types.ToInt64(r[t.pkHandle.Offset])
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+	} else if id != 0 {
+		// Already have auto increment ID
 		recordID = int64(id)
 	} else {
 		recordID, err = t.alloc.Alloc(t.ID)
@@ -316,10 +468,30 @@ func (t *Table) AddRecord(ctx context.Context, r []interface{}) (recordID int64,
 			return 0, err
 		}
 	}
-	txn, err := ctx.GetTxn(false)
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return 0, err
 	}
+	dst, err := t.partitionOf(ctx, r)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if t.pkHandle != nil {
+		if err = dst.checkHandleNotExists(txn, recordID); err != nil {
+			return recordID, errors.Trace(err)
+		}
+	}
+	if recordID, err = dst.addRecord(txn, recordID, r); err != nil {
+		return recordID, errors.Trace(err)
+	}
+	variable.GetSessionVars(ctx).AddAffectedRows(1)
+	return recordID, nil
+}
+
+// addRecord writes the indices and the row of handle recordID, it returns the
+// handle of the duplicate row if a unique index exists.
+func (t *Table) addRecord(txn kv.Transaction, recordID int64, r []interface{}) (int64, error) {
+	var err error
 	for _, v := range t.indices {
 		if v == nil {
 			continue
@@ -343,16 +515,27 @@ func (t *Table) AddRecord(ctx context.Context, r []interface{}) (recordID int64,
 		}
 	}
 
+	k := t.RecordKey(recordID, nil)
+	if t.rowFormat == model.RowFormatCompact {
+		// all the columns in one kv pair
+		row, err := t.encodeRow(r)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if err = txn.Set(k, row); err != nil {
+			return 0, errors.Trace(err)
+		}
+		return recordID, nil
+	}
 	// split a record into multiple kv pair
 	// first key -> LOCK
-	k := t.RecordKey(recordID, nil)
 	// A new row with current txn-id as lockKey
 	err = txn.Set([]byte(k), []byte(txn.String()))
 	if err != nil {
 		return 0, err
 	}
 	// column key -> column value
-	for _, c := range t.Cols() {
+	for _, c := range t.storedCols() {
 		colKey := t.RecordKey(recordID, c)
 		data, err := t.EncodeValue(r[c.Offset])
 		if err != nil {
@@ -363,7 +546,6 @@ func (t *Table) AddRecord(ctx context.Context, r []interface{}) (recordID int64,
 			return 0, err
 		}
 	}
-	variable.GetSessionVars(ctx).AddAffectedRows(1)
 	return recordID, nil
 }
 
@@ -388,26 +570,105 @@ func (t *Table) DecodeValue(data []byte, col *column.Col) (interface{}, error) {
 
 // RowWithCols implements table.Table RowWithCols interface.
 func (t *Table) RowWithCols(ctx context.Context, h int64, cols []*column.Col) ([]interface{}, error) {
-	txn, err := ctx.GetTxn(false)
+	rows, err := t.rowsWithCols(ctx, []int64{h}, cols)
 	if err != nil {
-		return nil, err
+		return nil, errors.Trace(err)
 	}
-	// use the length of t.Cols() for alignment
-	v := make([]interface{}, len(t.Cols()))
-	for _, c := range cols {
-		k := t.RecordKey(h, c)
-		data, err := txn.Get([]byte(k))
-		if err != nil {
+	return rows[0], nil
+}
+
+// rowsWithCols returns the rows of handles that contain the given cols.
+func (t *Table) rowsWithCols(ctx context.Context, handles []int64, cols []*column.Col) ([][]interface{}, error) {
+	if t.partitions != nil {
+		rows, err := t.partitionRowsWithCols(ctx, handles, cols)
+		return rows, errors.Trace(err)
+	}
+	if !hasVirtual(cols) {
+		return t.storedRowsWithCols(ctx, handles, cols)
+	}
+	// The VIRTUAL generated columns are computed from all the stored columns.
+	rows, err := t.storedRowsWithCols(ctx, handles, t.storedCols())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, v := range rows {
+		if err = t.evalGenerated(ctx, v, nil, true); err != nil {
 			return nil, errors.Trace(err)
 		}
+	}
+	return rows, nil
+}
 
-		val, err := t.DecodeValue(data, c)
-		if err != nil {
-			return nil, errors.Trace(err)
+// storedRowsWithCols returns the rows of handles that contain the given cols,
+// whose values are stored. The rows are read in one batch.
+func (t *Table) storedRowsWithCols(ctx context.Context, handles []int64, cols []*column.Col) ([][]interface{}, error) {
+	txn, err := t.GetTxn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, 0, len(handles))
+	for _, h := range handles {
+		keys = append(keys, t.RecordKey(h, nil))
+		if t.rowFormat == model.RowFormatColumns {
+			// The column keys are read with the row key in one batch.
+			keys = append(keys, t.columnKeys(h, cols)...)
+		}
+	}
+	values, err := txn.BatchGet(keys)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if t.rowFormat != model.RowFormatColumns {
+		// The rows in the columns format which are not rewritten in the compact format.
+		var colKeys [][]byte
+		for _, h := range handles {
+			if row, ok := values[string(t.RecordKey(h, nil))]; ok && !IsCompactRow(row) {
+				colKeys = append(colKeys, t.columnKeys(h, cols)...)
+			}
+		}
+		if len(colKeys) > 0 {
+			more, err1 := txn.BatchGet(colKeys)
+			if err1 != nil {
+				return nil, errors.Trace(err1)
+			}
+			for k, v := range more {
+				values[k] = v
+			}
+		}
+	}
+
+	rows := make([][]interface{}, 0, len(handles))
+	for _, h := range handles {
+		row, ok := values[string(t.RecordKey(h, nil))]
+		if !ok {
+			return nil, errors.Trace(kv.ErrNotExist)
+		}
+		if IsCompactRow(row) {
+			v, err1 := t.DecodeRow(row, cols)
+			if err1 != nil {
+				return nil, errors.Trace(err1)
+			}
+			rows = append(rows, v)
+			continue
+		}
+
+		// use the length of t.Cols() for alignment
+		v := make([]interface{}, len(t.Cols()))
+		for _, c := range cols {
+			data, ok := values[string(t.RecordKey(h, c))]
+			if !ok {
+				return nil, errors.Trace(kv.ErrNotExist)
+			}
+
+			val, err1 := t.DecodeValue(data, c)
+			if err1 != nil {
+				return nil, errors.Trace(err1)
+			}
+			v[c.Offset] = val
 		}
-		v[c.Offset] = val
+		rows = append(rows, v)
 	}
-	return v, nil
+	return rows, nil
 }
 
 // Row implements table.Table Row interface.
@@ -421,9 +682,22 @@ func (t *Table) Row(ctx context.Context, h int64) ([]interface{}, error) {
 	return r, nil
 }
 
+// Rows implements table.Table Rows interface.
+func (t *Table) Rows(ctx context.Context, handles []int64) ([][]interface{}, error) {
+	rows, err := t.rowsWithCols(ctx, handles, t.Cols())
+	return rows, errors.Trace(err)
+}
+
 // LockRow implements table.Table LockRow interface.
 func (t *Table) LockRow(ctx context.Context, h int64, update bool) error {
-	txn, err := ctx.GetTxn(false)
+	if t.partitions != nil {
+		p, err := t.findPartition(ctx, h)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return p.LockRow(ctx, h, update)
+	}
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -436,30 +710,52 @@ func (t *Table) LockRow(ctx context.Context, h int64, update bool) error {
 	if !update {
 		return nil
 	}
-	// set row lock key to current txn
-	err = txn.Set([]byte(lockKey), []byte(txn.String()))
+	// set row lock key to current txn, a compact row is set to itself.
+	v := []byte(txn.String())
+	row, err := txn.Get(lockKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if IsCompactRow(row) {
+		v = row
+	}
+	err = txn.Set(lockKey, v)
 	return errors.Trace(err)
 }
 
 // RemoveRow implements table.Table RemoveRow interface.
 func (t *Table) RemoveRow(ctx context.Context, h int64) error {
+	if t.partitions != nil {
+		p, err := t.findPartition(ctx, h)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return p.RemoveRow(ctx, h)
+	}
 	if err := t.LockRow(ctx, h, false); err != nil {
 		return errors.Trace(err)
 	}
-	txn, err := ctx.GetTxn(false)
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	// Remove row's colume one by one
-	for _, col := range t.Cols() {
-		k := t.RecordKey(h, col)
-		err := txn.Delete([]byte(k))
-		if err != nil {
-			return errors.Trace(err)
+	rk := t.RecordKey(h, nil)
+	row, err := txn.Get(rk)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !IsCompactRow(row) {
+		// Remove row's colume one by one
+		for _, col := range t.storedCols() {
+			k := t.RecordKey(h, col)
+			err := txn.Delete([]byte(k))
+			if err != nil {
+				return errors.Trace(err)
+			}
 		}
 	}
-	// Remove row lock
-	err = txn.Delete([]byte(t.RecordKey(h, nil)))
+	// Remove row lock, or the compact row
+	err = txn.Delete(rk)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -468,7 +764,14 @@ func (t *Table) RemoveRow(ctx context.Context, h int64) error {
 
 // RemoveRowIndex implements table.Table RemoveRowIndex interface.
 func (t *Table) RemoveRowIndex(ctx context.Context, h int64, vals []interface{}, idx *column.IndexedCol) error {
-	txn, err := ctx.GetTxn(false)
+	if t.partitions != nil {
+		p, err := t.findPartition(ctx, h)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return p.RemoveRowIndex(ctx, h, vals, p.partitionIndex(idx))
+	}
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return err
 	}
@@ -480,13 +783,20 @@ func (t *Table) RemoveRowIndex(ctx context.Context, h int64, vals []interface{},
 
 // RemoveRowAllIndex implements table.Table RemoveRowAllIndex interface.
 func (t *Table) RemoveRowAllIndex(ctx context.Context, h int64, rec []interface{}) error {
+	if t.partitions != nil {
+		p, err := t.partitionOf(ctx, rec)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return p.RemoveRowAllIndex(ctx, h, rec)
+	}
 	for _, v := range t.indices {
 		vals, err := v.FetchValues(rec)
 		if vals == nil {
 			// TODO: check this
 			continue
 		}
-		txn, err := ctx.GetTxn(false)
+		txn, err := t.GetTxn(ctx)
 		if err != nil {
 			return err
 		}
@@ -499,7 +809,14 @@ func (t *Table) RemoveRowAllIndex(ctx context.Context, h int64, rec []interface{
 
 // BuildIndexForRow implements table.Table BuildIndexForRow interface.
 func (t *Table) BuildIndexForRow(ctx context.Context, h int64, vals []interface{}, idx *column.IndexedCol) error {
-	txn, err := ctx.GetTxn(false)
+	if t.partitions != nil {
+		p, err := t.findPartition(ctx, h)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return p.BuildIndexForRow(ctx, h, vals, p.partitionIndex(idx))
+	}
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return err
 	}
@@ -511,21 +828,24 @@ func (t *Table) BuildIndexForRow(ctx context.Context, h int64, vals []interface{
 
 // IterRecords implements table.Table IterRecords interface.
 func (t *Table) IterRecords(ctx context.Context, startKey string, cols []*column.Col, fn table.RecordIterFunc) error {
-	txn, err := ctx.GetTxn(false)
+	if t.partitions != nil {
+		return t.iterPartitionRecords(ctx, startKey, cols, fn)
+	}
+	txn, err := t.GetTxn(ctx)
 	if err != nil {
 		return err
 	}
 
-	it, err := txn.Seek([]byte(startKey), nil)
+	prefix := t.KeyPrefix()
+	it, err := txn.Scan([]byte(startKey), kv.PrefixNext([]byte(prefix)), 0)
 	if err != nil {
 		return err
 	}
 	defer it.Close()
 
-	log.Debugf("startKey %q, key:%q,value:%q", startKey, it.Key(), it.Value())
+	log.Debugf("startKey %q", startKey)
 
-	prefix := t.KeyPrefix()
-	for it.Valid() && strings.HasPrefix(it.Key(), prefix) {
+	for it.Valid() {
 		// first kv pair is row lock information.
 		// TODO: check valid lock
 		// get row handle
@@ -14,6 +14,8 @@
 package tables_test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	. "github.com/pingcap/check"
@@ -25,6 +27,7 @@ import (
 	"github.com/pingcap/tidb/sessionctx"
 	"github.com/pingcap/tidb/store/localstore"
 	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/table/tables"
 	"github.com/pingcap/tidb/util"
 )
 
@@ -72,7 +75,8 @@ func (ts *testSuite) TestBasic(c *C) {
 
 	rid, err := tb.AddRecord(ctx, []interface{}{1, "abc"})
 	c.Assert(err, IsNil)
-	c.Assert(rid, Greater, int64(0))
+	// The integer primary key is the handle.
+	c.Assert(rid, Equals, int64(1))
 	row, err := tb.Row(ctx, rid)
 	c.Assert(err, IsNil)
 	c.Assert(len(row), Equals, 2)
@@ -92,6 +96,10 @@ func (ts *testSuite) TestBasic(c *C) {
 	c.Assert(tb.RemoveRowAllIndex(ctx, rid, []interface{}{1, "cba"}), IsNil)
 
 	c.Assert(tb.RemoveRow(ctx, rid), IsNil)
+	_, err = tb.Row(ctx, rid)
+	c.Assert(err, NotNil)
+	_, err = tb.AddRecord(ctx, []interface{}{2, "abc"})
+	c.Assert(err, IsNil)
 	// Make sure there is index data in the storage.
 	prefix := tb.IndexPrefix()
 	cnt, err := countEntriesWithPrefix(ctx, prefix)
@@ -177,3 +185,141 @@ func (ts *testSuite) TestUniqueIndexMultipleNullEntries(c *C) {
 	_, err = ts.se.Execute("drop table test.t")
 	c.Assert(err, IsNil)
 }
+
+func (ts *testSuite) TestRowFormat(c *C) {
+	_, err := ts.se.Execute("CREATE TABLE test.t (a int primary key, b varchar(255), c int)")
+	c.Assert(err, IsNil)
+	ctx := ts.se.(context.Context)
+	dom := sessionctx.GetDomain(ctx)
+	tb, err := dom.InfoSchema().TableByName(model.NewCIStr("test"), model.NewCIStr("t"))
+	c.Assert(err, IsNil)
+	c.Assert(tb.Meta().RowFormat, Equals, model.RowFormatCompact)
+
+	_, err = ts.se.Execute("insert test.t values (1, 'a', 1), (2, 'b', 2), (3, 'c', 3)")
+	c.Assert(err, IsNil)
+	// A row in the compact format is stored in one key.
+	cnt, err := countEntriesWithPrefix(ctx, tb.KeyPrefix())
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, 3)
+
+	checkRows := func(expect string) {
+		rs, err1 := ts.se.Execute("select a, b, c from test.t")
+		c.Assert(err1, IsNil)
+		rows, err1 := rs[0].Rows(-1, 0)
+		c.Assert(err1, IsNil)
+		c.Assert(fmt.Sprint(rows), Equals, expect)
+	}
+	checkRows("[[1 a 1] [2 b 2] [3 c 3]]")
+
+	_, err = ts.se.Execute("alter table test.t row_format = redundant")
+	c.Assert(err, IsNil)
+	tb, err = dom.InfoSchema().TableByName(model.NewCIStr("test"), model.NewCIStr("t"))
+	c.Assert(err, IsNil)
+	c.Assert(tb.Meta().RowFormat, Equals, model.RowFormatColumns)
+	// A row in the columns format is stored in a lock key and a key for every column.
+	cnt, err = countEntriesWithPrefix(ctx, tb.KeyPrefix())
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, 12)
+	checkRows("[[1 a 1] [2 b 2] [3 c 3]]")
+
+	_, err = ts.se.Execute("update test.t set b = 'bb' where a = 2")
+	c.Assert(err, IsNil)
+	_, err = ts.se.Execute("delete from test.t where a = 3")
+	c.Assert(err, IsNil)
+	checkRows("[[1 a 1] [2 bb 2]]")
+
+	// Convert a row in the columns format to the compact format by updating it.
+	info := tb.Meta()
+	info.RowFormat = model.RowFormatCompact
+	tb = tables.TableFromMeta("test", nil, info, nil)
+	txn, err := ctx.GetTxn(false)
+	c.Assert(err, IsNil)
+	c.Assert(tb.UpdateRecord(ctx, 1, []interface{}{1, "a", 1}, []interface{}{1, "aa", 1}, []bool{false, true, false}), IsNil)
+	data, err := txn.Get(tb.RecordKey(1, nil))
+	c.Assert(err, IsNil)
+	c.Assert(tables.IsCompactRow(data), IsTrue)
+	// The rows of both formats are read.
+	var handles []int64
+	err = tb.IterRecords(ctx, tb.FirstKey(), tb.Cols(), func(h int64, data []interface{}, cols []*column.Col) (bool, error) {
+		handles = append(handles, h)
+		return true, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(handles, DeepEquals, []int64{1, 2})
+	row, err := tb.Row(ctx, 2)
+	c.Assert(err, IsNil)
+	c.Assert(row[1], Equals, "bb")
+	rows, err := tb.Rows(ctx, []int64{2, 1})
+	c.Assert(err, IsNil)
+	c.Assert(fmt.Sprint(rows), Equals, "[[2 bb 2] [1 aa 1]]")
+	_, err = tb.Rows(ctx, []int64{1, 3})
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	c.Assert(tb.RemoveRow(ctx, 1), IsNil)
+	c.Assert(tb.RemoveRow(ctx, 2), IsNil)
+	cnt, err = countEntriesWithPrefix(ctx, tb.KeyPrefix())
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, 0)
+	c.Assert(ctx.FinishTxn(true), IsNil)
+
+	_, err = ts.se.Execute("alter table test.t row_format = compact")
+	c.Assert(err, IsNil)
+	cnt, err = countEntriesWithPrefix(ctx, tb.KeyPrefix())
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, 2)
+	checkRows("[[1 a 1] [2 bb 2]]")
+
+	_, err = ts.se.Execute("alter table test.t row_format = dynamic")
+	c.Assert(err, NotNil)
+	_, err = ts.se.Execute("drop table test.t")
+	c.Assert(err, IsNil)
+
+	// The new table is in the format of ROW_FORMAT.
+	_, err = ts.se.Execute("create table test.t (a int, b int) row_format = redundant")
+	c.Assert(err, IsNil)
+	tb, err = dom.InfoSchema().TableByName(model.NewCIStr("test"), model.NewCIStr("t"))
+	c.Assert(err, IsNil)
+	c.Assert(tb.Meta().RowFormat, Equals, model.RowFormatColumns)
+	vals := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		vals = append(vals, fmt.Sprintf("(%d, %d)", i, i))
+	}
+	_, err = ts.se.Execute("insert test.t values " + strings.Join(vals, ", "))
+	c.Assert(err, IsNil)
+	cnt, err = countEntriesWithPrefix(ctx, tb.KeyPrefix())
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, 600)
+
+	// The rows are rewritten in the transactions within tidb_txn_entry_limit.
+	_, err = ts.se.Execute("set tidb_txn_entry_limit = 100")
+	c.Assert(err, IsNil)
+	_, err = ts.se.Execute("alter table test.t row_format = compact")
+	c.Assert(err, IsNil)
+	_, err = ts.se.Execute("set tidb_txn_entry_limit = 300000")
+	c.Assert(err, IsNil)
+	cnt, err = countEntriesWithPrefix(ctx, tb.KeyPrefix())
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, 200)
+	_, err = ts.se.Execute("drop table test.t")
+	c.Assert(err, IsNil)
+}
+
+func (ts *testSuite) TestPartitionRows(c *C) {
+	_, err := ts.se.Execute("create table test.tp (a int primary key, b int) partition by hash (a) partitions 3")
+	c.Assert(err, IsNil)
+	_, err = ts.se.Execute("insert test.tp values (1, 1), (2, 2), (3, 3), (4, 4), (-5, 5)")
+	c.Assert(err, IsNil)
+	ctx := ts.se.(context.Context)
+	dom := sessionctx.GetDomain(ctx)
+	tb, err := dom.InfoSchema().TableByName(model.NewCIStr("test"), model.NewCIStr("tp"))
+	c.Assert(err, IsNil)
+
+	// The rows in several partitions come in the order of their handles.
+	rows, err := tb.Rows(ctx, []int64{4, 3, -5, 2, 1})
+	c.Assert(err, IsNil)
+	c.Assert(fmt.Sprint(rows), Equals, "[[4 4] [3 3] [-5 5] [2 2] [1 1]]")
+	_, err = tb.Rows(ctx, []int64{1, 6})
+	c.Assert(kv.IsErrNotFound(err), IsTrue)
+	c.Assert(ctx.FinishTxn(true), IsNil)
+	_, err = ts.se.Execute("drop table test.tp")
+	c.Assert(err, IsNil)
+}
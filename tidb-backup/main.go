@@ -0,0 +1,79 @@
+// Copyright 2015 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/tidb"
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	store     = flag.String("store", "goleveldb", "registered store name, [memory, goleveldb, boltdb, memkv, region, remote]")
+	storePath = flag.String("path", "/tmp/tidb", "tidb storage path")
+	logLevel  = flag.String("L", "info", "log level: info, debug, warn, error, fatal")
+	backupTo  = flag.String("backup", "", "back up the store to the archive file")
+	restore   = flag.String("restore", "", "restore the archive file to the empty store")
+)
+
+func main() {
+	flag.Parse()
+
+	log.SetLevelByString(*logLevel)
+	if (*backupTo == "") == (*restore == "") {
+		fmt.Fprintln(os.Stderr, "one of -backup and -restore must be set")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store, err := tidb.NewStore(fmt.Sprintf("%s://%s", *store, *storePath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	if *backupTo != "" {
+		err = backupStore(store)
+	} else {
+		err = restoreStore(store)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func backupStore(store kv.Storage) error {
+	f, err := os.Create(*backupTo)
+	if err != nil {
+		return err
+	}
+	if err = tidb.Backup(store, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func restoreStore(store kv.Storage) error {
+	f, err := os.Open(*restore)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tidb.Restore(store, f)
+}
@@ -19,6 +19,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 
 	"github.com/ngaut/log"
@@ -29,9 +30,11 @@ import (
 
 var (
 	store     = flag.String("store", "goleveldb", "registered store name, [memory, goleveldb, boltdb]")
-	storePath = flag.String("path", "/tmp/tidb", "tidb storage path")
+	storePath = flag.String("path", "/tmp/tidb", "tidb storage path, the options can be appended like /tmp/tidb?sync=true")
 	logLevel  = flag.String("L", "debug", "log level: info, debug, warn, error, fatal")
 	port      = flag.String("P", "4000", "mp server port")
+	readOnly  = flag.Bool("read-only", false, "open the storage in read-only mode, it must be bootstrapped and not opened by another process")
+	encrypted = flag.Bool("encrypt", false, "encrypt the local storage with the master keys in the keyfile option of the path, like /tmp/tidb?keyfile=/path/to/keyfile")
 )
 
 func main() {
@@ -48,7 +51,19 @@ func main() {
 	}
 
 	log.SetLevelByString(cfg.LogLevel)
-	store, err := tidb.NewStore(fmt.Sprintf("%s://%s", *store, *storePath))
+	path := *storePath
+	if *readOnly {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		path += sep + "read_only=true"
+	}
+	name := *store
+	if *encrypted {
+		name = tidb.EngineEncrypted + name
+	}
+	store, err := tidb.NewStore(fmt.Sprintf("%s://%s", name, path))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -338,7 +338,7 @@ func (cc *clientConn) writeOK() error {
 func (cc *clientConn) writeError(e error) error {
 	var m *mysql.SQLError
 	var ok bool
-	if m, ok = e.(*mysql.SQLError); !ok {
+	if m, ok = errors.Cause(e).(*mysql.SQLError); !ok {
 		m = mysql.NewError(mysql.ErUnknownError, e.Error())
 	}
 
@@ -18,6 +18,7 @@
 package tidb
 
 import (
+	"io"
 	"net/http"
 	// For pprof
 	_ "net/http/pprof"
@@ -37,10 +38,15 @@ import (
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/stmt"
 	"github.com/pingcap/tidb/stmt/stmts"
+	"github.com/pingcap/tidb/store/backup"
 	"github.com/pingcap/tidb/store/localstore"
 	"github.com/pingcap/tidb/store/localstore/boltdb"
+	"github.com/pingcap/tidb/store/localstore/encrypt"
 	"github.com/pingcap/tidb/store/localstore/engine"
 	"github.com/pingcap/tidb/store/localstore/goleveldb"
+	"github.com/pingcap/tidb/store/localstore/memkv"
+	"github.com/pingcap/tidb/store/localstore/region"
+	"github.com/pingcap/tidb/store/remote"
 )
 
 // Engine prefix name
@@ -49,6 +55,14 @@ const (
 	EngineGoLevelDBPersistent = "goleveldb://"
 	EngineHBase               = "zk://"
 	EngineBoltDB              = "boltdb://"
+	EngineMemKV               = "memkv://"
+	EngineRegion              = "region://"
+	EngineRemote              = "remote://"
+	// EngineEncrypted prefixes a local engine to encrypt its data, like
+	// encrypted+goleveldb:///path?keyfile=/path/to/keyfile, see package encrypt.
+	// The encrypted storages of goleveldb, boltdb and memkv are registered,
+	// the others are registered with RegisterEncryptedStore.
+	EngineEncrypted = "encrypted+"
 )
 
 type domainMap struct {
@@ -64,7 +78,7 @@ func (dm *domainMap) Get(store kv.Storage) (d *domain.Domain, err error) {
 	if d != nil {
 		return
 	}
-	d, err = domain.NewDomain(store)
+	d, err = domain.NewDomain(store, parser.ParseExpr)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -218,10 +232,23 @@ func RegisterLocalStore(name string, driver engine.Driver) error {
 	return RegisterStore(name, d)
 }
 
+// RegisterEncryptedStore registers the encrypted storage of the local storage
+// name with the name prefixed by EngineEncrypted.
+func RegisterEncryptedStore(name string) error {
+	d, ok := stores[strings.ToLower(name)].(localstore.Driver)
+	if !ok {
+		return errors.Errorf("%s is not a registered local storage", name)
+	}
+	return RegisterStore(EngineEncrypted+name, localstore.Driver{Driver: encrypt.Driver{Engine: d.Driver}})
+}
+
 // NewStore creates a kv Storage with specific uri.
 // The uri format must be engine://schema, like goleveldb://testpath
 // Engine is the storage name registered with RegisterStore.
 // Schema is the storage specific format.
+// The options of the storage are in the query of the schema, like goleveldb:///path?sync=true&cache_size=64MB.
+// The local storages compress the values with the compression option, like goleveldb:///path?compression=snappy.
+// The unknown options are rejected, see the engine Drivers for their options.
 func NewStore(uri string) (kv.Storage, error) {
 	pos := strings.Index(uri, "://")
 	if pos == -1 {
@@ -241,6 +268,20 @@ func NewStore(uri string) (kv.Storage, error) {
 	return s, errors.Trace(err)
 }
 
+// Backup writes a consistent archive of all the data in store to w,
+// the store can be used while it is backed up.
+func Backup(store kv.Storage, w io.Writer) error {
+	_, err := backup.Backup(store, w)
+	return errors.Trace(err)
+}
+
+// Restore loads the archive written by Backup from r to store, which must be empty.
+// The engine of store can be different from the one backed up.
+func Restore(store kv.Storage, r io.Reader) error {
+	_, err := backup.Restore(store, r)
+	return errors.Trace(err)
+}
+
 var queryStmtTable = []string{"explain", "select", "show", "execute", "describe", "desc"}
 
 // IsQuery checks if a sql statement is a query statement.
@@ -260,6 +301,12 @@ func init() {
 	RegisterLocalStore("memory", goleveldb.MemoryDriver{})
 	RegisterLocalStore("goleveldb", goleveldb.Driver{})
 	RegisterLocalStore("boltdb", boltdb.Driver{})
+	RegisterLocalStore("memkv", memkv.Driver{})
+	RegisterLocalStore("region", region.Driver{Engine: goleveldb.Driver{}})
+	RegisterStore("remote", remote.Driver{})
+	RegisterEncryptedStore("goleveldb")
+	RegisterEncryptedStore("boltdb")
+	RegisterEncryptedStore("memkv")
 
 	// start pprof handlers
 	if Debug {
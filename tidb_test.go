@@ -17,8 +17,11 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -26,13 +29,35 @@ import (
 	"github.com/ngaut/log"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/model"
 	mysql "github.com/pingcap/tidb/mysqldef"
 	"github.com/pingcap/tidb/rset"
+	"github.com/pingcap/tidb/sessionctx/temptable"
 	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/store/faulty"
+	"github.com/pingcap/tidb/store/localstore/memkv"
+	"github.com/pingcap/tidb/store/localstore/raft"
 	"github.com/pingcap/tidb/util/errors2"
 )
 
-var store = flag.String("store", "memory", "registered store name, [memory, goleveldb, boltdb]")
+var store = flag.String("store", "memory", "registered store name, [memory, goleveldb, boltdb, memkv, raft, region]")
+
+// engineFaulty prefixes a storage to inject faults, like faulty+memory://test,
+// the storages are registered so only for the tests.
+const engineFaulty = "faulty+"
+
+func init() {
+	// The replicas of the raft storage are in memory, it is registered so only
+	// for the tests.
+	RegisterLocalStore("raft", raft.Driver{Engine: memkv.Driver{}, Replicas: 3})
+	var names []string
+	for name := range stores {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		RegisterStore(engineFaulty+name, faulty.Driver{Driver: stores[name]})
+	}
+}
 
 func TestT(t *testing.T) {
 	TestingT(t)
@@ -154,6 +179,17 @@ func (s *testMainSuite) TestConcurrent(c *C) {
 	mustExec(c, testDB, dropDBSQL)
 }
 
+func (s *testMainSuite) TestDriverConnClose(c *C) {
+	n := len(processes.ProcessList(nil))
+	testDB, err := sql.Open(DriverName, *store+"://"+s.dbName+"/"+s.dbName)
+	c.Assert(err, IsNil)
+	mustExec(c, testDB, "select 1")
+	c.Assert(processes.ProcessList(nil), HasLen, n+1)
+	// The sessions of the connections are closed.
+	c.Assert(testDB.Close(), IsNil)
+	c.Assert(processes.ProcessList(nil), HasLen, n)
+}
+
 func (s *testMainSuite) TestTableInfoMeta(c *C) {
 	testDB, err := sql.Open(DriverName, *store+"://"+s.dbName+"/"+s.dbName)
 	c.Assert(err, IsNil)
@@ -279,6 +315,48 @@ func (s *testMainSuite) TestDeletePanic(c *C) {
 	c.Assert(rs.Close(), IsNil)
 }
 
+func (s *testMainSuite) TestStoreOptions(c *C) {
+	db, err := sql.Open("tidb", "memory://test_options/test?sync=true&cache_size=16MB")
+	c.Assert(err, IsNil)
+	mustExec(c, db, "create table if not exists t (c int)")
+	mustExec(c, db, "drop table t")
+	db.Close()
+
+	db, err = sql.Open("tidb", "memory://test_options/test?no_such=1")
+	c.Assert(err, IsNil)
+	c.Assert(db.Ping(), NotNil)
+	db.Close()
+
+	_, err = NewStore("memory://test_options?compression=zlib")
+	c.Assert(err, NotNil)
+}
+
+func (s *testMainSuite) TestEncryptedStore(c *C) {
+	keyFile := filepath.Join(os.TempDir(), "tidb_test_keyfile")
+	err := ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 16)+"\n"), 0600)
+	c.Assert(err, IsNil)
+	defer os.Remove(keyFile)
+
+	// The encrypted storages of the built-in persistent engines are registered.
+	store, err := NewStore(EngineEncrypted + "memkv://test_encrypted?keyfile=" + keyFile)
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+	db, err := sql.Open(DriverName, EngineEncrypted+"memkv://test_encrypted/test?keyfile="+keyFile)
+	c.Assert(err, IsNil)
+	c.Assert(db.Ping(), IsNil)
+	c.Assert(db.Close(), IsNil)
+
+	// The others are registered explicitly.
+	uri := EngineEncrypted + "memory://test_encrypted?keyfile=" + keyFile
+	_, err = NewStore(uri)
+	c.Assert(err, NotNil)
+	c.Assert(RegisterEncryptedStore("remote"), NotNil)
+	c.Assert(RegisterEncryptedStore("memory"), IsNil)
+	store, err = NewStore(uri)
+	c.Assert(err, IsNil)
+	c.Assert(store.Close(), IsNil)
+}
+
 // Testcase for arg type.
 func (s *testMainSuite) TestCheckArgs(c *C) {
 	db, err := sql.Open("tidb", "memory://test/test")
@@ -771,6 +849,511 @@ func (s *testSessionSuite) TestSubQuery(c *C) {
 	match(c, rows[1], 2)
 }
 
+func (s *testSessionSuite) TestTxnLimit(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, "create table t (c1 int, c2 int)")
+	mustExecSQL(c, se, "set tidb_txn_entry_limit = 10")
+	mustExecSQL(c, se, "begin")
+	var err error
+	for i := 0; i < 20 && err == nil; i++ {
+		_, err = exec(c, se, "insert t values (?, ?)", i, i)
+	}
+	c.Assert(errors2.ErrorEqual(err, kv.ErrTxnTooLarge), IsTrue)
+	mustExecSQL(c, se, "rollback")
+
+	mustExecSQL(c, se, "set tidb_txn_entry_limit = 0")
+	mustExecSQL(c, se, "set tidb_txn_size_limit = 100")
+	_, err = exec(c, se, "insert t values (1, 1), (2, 2), (3, 3), (4, 4), (5, 5), (6, 6)")
+	c.Assert(errors2.ErrorEqual(err, kv.ErrTxnTooLarge), IsTrue)
+
+	mustExecSQL(c, se, "set tidb_txn_size_limit = 0")
+	mustExecSQL(c, se, "insert t values (1, 1), (2, 2), (3, 3), (4, 4), (5, 5), (6, 6)")
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestShowProcessList(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	se1 := newSession(c, store, s.dbName)
+	se1.SetUsername("u1")
+
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, "create table t (c1 int, c2 int)")
+	mustExecSQL(c, se1, "begin")
+	mustExecSQL(c, se1, "insert t values (1, 1)")
+
+	r := mustExecSQL(c, se, "show full processlist")
+	rows, err := r.Rows(-1, 0)
+	c.Assert(err, IsNil)
+	var found int
+	for _, row := range rows {
+		switch row[0] {
+		case se.(*session).sid:
+			found++
+			match(c, row[1:8], "", "", s.dbName, "Query", 0, "", "show full processlist")
+		case se1.(*session).sid:
+			found++
+			match(c, row[1:8], "u1", "", s.dbName, "Sleep", 0, "", nil)
+			c.Assert(row[8].(int64), Greater, int64(0))
+			c.Assert(row[9].(int64), Greater, int64(0))
+		}
+	}
+	c.Assert(found, Equals, 2)
+
+	mustExecSQL(c, se1, "commit")
+	c.Assert(se1.Close(), IsNil)
+	r = mustExecSQL(c, se, "show processlist")
+	rows, err = r.Rows(-1, 0)
+	c.Assert(err, IsNil)
+	for _, row := range rows {
+		c.Assert(row[0], Not(Equals), se1.(*session).sid)
+	}
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestRetryFaultyCommit(c *C) {
+	store, err := NewStore(engineFaulty + *store + "://" + s.dbName)
+	c.Assert(err, IsNil)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, "create table t (c int)")
+
+	mustExecSQL(c, se, "begin")
+	mustExecSQL(c, se, "insert t values (1)")
+	fs := store.(*faulty.Store)
+	fs.Enable(faulty.Commit, faulty.Action{Err: kv.ErrConditionNotMatch, Times: 1})
+	_, err = exec(c, se, "commit")
+	c.Assert(kv.IsRetryableError(err), IsTrue)
+	c.Assert(fs.Hits(faulty.Commit), Equals, 1)
+
+	c.Assert(se.Retry(), IsNil)
+	r := mustExecSQL(c, se, "select c from t")
+	row, err := r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 1)
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestReadOnly(c *C) {
+	path := "/tmp/test-tidb-readonly-session"
+	defer os.RemoveAll(path)
+	store, err := NewStore(EngineGoLevelDBPersistent + path)
+	c.Assert(err, IsNil)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "create table t (c int)")
+	mustExecSQL(c, se, "insert t values (1)")
+	c.Assert(store.Close(), IsNil)
+
+	store, err = NewStore(EngineGoLevelDBPersistent + path + "?read_only=true")
+	c.Assert(err, IsNil)
+	defer store.Close()
+	se = newSession(c, store, s.dbName)
+	r := mustExecSQL(c, se, "select c from t")
+	row, err := r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 1)
+	r = mustExecSQL(c, se, "select @@read_only")
+	row, err = r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, "ON")
+
+	_, err = exec(c, se, "insert t values (2)")
+	c.Assert(errors2.ErrorEqual(err, kv.ErrReadOnly), IsTrue)
+	_, err = exec(c, se, "create table t1 (c int)")
+	c.Assert(errors2.ErrorEqual(err, kv.ErrReadOnly), IsTrue)
+	_, err = exec(c, se, "drop table t")
+	c.Assert(errors2.ErrorEqual(err, kv.ErrReadOnly), IsTrue)
+	r = mustExecSQL(c, se, "select count(*) from t")
+	row, err = r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 1)
+
+	// The temporary tables are never written to the store.
+	mustExecSQL(c, se, "create temporary table t1 (c int)")
+	mustExecSQL(c, se, "insert t1 select c + 1 from t")
+	r = mustExecSQL(c, se, "select t.c, t1.c from t, t1")
+	row, err = r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 1, 2)
+	c.Assert(se.Close(), IsNil)
+}
+
+func (s *testSessionSuite) TestDeleteRange(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, "create table t (c int, d int, index idx_d (d))")
+	mustExecSQL(c, se, "insert t values (1, 1), (2, 2)")
+
+	// The rows inserted after the truncation are kept.
+	mustExecSQL(c, se, "begin")
+	mustExecSQL(c, se, "truncate table t")
+	mustExecSQL(c, se, "insert t values (3, 3)")
+	r := mustExecSQL(c, se, "select count(*) from t")
+	row, err := r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 1)
+	mustExecSQL(c, se, "commit")
+
+	r = mustExecSQL(c, se, "select c from t where d = 3")
+	row, err = r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 3)
+
+	mustExecSQL(c, se, "alter table t drop index idx_d")
+	mustExecSQL(c, se, "insert t values (4, 4)")
+	r = mustExecSQL(c, se, "select count(*) from t where d > 2")
+	row, err = r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 2)
+
+	mustExecSQL(c, se, "drop table t")
+	mustExecSQL(c, se, "create table t (c int)")
+	r = mustExecSQL(c, se, "select count(*) from t")
+	row, err = r.FirstRow()
+	c.Assert(err, IsNil)
+	match(c, row, 0)
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestClusteredPK(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, "create table t (id bigint primary key, c int, index idx_c (c))")
+	mustExecSQL(c, se, "insert t values (-5, 1), (3, 2), (10, 3), (7, 4)")
+
+	queryRows := func(sql string) string {
+		r := mustExecSQL(c, se, sql)
+		rows, err := r.Rows(-1, 0)
+		c.Assert(err, IsNil)
+		return fmt.Sprint(rows)
+	}
+	c.Assert(queryRows("select * from t"), Equals, "[[-5 1] [3 2] [7 4] [10 3]]")
+	c.Assert(queryRows("select c from t where id = 7"), Equals, "[[4]]")
+	c.Assert(queryRows("select c from t where id = 8"), Equals, "[]")
+	c.Assert(queryRows("select id from t where id > -5 and id <= 7"), Equals, "[[3] [7]]")
+	c.Assert(queryRows("select id from t where id != 3"), Equals, "[[-5] [7] [10]]")
+	c.Assert(queryRows("select id from t where id = -5 or id >= 7"), Equals, "[[-5] [7] [10]]")
+	c.Assert(queryRows("select id from t where id > 3 limit 1"), Equals, "[[7]]")
+	c.Assert(queryRows("select id from t where c = 3"), Equals, "[[10]]")
+	c.Assert(strings.Contains(queryRows("explain select * from t where id > 3"), "using primary key"), IsTrue)
+	c.Assert(queryRows("select id from t where id > 2.5 and id < 7.5"), Equals, "[[3] [7]]")
+	c.Assert(queryRows("select id from t where c >= 1.5 and c <= 3.5"), Equals, "[[3] [10]]")
+	c.Assert(queryRows("select id from t where id = 3.5 or c = 2.5"), Equals, "[]")
+
+	// The primary key has no index, the row key keeps it unique.
+	c.Assert(queryRows("select count(*) from information_schema.statistics where table_name = 't' and index_name = 'PRIMARY' and comment = 'clustered'"), Equals, "[[1]]")
+	c.Assert(queryRows("show columns from t"), Equals, "[[id BIGINT NO PRI <nil> clustered] [c INT YES MUL <nil> ]]")
+	_, err := exec(c, se, "insert t values (3, 5)")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, "insert t values (3, 5) on duplicate key update c = 20")
+	c.Assert(queryRows("select c from t where id = 3"), Equals, "[[20]]")
+
+	// Updating the primary key moves the rows, every row is updated once.
+	mustExecSQL(c, se, "update t set id = id + 100")
+	c.Assert(queryRows("select * from t"), Equals, "[[95 1] [103 20] [107 4] [110 3]]")
+	c.Assert(queryRows("select id from t where c = 4"), Equals, "[[107]]")
+	_, err = exec(c, se, "update t set id = 110 where id = 107")
+	c.Assert(err, NotNil)
+
+	mustExecSQL(c, se, "delete from t where id < 105")
+	c.Assert(queryRows("select * from t"), Equals, "[[107 4] [110 3]]")
+
+	// Only a primary key of a single signed integer column is the handle.
+	mustExecSQL(c, se, "create table t1 (id bigint unsigned primary key)")
+	mustExecSQL(c, se, "create table t2 (a int, b int, primary key (a, b))")
+	c.Assert(queryRows("select table_name from information_schema.statistics where index_name = 'PRIMARY' and comment = '' order by table_name"), Equals, "[[t1] [t2] [t2]]")
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestOrderByIndexDesc(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, "create table t (id int, c int, d int, index idx_c (c))")
+	mustExecSQL(c, se, "insert t values (1, 3, 1), (2, null, 2), (3, 1, 1), (4, 5, 2), (5, 3, 1)")
+
+	queryRows := func(sql string) string {
+		r := mustExecSQL(c, se, sql)
+		rows, err := r.Rows(-1, 0)
+		c.Assert(err, IsNil)
+		return fmt.Sprint(rows)
+	}
+	explain := queryRows("explain select id, c from t order by c desc")
+	c.Assert(strings.Contains(explain, "backward using index"), IsTrue)
+	c.Assert(strings.Contains(explain, "Order by"), IsFalse)
+	c.Assert(queryRows("select id, c from t order by c desc"), Equals, "[[4 5] [5 3] [1 3] [3 1] [2 <nil>]]")
+	c.Assert(queryRows("select id, c from t order by 2 desc limit 2"), Equals, "[[4 5] [5 3]]")
+	c.Assert(queryRows("select c as x from t as a order by x desc"), Equals, "[[5] [3] [3] [1] [<nil>]]")
+	c.Assert(queryRows("select id from t where c != 3 order by c desc"), Equals, "[[4] [3]]")
+	c.Assert(queryRows("select id from t where c >= 1 and c < 5 order by c desc"), Equals, "[[5] [1] [3]]")
+	c.Assert(queryRows("select id from t where c > 1 and d = 1 order by c desc"), Equals, "[[5] [1]]")
+	c.Assert(queryRows("select id from t where d = 2 order by c desc"), Equals, "[[4] [2]]")
+
+	// The rows are sorted if the order by column has no index.
+	c.Assert(strings.Contains(queryRows("explain select id from t where c > 1 order by d desc"), "Order by"), IsTrue)
+	c.Assert(queryRows("select id from t where c > 1 order by d desc, id"), Equals, "[[4] [1] [5]]")
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestPartition(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t")
+	mustExecSQL(c, se, `create table t (id int, c int, index idx_c (c)) partition by range (id) (
+		partition p0 values less than (10),
+		partition p1 values less than (20),
+		partition p2 values less than (30))`)
+	mustExecSQL(c, se, "insert t values (1, 1), (15, 2), (25, 3), (null, 4), (12, 5)")
+
+	queryRows := func(sql string) string {
+		r := mustExecSQL(c, se, sql)
+		rows, err := r.Rows(-1, 0)
+		c.Assert(err, IsNil)
+		return fmt.Sprint(rows)
+	}
+	explainPartitions := func(sql string) string {
+		rows := queryRows("explain " + sql)
+		i := strings.Index(rows, "Iterate partitions ")
+		j := strings.Index(rows, " of table")
+		return rows[i+len("Iterate partitions ") : j]
+	}
+	c.Assert(queryRows("select * from t"), Equals, "[[1 1] [<nil> 4] [15 2] [12 5] [25 3]]")
+	_, err := exec(c, se, "insert t values (30, 6)")
+	c.Assert(err, NotNil)
+
+	// The partitions are pruned by the predicates on the partitioning column.
+	c.Assert(queryRows("select c from t where id >= 12 and id < 26"), Equals, "[[2] [5] [3]]")
+	c.Assert(explainPartitions("select * from t where id >= 12 and id < 26"), Equals, "p1, p2")
+	c.Assert(explainPartitions("select * from t where id = 15 and c = 2"), Equals, "p1")
+	c.Assert(queryRows("select id from t where id = 15 and c = 2"), Equals, "[[15]]")
+	c.Assert(queryRows("select id from t where id != 15"), Equals, "[[1] [12] [25]]")
+	c.Assert(queryRows("select id from t where c = 3"), Equals, "[[25]]")
+	c.Assert(queryRows("select id from t where id > 100"), Equals, "[]")
+	// A fractional literal is not rounded before the partitions are pruned.
+	c.Assert(queryRows("select id from t where id > 9.5"), Equals, "[[15] [12] [25]]")
+	c.Assert(explainPartitions("select * from t where id > 9.5"), Equals, "p1, p2")
+	c.Assert(queryRows("select id from t where id < 12.5 and id >= 0.5"), Equals, "[[1] [12]]")
+	c.Assert(queryRows("select id from t where id = 12.5"), Equals, "[]")
+
+	// A row is moved to its new partition once.
+	mustExecSQL(c, se, "update t set id = id + 10 where id < 20")
+	c.Assert(queryRows("select * from t"), Equals, "[[<nil> 4] [11 1] [25 2] [25 3] [22 5]]")
+	c.Assert(queryRows("select id from t where c = 5"), Equals, "[[22]]")
+	mustExecSQL(c, se, "delete from t where id = 25 and c = 3")
+	c.Assert(queryRows("select * from t where id > 20"), Equals, "[[25 2] [22 5]]")
+
+	mustExecSQL(c, se, "alter table t add partition (partition p3 values less than maxvalue)")
+	mustExecSQL(c, se, "insert t values (100, 7)")
+	_, err = exec(c, se, "alter table t add partition (partition p4 values less than (200))")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, "alter table t truncate partition p1")
+	c.Assert(queryRows("select * from t"), Equals, "[[<nil> 4] [25 2] [22 5] [100 7]]")
+	mustExecSQL(c, se, "alter table t drop partition p0, p2")
+	c.Assert(queryRows("select * from t"), Equals, "[[100 7]]")
+	c.Assert(queryRows("select id from t where c = 7"), Equals, "[[100]]")
+	mustExecSQL(c, se, "insert t values (5, 8)")
+	c.Assert(queryRows("select * from t"), Equals, "[[5 8] [100 7]]")
+
+	// The rows of HASH partitioning are spread by the expression.
+	mustExecSQL(c, se, "create table t1 (id int primary key, c int) partition by hash (id) partitions 3")
+	mustExecSQL(c, se, "insert t1 values (1, 1), (2, 2), (3, 3), (4, 4), (-5, 5)")
+	c.Assert(queryRows("select * from t1"), Equals, "[[3 3] [1 1] [4 4] [-5 5] [2 2]]")
+	c.Assert(explainPartitions("select * from t1 where id = 4"), Equals, "p1")
+	c.Assert(queryRows("select c from t1 where id = 4"), Equals, "[[4]]")
+	_, err = exec(c, se, "insert t1 values (4, 6)")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, "insert t1 values (4, 6) on duplicate key update c = 40")
+	mustExecSQL(c, se, "update t1 set id = 6 where id = 4")
+	c.Assert(queryRows("select * from t1 where c = 40"), Equals, "[[6 40]]")
+	mustExecSQL(c, se, "create table t2 (id int, d datetime) partition by hash (year(d)) partitions 2")
+	mustExecSQL(c, se, "insert t2 values (1, '2015-01-01'), (2, '2016-01-01')")
+	c.Assert(queryRows("select id from t2 where year(d) = 2016"), Equals, "[[2]]")
+	c.Assert(explainPartitions("select * from t2 where d = '2016-01-01'"), Equals, "p0")
+	c.Assert(queryRows("select id from t2 where d = '2016-01-01'"), Equals, "[[2]]")
+	c.Assert(explainPartitions("select * from t2 where d > '2016-01-01'"), Equals, "p0, p1")
+
+	// A RANGE partitioning by a monotonic function of a column is pruned by
+	// the predicates on the column.
+	mustExecSQL(c, se, `create table t4 (id int, d datetime) partition by range (year(d)) (
+		partition p0 values less than (2015),
+		partition p1 values less than (2016),
+		partition p2 values less than (2017))`)
+	mustExecSQL(c, se, "insert t4 values (1, '2014-06-01'), (2, '2015-06-01'), (3, '2016-01-01'), (4, '2016-06-01')")
+	c.Assert(explainPartitions("select * from t4 where d >= '2015-03-01' and d < '2016-01-01'"), Equals, "p1, p2")
+	c.Assert(queryRows("select id from t4 where d >= '2015-03-01' and d < '2016-01-01'"), Equals, "[[2]]")
+	c.Assert(explainPartitions("select * from t4 where d > '2016-03-01'"), Equals, "p2")
+	c.Assert(explainPartitions("select * from t4 where d < '2015-01-01'"), Equals, "p0, p1")
+	c.Assert(explainPartitions("select * from t4 where d > '2020-01-01'"), Equals, "p0, p1, p2")
+	c.Assert(queryRows("select id from t4 where d > '2020-01-01'"), Equals, "[]")
+	c.Assert(explainPartitions("select * from t4 where d = '2016-06-01'"), Equals, "p2")
+	c.Assert(queryRows("select id from t4 where d = '2016-06-01'"), Equals, "[[4]]")
+
+	// The unique keys must include the partitioning columns.
+	_, err = exec(c, se, "create table t3 (id int, c int unique) partition by hash (id)")
+	c.Assert(err, NotNil)
+	_, err = exec(c, se, "create unique index idx_uc on t1 (c)")
+	c.Assert(err, NotNil)
+	_, err = exec(c, se, "create table t3 (id int, c varchar(10)) partition by hash (c)")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestTemporaryTable(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	se2 := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t, t1")
+	mustExecSQL(c, se, "create table t (id int, c int)")
+	mustExecSQL(c, se, "insert t values (1, 10), (2, 20), (3, 30)")
+
+	queryRows := func(se Session, sql string) string {
+		r := mustExecSQL(c, se, sql)
+		rows, err := r.Rows(-1, 0)
+		c.Assert(err, IsNil)
+		return fmt.Sprint(rows)
+	}
+	// The temporary table shadows the table of the same name in its session only.
+	mustExecSQL(c, se, "create temporary table t (id int primary key, name varchar(10), unique key idx_name (name))")
+	_, err := exec(c, se, "create temporary table t (id int)")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, "create temporary table if not exists t (id int)")
+	mustExecSQL(c, se, "insert t values (1, 'a'), (2, 'b')")
+	c.Assert(queryRows(se, "select * from t"), Equals, "[[1 a] [2 b]]")
+	c.Assert(queryRows(se2, "select * from t"), Equals, "[[1 10] [2 20] [3 30]]")
+	_, err = exec(c, se2, "create temporary table t1 (id int)")
+	c.Assert(err, IsNil)
+	_, err = exec(c, se, "select * from t1")
+	c.Assert(err, NotNil)
+
+	// The indices are enforced and used.
+	_, err = exec(c, se, "insert t values (3, 'a')")
+	c.Assert(err, NotNil)
+	c.Assert(queryRows(se, "select id from t where name = 'b'"), Equals, "[[2]]")
+	mustExecSQL(c, se, "create index idx_id_name on t (id, name)")
+	c.Assert(queryRows(se, "select name from t where id >= 2"), Equals, "[[b]]")
+	mustExecSQL(c, se, "alter table t drop index idx_name")
+	mustExecSQL(c, se, "insert t values (3, 'a')")
+	_, err = exec(c, se, "alter table t add column c int")
+	c.Assert(err, NotNil)
+
+	// INSERT ... SELECT and joins with the other tables.
+	mustExecSQL(c, se, "create table t1 (id int, v varchar(10))")
+	mustExecSQL(c, se, "insert t1 values (2, 'x'), (3, 'y')")
+	mustExecSQL(c, se, "create temporary table tmp (id int, c int, index idx_c (c))")
+	mustExecSQL(c, se, "insert tmp select id, id * 20 from t1")
+	c.Assert(queryRows(se, "select * from tmp where c > 40"), Equals, "[[3 60]]")
+	c.Assert(queryRows(se, "select tmp.c, t1.v, t.name from tmp, t1, t where tmp.id = t1.id and t.id = tmp.id"), Equals, "[[40 x b] [60 y a]]")
+	mustExecSQL(c, se, "update tmp, t1 set tmp.c = 0 where tmp.id = t1.id and t1.v = 'y'")
+	mustExecSQL(c, se, "delete from tmp where id = 2")
+	c.Assert(queryRows(se, "select * from tmp"), Equals, "[[3 0]]")
+
+	// The temporary tables are transactional.
+	mustExecSQL(c, se, "begin")
+	mustExecSQL(c, se, "insert tmp values (4, 4)")
+	mustExecSQL(c, se, "insert t1 values (4, 'z')")
+	mustExecSQL(c, se, "rollback")
+	c.Assert(queryRows(se, "select * from tmp"), Equals, "[[3 0]]")
+	c.Assert(queryRows(se, "select count(*) from t1"), Equals, "[[2]]")
+	mustExecSQL(c, se, "truncate table tmp")
+	c.Assert(queryRows(se, "select * from tmp"), Equals, "[]")
+
+	// DROP TABLE drops the temporary table first, DROP TEMPORARY TABLE never drops the other tables.
+	mustExecSQL(c, se, "drop table t")
+	c.Assert(queryRows(se, "select * from t"), Equals, "[[1 10] [2 20] [3 30]]")
+	_, err = exec(c, se, "drop temporary table t")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, "drop temporary table if exists t")
+
+	// The temporary tables are dropped with the session.
+	c.Assert(se.Close(), IsNil)
+	c.Assert(temptable.GetTables(se.(*session)).TableByName(model.NewCIStr(s.dbName), model.NewCIStr("tmp")), IsNil)
+	c.Assert(se2.Close(), IsNil)
+	se = newSession(c, store, s.dbName)
+	_, err = exec(c, se, "select * from tmp")
+	c.Assert(err, NotNil)
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
+func (s *testSessionSuite) TestGeneratedColumn(c *C) {
+	store := newStore(c, s.dbName)
+	se := newSession(c, store, s.dbName)
+	mustExecSQL(c, se, "drop table if exists t, t1")
+
+	queryRows := func(sql string) string {
+		r := mustExecSQL(c, se, sql)
+		rows, err := r.Rows(-1, 0)
+		c.Assert(err, IsNil)
+		return fmt.Sprint(rows)
+	}
+	for _, sql := range []string{
+		"create table t (a int, b int as (x + 1))",
+		"create table t (a int, b int as (c + 1), c int as (a + 1))",
+		"create table t (a int, b int as (b + 1))",
+		"create table t (a int, b int as (count(a)))",
+		"create table t (a int, b int as (a + 1) default 1)",
+		"create table t (a int, b int as (a + 1) virtual, index idx_b (b))",
+	} {
+		_, err := exec(c, se, sql)
+		c.Assert(err, NotNil, Commentf("%s", sql))
+	}
+
+	mustExecSQL(c, se, "create table t (a int, b int, c int as (a + b) virtual, d int as (a * b) stored, e int generated always as (c + 1), index idx_d (d))")
+	mustExecSQL(c, se, "insert t (a, b) values (1, 2), (3, 4)")
+	mustExecSQL(c, se, "insert t values (5, 6, default, default, default)")
+	mustExecSQL(c, se, "insert t set a = 7")
+	c.Assert(queryRows("select * from t"), Equals, "[[1 2 3 2 4] [3 4 7 12 8] [5 6 11 30 12] [7 <nil> <nil> <nil> <nil>]]")
+
+	// The generated columns can't be written directly.
+	for _, sql := range []string{
+		"insert t (a, c) values (1, 1)",
+		"insert t values (1, 2, 3, 4, 5)",
+		"insert t set a = 1, d = 1",
+		"insert t (a, d) select a, b from t",
+		"update t set c = 1",
+		"update t set a = 0, e = 1 where a = 1",
+	} {
+		_, err := exec(c, se, sql)
+		c.Assert(err, NotNil, Commentf("%s", sql))
+	}
+
+	// The generated columns are computed again when the row is updated, the
+	// index of the STORED column is rebuilt.
+	mustExecSQL(c, se, "update t set b = 10 where a = 1")
+	c.Assert(queryRows("select a, c, d, e from t where a = 1"), Equals, "[[1 11 10 12]]")
+	c.Assert(queryRows("select a from t where d = 10"), Equals, "[[1]]")
+	c.Assert(queryRows("select a from t where d = 2"), Equals, "[]")
+	c.Assert(queryRows("select a from t where c > 10 order by a"), Equals, "[[1] [5]]")
+	mustExecSQL(c, se, "delete from t where c = 7")
+	c.Assert(queryRows("select a from t"), Equals, "[[1] [5] [7]]")
+
+	// The VIRTUAL columns are never stored, in any row format.
+	mustExecSQL(c, se, "alter table t row_format = redundant")
+	c.Assert(queryRows("select * from t where a = 5"), Equals, "[[5 6 11 30 12]]")
+	mustExecSQL(c, se, "update t set a = 2 where a = 5")
+	c.Assert(queryRows("select * from t where a = 2"), Equals, "[[2 6 8 12 9]]")
+	mustExecSQL(c, se, "alter table t row_format = compact")
+	c.Assert(queryRows("select * from t where d = 12"), Equals, "[[2 6 8 12 9]]")
+
+	// NOT NULL is checked on the computed values.
+	mustExecSQL(c, se, "create table t1 (a int, b int as (a + 1) stored not null)")
+	mustExecSQL(c, se, "insert t1 (a) values (1)")
+	_, err := exec(c, se, "insert t1 (a) values (null)")
+	c.Assert(err, NotNil)
+	_, err = exec(c, se, "alter table t1 add column c int as (a + 2)")
+	c.Assert(err, NotNil)
+
+	c.Assert(queryRows("show columns from t"), Equals, "[[a INT YES  <nil> ] [b INT YES  <nil> ] "+
+		"[c INT YES  <nil> VIRTUAL GENERATED] [d INT YES MUL <nil> STORED GENERATED] [e INT YES  <nil> VIRTUAL GENERATED]]")
+	c.Assert(queryRows("select column_name, extra, generation_expression from information_schema.columns where table_schema = '"+s.dbName+"' and table_name = 't'"),
+		Equals, "[[a  ] [b  ] [c VIRTUAL GENERATED a + b] [d STORED GENERATED a * b] [e VIRTUAL GENERATED c + 1]]")
+	mustExecSQL(c, se, s.dropDBSQL)
+}
+
 func newSession(c *C, store kv.Storage, dbName string) Session {
 	se, err := CreateSession(store)
 	c.Assert(err, IsNil)
@@ -19,7 +19,6 @@ package util
 
 import (
 	"bytes"
-	"strings"
 
 	"github.com/juju/errors"
 	"github.com/ngaut/log"
@@ -28,32 +27,21 @@ import (
 	"github.com/pingcap/tidb/util/codec"
 )
 
-func hasPrefix(prefix []byte) kv.FnKeyCmp {
-	return func(k []byte) bool {
-		return bytes.HasPrefix(k, prefix)
-	}
-}
-
 // ScanMetaWithPrefix scans metadata with the prefix.
 func ScanMetaWithPrefix(txn kv.Transaction, prefix string, filter func([]byte, []byte) bool) error {
-	iter, err := txn.Seek([]byte(prefix), hasPrefix([]byte(prefix)))
+	iter, err := txn.Scan([]byte(prefix), kv.PrefixNext([]byte(prefix)), 0)
 	if err != nil {
 		return err
 	}
 	defer iter.Close()
-	for {
+	for iter.Valid() {
+		if !filter([]byte(iter.Key()), iter.Value()) {
+			break
+		}
+		iter, err = iter.Next(nil)
 		if err != nil {
 			return err
 		}
-
-		if iter.Valid() && strings.HasPrefix(iter.Key(), prefix) {
-			if !filter([]byte(iter.Key()), iter.Value()) {
-				break
-			}
-			iter, err = iter.Next(hasPrefix([]byte(prefix)))
-		} else {
-			break
-		}
 	}
 
 	return nil
@@ -66,34 +54,7 @@ func DelKeyWithPrefix(ctx context.Context, prefix string) error {
 	if err != nil {
 		return err
 	}
-
-	var keys []string
-	iter, err := txn.Seek([]byte(prefix), hasPrefix([]byte(prefix)))
-	if err != nil {
-		return err
-	}
-	defer iter.Close()
-	for {
-		if err != nil {
-			return err
-		}
-
-		if iter.Valid() && strings.HasPrefix(iter.Key(), prefix) {
-			keys = append(keys, iter.Key())
-			iter, err = iter.Next(hasPrefix([]byte(prefix)))
-		} else {
-			break
-		}
-	}
-
-	for _, key := range keys {
-		err := txn.Delete([]byte(key))
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return kv.DeleteRange(txn, []byte(prefix), kv.PrefixNext([]byte(prefix)))
 }
 
 // EncodeRecordKey encodes the string value to a byte slice.
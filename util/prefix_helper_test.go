@@ -14,6 +14,7 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 
@@ -160,9 +161,7 @@ func (s *testPrefixSuite) TestCode(c *C) {
 	c.Logf("%#v, %#v", b2, b1)
 	raw, err := codec.StripEnd(b1)
 	c.Assert(err, IsNil)
-	f := hasPrefix(raw)
-	has := f(b2)
-	c.Assert(has, IsTrue)
+	c.Assert(bytes.HasPrefix(b2, raw), IsTrue)
 }
 
 func (s *testPrefixSuite) TestPrefixFilter(c *C) {